@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -15,15 +17,22 @@ import (
 	docs "github.com/lucast-ruiz/devices-api/internal/docs"
 
 	"github.com/lucast-ruiz/devices-api/internal/api"
+	"github.com/lucast-ruiz/devices-api/internal/auth"
+	"github.com/lucast-ruiz/devices-api/internal/ratelimit"
 	"github.com/lucast-ruiz/devices-api/internal/repo"
 	"github.com/lucast-ruiz/devices-api/internal/service"
 )
 
+var (
+	rootDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	rootSunset       = time.Date(2027, time.April, 30, 0, 0, 0, 0, time.UTC)
+)
+
 // @title Devices API
 // @version 1.0
 // @description Devices management API
 // @host localhost:8080
-// @BasePath /
+// @BasePath /api/v1
 func main() {
 	db, err := sql.Open("pgx", os.Getenv("DATABASE_URL"))
 	if err != nil {
@@ -32,15 +41,42 @@ func main() {
 	defer db.Close()
 
 	deviceRepo := repo.NewDeviceRepository(db)
-	deviceService := service.NewDeviceService(deviceRepo)
-	handler := api.NewHandler(deviceService)
+	deviceService := service.NewDeviceService(service.Stores{
+		Devices:      deviceRepo,
+		History:      deviceRepo,
+		Stats:        deviceRepo,
+		Utilization:  deviceRepo,
+		Schemas:      deviceRepo,
+		Brands:       deviceRepo,
+		Models:       deviceRepo,
+		Locations:    deviceRepo,
+		Parents:      deviceRepo,
+		Holders:      deviceRepo,
+		Reservations: deviceRepo,
+		Maintenance:  deviceRepo,
+		Schedule:     deviceRepo,
+	})
+	idempotencyRepo := repo.NewIdempotencyRepository(db)
+	handler := api.NewHandler(deviceService, idempotencyRepo)
+
+	// Reservations start and end, and scheduled actions run, on their own,
+	// so jobs check for due ones every interval, and expired idempotency
+	// keys are deleted. Every replica runs them.
+	go deviceService.RunReservationJob(context.Background(), time.Duration(envInt("RESERVATION_JOB_INTERVAL_SECONDS", 60))*time.Second)
+	go deviceService.RunScheduler(context.Background(), time.Duration(envInt("SCHEDULER_INTERVAL_SECONDS", 30))*time.Second)
+	go service.RunIdempotencyPurge(context.Background(), idempotencyRepo, time.Duration(envInt("IDEMPOTENCY_PURGE_INTERVAL_SECONDS", 3600))*time.Second)
+
+	apiKeys, err := auth.ParseKeys(os.Getenv("API_KEYS"))
+	if err != nil {
+		panic(err)
+	}
 
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
-	r.Use(middleware.Timeout(60 * time.Second))
+	r.Use(api.Authenticate(apiKeys))
 
 	//Healthcheck
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -49,17 +85,56 @@ func main() {
 	})
 
 	//Swagger
-	docs.SwaggerInfo.BasePath = "/"
-	
-	r.Get("/swagger/*", httpSwagger.Handler(
-		httpSwagger.URL("doc.json"), 
+	docs.SwaggerInfov1.BasePath = "/api/v1"
+
+	r.Get("/swagger/v1/*", httpSwagger.Handler(
+		httpSwagger.URL("doc.json"),
+		httpSwagger.InstanceName("v1"),
+	))
+	r.Get("/swagger/v2/*", httpSwagger.Handler(
+		httpSwagger.URL("doc.json"),
+		httpSwagger.InstanceName("v2"),
 	))
+	r.Get("/swagger/*", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/swagger/v1/index.html", http.StatusMovedPermanently)
+	})
 
 	//api
-	r.Mount("/", handler.Routes())
+	rateLimit := api.RateLimit(ratelimit.NewMemoryStore(), api.RateLimitConfig{
+		Read: ratelimit.Limit{
+			Rate:  envFloat("RATE_LIMIT_READ_RPS", 50),
+			Burst: envInt("RATE_LIMIT_READ_BURST", 100),
+		},
+		Write: ratelimit.Limit{
+			Rate:  envFloat("RATE_LIMIT_WRITE_RPS", 10),
+			Burst: envInt("RATE_LIMIT_WRITE_BURST", 20),
+		},
+	})
+	r.With(rateLimit).Mount("/api/v1", handler.Routes())
+	r.With(api.Version(2), rateLimit).Mount("/api/v2", handler.Routes())
+
+	// The unversioned routes predate /api/v1 and are kept as deprecated
+	// aliases of it until rootSunset.
+	r.With(api.Deprecated(rootDeprecatedAt, rootSunset, "/api/v1"), rateLimit).Mount("/", handler.Routes())
 
 	fmt.Println("Server running on :8080")
 	if err := http.ListenAndServe(":8080", r); err != nil {
 		panic(err)
 	}
-}
\ No newline at end of file
+}
+
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+func envFloat(name string, def float64) float64 {
+	v, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil {
+		return def
+	}
+	return v
+}
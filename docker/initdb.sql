@@ -0,0 +1,4 @@
+-- The API connects as devices_app, which is neither a superuser nor allowed
+-- to bypass row-level security, so the tenant policies apply to it. The
+-- migrations, run as postgres, grant it the tables.
+CREATE ROLE devices_app LOGIN PASSWORD 'devices_app' NOSUPERUSER NOBYPASSRLS;
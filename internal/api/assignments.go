@@ -0,0 +1,398 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+// HolderDTO is the holder representation served by the API. ExternalID is
+// null when the holder has none.
+type HolderDTO struct {
+	ID         string    `json:"id"`
+	Kind       string    `json:"kind" enums:"person,team"`
+	Name       string    `json:"name"`
+	ExternalID *string   `json:"external_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// SaveHolderDTO represents the payload to create or replace a holder. The
+// external ID is the holder's ID in the directory it comes from, and is
+// unique per kind.
+type SaveHolderDTO struct {
+	Kind       string `json:"kind" validate:"trim,lower,required,oneof=person team" enums:"person,team"`
+	Name       string `json:"name" validate:"trim,required,max=100,printable" maxLength:"100"`
+	ExternalID string `json:"external_id,omitempty" validate:"trim,max=100,printable" maxLength:"100"`
+}
+
+// AssignDeviceDTO represents the payload to assign a device to a holder.
+type AssignDeviceDTO struct {
+	HolderID string `json:"holder_id" validate:"trim,required"`
+	Note     string `json:"note,omitempty" validate:"trim,max=500" maxLength:"500"`
+}
+
+// AssignmentDTO is an assignment of a device to a holder. EndedAt is null
+// while the assignment is active.
+type AssignmentDTO struct {
+	ID        string     `json:"id"`
+	DeviceID  string     `json:"device_id"`
+	HolderID  string     `json:"holder_id"`
+	Note      string     `json:"note"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	Active    bool       `json:"active"`
+}
+
+func toHolderDTO(h *model.Holder) HolderDTO {
+	return HolderDTO{
+		ID:         h.ID,
+		Kind:       string(h.Kind),
+		Name:       h.Name,
+		ExternalID: optional(h.ExternalID),
+		CreatedAt:  h.CreatedAt,
+		UpdatedAt:  h.UpdatedAt,
+	}
+}
+
+func toAssignmentDTO(a *model.Assignment) AssignmentDTO {
+	return AssignmentDTO{
+		ID:        a.ID,
+		DeviceID:  a.DeviceID,
+		HolderID:  a.HolderID,
+		Note:      a.Note,
+		StartedAt: a.StartedAt,
+		EndedAt:   a.EndedAt,
+		Active:    a.EndedAt == nil,
+	}
+}
+
+// readHolder reads and validates a SaveHolderDTO. It writes the error
+// response and returns false if the body is invalid.
+func readHolder(w http.ResponseWriter, r *http.Request) (service.HolderInput, bool) {
+	var req SaveHolderDTO
+	if !readJSON(w, r, &req) {
+		return service.HolderInput{}, false
+	}
+	return service.HolderInput{Kind: req.Kind, Name: req.Name, ExternalID: req.ExternalID}, true
+}
+
+// ListHolders godoc
+// @Summary List holders
+// @Description List the people and teams devices can be assigned to, by name, optionally of one kind or with one external ID.
+// @Tags holders
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param kind query string false "Only the holders of this kind" Enums(person, team)
+// @Param external_id query string false "Only the holders with this external ID"
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.HolderDTO
+// @Failure 400 {object} map[string]string "invalid kind"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /holders [get]
+func (h *Handler) ListHolders(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	holders, err := h.svc.ListHolders(r.Context(), query.Get("kind"), query.Get("external_id"), limit, offset)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := make([]HolderDTO, len(holders))
+	for i := range holders {
+		out[i] = toHolderDTO(&holders[i])
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+// GetHolder godoc
+// @Summary Get a holder
+// @Description Get a person or team by ID
+// @Tags holders
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Holder ID"
+// @Success 200 {object} api.HolderDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /holders/{id} [get]
+func (h *Handler) GetHolder(w http.ResponseWriter, r *http.Request) {
+	holder, err := h.svc.GetHolder(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if holder == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toHolderDTO(holder))
+}
+
+// CreateHolder godoc
+// @Summary Create a holder
+// @Description Add a person or team that devices can be assigned to. External IDs are unique per kind.
+// @Tags holders
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param holder body api.SaveHolderDTO true "Holder to create"
+// @Success 201 {object} api.HolderDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body or validation error"
+// @Failure 409 {object} map[string]string "external ID already in use"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /holders [post]
+func (h *Handler) CreateHolder(w http.ResponseWriter, r *http.Request) {
+	in, ok := readHolder(w, r)
+	if !ok {
+		return
+	}
+
+	holder, err := h.svc.CreateHolder(r.Context(), in)
+	if writeHolderError(w, r, err) {
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, toHolderDTO(holder))
+}
+
+// UpdateHolder godoc
+// @Summary Replace a holder
+// @Description Replace the kind, name and external ID of a holder.
+// @Tags holders
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Holder ID"
+// @Param holder body api.SaveHolderDTO true "Fields of the holder"
+// @Success 200 {object} api.HolderDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body or validation error"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "external ID already in use"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /holders/{id} [put]
+func (h *Handler) UpdateHolder(w http.ResponseWriter, r *http.Request) {
+	in, ok := readHolder(w, r)
+	if !ok {
+		return
+	}
+
+	holder, err := h.svc.UpdateHolder(r.Context(), chi.URLParam(r, "id"), in)
+	if writeHolderError(w, r, err) {
+		return
+	}
+	if holder == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toHolderDTO(holder))
+}
+
+// DeleteHolder godoc
+// @Summary Delete a holder
+// @Description Remove a holder. Holders that have been assigned devices cannot be deleted, so that the assignment history stays complete.
+// @Tags holders
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Holder ID"
+// @Success 204 "no content"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "holder has assignments"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /holders/{id} [delete]
+func (h *Handler) DeleteHolder(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.svc.DeleteHolder(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if strings.Contains(err.Error(), "cannot ") {
+			writeError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !deleted {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListHolderDevices godoc
+// @Summary List the devices of a holder
+// @Description List the devices a person or team currently holds, the most recently assigned first.
+// @Tags holders
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Holder ID"
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.DeviceDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /holders/{id}/devices [get]
+func (h *Handler) ListHolderDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	devices, err := h.svc.HolderDevices(r.Context(), chi.URLParam(r, "id"), limit, offset)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if devices == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeDevices(w, r, http.StatusOK, devices)
+}
+
+// ListDeviceAssignments godoc
+// @Summary List the assignments of a device
+// @Description List the assignment history of a device, the most recent first.
+// @Tags devices
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Device ID"
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.AssignmentDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/assignments [get]
+func (h *Handler) ListDeviceAssignments(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	assignments, err := h.svc.DeviceAssignments(r.Context(), chi.URLParam(r, "id"), limit, offset)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if assignments == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	out := make([]AssignmentDTO, len(assignments))
+	for i := range assignments {
+		out[i] = toAssignmentDTO(&assignments[i])
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+// AssignDevice godoc
+// @Summary Assign a device
+// @Description Assign a device to a person or team, starting now, and put it in use. A device has at most one active assignment, which the database enforces with an exclusion constraint. Inactive devices cannot be assigned.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Device ID"
+// @Param assignment body api.AssignDeviceDTO true "Holder of the device"
+// @Success 201 {object} api.AssignmentDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body, unknown holder or inactive device"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "device already has an active assignment"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/assignments [post]
+func (h *Handler) AssignDevice(w http.ResponseWriter, r *http.Request) {
+	var req AssignDeviceDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	a, err := h.svc.Assign(r.Context(), chi.URLParam(r, "id"), req.HolderID, req.Note)
+	if writeAssignmentError(w, r, err) {
+		return
+	}
+	if a == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, toAssignmentDTO(a))
+}
+
+// EndDeviceAssignment godoc
+// @Summary End the assignment of a device
+// @Description End the active assignment of a device, now, and make the device available again, unless an active reservation keeps it in use.
+// @Tags devices
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Device ID"
+// @Success 200 {object} api.AssignmentDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "device has no active assignment"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/assignments:end [post]
+func (h *Handler) EndDeviceAssignment(w http.ResponseWriter, r *http.Request) {
+	a, err := h.svc.EndAssignment(r.Context(), chi.URLParam(r, "id"))
+	if writeAssignmentError(w, r, err) {
+		return
+	}
+	if a == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toAssignmentDTO(a))
+}
+
+// writeHolderError writes the response for an error returned when saving a
+// holder. It returns false, writing nothing, if err is nil.
+func writeHolderError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case writeValidationFailure(w, r, err), writeDuplicate(w, r, err):
+	case strings.Contains(err.Error(), "required"):
+		writeError(w, r, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+	return true
+}
+
+// writeAssignmentError writes the response for an error returned when
+// starting or ending an assignment. It returns false, writing nothing, if
+// err is nil.
+func writeAssignmentError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case writeValidationFailure(w, r, err):
+	case errors.Is(err, model.ErrAlreadyAssigned), errors.Is(err, service.ErrNotAssigned):
+		writeError(w, r, http.StatusConflict, err.Error())
+	case strings.Contains(err.Error(), "cannot "):
+		writeError(w, r, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+// assignmentRepo is a device and holder store holding one device and its
+// assignments.
+type assignmentRepo struct {
+	service.DeviceStore
+	service.HolderStore
+	active []model.Assignment
+}
+
+func (r *assignmentRepo) GetByID(ctx context.Context, id string) (*model.Device, error) {
+	return &model.Device{ID: id, Name: "Laptop", Brand: "Dell", State: model.StateInUse, CreatedAt: time.Now()}, nil
+}
+
+func (r *assignmentRepo) Assignments(ctx context.Context, filter model.AssignmentFilter, limit, offset int) ([]model.Assignment, error) {
+	return r.active, nil
+}
+
+func (r *assignmentRepo) EndAssignment(ctx context.Context, d *model.Device, a *model.Assignment) error {
+	r.active = nil
+	return nil
+}
+
+func TestEndDeviceAssignment(t *testing.T) {
+	repo := &assignmentRepo{active: []model.Assignment{{ID: "a1", DeviceID: "1", HolderID: "h1", StartedAt: time.Now()}}}
+	routes := NewHandler(service.NewDeviceService(service.Stores{Devices: repo, Holders: repo}), nil).Routes()
+
+	end := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/devices/1/assignments:end", nil)
+		req = withTenant(req, "acme")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := end(); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := end(); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 without an active assignment, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/lucast-ruiz/devices-api/internal/auth"
+)
+
+const apiKeyHeader = "X-API-Key"
+
+// Authenticate puts the principal of the API key in the X-API-Key header
+// into the context of the request. Requests without a key go on
+// unauthenticated; an unknown key is rejected with 401.
+func Authenticate(keys auth.Keys) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(apiKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			p, ok := keys.Authenticate(key)
+			if !ok {
+				writeError(w, r, http.StatusUnauthorized, "invalid API key")
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), p)))
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucast-ruiz/devices-api/internal/auth"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestAuthenticate(t *testing.T) {
+	keys := auth.Keys{"secret": {Subject: "ci-bot", TenantID: "acme"}, "admin-key": {Subject: "admin"}}
+
+	tests := []struct {
+		name   string
+		key    string
+		header string
+		status int
+		tenant string
+	}{
+		{name: "key", key: "secret", status: http.StatusOK, tenant: "acme"},
+		{name: "key and other tenant", key: "secret", header: "globex", status: http.StatusForbidden},
+		{name: "unknown key", key: "guess", header: "acme", status: http.StatusUnauthorized},
+		{name: "tenantless key", key: "admin-key", header: "globex", status: http.StatusOK, tenant: "globex"},
+		{name: "no key", header: "globex", status: http.StatusUnauthorized},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			h := Authenticate(keys)(resolveTenant(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = tenant.FromContext(r.Context())
+			})))
+
+			req := httptest.NewRequest(http.MethodGet, "/devices", nil)
+			if tc.key != "" {
+				req.Header.Set(apiKeyHeader, tc.key)
+			}
+			if tc.header != "" {
+				req.Header.Set(tenantHeader, tc.header)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, rec.Code)
+			}
+			if got != tc.tenant {
+				t.Fatalf("expected tenant %q, got %q", tc.tenant, got)
+			}
+		})
+	}
+}
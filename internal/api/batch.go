@@ -0,0 +1,259 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// BatchCreateDTO represents the payload to create several devices.
+type BatchCreateDTO struct {
+	Mode  string            `json:"mode" validate:"oneof=atomic best_effort" enums:"atomic,best_effort"`
+	Items []CreateDeviceDTO `json:"items"`
+}
+
+// BatchUpdateItemDTO represents a partial update of one device in a batch.
+type BatchUpdateItemDTO struct {
+	ID    string  `json:"id" validate:"trim,required"`
+	Name  *string `json:"name" validate:"trim,required,max=100,printable" maxLength:"100"`
+	Brand *string `json:"brand" validate:"trim,required,max=50,printable" maxLength:"50"`
+	State *string `json:"state" validate:"trim,lower,oneof=available in-use inactive" enums:"available,in-use,inactive"`
+	// An empty serial_number or asset_tag clears it.
+	SerialNumber *string `json:"serial_number" validate:"trim,max=100,printable" maxLength:"100"`
+	AssetTag     *string `json:"asset_tag" validate:"trim,max=100,printable" maxLength:"100"`
+	// Attributes replace the current attributes when present.
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// BatchUpdateDTO represents the payload to partially update several devices.
+type BatchUpdateDTO struct {
+	Mode  string               `json:"mode" validate:"oneof=atomic best_effort" enums:"atomic,best_effort"`
+	Items []BatchUpdateItemDTO `json:"items"`
+}
+
+// BatchDeleteDTO represents the payload to delete several devices.
+type BatchDeleteDTO struct {
+	Mode string   `json:"mode" validate:"oneof=atomic best_effort" enums:"atomic,best_effort"`
+	IDs  []string `json:"ids"`
+}
+
+// BatchItemResultDTO is the outcome of one item of a batch, in request order.
+type BatchItemResultDTO struct {
+	Index  int        `json:"index"`
+	ID     string     `json:"id,omitempty"`
+	Status int        `json:"status"`
+	Device *DeviceDTO `json:"device,omitempty"`
+	Error  string     `json:"error,omitempty"`
+	// Fields lists the violations of each invalid field of the item.
+	Fields map[string][]string `json:"fields,omitempty"`
+}
+
+// BatchResultDTO is the response of a batch operation.
+type BatchResultDTO struct {
+	Results []BatchItemResultDTO `json:"results"`
+}
+
+// BatchCreateDevices godoc
+// @Summary Create devices in batch
+// @Description Create several devices with the same rules as POST /devices. In atomic mode nothing is created unless every item is valid; in best_effort mode the valid items are created and the others reported.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param batch body api.BatchCreateDTO true "Devices to create"
+// @Success 200 {object} api.BatchResultDTO "every item was applied, or best_effort mode"
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 422 {object} api.BatchResultDTO "atomic batch not applied"
+// @Failure 409 {object} map[string]string "atomic batch claimed an identifier taken meanwhile"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices:batchCreate [post]
+func (h *Handler) BatchCreateDevices(w http.ResponseWriter, r *http.Request) {
+	var req BatchCreateDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	results := make([]service.BatchResult, len(req.Items))
+	var items []service.CreateInput
+	var valid []int
+	for i := range req.Items {
+		item := &req.Items[i]
+		if err := validate.Struct(item); err != nil {
+			results[i].Err = err
+			continue
+		}
+		items = append(items, item.input())
+		valid = append(valid, i)
+	}
+
+	mode := service.BatchMode(req.Mode)
+	results, err := runBatch(mode, results, valid, func() ([]service.BatchResult, error) {
+		return h.svc.BatchCreate(r.Context(), mode, items)
+	})
+	writeBatchResult(w, r, mode, results, err, http.StatusCreated)
+}
+
+// BatchUpdateDevices godoc
+// @Summary Update devices in batch
+// @Description Partially update several devices with the same rules as PATCH /devices/{id}. In atomic mode nothing is updated unless every item is valid; in best_effort mode the valid items are updated and the others reported.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param batch body api.BatchUpdateDTO true "Partial device updates"
+// @Success 200 {object} api.BatchResultDTO "every item was applied, or best_effort mode"
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 422 {object} api.BatchResultDTO "atomic batch not applied"
+// @Failure 409 {object} map[string]string "atomic batch claimed an identifier taken meanwhile"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices:batchUpdate [patch]
+func (h *Handler) BatchUpdateDevices(w http.ResponseWriter, r *http.Request) {
+	var req BatchUpdateDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	results := make([]service.BatchResult, len(req.Items))
+	var items []service.UpdateInput
+	var valid []int
+	for i := range req.Items {
+		item := &req.Items[i]
+		if err := validate.Struct(item); err != nil {
+			results[i] = service.BatchResult{ID: item.ID, Err: err}
+			continue
+		}
+		items = append(items, service.UpdateInput{
+			ID:           item.ID,
+			Name:         item.Name,
+			Brand:        item.Brand,
+			State:        item.State,
+			SerialNumber: item.SerialNumber,
+			AssetTag:     item.AssetTag,
+			Attributes:   item.Attributes,
+		})
+		valid = append(valid, i)
+	}
+
+	mode := service.BatchMode(req.Mode)
+	results, err := runBatch(mode, results, valid, func() ([]service.BatchResult, error) {
+		return h.svc.BatchUpdate(r.Context(), mode, items)
+	})
+	writeBatchResult(w, r, mode, results, err, http.StatusOK)
+}
+
+// BatchDeleteDevices godoc
+// @Summary Delete devices in batch
+// @Description Delete several devices with the same rules as DELETE /devices/{id}. In atomic mode nothing is deleted unless every device can be; in best_effort mode the others are reported.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param batch body api.BatchDeleteDTO true "IDs of the devices to delete"
+// @Success 200 {object} api.BatchResultDTO "every item was applied, or best_effort mode"
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 422 {object} api.BatchResultDTO "atomic batch not applied"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices:batchDelete [post]
+func (h *Handler) BatchDeleteDevices(w http.ResponseWriter, r *http.Request) {
+	var req BatchDeleteDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	mode := service.BatchMode(req.Mode)
+	results, err := h.svc.BatchDelete(r.Context(), mode, req.IDs)
+	writeBatchResult(w, r, mode, results, err, http.StatusNoContent)
+}
+
+// runBatch runs the items of a batch that passed request validation and
+// merges their results into results, which already holds the rejected ones
+// at the indexes missing from valid. An atomic batch with a rejected item is
+// not run, and its valid items are reported as aborted.
+func runBatch(mode service.BatchMode, results []service.BatchResult, valid []int, run func() ([]service.BatchResult, error)) ([]service.BatchResult, error) {
+	if len(results) > service.MaxBatchSize {
+		return nil, fmt.Errorf("%w: at most %d items are allowed", service.ErrInvalidBatch, service.MaxBatchSize)
+	}
+
+	if len(valid) < len(results) && (mode == service.BatchAtomic || len(valid) == 0) {
+		for _, i := range valid {
+			results[i].Err = service.ErrBatchAborted
+		}
+		return results, nil
+	}
+
+	ran, err := run()
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range valid {
+		results[i] = ran[j]
+	}
+	return results, nil
+}
+
+// writeBatchResult writes the per-item results of a batch. okStatus is the
+// status reported for items that were applied. A failed atomic batch is
+// answered with 422 since none of its items were applied.
+func writeBatchResult(w http.ResponseWriter, r *http.Request, mode service.BatchMode, results []service.BatchResult, err error, okStatus int) {
+	if errors.Is(err, service.ErrInvalidBatch) {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if writeDuplicate(w, r, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	resp := BatchResultDTO{Results: make([]BatchItemResultDTO, len(results))}
+	failed := false
+	for i, res := range results {
+		item := BatchItemResultDTO{Index: i, ID: res.ID, Status: okStatus}
+		if res.Err != nil {
+			failed = true
+			item.Status = batchItemStatus(res.Err)
+			item.Error = res.Err.Error()
+			var errs validate.Errors
+			if errors.As(res.Err, &errs) {
+				item.Fields = errs
+			}
+		} else if res.Device != nil {
+			dto := toDeviceDTO(r, res.Device)
+			item.Device = &dto
+		}
+		resp.Results[i] = item
+	}
+
+	status := http.StatusOK
+	if failed && mode == service.BatchAtomic {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, r, status, resp)
+}
+
+func batchItemStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, service.ErrQuotaExceeded):
+		return http.StatusForbidden
+	case errors.As(err, new(*model.DuplicateError)):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrBatchAborted):
+		return http.StatusFailedDependency
+	default:
+		return http.StatusBadRequest
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/schema"
+)
+
+// BrandSchemaDTO is the attribute schema of a brand.
+type BrandSchemaDTO struct {
+	Brand     string          `json:"brand"`
+	Schema    json.RawMessage `json:"schema" swaggertype:"object"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+func toBrandSchemaDTO(s *model.BrandSchema) BrandSchemaDTO {
+	return BrandSchemaDTO{Brand: s.Brand, Schema: s.Schema, UpdatedAt: s.UpdatedAt}
+}
+
+// pathParam returns an unescaped path parameter, for parameters such as
+// brand names that may contain reserved characters.
+func pathParam(r *http.Request, key string) string {
+	value := chi.URLParam(r, key)
+	if unescaped, err := url.PathUnescape(value); err == nil {
+		return unescaped
+	}
+	return value
+}
+
+// GetBrandSchema godoc
+// @Summary Get the attribute schema of a brand
+// @Description Get the JSON Schema that the attributes of the brand's devices are validated against.
+// @Tags brands
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param brand path string true "Brand"
+// @Success 200 {object} api.BrandSchemaDTO
+// @Failure 404 {object} map[string]string "brand has no schema"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /brands/{brand}/schema [get]
+func (h *Handler) GetBrandSchema(w http.ResponseWriter, r *http.Request) {
+	bs, err := h.svc.GetBrandSchema(r.Context(), pathParam(r, "brand"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if bs == nil {
+		writeError(w, r, http.StatusNotFound, "brand has no schema")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toBrandSchemaDTO(bs))
+}
+
+// PutBrandSchema godoc
+// @Summary Set the attribute schema of a brand
+// @Description Create or replace the JSON Schema that the attributes of the brand's devices are validated against. The root must be an object schema. Supported keywords: type, properties, required, additionalProperties (boolean), items, enum, minLength, maxLength, pattern, minimum, maximum, format (mac, imei) and description. Existing devices are validated the next time their brand or attributes change.
+// @Tags brands
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param brand path string true "Brand"
+// @Param schema body object true "JSON Schema of the attributes"
+// @Success 200 {object} api.BrandSchemaDTO
+// @Failure 400 {object} map[string]string "invalid schema"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /brands/{brand}/schema [put]
+func (h *Handler) PutBrandSchema(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	bs, err := h.svc.PutBrandSchema(r.Context(), pathParam(r, "brand"), body)
+	if err != nil {
+		if errors.Is(err, schema.ErrInvalidSchema) || strings.Contains(err.Error(), "required") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toBrandSchemaDTO(bs))
+}
+
+// DeleteBrandSchema godoc
+// @Summary Delete the attribute schema of a brand
+// @Description Delete the attribute schema of a brand, after which its devices accept any attributes.
+// @Tags brands
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param brand path string true "Brand"
+// @Success 204 "no content"
+// @Failure 404 {object} map[string]string "brand has no schema"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /brands/{brand}/schema [delete]
+func (h *Handler) DeleteBrandSchema(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.svc.DeleteBrandSchema(r.Context(), pathParam(r, "brand"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !deleted {
+		writeError(w, r, http.StatusNotFound, "brand has no schema")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
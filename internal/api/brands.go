@@ -0,0 +1,188 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+// BrandDTO is the brand representation served by the API.
+type BrandDTO struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Aliases   []string  `json:"aliases"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SaveBrandDTO represents the payload to create or replace a brand.
+// Aliases are other spellings that resolve to it.
+type SaveBrandDTO struct {
+	Name    string   `json:"name" validate:"trim,required,max=50,printable" maxLength:"50"`
+	Aliases []string `json:"aliases,omitempty"`
+}
+
+func toBrandDTO(b *model.Brand) BrandDTO {
+	aliases := b.Aliases
+	if aliases == nil {
+		aliases = []string{}
+	}
+	return BrandDTO{ID: b.ID, Name: b.Name, Aliases: aliases, CreatedAt: b.CreatedAt, UpdatedAt: b.UpdatedAt}
+}
+
+// ListBrands godoc
+// @Summary List brands
+// @Description List the canonical brands of the tenant, by name.
+// @Tags brands
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Success 200 {array} api.BrandDTO
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /brands [get]
+func (h *Handler) ListBrands(w http.ResponseWriter, r *http.Request) {
+	brands, err := h.svc.ListBrands(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := make([]BrandDTO, len(brands))
+	for i := range brands {
+		out[i] = toBrandDTO(&brands[i])
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+// GetBrand godoc
+// @Summary Get a brand
+// @Description Get a canonical brand by ID
+// @Tags brands
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Brand ID"
+// @Success 200 {object} api.BrandDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /brands/{id} [get]
+func (h *Handler) GetBrand(w http.ResponseWriter, r *http.Request) {
+	brand, err := h.svc.GetBrand(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if brand == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toBrandDTO(brand))
+}
+
+// CreateBrand godoc
+// @Summary Create a brand
+// @Description Register a canonical brand with optional aliases. Names and aliases are compared ignoring case and whitespace, and must not resolve to another brand.
+// @Tags brands
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param brand body api.SaveBrandDTO true "Brand to create"
+// @Success 201 {object} api.BrandDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body or validation error"
+// @Failure 409 {object} map[string]string "name or alias already in use"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /brands [post]
+func (h *Handler) CreateBrand(w http.ResponseWriter, r *http.Request) {
+	var req SaveBrandDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	brand, err := h.svc.CreateBrand(r.Context(), req.Name, req.Aliases)
+	if writeBrandError(w, r, err) {
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, toBrandDTO(brand))
+}
+
+// UpdateBrand godoc
+// @Summary Replace a brand
+// @Description Replace the name and aliases of a brand. Its devices and attribute schema follow a new name.
+// @Tags brands
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Brand ID"
+// @Param brand body api.SaveBrandDTO true "Name and aliases of the brand"
+// @Success 200 {object} api.BrandDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body or validation error"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "name or alias already in use"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /brands/{id} [put]
+func (h *Handler) UpdateBrand(w http.ResponseWriter, r *http.Request) {
+	var req SaveBrandDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	brand, err := h.svc.UpdateBrand(r.Context(), chi.URLParam(r, "id"), req.Name, req.Aliases)
+	if writeBrandError(w, r, err) {
+		return
+	}
+	if brand == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toBrandDTO(brand))
+}
+
+// DeleteBrand godoc
+// @Summary Delete a brand
+// @Description Delete a brand and its attribute schema. Brands that still have devices cannot be deleted.
+// @Tags brands
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Brand ID"
+// @Success 204 "no content"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "brand has devices"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /brands/{id} [delete]
+func (h *Handler) DeleteBrand(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.svc.DeleteBrand(r.Context(), chi.URLParam(r, "id"))
+	if writeBrandError(w, r, err) {
+		return
+	}
+	if !deleted {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeBrandError writes the response for an error returned by the brand
+// service methods. It returns false, writing nothing, if err is nil.
+func writeBrandError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case writeValidationFailure(w, r, err), writeDuplicate(w, r, err):
+	case errors.Is(err, service.ErrBrandConflict), strings.Contains(err.Error(), "cannot "):
+		writeError(w, r, http.StatusConflict, err.Error())
+	default:
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+	return true
+}
@@ -0,0 +1,403 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// DeviceModelDTO is the catalog model representation served by the API.
+// Dates are formatted as YYYY-MM-DD and are null when unknown.
+type DeviceModelDTO struct {
+	ID           string         `json:"id"`
+	BrandID      string         `json:"brand_id"`
+	Brand        string         `json:"brand"`
+	Name         string         `json:"name"`
+	Specs        map[string]any `json:"specs"`
+	ReleaseDate  *string        `json:"release_date" format:"date"`
+	EndOfSupport *string        `json:"end_of_support" format:"date"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+}
+
+// SaveDeviceModelDTO represents the payload to create or replace a catalog
+// model. The brand of an existing model cannot change.
+type SaveDeviceModelDTO struct {
+	Brand        string         `json:"brand" validate:"trim,required,max=50,printable" maxLength:"50"`
+	Name         string         `json:"name" validate:"trim,required,max=100,printable" maxLength:"100"`
+	Specs        map[string]any `json:"specs,omitempty"`
+	ReleaseDate  *string        `json:"release_date,omitempty" validate:"trim" format:"date"`
+	EndOfSupport *string        `json:"end_of_support,omitempty" validate:"trim" format:"date"`
+}
+
+// DeviceModelRefDTO represents the payload to assign a catalog model to a
+// device. An empty or null model_id clears it.
+type DeviceModelRefDTO struct {
+	ModelID string `json:"model_id" validate:"trim"`
+}
+
+// UnsupportedDeviceDTO is a device whose model has passed its end of
+// support.
+type UnsupportedDeviceDTO struct {
+	Device DeviceDTO      `json:"device"`
+	Model  DeviceModelDTO `json:"model"`
+}
+
+func toDeviceModelDTO(m *model.DeviceModel) DeviceModelDTO {
+	specs := m.Specs
+	if specs == nil {
+		specs = map[string]any{}
+	}
+	return DeviceModelDTO{
+		ID:           m.ID,
+		BrandID:      m.BrandID,
+		Brand:        m.Brand,
+		Name:         m.Name,
+		Specs:        specs,
+		ReleaseDate:  formatDate(m.ReleaseDate),
+		EndOfSupport: formatDate(m.EndOfSupport),
+		CreatedAt:    m.CreatedAt,
+		UpdatedAt:    m.UpdatedAt,
+	}
+}
+
+func formatDate(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(time.DateOnly)
+	return &s
+}
+
+// parseDate parses an optional YYYY-MM-DD date, recording a violation of
+// field in errs if it is invalid.
+func parseDate(field string, value *string, errs validate.Errors) *time.Time {
+	if value == nil || *value == "" {
+		return nil
+	}
+	t, err := time.Parse(time.DateOnly, *value)
+	if err != nil {
+		errs.Add(field, "must be a date (YYYY-MM-DD)")
+		return nil
+	}
+	return &t
+}
+
+// readDeviceModel reads and validates a SaveDeviceModelDTO. It writes the
+// error response and returns false if the body is invalid.
+func readDeviceModel(w http.ResponseWriter, r *http.Request) (service.ModelInput, bool) {
+	var req SaveDeviceModelDTO
+	if !readJSON(w, r, &req) {
+		return service.ModelInput{}, false
+	}
+
+	errs := validate.Errors{}
+	in := service.ModelInput{
+		Brand:        req.Brand,
+		Name:         req.Name,
+		Specs:        req.Specs,
+		ReleaseDate:  parseDate("release_date", req.ReleaseDate, errs),
+		EndOfSupport: parseDate("end_of_support", req.EndOfSupport, errs),
+	}
+	if len(errs) > 0 {
+		writeValidationError(w, r, errs)
+		return service.ModelInput{}, false
+	}
+	return in, true
+}
+
+// ListDeviceModels godoc
+// @Summary List catalog models
+// @Description List the device model catalog by brand and name, optionally for one brand.
+// @Tags models
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param brand query string false "Brand name or alias"
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.DeviceModelDTO
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /models [get]
+func (h *Handler) ListDeviceModels(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	models, err := h.svc.ListModels(r.Context(), query.Get("brand"), limit, offset)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := make([]DeviceModelDTO, len(models))
+	for i := range models {
+		out[i] = toDeviceModelDTO(&models[i])
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+// GetDeviceModel godoc
+// @Summary Get a catalog model
+// @Description Get a device model of the catalog by ID
+// @Tags models
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Model ID"
+// @Success 200 {object} api.DeviceModelDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /models/{id} [get]
+func (h *Handler) GetDeviceModel(w http.ResponseWriter, r *http.Request) {
+	m, err := h.svc.GetModel(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if m == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toDeviceModelDTO(m))
+}
+
+// CreateDeviceModel godoc
+// @Summary Create a catalog model
+// @Description Add a device model to the catalog. The brand resolves like the brand of a device, and the name must be unique within the brand.
+// @Tags models
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param model body api.SaveDeviceModelDTO true "Model to create"
+// @Success 201 {object} api.DeviceModelDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body or validation error"
+// @Failure 409 {object} map[string]string "brand already has a model with this name"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /models [post]
+func (h *Handler) CreateDeviceModel(w http.ResponseWriter, r *http.Request) {
+	in, ok := readDeviceModel(w, r)
+	if !ok {
+		return
+	}
+
+	m, err := h.svc.CreateModel(r.Context(), in)
+	if writeDeviceModelError(w, r, err) {
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, toDeviceModelDTO(m))
+}
+
+// UpdateDeviceModel godoc
+// @Summary Replace a catalog model
+// @Description Replace the name, specs and dates of a catalog model. The brand must be the model's own.
+// @Tags models
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Model ID"
+// @Param model body api.SaveDeviceModelDTO true "Fields of the model"
+// @Success 200 {object} api.DeviceModelDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body or validation error"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "brand already has a model with this name"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /models/{id} [put]
+func (h *Handler) UpdateDeviceModel(w http.ResponseWriter, r *http.Request) {
+	in, ok := readDeviceModel(w, r)
+	if !ok {
+		return
+	}
+
+	m, err := h.svc.UpdateModel(r.Context(), chi.URLParam(r, "id"), in)
+	if writeDeviceModelError(w, r, err) {
+		return
+	}
+	if m == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toDeviceModelDTO(m))
+}
+
+// DeleteDeviceModel godoc
+// @Summary Delete a catalog model
+// @Description Remove a model from the catalog. Models that still have devices cannot be deleted.
+// @Tags models
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Model ID"
+// @Success 204 "no content"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "model has devices"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /models/{id} [delete]
+func (h *Handler) DeleteDeviceModel(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.svc.DeleteModel(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if strings.Contains(err.Error(), "cannot ") {
+			writeError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !deleted {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeviceModelUnits godoc
+// @Summary List the devices of a catalog model
+// @Description List the devices that are units of a model, newest first.
+// @Tags models
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Model ID"
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.DeviceDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /models/{id}/devices [get]
+func (h *Handler) ListDeviceModelUnits(w http.ResponseWriter, r *http.Request) {
+	m, err := h.svc.GetModel(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if m == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	query := r.URL.Query()
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	devices, err := h.svc.List(r.Context(), model.DeviceFilter{ModelID: m.ID}, limit, offset)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeDevices(w, r, http.StatusOK, devices)
+}
+
+// SetDeviceModel godoc
+// @Summary Assign a catalog model to a device
+// @Description Set the catalog model of a device, which must be of the device's brand. An empty or null model_id clears it. A device with a model cannot change brand.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Device ID"
+// @Param model body api.DeviceModelRefDTO true "Model of the device"
+// @Success 200 {object} api.DeviceDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body, unknown model or model of another brand"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/model [put]
+func (h *Handler) SetDeviceModel(w http.ResponseWriter, r *http.Request) {
+	var req DeviceModelRefDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	device, err := h.svc.SetModel(r.Context(), chi.URLParam(r, "id"), req.ModelID)
+	if writeValidationFailure(w, r, err) {
+		return
+	}
+	if err != nil {
+		if strings.Contains(err.Error(), "cannot ") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if device == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeDevice(w, r, http.StatusOK, device)
+}
+
+// EndOfSupportReport godoc
+// @Summary Report devices past end of support
+// @Description List the devices whose catalog model's end of support is before as_of, the longest unsupported first, each with its model.
+// @Tags reports
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param as_of query string false "Date to report at, as YYYY-MM-DD (default today, UTC)"
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.UnsupportedDeviceDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid as_of"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /reports/end-of-support [get]
+func (h *Handler) EndOfSupportReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	asOf := time.Now().UTC().Truncate(24 * time.Hour)
+	if value := query.Get("as_of"); value != "" {
+		errs := validate.Errors{}
+		if t := parseDate("as_of", &value, errs); t != nil {
+			asOf = *t
+		}
+		if len(errs) > 0 {
+			writeValidationError(w, r, errs)
+			return
+		}
+	}
+
+	unsupported, err := h.svc.UnsupportedDevices(r.Context(), asOf, limit, offset)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := make([]UnsupportedDeviceDTO, len(unsupported))
+	for i := range unsupported {
+		out[i] = UnsupportedDeviceDTO{
+			Device: toDeviceDTO(r, &unsupported[i].Device),
+			Model:  toDeviceModelDTO(&unsupported[i].Model),
+		}
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+// writeDeviceModelError writes the response for an error returned when
+// saving a catalog model. It returns false, writing nothing, if err is nil.
+func writeDeviceModelError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case writeValidationFailure(w, r, err), writeDuplicate(w, r, err):
+	case errors.Is(err, service.ErrModelConflict):
+		writeError(w, r, http.StatusConflict, err.Error())
+	case strings.Contains(err.Error(), "cannot "), strings.Contains(err.Error(), "required"):
+		writeError(w, r, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+	return true
+}
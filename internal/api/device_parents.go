@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// DeviceParentRefDTO represents the payload to attach a device to a parent
+// device. An empty or null parent_id detaches it.
+type DeviceParentRefDTO struct {
+	ParentID string `json:"parent_id" validate:"trim"`
+}
+
+// SetDeviceParent godoc
+// @Summary Attach a device to a parent device
+// @Description Attach a device, such as a dock, charger or peripheral, to the device it belongs to. An empty or null parent_id detaches it. A device cannot be attached to itself or to one of its descendants.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Device ID"
+// @Param parent body api.DeviceParentRefDTO true "Parent of the device"
+// @Success 200 {object} api.DeviceDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body or unknown parent"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "parent is the device or one of its descendants"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/parent [put]
+func (h *Handler) SetDeviceParent(w http.ResponseWriter, r *http.Request) {
+	var req DeviceParentRefDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	device, err := h.svc.SetParent(r.Context(), chi.URLParam(r, "id"), req.ParentID)
+	if writeValidationFailure(w, r, err) {
+		return
+	}
+	if err != nil {
+		if errors.Is(err, model.ErrParentCycle) {
+			writeError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if device == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeDevice(w, r, http.StatusOK, device)
+}
+
+// ListDeviceChildren godoc
+// @Summary List the devices attached to a device
+// @Description List the devices directly attached to a device, newest first.
+// @Tags devices
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Device ID"
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.DeviceDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/children [get]
+func (h *Handler) ListDeviceChildren(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	children, err := h.svc.Children(r.Context(), chi.URLParam(r, "id"), limit, offset)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if children == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeDevices(w, r, http.StatusOK, children)
+}
+
+// ListDeviceAncestors godoc
+// @Summary List the devices a device is attached to
+// @Description List the chain of devices a device is attached to, from its parent up to the top-level device.
+// @Tags devices
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Device ID"
+// @Success 200 {array} api.DeviceDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/ancestors [get]
+func (h *Handler) ListDeviceAncestors(w http.ResponseWriter, r *http.Request) {
+	ancestors, err := h.svc.Ancestors(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if ancestors == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeDevices(w, r, http.StatusOK, ancestors)
+}
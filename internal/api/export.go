@@ -0,0 +1,156 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// deviceExporter writes devices in one export format.
+type deviceExporter interface {
+	begin() error
+	write(d DeviceDTO) error
+	end() error
+}
+
+// ExportDevices godoc
+// @Summary Export devices
+// @Description Stream every device matching the filters as a CSV, NDJSON or JSON download. Rows are read from a server-side cursor and flushed in batches, so exports of any size neither load the whole table into memory nor hit the request timeout.
+// @Tags devices
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param format query string false "Export format (default json)" Enums(csv, ndjson, json)
+// @Param brand query string false "Filter by brand"
+// @Param state query string false "Filter by state"
+// @Param selector query string false "Label selector, e.g. env=prod,team in (a,b),!deprecated"
+// @Param attr.name query string false "Attribute filter: attr.<name>=<value> matches devices whose top-level attribute equals the value"
+// @Success 200 {array} api.DeviceDTO
+// @Failure 400 {object} map[string]string "invalid format or filter"
+// @Failure 500 {object} map[string]string "internal error"
+// @x-streaming true
+// @Router /devices/export [get]
+func (h *Handler) ExportDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := parseDeviceFilter(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.State != "" && !model.IsValidState(filter.State) {
+		writeError(w, r, http.StatusBadRequest, "invalid state value")
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+
+	var exp deviceExporter
+	var contentType string
+	switch format {
+	case "csv":
+		exp, contentType = newCSVExporter(w), "text/csv"
+	case "ndjson":
+		exp, contentType = &ndjsonExporter{enc: json.NewEncoder(w)}, "application/x-ndjson"
+	case "json":
+		exp, contentType = &jsonExporter{w: w, enc: json.NewEncoder(w)}, "application/json"
+	default:
+		writeError(w, r, http.StatusBadRequest, "invalid format value")
+		return
+	}
+
+	filename := "devices-" + time.Now().UTC().Format("20060102T150405Z") + "." + format
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	flush := func() {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+
+	// Once the body has started the status can no longer change, so a
+	// failure midway leaves a truncated download and is only visible to the
+	// client as a missing end of stream.
+	if err := exp.begin(); err != nil {
+		return
+	}
+	write := func(d *model.Device) error { return exp.write(toDeviceDTO(r, d)) }
+	if err := h.svc.Export(r.Context(), filter, write, flush); err != nil {
+		return
+	}
+	_ = exp.end()
+	flush()
+}
+
+type csvExporter struct {
+	w *csv.Writer
+}
+
+func newCSVExporter(w io.Writer) *csvExporter {
+	return &csvExporter{w: csv.NewWriter(w)}
+}
+
+func (e *csvExporter) begin() error {
+	return e.w.Write([]string{"id", "name", "brand", "state", "created_at", "serial_number", "asset_tag"})
+}
+
+func (e *csvExporter) write(d DeviceDTO) error {
+	err := e.w.Write([]string{d.ID, d.Name, d.Brand, d.State, d.CreatedAt.UTC().Format(time.RFC3339), deref(d.SerialNumber), deref(d.AssetTag)})
+	if err != nil {
+		return err
+	}
+	// Flush the csv buffer into the response so that the periodic HTTP
+	// flush sends complete rows.
+	e.w.Flush()
+	return e.w.Error()
+}
+
+func (e *csvExporter) end() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonExporter struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonExporter) begin() error { return nil }
+
+func (e *ndjsonExporter) write(d DeviceDTO) error { return e.enc.Encode(d) }
+
+func (e *ndjsonExporter) end() error { return nil }
+
+type jsonExporter struct {
+	w     io.Writer
+	enc   *json.Encoder
+	count int
+}
+
+func (e *jsonExporter) begin() error {
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonExporter) write(d DeviceDTO) error {
+	if e.count > 0 {
+		if _, err := io.WriteString(e.w, ","); err != nil {
+			return err
+		}
+	}
+	e.count++
+	return e.enc.Encode(d)
+}
+
+func (e *jsonExporter) end() error {
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
+
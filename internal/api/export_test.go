@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+// exportRepo is a device and brand store that only implements Export, and
+// brand resolution for the Acme brand.
+type exportRepo struct {
+	service.DeviceStore
+	service.BrandStore
+	devices []model.Device
+	filter  model.DeviceFilter
+}
+
+func (e *exportRepo) Export(ctx context.Context, filter model.DeviceFilter, fn func(*model.Device) error, afterBatch func()) error {
+	e.filter = filter
+	for i := range e.devices {
+		if err := fn(&e.devices[i]); err != nil {
+			return err
+		}
+	}
+	afterBatch()
+	return nil
+}
+
+func (e *exportRepo) BrandByKey(ctx context.Context, key string) (*model.Brand, error) {
+	if key == "acme" {
+		return &model.Brand{ID: "b1", Name: "Acme"}, nil
+	}
+	return nil, nil
+}
+
+func TestExportDevices(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	repo := &exportRepo{devices: []model.Device{
+		{ID: "1", Name: "Phone", Brand: "Acme", SerialNumber: "SN-1", AssetTag: "A-1", State: model.StateAvailable, CreatedAt: created},
+		{ID: "2", Name: "Laptop, 14", Brand: "Acme", State: model.StateInUse, CreatedAt: created},
+	}}
+	h := NewHandler(service.NewDeviceService(service.Stores{Devices: repo, Brands: repo}), nil)
+
+	export := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ExportDevices(rec, httptest.NewRequest(http.MethodGet, "/devices/export?"+query, nil))
+		return rec
+	}
+
+	rec := export("format=json&brand=acme")
+	var devices []model.Device
+	if err := json.Unmarshal(rec.Body.Bytes(), &devices); err != nil || len(devices) != 2 {
+		t.Fatalf("expected a JSON array of 2 devices, got %q (%v)", rec.Body.String(), err)
+	}
+	if repo.filter.BrandID != "b1" {
+		t.Fatalf("expected brand filter to resolve to its canonical brand, got %+v", repo.filter)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); !strings.HasPrefix(cd, "attachment;") || !strings.HasSuffix(cd, `.json"`) {
+		t.Fatalf("unexpected Content-Disposition %q", cd)
+	}
+
+	rec = export("format=csv")
+	want := "id,name,brand,state,created_at,serial_number,asset_tag\n" +
+		"1,Phone,Acme,available,2026-01-02T03:04:05Z,SN-1,A-1\n" +
+		"2,\"Laptop, 14\",Acme,in-use,2026-01-02T03:04:05Z,,\n"
+	if rec.Body.String() != want {
+		t.Fatalf("unexpected csv:\n%s", rec.Body.String())
+	}
+
+	rec = export("format=ndjson")
+	if lines := strings.Count(rec.Body.String(), "\n"); lines != 2 {
+		t.Fatalf("expected 2 ndjson lines, got %d", lines)
+	}
+
+	if rec := export("format=xml"); rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown format, got %d", rec.Code)
+	}
+}
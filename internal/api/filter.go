@@ -0,0 +1,80 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/lucast-ruiz/devices-api/internal/labels"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// attributeParamPrefix prefixes the query parameters that filter devices by
+// attribute, as in attr.imei=490154203237518.
+const attributeParamPrefix = "attr."
+
+func hasAttributeFilter(query url.Values) bool {
+	for name := range query {
+		if strings.HasPrefix(name, attributeParamPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseDeviceFilter reads the brand, state, selector and attr.<name> query
+// parameters.
+func parseDeviceFilter(query url.Values) (model.DeviceFilter, error) {
+	selector, err := labels.Parse(query.Get("selector"))
+	if err != nil {
+		return model.DeviceFilter{}, err
+	}
+
+	filter := model.DeviceFilter{
+		Brand:    query.Get("brand"),
+		State:    query.Get("state"),
+		Selector: selector,
+	}
+	for name, values := range query {
+		attr, ok := strings.CutPrefix(name, attributeParamPrefix)
+		if !ok {
+			continue
+		}
+		if attr == "" || len(values) != 1 {
+			return model.DeviceFilter{}, fmt.Errorf("invalid attribute filter %s: expected attr.<name>=<value> once per name", name)
+		}
+		if filter.Attributes == nil {
+			filter.Attributes = make(map[string]string)
+		}
+		filter.Attributes[attr] = values[0]
+	}
+
+	return filter, nil
+}
+
+// filterDevices lists the devices matching the brand, state, selector and
+// attribute query parameters, paginated.
+func (h *Handler) filterDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter, err := parseDeviceFilter(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	devices, err := h.svc.List(r.Context(), filter, limit, offset)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeDevices(w, r, http.StatusOK, devices)
+}
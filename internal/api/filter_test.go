@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestParseDeviceFilter(t *testing.T) {
+	query, _ := url.ParseQuery("brand=Acme&selector=env%3Dprod&attr.imei=490154203237518&limit=5")
+
+	filter, err := parseDeviceFilter(query)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filter.Brand != "Acme" || len(filter.Selector) != 1 {
+		t.Fatalf("unexpected filter %+v", filter)
+	}
+	if len(filter.Attributes) != 1 || filter.Attributes["imei"] != "490154203237518" {
+		t.Fatalf("unexpected attributes %v", filter.Attributes)
+	}
+
+	for _, raw := range []string{"attr.=x", "attr.imei=1&attr.imei=2", "selector=env+in+(a"} {
+		query, _ := url.ParseQuery(raw)
+		if _, err := parseDeviceFilter(query); err == nil {
+			t.Fatalf("%s: expected error", raw)
+		}
+	}
+}
@@ -2,45 +2,123 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/patch"
 	"github.com/lucast-ruiz/devices-api/internal/service"
 )
 
 type Handler struct {
-	svc *service.DeviceService
+	svc         *service.DeviceService
+	idempotency IdempotencyStore
 }
 
-func NewHandler(s *service.DeviceService) *Handler {
-	return &Handler{svc: s}
+func NewHandler(s *service.DeviceService, idempotency IdempotencyStore) *Handler {
+	return &Handler{svc: s, idempotency: idempotency}
 }
 
 // CreateDeviceDTO represents the payload to create a device.
 type CreateDeviceDTO struct {
-	Name  string `json:"name"`
-	Brand string `json:"brand"`
-	State string `json:"state"`
+	Name  string `json:"name" validate:"trim,required,max=100,printable" maxLength:"100"`
+	Brand string `json:"brand" validate:"trim,required,max=50,printable" maxLength:"50"`
+	State string `json:"state" validate:"trim,lower,oneof=available in-use inactive" enums:"available,in-use,inactive"`
+	// SerialNumber and AssetTag are optional and unique within the brand.
+	SerialNumber string `json:"serial_number,omitempty" validate:"trim,max=100,printable" maxLength:"100"`
+	AssetTag     string `json:"asset_tag,omitempty" validate:"trim,max=100,printable" maxLength:"100"`
+	// Attributes are validated against the brand's attribute schema.
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// input is the service input for the device described by the payload.
+func (d *CreateDeviceDTO) input() service.CreateInput {
+	return service.CreateInput{
+		Name:         d.Name,
+		Brand:        d.Brand,
+		State:        d.State,
+		SerialNumber: d.SerialNumber,
+		AssetTag:     d.AssetTag,
+		Attributes:   d.Attributes,
+	}
 }
 
 // UpdateDeviceDTO represents the payload to partially update a device.
+// Absent fields are left unchanged; present ones follow the rules of
+// CreateDeviceDTO. An empty serial_number or asset_tag clears it.
+// Attributes, when present, replace the current ones.
 type UpdateDeviceDTO struct {
-	Name  *string `json:"name"`
-	Brand *string `json:"brand"`
-	State *string `json:"state"`
+	Name         *string        `json:"name" validate:"trim,required,max=100,printable" maxLength:"100"`
+	Brand        *string        `json:"brand" validate:"trim,required,max=50,printable" maxLength:"50"`
+	State        *string        `json:"state" validate:"trim,lower,oneof=available in-use inactive" enums:"available,in-use,inactive"`
+	SerialNumber *string        `json:"serial_number" validate:"trim,max=100,printable" maxLength:"100"`
+	AssetTag     *string        `json:"asset_tag" validate:"trim,max=100,printable" maxLength:"100"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
 }
 
-func writeJSON(w http.ResponseWriter, status int, v any) {
+// ReplaceDeviceDTO represents the payload to fully replace a device. id and
+// created_at are optional and, when sent, must match the stored device.
+type ReplaceDeviceDTO struct {
+	ID        *string    `json:"id,omitempty"`
+	Name      string     `json:"name" validate:"trim,required,max=100,printable" maxLength:"100"`
+	Brand     string     `json:"brand" validate:"trim,required,max=50,printable" maxLength:"50"`
+	State     string     `json:"state" validate:"trim,lower,oneof=available in-use inactive" enums:"available,in-use,inactive"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	// Identifiers and attributes replace the current ones; absent means
+	// none.
+	SerialNumber string         `json:"serial_number,omitempty" validate:"trim,max=100,printable" maxLength:"100"`
+	AssetTag     string         `json:"asset_tag,omitempty" validate:"trim,max=100,printable" maxLength:"100"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+}
+
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+	acceptPatch    = "application/json, " + mergePatchType + ", " + jsonPatchType
+)
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	if apiVersion(r) >= 2 {
+		v = EnvelopeDTO{Data: v}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(v)
 }
 
-func writeError(w http.ResponseWriter, status int, message string) {
-	writeJSON(w, status, map[string]string{"error": message})
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if apiVersion(r) >= 2 {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(ProblemDTO{
+			Type:     "about:blank",
+			Title:    http.StatusText(status),
+			Status:   status,
+			Detail:   message,
+			Instance: r.URL.Path,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// writeDuplicate writes a 409 naming the field of a *model.DuplicateError.
+// It returns false, writing nothing, for any other error.
+func writeDuplicate(w http.ResponseWriter, r *http.Request, err error) bool {
+	var dup *model.DuplicateError
+	if !errors.As(err, &dup) {
+		return false
+	}
+	writeError(w, r, http.StatusConflict, dup.Error())
+	return true
 }
 
 func parseIntQuery(value string, def int) int {
@@ -60,74 +138,95 @@ func parseIntQuery(value string, def int) int {
 // @Tags devices
 // @Accept json
 // @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
 // @Param device body api.CreateDeviceDTO true "Device to create"
-// @Success 201 {object} model.Device
-// @Failure 400 {object} map[string]string "invalid body or validation error"
+// @Success 201 {object} api.DeviceDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body or validation error"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 403 {object} map[string]string "device quota exceeded for tenant"
+// @Failure 409 {object} map[string]string "request with this idempotency key still in progress"
+// @Failure 422 {object} map[string]string "idempotency key reused with a different request"
 // @Failure 500 {object} map[string]string "failed to create device"
 // @Router /devices [post]
 func (h *Handler) CreateDevice(w http.ResponseWriter, r *http.Request) {
 	var req CreateDeviceDTO
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid body")
+	if !readJSON(w, r, &req) {
 		return
 	}
 
-	// Validações básicas
-	if strings.TrimSpace(req.Name) == "" || strings.TrimSpace(req.Brand) == "" {
-		writeError(w, http.StatusBadRequest, "name and brand are required")
+	device, err := h.svc.Create(r.Context(), req.input())
+	if writeValidationFailure(w, r, err) || writeDuplicate(w, r, err) {
 		return
 	}
-	if !model.IsValidState(req.State) {
-		writeError(w, http.StatusBadRequest, "invalid state value")
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		writeError(w, r, http.StatusForbidden, err.Error())
 		return
 	}
-
-	device, err := h.svc.Create(r.Context(), req.Name, req.Brand, req.State)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to create device")
+		writeError(w, r, http.StatusInternalServerError, "failed to create device")
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, device)
+	writeDevice(w, r, http.StatusCreated, device)
 }
 
 // GetDeviceByID godoc
 // @Summary Get a device by ID
-// @Description Get a single device by its ID
+// @Description Get a single device by its ID, or with as_of as it was at that time. A device that did not exist then, or had been deleted, is not found.
 // @Tags devices
 // @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
 // @Param id path string true "Device ID"
-// @Success 200 {object} model.Device
+// @Param as_of query string false "Time to read the device at (RFC 3339)"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,name,state"
+// @Success 200 {object} api.DeviceDTO
+// @Failure 400 {object} map[string]string "invalid as_of or fields"
 // @Failure 404 {object} map[string]string "not found"
 // @Failure 500 {object} map[string]string "internal error"
 // @Router /devices/{id} [get]
 func (h *Handler) GetDeviceByID(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	asOf, err := parseAsOf(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	device, err := h.svc.GetByID(r.Context(), id)
+	var device *model.Device
+	if asOf.IsZero() {
+		device, err = h.svc.GetByID(r.Context(), id)
+	} else {
+		device, err = h.svc.GetByIDAsOf(r.Context(), id, asOf)
+	}
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "internal error")
+		writeError(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
 	if device == nil {
-		writeError(w, http.StatusNotFound, "not found")
+		writeError(w, r, http.StatusNotFound, "not found")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, device)
+	writeDevice(w, r, http.StatusOK, device)
 }
 
 // ListDevices godoc
 // @Summary List devices
-// @Description List all devices or filter by brand/state. If no filter is provided, results are paginated.
+// @Description List all devices or filter by brand/state. If no filter is provided, results are paginated. With a label selector or attribute filters, the brand and state filters are combined with them. With as_of, the devices that matched the filters at that time are listed as they were then, always paginated.
 // @Tags devices
 // @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
 // @Param brand query string false "Filter by brand"
 // @Param state query string false "Filter by state"
 // @Param limit query int false "Max items to return (default 100)"
 // @Param offset query int false "Items to skip for pagination (default 0)"
-// @Success 200 {array} model.Device
+// @Param selector query string false "Label selector, e.g. env=prod,team in (a,b),!deprecated. Combined with brand and state, and always paginated"
+// @Param attr.name query string false "Attribute filter: attr.<name>=<value> matches devices whose top-level attribute equals the value. Repeatable with different names, combined with the other filters, and always paginated"
+// @Param as_of query string false "Time to list the devices at (RFC 3339). Combined with the other filters, and always paginated"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,name,state"
+// @Success 200 {array} api.DeviceDTO
+// @Failure 400 {object} map[string]string "invalid selector, attribute filter, state, as_of or fields"
 // @Failure 500 {object} map[string]string "internal error"
 // @Router /devices [get]
 func (h *Handler) ListDevices(w http.ResponseWriter, r *http.Request) {
@@ -135,23 +234,33 @@ func (h *Handler) ListDevices(w http.ResponseWriter, r *http.Request) {
 	brand := query.Get("brand")
 	state := query.Get("state")
 
+	if query.Has("as_of") {
+		h.listDevicesAsOf(w, r)
+		return
+	}
+
+	if query.Has("selector") || hasAttributeFilter(query) {
+		h.filterDevices(w, r)
+		return
+	}
+
 	if brand != "" {
 		devices, err := h.svc.GetByBrand(r.Context(), brand)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
-		writeJSON(w, http.StatusOK, devices)
+		writeDevices(w, r, http.StatusOK, devices)
 		return
 	}
 
 	if state != "" {
 		devices, err := h.svc.GetByState(r.Context(), state)
 		if err != nil {
-			writeError(w, http.StatusInternalServerError, "internal error")
+			writeError(w, r, http.StatusInternalServerError, "internal error")
 			return
 		}
-		writeJSON(w, http.StatusOK, devices)
+		writeDevices(w, r, http.StatusOK, devices)
 		return
 	}
 
@@ -160,68 +269,210 @@ func (h *Handler) ListDevices(w http.ResponseWriter, r *http.Request) {
 
 	devices, err := h.svc.ListAll(r.Context(), limit, offset)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "internal error")
+		writeError(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, devices)
+	writeDevices(w, r, http.StatusOK, devices)
 }
 
 // UpdateDevice godoc
 // @Summary Update a device
-// @Description Partially update a device
+// @Description Partially update a device. Besides the partial device object (application/json), the body can be a JSON Merge Patch (application/merge-patch+json, RFC 7396) or a JSON Patch (application/json-patch+json, RFC 6902, including test operations) applied to the device document.
 // @Tags devices
 // @Accept json
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
 // @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
 // @Param id path string true "Device ID"
 // @Param device body api.UpdateDeviceDTO true "Partial device fields"
-// @Success 200 {object} model.Device
-// @Failure 400 {object} map[string]string "validation or business rule error"
+// @Success 200 {object} api.DeviceDTO
+// @Failure 400 {object} api.ValidationErrorDTO "validation or business rule error; fields is only set for validation errors"
+// @Failure 413 {object} map[string]string "request body too large"
 // @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "JSON Patch test failed, or request with this idempotency key still in progress"
+// @Failure 415 {object} map[string]string "unsupported content type"
+// @Failure 422 {object} map[string]string "patch path does not exist or is invalid, or idempotency key reused with a different request"
 // @Failure 500 {object} map[string]string "internal error"
 // @Router /devices/{id} [patch]
 func (h *Handler) UpdateDevice(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
+	w.Header().Set("Accept-Patch", acceptPatch)
 
-	var req UpdateDeviceDTO
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid body")
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "", "application/json":
+	case mergePatchType:
+		h.patchDocument(w, r, id, patch.MergePatch)
+		return
+	case jsonPatchType:
+		h.patchDocument(w, r, id, patch.JSONPatch)
+		return
+	default:
+		writeError(w, r, http.StatusUnsupportedMediaType, "content type must be one of "+acceptPatch)
 		return
 	}
 
-	// Valida state se vier
-	if req.State != nil && !model.IsValidState(*req.State) {
-		writeError(w, http.StatusBadRequest, "invalid state value")
+	var req UpdateDeviceDTO
+	if !readJSON(w, r, &req) {
 		return
 	}
 
-	device, err := h.svc.Update(r.Context(), id, req.Name, req.Brand, req.State)
+	device, err := h.svc.Update(r.Context(), service.UpdateInput{
+		ID:           id,
+		Name:         req.Name,
+		Brand:        req.Brand,
+		State:        req.State,
+		SerialNumber: req.SerialNumber,
+		AssetTag:     req.AssetTag,
+		Attributes:   req.Attributes,
+	})
+	if writeValidationFailure(w, r, err) || writeDuplicate(w, r, err) {
+		return
+	}
 	if err != nil {
 		// Erros de regra de negócio
 		msg := err.Error()
 		if strings.Contains(msg, "cannot ") || strings.Contains(msg, "invalid") {
-			writeError(w, http.StatusBadRequest, msg)
+			writeError(w, r, http.StatusBadRequest, msg)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if device == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeDevice(w, r, http.StatusOK, device)
+}
+
+// ReplaceDevice godoc
+// @Summary Replace a device
+// @Description Fully replace a device. name, brand and state are required; id and created_at cannot be changed. With upsert=true, a device that does not exist is created with the UUID from the path.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Device ID"
+// @Param upsert query bool false "Create the device if it does not exist"
+// @Param device body api.ReplaceDeviceDTO true "Full device"
+// @Success 200 {object} api.DeviceDTO "replaced"
+// @Success 201 {object} api.DeviceDTO "created by upsert"
+// @Failure 400 {object} api.ValidationErrorDTO "validation or business rule error; fields is only set for validation errors"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 403 {object} map[string]string "device quota exceeded for tenant"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id} [put]
+func (h *Handler) ReplaceDevice(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req ReplaceDeviceDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.ID != nil && *req.ID != id {
+		writeError(w, r, http.StatusBadRequest, "cannot change id")
+		return
+	}
+
+	upsert, _ := strconv.ParseBool(r.URL.Query().Get("upsert"))
+
+	in := service.CreateInput{
+		Name:         req.Name,
+		Brand:        req.Brand,
+		State:        req.State,
+		SerialNumber: req.SerialNumber,
+		AssetTag:     req.AssetTag,
+		Attributes:   req.Attributes,
+	}
+	device, created, err := h.svc.Replace(r.Context(), id, in, req.CreatedAt, upsert)
+	if writeValidationFailure(w, r, err) || writeDuplicate(w, r, err) {
+		return
+	}
+	if errors.Is(err, service.ErrQuotaExceeded) {
+		writeError(w, r, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		msg := err.Error()
+		if strings.Contains(msg, "cannot ") || strings.Contains(msg, "invalid") {
+			writeError(w, r, http.StatusBadRequest, msg)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if device == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	if created {
+		writeDevice(w, r, http.StatusCreated, device)
+		return
+	}
+	writeDevice(w, r, http.StatusOK, device)
+}
+
+// patchDocument applies a merge patch or JSON patch from the request body to
+// the device document.
+func (h *Handler) patchDocument(w http.ResponseWriter, r *http.Request, id string, apply func(doc, p []byte) ([]byte, error)) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeBodyError(w, r, err)
+		return
+	}
+
+	device, err := h.svc.PatchDocument(r.Context(), id, func(doc []byte) ([]byte, error) {
+		return apply(doc, body)
+	})
+	if writeValidationFailure(w, r, err) || writeDuplicate(w, r, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, patch.ErrTestFailed):
+		writeError(w, r, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, patch.ErrPathNotFound), errors.Is(err, patch.ErrInvalidPath):
+		writeError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	case errors.Is(err, patch.ErrInvalidPatch):
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		msg := err.Error()
+		if strings.Contains(msg, "cannot ") || strings.Contains(msg, "invalid") {
+			writeError(w, r, http.StatusBadRequest, msg)
 			return
 		}
-		writeError(w, http.StatusInternalServerError, "internal error")
+		writeError(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
 	if device == nil {
-		writeError(w, http.StatusNotFound, "not found")
+		writeError(w, r, http.StatusNotFound, "not found")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, device)
+	writeDevice(w, r, http.StatusOK, device)
 }
 
 // DeleteDevice godoc
 // @Summary Delete a device
 // @Description Delete a device by ID
 // @Tags devices
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
 // @Param id path string true "Device ID"
 // @Success 204 "no content"
 // @Failure 400 {object} map[string]string "business rule error"
 // @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "request with this idempotency key still in progress"
+// @Failure 422 {object} map[string]string "idempotency key reused with a different request"
 // @Failure 500 {object} map[string]string "internal error"
 // @Router /devices/{id} [delete]
 func (h *Handler) DeleteDevice(w http.ResponseWriter, r *http.Request) {
@@ -231,17 +482,17 @@ func (h *Handler) DeleteDevice(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		msg := err.Error()
 		if strings.Contains(msg, "cannot delete") {
-			writeError(w, http.StatusBadRequest, msg)
+			writeError(w, r, http.StatusBadRequest, msg)
 			return
 		}
-		writeError(w, http.StatusInternalServerError, "internal error")
+		writeError(w, r, http.StatusInternalServerError, "internal error")
 		return
 	}
 
 	// Se não existia, retornamos 404 para ser mais explícito
 	device, _ := h.svc.GetByID(r.Context(), id)
 	if device == nil {
-		writeError(w, http.StatusNotFound, "not found")
+		writeError(w, r, http.StatusNotFound, "not found")
 		return
 	}
 
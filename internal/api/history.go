@@ -0,0 +1,125 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// FieldChangeDTO is a field of a device that differs between two times.
+// From or To is null where the field is empty or the device did not exist.
+type FieldChangeDTO struct {
+	Field string `json:"field" example:"state"`
+	From  any    `json:"from" swaggertype:"string" example:"available"`
+	To    any    `json:"to" swaggertype:"string" example:"in-use"`
+}
+
+// DeviceDiffDTO compares a device as it was at two times. Before and After
+// are null where the device did not exist.
+type DeviceDiffDTO struct {
+	DeviceID string           `json:"device_id"`
+	From     time.Time        `json:"from"`
+	To       time.Time        `json:"to"`
+	Before   *DeviceDTO       `json:"before"`
+	After    *DeviceDTO       `json:"after"`
+	Changes  []FieldChangeDTO `json:"changes"`
+}
+
+// parseAsOf parses the as_of query parameter, returning the zero time when
+// it is absent.
+func parseAsOf(query url.Values) (time.Time, error) {
+	value := query.Get("as_of")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid as_of value: must be an RFC 3339 time")
+	}
+	return t, nil
+}
+
+// listDevicesAsOf lists the devices that matched the brand, state, selector
+// and attribute query parameters at as_of, as they were then, paginated.
+func (h *Handler) listDevicesAsOf(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	asOf, err := parseAsOf(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter, err := parseDeviceFilter(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	devices, err := h.svc.ListAsOf(r.Context(), filter, asOf, limit, offset)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeDevices(w, r, http.StatusOK, devices)
+}
+
+// DiffDevice godoc
+// @Summary Compare a device between two times
+// @Description Compare a device as it was at from with how it was at to, or with how it is now without to, and list the fields that differ. Where the device did not exist, before or after is null and every field of the other side is listed.
+// @Tags devices
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Device ID"
+// @Param from query string true "Earlier time (RFC 3339)"
+// @Param to query string false "Later time (RFC 3339, default now)"
+// @Success 200 {object} api.DeviceDiffDTO
+// @Failure 400 {object} map[string]string "missing or invalid from or to"
+// @Failure 404 {object} map[string]string "device did not exist at either time"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/diff [get]
+func (h *Handler) DiffDevice(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parsePeriod(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	diff, err := h.svc.DiffDevice(r.Context(), id, from, to)
+	if err != nil {
+		if strings.Contains(err.Error(), "required") || strings.Contains(err.Error(), "invalid") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if diff == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	out := DeviceDiffDTO{DeviceID: id, From: diff.From, To: diff.To, Changes: make([]FieldChangeDTO, len(diff.Changes))}
+	if diff.Before != nil {
+		before := toDeviceDTO(r, diff.Before)
+		out.Before = &before
+	}
+	if diff.After != nil {
+		after := toDeviceDTO(r, diff.After)
+		out.After = &after
+	}
+	for i, c := range diff.Changes {
+		out.Changes[i] = FieldChangeDTO{Field: c.Field, From: c.From, To: c.To}
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+// historyRepo is a service.HistoryStore that records the time devices are
+// read at.
+type historyRepo struct {
+	service.HistoryStore
+	at     time.Time
+	filter model.DeviceFilter
+}
+
+func (r *historyRepo) GetByIDAsOf(ctx context.Context, id string, at time.Time) (*model.Device, error) {
+	r.at = at
+	return &model.Device{ID: id, Name: "Phone", Brand: "Apple", State: model.StateAvailable, CreatedAt: at.Add(-time.Hour)}, nil
+}
+
+func (r *historyRepo) ListAsOf(ctx context.Context, filter model.DeviceFilter, at time.Time, limit, offset int) ([]model.Device, error) {
+	r.at, r.filter = at, filter
+	return []model.Device{}, nil
+}
+
+func TestGetDevicesAsOf(t *testing.T) {
+	repo := &historyRepo{}
+	routes := NewHandler(service.NewDeviceService(service.Stores{History: repo}), nil).Routes()
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = withTenant(req, "acme")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+	asOf := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	rec := get("/devices/0b7e6b8e-3c55-4a57-a7f3-5f0c1e2d4b6a?as_of=2026-01-01T00:00:00Z")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !repo.at.Equal(asOf) {
+		t.Fatalf("expected the device to be read at %v, got %v", asOf, repo.at)
+	}
+
+	repo.at = time.Time{}
+	rec = get("/devices?as_of=2026-01-01T00:00:00Z&state=in-use")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !repo.at.Equal(asOf) || repo.filter.State != "in-use" {
+		t.Fatalf("expected the filtered devices to be listed at %v, got %v with %+v", asOf, repo.at, repo.filter)
+	}
+
+	for _, target := range []string{
+		"/devices/0b7e6b8e-3c55-4a57-a7f3-5f0c1e2d4b6a?as_of=2026-01-01",
+		"/devices?as_of=yesterday",
+		"/devices/0b7e6b8e-3c55-4a57-a7f3-5f0c1e2d4b6a/diff",
+	} {
+		if rec := get(target); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d: %s", target, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	idempotencyTTL    = 24 * time.Hour
+)
+
+// IdempotencyStore persists the responses of requests sent with an
+// Idempotency-Key header.
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*model.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error
+	Release(ctx context.Context, key string) error
+}
+
+// idempotent makes POST, PATCH and DELETE requests carrying an
+// Idempotency-Key header safe to retry. The first request with a key is
+// processed and its response stored; identical retries get the stored
+// response back, and a retry with a different method, path or body is
+// rejected with 422.
+func (h *Handler) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(idempotencyHeader)
+		if h.idempotency == nil || key == "" || !isIdempotentMethod(r.Method) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			writeBodyError(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(r, body)
+
+		rec, reserved, err := h.idempotency.Reserve(r.Context(), key, fingerprint, idempotencyTTL)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "internal error")
+			return
+		}
+
+		if !reserved {
+			switch {
+			case rec.Fingerprint != fingerprint:
+				writeError(w, r, http.StatusUnprocessableEntity, "idempotency key reused with a different request")
+			case !rec.Completed():
+				writeError(w, r, http.StatusConflict, "a request with this idempotency key is still in progress")
+			default:
+				if rec.ContentType != "" {
+					w.Header().Set("Content-Type", rec.ContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(rec.StatusCode)
+				_, _ = w.Write(rec.ResponseBody)
+			}
+			return
+		}
+
+		// The reservation is settled even after the request times out, the
+		// client disconnects or the handler panics. A key left in progress
+		// would answer every retry with 409 until it expires.
+		ctx := context.WithoutCancel(r.Context())
+		completed := false
+		defer func() {
+			if !completed {
+				_ = h.idempotency.Release(ctx, key)
+			}
+		}()
+
+		cw := &capturingWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(cw, r)
+
+		// Server errors are not stored so that the client can retry them.
+		if cw.status >= http.StatusInternalServerError {
+			return
+		}
+		completed = h.idempotency.Complete(ctx, key, cw.status, cw.Header().Get("Content-Type"), cw.body.Bytes()) == nil
+	})
+}
+
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPatch, http.MethodDelete:
+		return true
+	default:
+		return false
+	}
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	sum := sha256.New()
+	sum.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	sum.Write(body)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// capturingWriter passes a response through while keeping a copy of its
+// status and body.
+type capturingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (c *capturingWriter) WriteHeader(status int) {
+	if !c.wroteHeader {
+		c.status = status
+		c.wroteHeader = true
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *capturingWriter) Write(b []byte) (int, error) {
+	if !c.wroteHeader {
+		c.WriteHeader(http.StatusOK)
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+func (c *capturingWriter) Flush() {
+	if f, ok := c.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+type memoryIdempotencyStore struct {
+	records map[string]*model.IdempotencyRecord
+}
+
+func (m *memoryIdempotencyStore) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*model.IdempotencyRecord, bool, error) {
+	if rec, ok := m.records[key]; ok {
+		return rec, false, nil
+	}
+	m.records[key] = &model.IdempotencyRecord{Key: key, Fingerprint: fingerprint}
+	return m.records[key], true, nil
+}
+
+func (m *memoryIdempotencyStore) Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	rec := m.records[key]
+	rec.StatusCode, rec.ContentType, rec.ResponseBody = statusCode, contentType, body
+	return nil
+}
+
+func (m *memoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	delete(m.records, key)
+	return nil
+}
+
+func TestIdempotent(t *testing.T) {
+	calls := 0
+	h := &Handler{idempotency: &memoryIdempotencyStore{records: map[string]*model.IdempotencyRecord{}}}
+	next := h.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		writeJSON(w, r, http.StatusCreated, map[string]int{"call": calls})
+	}))
+
+	do := func(key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/devices", strings.NewReader(body))
+		req.Header.Set(idempotencyHeader, key)
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, req)
+		return rec
+	}
+
+	first := do("k1", `{"name":"a"}`)
+	if first.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", first.Code)
+	}
+
+	replay := do("k1", `{"name":"a"}`)
+	if replay.Code != http.StatusCreated || replay.Body.String() != first.Body.String() {
+		t.Fatalf("expected replayed response, got %d %s", replay.Code, replay.Body.String())
+	}
+	if replay.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected Idempotent-Replayed header")
+	}
+	if calls != 1 {
+		t.Fatalf("expected handler to run once, ran %d times", calls)
+	}
+
+	if rec := do("k1", `{"name":"b"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for reused key, got %d", rec.Code)
+	}
+
+	if rec := do("k2", `{"name":"a"}`); rec.Code != http.StatusCreated || calls != 2 {
+		t.Fatalf("expected new key to be processed, got %d after %d calls", rec.Code, calls)
+	}
+}
+
+func TestIdempotent_ReleasesKeyOfUnfinishedRequest(t *testing.T) {
+	store := &memoryIdempotencyStore{records: map[string]*model.IdempotencyRecord{}}
+	h := &Handler{idempotency: store}
+
+	for name, handler := range map[string]http.HandlerFunc{
+		"cancelled": func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, r, http.StatusServiceUnavailable, "timeout")
+		},
+		"panicked": func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		req := httptest.NewRequest(http.MethodPost, "/devices", strings.NewReader(`{}`)).WithContext(ctx)
+		req.Header.Set(idempotencyHeader, name)
+		next := h.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cancel()
+			handler(w, r)
+		}))
+
+		func() {
+			defer func() { _ = recover() }()
+			next.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+
+		if _, ok := store.records[name]; ok {
+			t.Fatalf("%s: expected the key to be released", name)
+		}
+	}
+}
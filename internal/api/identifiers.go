@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// GetDeviceBySerialNumber godoc
+// @Summary Get a device by serial number
+// @Description Get the device with a serial number. Serial numbers are unique within a brand, so brand is required when devices of several brands share it.
+// @Tags devices
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param serial path string true "Serial number"
+// @Param brand query string false "Brand name or alias"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,name,state"
+// @Success 200 {object} api.DeviceDTO
+// @Failure 400 {object} api.ValidationErrorDTO "brand required or invalid fields"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/by-serial/{serial} [get]
+func (h *Handler) GetDeviceBySerialNumber(w http.ResponseWriter, r *http.Request) {
+	device, err := h.svc.GetBySerialNumber(r.Context(), pathParam(r, "serial"), r.URL.Query().Get("brand"))
+	writeIdentifiedDevice(w, r, device, err)
+}
+
+// GetDeviceByAssetTag godoc
+// @Summary Get a device by asset tag
+// @Description Get the device with an asset tag. Asset tags are unique within a brand, so brand is required when devices of several brands share it.
+// @Tags devices
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param tag path string true "Asset tag"
+// @Param brand query string false "Brand name or alias"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,name,state"
+// @Success 200 {object} api.DeviceDTO
+// @Failure 400 {object} api.ValidationErrorDTO "brand required or invalid fields"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/by-asset-tag/{tag} [get]
+func (h *Handler) GetDeviceByAssetTag(w http.ResponseWriter, r *http.Request) {
+	device, err := h.svc.GetByAssetTag(r.Context(), pathParam(r, "tag"), r.URL.Query().Get("brand"))
+	writeIdentifiedDevice(w, r, device, err)
+}
+
+func writeIdentifiedDevice(w http.ResponseWriter, r *http.Request, device *model.Device, err error) {
+	if writeValidationFailure(w, r, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if device == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeDevice(w, r, http.StatusOK, device)
+}
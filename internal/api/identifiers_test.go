@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+// duplicateRepo is a device store whose writes all hit a taken serial
+// number.
+type duplicateRepo struct {
+	service.DeviceStore
+	service.BrandStore
+	service.SchemaStore
+}
+
+func (duplicateRepo) BrandByKey(ctx context.Context, key string) (*model.Brand, error) {
+	return &model.Brand{ID: "b1", Name: "Acme"}, nil
+}
+
+func (duplicateRepo) BrandSchema(ctx context.Context, brand string) (*model.BrandSchema, error) {
+	return nil, nil
+}
+
+func (duplicateRepo) Create(ctx context.Context, d *model.Device) error {
+	return &model.DuplicateError{Field: "serial_number"}
+}
+
+var duplicateStores = service.Stores{Devices: duplicateRepo{}, Brands: duplicateRepo{}, Schemas: duplicateRepo{}}
+
+func TestCreateDevice_DuplicateIdentifier(t *testing.T) {
+	h := NewHandler(service.NewDeviceService(duplicateStores), nil)
+
+	body := `{"name":"Phone","brand":"Acme","state":"available","serial_number":" SN-1 "}`
+	rec := httptest.NewRecorder()
+	h.CreateDevice(rec, httptest.NewRequest(http.MethodPost, "/devices", strings.NewReader(body)))
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if !strings.Contains(rec.Body.String(), "serial_number already in use") {
+		t.Fatalf("expected the error to name the field, got %s", rec.Body.String())
+	}
+}
+
+func (duplicateRepo) CreateMany(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+	// The serial number is taken after it was checked, which fails an
+	// atomic batch as a whole.
+	if atomic {
+		return nil, &model.DuplicateError{Field: "serial_number"}
+	}
+	errs := make([]error, len(devices))
+	for i, d := range devices {
+		if d.SerialNumber != "" {
+			errs[i] = &model.DuplicateError{Field: "serial_number"}
+		}
+	}
+	return errs, nil
+}
+
+func TestBatchCreateDevices_DuplicateIdentifierFailsItsItem(t *testing.T) {
+	h := NewHandler(service.NewDeviceService(duplicateStores), nil)
+
+	body := `{"mode":"best_effort","items":[{"name":"Phone","brand":"Acme","state":"available","serial_number":"SN-1"},{"name":"Tablet","brand":"Acme","state":"available"}]}`
+	rec := httptest.NewRecorder()
+	h.BatchCreateDevices(rec, httptest.NewRequest(http.MethodPost, "/devices:batchCreate", strings.NewReader(body)))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp BatchResultDTO
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Results[0].Status != http.StatusConflict || resp.Results[0].Error != "serial_number already in use" {
+		t.Fatalf("expected the duplicate item to conflict, got %+v", resp.Results[0])
+	}
+	if resp.Results[1].Status != http.StatusCreated || resp.Results[1].Device == nil {
+		t.Fatalf("expected the other item to be created, got %+v", resp.Results[1])
+	}
+}
+
+func TestBatchCreateDevices_AtomicBatchConflictsAsAWhole(t *testing.T) {
+	h := NewHandler(service.NewDeviceService(duplicateStores), nil)
+
+	body := `{"mode":"atomic","items":[{"name":"Phone","brand":"Acme","state":"available","serial_number":"SN-1"}]}`
+	rec := httptest.NewRecorder()
+	h.BatchCreateDevices(rec, httptest.NewRequest(http.MethodPost, "/devices:batchCreate", strings.NewReader(body)))
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,367 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lucast-ruiz/devices-api/internal/service"
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// importChunkSize is the number of rows validated and written together.
+// Together with the streamed report it bounds the memory used by an import.
+const importChunkSize = 500
+
+// ImportLineDTO reports what happened to one line of an import.
+type ImportLineDTO struct {
+	Line   int    `json:"line"`
+	Status string `json:"status" enums:"created,updated,rejected"`
+	ID     string `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Fields lists the violations of each invalid field of a rejected line.
+	Fields map[string][]string `json:"fields,omitempty"`
+}
+
+// ImportSummaryDTO counts the lines of an import by outcome.
+type ImportSummaryDTO struct {
+	Accepted int `json:"accepted"`
+	Created  int `json:"created"`
+	Updated  int `json:"updated"`
+	Rejected int `json:"rejected"`
+}
+
+// ImportReportDTO is the response of an import. It is streamed, so a failure
+// after the first line was written is reported in Error.
+type ImportReportDTO struct {
+	DryRun  bool             `json:"dry_run"`
+	Lines   []ImportLineDTO  `json:"lines"`
+	Summary ImportSummaryDTO `json:"summary"`
+	Error   string           `json:"error,omitempty"`
+}
+
+// importRow is one parsed line of an import file. err is set when the line
+// could not be parsed.
+type importRow struct {
+	line int
+	dto  CreateDeviceDTO
+	err  error
+}
+
+// rowReader yields the rows of an import file. It returns io.EOF at the end
+// of the file; any other error aborts the import.
+type rowReader interface {
+	next() (importRow, error)
+}
+
+// ImportDevices godoc
+// @Summary Import devices
+// @Description Import devices from a CSV file (with a name,brand,state header and optional serial_number and asset_tag columns) or from NDJSON (one device object per line). Every row goes through the same validation as POST /devices and the report lists the outcome of each line. The file is processed in chunks, so it can be of any size.
+// @Tags devices
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param dry_run query bool false "Validate the rows without writing anything"
+// @Param upsert_by query string false "Comma-separated fields (name, brand, serial_number, asset_tag) that identify an existing device to update instead of creating a new one"
+// @Param file body string true "CSV or NDJSON content"
+// @Success 200 {object} api.ImportReportDTO
+// @Failure 400 {object} map[string]string "invalid file or options"
+// @Failure 415 {object} map[string]string "unsupported content type"
+// @Failure 500 {object} map[string]string "internal error"
+// @x-streaming true
+// @Router /devices/import [post]
+func (h *Handler) ImportDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	dryRun, err := strconv.ParseBool(query.Get("dry_run"))
+	if err != nil && query.Get("dry_run") != "" {
+		writeError(w, r, http.StatusBadRequest, "invalid dry_run value")
+		return
+	}
+
+	var upsertBy []string
+	if v := query.Get("upsert_by"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			upsertBy = append(upsertBy, strings.TrimSpace(field))
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var rows rowReader
+	switch mediaType {
+	case "text/csv":
+		rows, err = newCSVRowReader(r.Body)
+	case "application/x-ndjson":
+		rows = newNDJSONRowReader(r.Body)
+	default:
+		writeError(w, r, http.StatusUnsupportedMediaType, "content type must be text/csv or application/x-ndjson")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	imp, err := h.svc.StartImport(r.Context(), service.ImportOptions{DryRun: dryRun, UpsertBy: upsertBy})
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	report := newImportReportWriter(w, dryRun)
+	report.start()
+
+	var chunk []importRow
+	for {
+		row, err := rows.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			report.finish("failed to read file: " + err.Error())
+			return
+		}
+
+		chunk = append(chunk, row)
+		if len(chunk) == importChunkSize {
+			if err := h.importChunk(r, imp, chunk, report); err != nil {
+				report.finish("internal error")
+				return
+			}
+			chunk = chunk[:0]
+		}
+	}
+
+	if err := h.importChunk(r, imp, chunk, report); err != nil {
+		report.finish("internal error")
+		return
+	}
+	report.finish("")
+}
+
+// importChunk validates a chunk of rows, imports the valid ones and reports
+// every line in file order.
+func (h *Handler) importChunk(r *http.Request, imp *service.Import, chunk []importRow, report *importReportWriter) error {
+	lines := make([]ImportLineDTO, len(chunk))
+	var inputs []service.CreateInput
+	var accepted []int
+	for i, row := range chunk {
+		lines[i].Line = row.line
+
+		err := row.err
+		if err == nil {
+			err = validate.Struct(&chunk[i].dto)
+		}
+		if err != nil {
+			lines[i].Status = string(service.ImportRejected)
+			lines[i].Error = err.Error()
+			var errs validate.Errors
+			if errors.As(err, &errs) {
+				lines[i].Fields = errs
+			}
+			continue
+		}
+		dto := &chunk[i].dto
+		inputs = append(inputs, dto.input())
+		accepted = append(accepted, i)
+	}
+
+	if len(inputs) > 0 {
+		results, err := imp.Apply(r.Context(), inputs)
+		if err != nil {
+			return err
+		}
+
+		for j, res := range results {
+			line := &lines[accepted[j]]
+			line.Status = string(res.Action)
+			if res.Device != nil {
+				line.ID = res.Device.ID
+			}
+			if res.Err != nil {
+				line.Error = res.Err.Error()
+				var errs validate.Errors
+				if errors.As(res.Err, &errs) {
+					line.Fields = errs
+				}
+			}
+		}
+	}
+
+	for _, line := range lines {
+		report.line(line)
+	}
+	report.flush()
+
+	return nil
+}
+
+// importReportWriter streams an ImportReportDTO, one line at a time.
+type importReportWriter struct {
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	dryRun  bool
+	lines   int
+	summary ImportSummaryDTO
+}
+
+func newImportReportWriter(w http.ResponseWriter, dryRun bool) *importReportWriter {
+	return &importReportWriter{w: w, enc: json.NewEncoder(w), dryRun: dryRun}
+}
+
+func (rw *importReportWriter) start() {
+	rw.w.Header().Set("Content-Type", "application/json")
+	rw.w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(rw.w, `{"dry_run":%t,"lines":[`, rw.dryRun)
+}
+
+func (rw *importReportWriter) line(l ImportLineDTO) {
+	if rw.lines > 0 {
+		_, _ = io.WriteString(rw.w, ",")
+	}
+	rw.lines++
+	_ = rw.enc.Encode(l)
+
+	switch service.ImportAction(l.Status) {
+	case service.ImportCreated:
+		rw.summary.Accepted++
+		rw.summary.Created++
+	case service.ImportUpdated:
+		rw.summary.Accepted++
+		rw.summary.Updated++
+	default:
+		rw.summary.Rejected++
+	}
+}
+
+func (rw *importReportWriter) flush() {
+	if f, ok := rw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rw *importReportWriter) finish(errMsg string) {
+	_, _ = io.WriteString(rw.w, `],"summary":`)
+	_ = rw.enc.Encode(rw.summary)
+	if errMsg != "" {
+		_, _ = io.WriteString(rw.w, `,"error":`)
+		_ = rw.enc.Encode(errMsg)
+	}
+	_, _ = io.WriteString(rw.w, "}\n")
+}
+
+type csvRowReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+func newCSVRowReader(body io.Reader) (*csvRowReader, error) {
+	r := csv.NewReader(body)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	r.ReuseRecord = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, errors.New("invalid csv: missing header")
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "brand", "state"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("invalid csv: missing %q column", required)
+		}
+	}
+
+	return &csvRowReader{r: r, columns: columns}, nil
+}
+
+func (c *csvRowReader) next() (importRow, error) {
+	record, err := c.r.Read()
+	if err == io.EOF {
+		return importRow{}, io.EOF
+	}
+
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return importRow{line: parseErr.StartLine, err: fmt.Errorf("invalid csv: %w", parseErr.Err)}, nil
+	}
+	if err != nil {
+		return importRow{}, err
+	}
+
+	line, _ := c.r.FieldPos(0)
+	field := func(name string) string {
+		if i, ok := c.columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	return importRow{
+		line: line,
+		dto: CreateDeviceDTO{
+			Name:         field("name"),
+			Brand:        field("brand"),
+			State:        field("state"),
+			SerialNumber: field("serial_number"),
+			AssetTag:     field("asset_tag"),
+		},
+	}, nil
+}
+
+type ndjsonRowReader struct {
+	s    *bufio.Scanner
+	line int
+}
+
+// maxNDJSONLine bounds the size of a single NDJSON line.
+const maxNDJSONLine = 64 * 1024
+
+func newNDJSONRowReader(body io.Reader) *ndjsonRowReader {
+	s := bufio.NewScanner(body)
+	s.Buffer(make([]byte, 0, 4096), maxNDJSONLine)
+	return &ndjsonRowReader{s: s}
+}
+
+func (n *ndjsonRowReader) next() (importRow, error) {
+	for n.s.Scan() {
+		n.line++
+		data := bytes.TrimSpace(n.s.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		row := importRow{line: n.line}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&row.dto); err != nil {
+			row.err = errors.New("invalid json")
+			if name := unknownField(err); name != "" {
+				row.err = validate.Errors{name: {"is not a known field"}}
+			}
+		}
+		return row, nil
+	}
+
+	if err := n.s.Err(); err != nil {
+		return importRow{}, err
+	}
+	return importRow{}, io.EOF
+}
@@ -0,0 +1,81 @@
+package api
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func readAllRows(t *testing.T, rows rowReader) []importRow {
+	t.Helper()
+
+	var out []importRow
+	for {
+		row, err := rows.next()
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		out = append(out, row)
+	}
+}
+
+func TestCSVRowReader(t *testing.T) {
+	body := "state,name,brand\navailable,Phone,Acme\nin-use,\"Laptop, 14\"\"\",Globex\n"
+
+	rows, err := newCSVRowReader(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := readAllRows(t, rows)
+	if len(got) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(got))
+	}
+	if got[1].line != 3 || got[1].dto.Name != `Laptop, 14"` || got[1].dto.Brand != "Globex" || got[1].dto.State != "in-use" {
+		t.Fatalf("unexpected row: %+v", got[1])
+	}
+	if got[0].dto.SerialNumber != "" || got[0].dto.AssetTag != "" {
+		t.Fatalf("expected missing optional columns to be empty, got %+v", got[0])
+	}
+}
+
+func TestCSVRowReader_Identifiers(t *testing.T) {
+	body := "name,brand,state,asset_tag,serial_number\nPhone,Acme,available,A-1,SN-1\nTablet,Acme,available,,\n"
+
+	rows, err := newCSVRowReader(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := readAllRows(t, rows)
+	if got[0].dto.SerialNumber != "SN-1" || got[0].dto.AssetTag != "A-1" {
+		t.Fatalf("unexpected identifiers: %+v", got[0])
+	}
+	if got[1].dto.SerialNumber != "" || got[1].dto.AssetTag != "" {
+		t.Fatalf("expected empty identifiers, got %+v", got[1])
+	}
+}
+
+func TestCSVRowReader_RequiresColumns(t *testing.T) {
+	if _, err := newCSVRowReader(strings.NewReader("name,brand\nPhone,Acme\n")); err == nil {
+		t.Fatalf("expected error for missing state column")
+	}
+}
+
+func TestNDJSONRowReader(t *testing.T) {
+	body := `{"name":"Phone","brand":"Acme","state":"available"}` + "\n\n" + `{not json}` + "\n"
+
+	got := readAllRows(t, newNDJSONRowReader(strings.NewReader(body)))
+	if len(got) != 2 {
+		t.Fatalf("expected 2 rows, got %d", len(got))
+	}
+	if got[0].err != nil || got[0].dto.Name != "Phone" {
+		t.Fatalf("unexpected first row: %+v", got[0])
+	}
+	if got[1].line != 3 || got[1].err == nil {
+		t.Fatalf("expected line 3 to be rejected, got %+v", got[1])
+	}
+}
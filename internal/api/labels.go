@@ -0,0 +1,51 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// LabelsDTO represents the full label set of a device.
+type LabelsDTO struct {
+	Labels map[string]string `json:"labels"`
+}
+
+// SetDeviceLabels godoc
+// @Summary Replace the labels of a device
+// @Description Replace every label of a device. Keys are an optional DNS subdomain prefix and a slash, followed by a name of up to 63 alphanumerics, '-', '_' or '.'; values follow the same rules as names and may be empty. A device carries at most 64 labels.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Device ID"
+// @Param labels body api.LabelsDTO true "Labels of the device"
+// @Success 200 {object} api.DeviceDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body or labels"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/labels [put]
+func (h *Handler) SetDeviceLabels(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+
+	var req LabelsDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	device, err := h.svc.SetLabels(r.Context(), id, req.Labels)
+	if writeValidationFailure(w, r, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if device == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeDevice(w, r, http.StatusOK, device)
+}
@@ -0,0 +1,365 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+// LocationDTO is the location representation served by the API. ParentID
+// is null for sites, and Path holds the names from the site down to the
+// location itself.
+type LocationDTO struct {
+	ID        string    `json:"id"`
+	ParentID  *string   `json:"parent_id"`
+	Kind      string    `json:"kind" enums:"site,building,room,shelf"`
+	Name      string    `json:"name"`
+	Path      []string  `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SaveLocationDTO represents the payload to create or replace a location.
+// Sites have no parent; buildings are placed in sites, rooms in buildings
+// and shelves in rooms. The kind of an existing location cannot change.
+type SaveLocationDTO struct {
+	ParentID string `json:"parent_id,omitempty" validate:"trim"`
+	Kind     string `json:"kind" validate:"trim,lower,required,oneof=site building room shelf" enums:"site,building,room,shelf"`
+	Name     string `json:"name" validate:"trim,required,max=100,printable" maxLength:"100"`
+}
+
+// DeviceLocationDTO represents the payload to move a device. An empty or
+// null location_id clears its location. The note is kept in its history.
+type DeviceLocationDTO struct {
+	LocationID string `json:"location_id" validate:"trim"`
+	Note       string `json:"note,omitempty" validate:"trim,max=500" maxLength:"500"`
+}
+
+// DeviceMoveDTO is a move in the location history of a device. Locations
+// are null when the device had none, or the location was deleted since.
+type DeviceMoveDTO struct {
+	ID             string    `json:"id"`
+	FromLocationID *string   `json:"from_location_id"`
+	ToLocationID   *string   `json:"to_location_id"`
+	Note           string    `json:"note"`
+	MovedAt        time.Time `json:"moved_at"`
+}
+
+func toLocationDTO(l *model.Location) LocationDTO {
+	path := l.Path
+	if path == nil {
+		path = []string{}
+	}
+	return LocationDTO{
+		ID:        l.ID,
+		ParentID:  optional(l.ParentID),
+		Kind:      string(l.Kind),
+		Name:      l.Name,
+		Path:      path,
+		CreatedAt: l.CreatedAt,
+		UpdatedAt: l.UpdatedAt,
+	}
+}
+
+// readLocation reads and validates a SaveLocationDTO. It writes the error
+// response and returns false if the body is invalid.
+func readLocation(w http.ResponseWriter, r *http.Request) (service.LocationInput, bool) {
+	var req SaveLocationDTO
+	if !readJSON(w, r, &req) {
+		return service.LocationInput{}, false
+	}
+	return service.LocationInput{ParentID: req.ParentID, Kind: req.Kind, Name: req.Name}, true
+}
+
+// ListLocations godoc
+// @Summary List locations
+// @Description List locations by name, optionally only the children of a location or those of one kind.
+// @Tags locations
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param parent_id query string false "Only the locations placed in this location"
+// @Param kind query string false "Only the locations of this kind" Enums(site, building, room, shelf)
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.LocationDTO
+// @Failure 400 {object} map[string]string "invalid kind"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /locations [get]
+func (h *Handler) ListLocations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	locations, err := h.svc.ListLocations(r.Context(), query.Get("parent_id"), query.Get("kind"), limit, offset)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := make([]LocationDTO, len(locations))
+	for i := range locations {
+		out[i] = toLocationDTO(&locations[i])
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+// GetLocation godoc
+// @Summary Get a location
+// @Description Get a location by ID, with its path from the site down
+// @Tags locations
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Location ID"
+// @Success 200 {object} api.LocationDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /locations/{id} [get]
+func (h *Handler) GetLocation(w http.ResponseWriter, r *http.Request) {
+	l, err := h.svc.GetLocation(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if l == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toLocationDTO(l))
+}
+
+// CreateLocation godoc
+// @Summary Create a location
+// @Description Add a site, or a building, room or shelf placed in a location of the level above. Names are unique among the children of a location.
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param location body api.SaveLocationDTO true "Location to create"
+// @Success 201 {object} api.LocationDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body, unknown parent or parent of the wrong kind"
+// @Failure 409 {object} map[string]string "parent already has a location with this name"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /locations [post]
+func (h *Handler) CreateLocation(w http.ResponseWriter, r *http.Request) {
+	in, ok := readLocation(w, r)
+	if !ok {
+		return
+	}
+
+	l, err := h.svc.CreateLocation(r.Context(), in)
+	if writeLocationError(w, r, err) {
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, toLocationDTO(l))
+}
+
+// UpdateLocation godoc
+// @Summary Replace a location
+// @Description Rename a location or move it, with everything under it, to another parent of the level above. The kind cannot change.
+// @Tags locations
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Location ID"
+// @Param location body api.SaveLocationDTO true "Fields of the location"
+// @Success 200 {object} api.LocationDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body, unknown parent or parent of the wrong kind"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "parent already has a location with this name"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /locations/{id} [put]
+func (h *Handler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
+	in, ok := readLocation(w, r)
+	if !ok {
+		return
+	}
+
+	l, err := h.svc.UpdateLocation(r.Context(), chi.URLParam(r, "id"), in)
+	if writeLocationError(w, r, err) {
+		return
+	}
+	if l == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toLocationDTO(l))
+}
+
+// DeleteLocation godoc
+// @Summary Delete a location
+// @Description Remove a location. Locations that still hold other locations or devices cannot be deleted.
+// @Tags locations
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Location ID"
+// @Success 204 "no content"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "location has locations or devices"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /locations/{id} [delete]
+func (h *Handler) DeleteLocation(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.svc.DeleteLocation(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if strings.Contains(err.Error(), "cannot ") {
+			writeError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !deleted {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListLocationDevices godoc
+// @Summary List the devices in a location
+// @Description List the devices kept in a location, newest first. With recursive=true it also lists those kept anywhere under it, such as every shelf of a site.
+// @Tags locations
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Location ID"
+// @Param recursive query bool false "Include the devices of the whole subtree"
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.DeviceDTO
+// @Failure 400 {object} map[string]string "invalid recursive"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /locations/{id}/devices [get]
+func (h *Handler) ListLocationDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	recursive, err := strconv.ParseBool(query.Get("recursive"))
+	if err != nil && query.Get("recursive") != "" {
+		writeError(w, r, http.StatusBadRequest, "invalid recursive value")
+		return
+	}
+
+	devices, err := h.svc.LocationDevices(r.Context(), chi.URLParam(r, "id"), recursive, limit, offset)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if devices == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeDevices(w, r, http.StatusOK, devices)
+}
+
+// MoveDevice godoc
+// @Summary Move a device
+// @Description Place a device in a location, or clear its location with an empty or null location_id. Every move is recorded in the device's history; moving a device to where it already is records nothing.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Device ID"
+// @Param location body api.DeviceLocationDTO true "Location of the device"
+// @Success 200 {object} api.DeviceDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body or unknown location"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/location [put]
+func (h *Handler) MoveDevice(w http.ResponseWriter, r *http.Request) {
+	var req DeviceLocationDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	device, err := h.svc.MoveDevice(r.Context(), chi.URLParam(r, "id"), req.LocationID, req.Note)
+	if writeValidationFailure(w, r, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if device == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeDevice(w, r, http.StatusOK, device)
+}
+
+// ListDeviceMoves godoc
+// @Summary List the moves of a device
+// @Description List the location history of a device, the most recent move first.
+// @Tags devices
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Device ID"
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.DeviceMoveDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/moves [get]
+func (h *Handler) ListDeviceMoves(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	moves, err := h.svc.DeviceMoves(r.Context(), chi.URLParam(r, "id"), limit, offset)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if moves == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	out := make([]DeviceMoveDTO, len(moves))
+	for i, m := range moves {
+		out[i] = DeviceMoveDTO{
+			ID:             m.ID,
+			FromLocationID: optional(m.FromLocationID),
+			ToLocationID:   optional(m.ToLocationID),
+			Note:           m.Note,
+			MovedAt:        m.MovedAt,
+		}
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+// writeLocationError writes the response for an error returned when saving
+// a location. It returns false, writing nothing, if err is nil.
+func writeLocationError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case writeValidationFailure(w, r, err), writeDuplicate(w, r, err):
+	case strings.Contains(err.Error(), "cannot "), strings.Contains(err.Error(), "required"):
+		writeError(w, r, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+	return true
+}
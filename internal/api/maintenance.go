@@ -0,0 +1,264 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+// OpenMaintenanceDTO represents the payload to open a maintenance record.
+type OpenMaintenanceDTO struct {
+	Diagnosis string `json:"diagnosis,omitempty" validate:"trim,max=2000" maxLength:"2000"`
+}
+
+// CloseMaintenanceDTO represents the payload to close a maintenance record.
+// A diagnosis replaces the one given when the record was opened. The cost is
+// in the smallest unit of the currency, such as cents.
+type CloseMaintenanceDTO struct {
+	Diagnosis  *string `json:"diagnosis,omitempty" validate:"trim,max=2000" maxLength:"2000"`
+	Resolution string  `json:"resolution" validate:"trim,required,max=2000" maxLength:"2000"`
+	CostCents  *int64  `json:"cost_cents,omitempty" minimum:"0"`
+}
+
+// MaintenanceDTO is a maintenance record of a device. ClosedAt is null while
+// the record is open, and CostCents while the cost is unknown.
+type MaintenanceDTO struct {
+	ID            string     `json:"id"`
+	DeviceID      string     `json:"device_id"`
+	Brand         string     `json:"brand"`
+	Diagnosis     string     `json:"diagnosis"`
+	Resolution    string     `json:"resolution"`
+	CostCents     *int64     `json:"cost_cents"`
+	PreviousState string     `json:"previous_state" enums:"available,in-use,inactive"`
+	OpenedAt      time.Time  `json:"opened_at"`
+	ClosedAt      *time.Time `json:"closed_at"`
+	Open          bool       `json:"open"`
+}
+
+// RepairTimeDTO summarizes the repairs of the devices of a brand.
+type RepairTimeDTO struct {
+	BrandID               string  `json:"brand_id"`
+	Brand                 string  `json:"brand"`
+	Repairs               int     `json:"repairs"`
+	MeanTimeToRepairHours float64 `json:"mean_time_to_repair_hours"`
+	CostCents             int64   `json:"cost_cents"`
+}
+
+func toMaintenanceDTO(rec *model.MaintenanceRecord) MaintenanceDTO {
+	return MaintenanceDTO{
+		ID:            rec.ID,
+		DeviceID:      rec.DeviceID,
+		Brand:         rec.Brand,
+		Diagnosis:     rec.Diagnosis,
+		Resolution:    rec.Resolution,
+		CostCents:     rec.CostCents,
+		PreviousState: string(rec.PreviousState),
+		OpenedAt:      rec.OpenedAt,
+		ClosedAt:      rec.ClosedAt,
+		Open:          rec.ClosedAt == nil,
+	}
+}
+
+func writeMaintenanceRecords(w http.ResponseWriter, r *http.Request, records []model.MaintenanceRecord) {
+	out := make([]MaintenanceDTO, len(records))
+	for i := range records {
+		out[i] = toMaintenanceDTO(&records[i])
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+// ListDeviceMaintenance godoc
+// @Summary List the maintenance records of a device
+// @Description List the maintenance history of a device, the most recently opened first.
+// @Tags devices
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Device ID"
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.MaintenanceDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/maintenance [get]
+func (h *Handler) ListDeviceMaintenance(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	records, err := h.svc.DeviceMaintenance(r.Context(), chi.URLParam(r, "id"), limit, offset)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if records == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeMaintenanceRecords(w, r, records)
+}
+
+// OpenDeviceMaintenance godoc
+// @Summary Open a maintenance record
+// @Description Open a maintenance record for a device, now, and take the device out of service by making it inactive. The state it had is restored when the record is closed. A device has at most one open record.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Device ID"
+// @Param maintenance body api.OpenMaintenanceDTO true "Diagnosis so far"
+// @Success 201 {object} api.MaintenanceDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "device already has an open maintenance record"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/maintenance [post]
+func (h *Handler) OpenDeviceMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req OpenMaintenanceDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	rec, err := h.svc.OpenMaintenance(r.Context(), chi.URLParam(r, "id"), req.Diagnosis)
+	if writeMaintenanceError(w, r, err) {
+		return
+	}
+	if rec == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, toMaintenanceDTO(rec))
+}
+
+// CloseDeviceMaintenance godoc
+// @Summary Close the maintenance record of a device
+// @Description Close the open maintenance record of a device, now, with the outcome of the repair, and put the device back in the state it had when the record was opened. A device whose state was changed during the repair keeps it.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Device ID"
+// @Param maintenance body api.CloseMaintenanceDTO true "Outcome of the repair"
+// @Success 200 {object} api.MaintenanceDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body or negative cost"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "device has no open maintenance record"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/maintenance:close [post]
+func (h *Handler) CloseDeviceMaintenance(w http.ResponseWriter, r *http.Request) {
+	var req CloseMaintenanceDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	rec, err := h.svc.CloseMaintenance(r.Context(), chi.URLParam(r, "id"), service.CloseMaintenanceInput{
+		Diagnosis:  req.Diagnosis,
+		Resolution: req.Resolution,
+		CostCents:  req.CostCents,
+	})
+	if writeMaintenanceError(w, r, err) {
+		return
+	}
+	if rec == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toMaintenanceDTO(rec))
+}
+
+// ListOpenMaintenance godoc
+// @Summary List open maintenance records
+// @Description List the devices under repair, by their open maintenance records, the most recently opened first, optionally of one brand.
+// @Tags maintenance
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param brand query string false "Only the records of devices of this brand, by name or alias"
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.MaintenanceDTO
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /maintenance [get]
+func (h *Handler) ListOpenMaintenance(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	records, err := h.svc.OpenMaintenanceRecords(r.Context(), query.Get("brand"), limit, offset)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeMaintenanceRecords(w, r, records)
+}
+
+// RepairTimeReport godoc
+// @Summary Report mean time to repair
+// @Description Report, per brand, the maintenance records closed in the period from from to to, their mean time from opening to closing and their total known cost, by brand name.
+// @Tags reports
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param brand query string false "Only this brand, by name or alias"
+// @Param from query string false "Only records closed at or after this time (RFC 3339)"
+// @Param to query string false "Only records closed before this time (RFC 3339)"
+// @Success 200 {array} api.RepairTimeDTO
+// @Failure 400 {object} map[string]string "invalid from or to"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /reports/mttr [get]
+func (h *Handler) RepairTimeReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := parsePeriod(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	times, err := h.svc.RepairTimes(r.Context(), query.Get("brand"), from, to)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := make([]RepairTimeDTO, len(times))
+	for i, t := range times {
+		out[i] = RepairTimeDTO{
+			BrandID:               t.BrandID,
+			Brand:                 t.Brand,
+			Repairs:               t.Repairs,
+			MeanTimeToRepairHours: t.MeanTimeToRepair.Hours(),
+			CostCents:             t.CostCents,
+		}
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+// writeMaintenanceError writes the response for an error returned when
+// opening or closing a maintenance record. It returns false, writing
+// nothing, if err is nil.
+func writeMaintenanceError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case writeValidationFailure(w, r, err):
+	case errors.Is(err, model.ErrUnderMaintenance), errors.Is(err, service.ErrNotUnderMaintenance):
+		writeError(w, r, http.StatusConflict, err.Error())
+	default:
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+	return true
+}
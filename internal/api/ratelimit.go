@@ -0,0 +1,81 @@
+package api
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/auth"
+	"github.com/lucast-ruiz/devices-api/internal/ratelimit"
+)
+
+// RateLimitConfig holds the separate budgets for reads and writes.
+type RateLimitConfig struct {
+	Read  ratelimit.Limit
+	Write ratelimit.Limit
+}
+
+// RateLimit rejects clients that exceed their budget with 429. Clients are
+// identified by the subject of the authenticated principal, or else by the
+// remote IP.
+// Every response carries the RateLimit-* headers of the budget it used.
+func RateLimit(store ratelimit.Store, cfg RateLimitConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			budget, limit := "write", cfg.Write
+			if isReadMethod(r.Method) {
+				budget, limit = "read", cfg.Read
+			}
+
+			res, err := store.Allow(r.Context(), budget+":"+clientKey(r), limit)
+			if err != nil {
+				// Fail open: an unavailable store must not take the API down.
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+			if !res.Allowed {
+				h.Set("Retry-After", strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				writeError(w, r, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func isReadMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// clientKey identifies the client of r. Credentials the authentication
+// layer has not verified, such as a raw API key header, are not used, since
+// a client could pick a new one for every request to get a fresh budget.
+func clientKey(r *http.Request) string {
+	if p, ok := auth.PrincipalFrom(r.Context()); ok && p.Subject != "" {
+		return "sub:" + p.Subject
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucast-ruiz/devices-api/internal/auth"
+	"github.com/lucast-ruiz/devices-api/internal/ratelimit"
+)
+
+func TestRateLimit_SeparateReadAndWriteBudgets(t *testing.T) {
+	cfg := RateLimitConfig{
+		Read:  ratelimit.Limit{Rate: 0.001, Burst: 1},
+		Write: ratelimit.Limit{Rate: 0.001, Burst: 1},
+	}
+	h := RateLimit(ratelimit.NewMemoryStore(), cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	do := func(method, subject string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/devices", nil)
+		req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{Subject: subject}))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "k1"); rec.Code != http.StatusOK {
+		t.Fatalf("first read: expected 200, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "k1"); rec.Code != http.StatusOK {
+		t.Fatalf("first write: expected 200, got %d", rec.Code)
+	}
+
+	rec := do(http.MethodGet, "k1")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("second read: expected 429, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header")
+	}
+	if got := rec.Header().Get("RateLimit-Remaining"); got != "0" {
+		t.Fatalf("expected RateLimit-Remaining 0, got %q", got)
+	}
+
+	if rec := do(http.MethodGet, "k2"); rec.Code != http.StatusOK {
+		t.Fatalf("other client: expected 200, got %d", rec.Code)
+	}
+}
+
+func TestRateLimit_IgnoresUnverifiedAPIKeys(t *testing.T) {
+	cfg := RateLimitConfig{
+		Read:  ratelimit.Limit{Rate: 0.001, Burst: 1},
+		Write: ratelimit.Limit{Rate: 0.001, Burst: 1},
+	}
+	h := RateLimit(ratelimit.NewMemoryStore(), cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	codes := make([]int, 2)
+	for i, key := range []string{"k1", "k2"} {
+		req := httptest.NewRequest(http.MethodGet, "/devices", nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		codes[i] = rec.Code
+	}
+
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Fatalf("expected a new key from the same address to share its budget, got %v", codes)
+	}
+}
+
+func TestRateLimit_LimitsAuthenticatedSubjects(t *testing.T) {
+	cfg := RateLimitConfig{
+		Read:  ratelimit.Limit{Rate: 0.001, Burst: 1},
+		Write: ratelimit.Limit{Rate: 0.001, Burst: 1},
+	}
+	keys := auth.Keys{"k1": {Subject: "ci-bot", TenantID: "acme"}, "k2": {Subject: "importer", TenantID: "acme"}}
+	h := Authenticate(keys)(RateLimit(ratelimit.NewMemoryStore(), cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})))
+
+	// Every request comes from the address httptest gives them.
+	do := func(header, value string) int {
+		req := httptest.NewRequest(http.MethodGet, "/devices", nil)
+		req.Header.Set(header, value)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := do(apiKeyHeader, "k1"); code != http.StatusOK {
+		t.Fatalf("first request of ci-bot: expected 200, got %d", code)
+	}
+	if code := do(apiKeyHeader, "k1"); code != http.StatusTooManyRequests {
+		t.Fatalf("second request of ci-bot: expected 429, got %d", code)
+	}
+	if code := do(apiKeyHeader, "k2"); code != http.StatusOK {
+		t.Fatalf("importer behind the same address: expected 200, got %d", code)
+	}
+
+	// Bearer tokens are not verified, so their clients share the budget of
+	// their address whatever the token says.
+	if code := do("Authorization", "Bearer a"); code != http.StatusOK {
+		t.Fatalf("first bearer token: expected 200, got %d", code)
+	}
+	if code := do("Authorization", "Bearer b"); code != http.StatusTooManyRequests {
+		t.Fatalf("second bearer token: expected 429, got %d", code)
+	}
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+// ReserveDeviceDTO represents the payload to reserve a device for a period.
+// The period includes starts_at and excludes ends_at, so back-to-back
+// reservations do not overlap.
+type ReserveDeviceDTO struct {
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	HolderID string    `json:"holder_id,omitempty" validate:"trim"`
+	Note     string    `json:"note,omitempty" validate:"trim,max=500" maxLength:"500"`
+}
+
+// ReservationDTO is a reservation of a device. Status is scheduled until the
+// period starts, active during it and completed after it. HolderID is null
+// when the reservation is for no holder in particular.
+type ReservationDTO struct {
+	ID        string    `json:"id"`
+	DeviceID  string    `json:"device_id"`
+	HolderID  *string   `json:"holder_id"`
+	Note      string    `json:"note"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Status    string    `json:"status" enums:"scheduled,active,completed"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func toReservationDTO(res *model.Reservation) ReservationDTO {
+	return ReservationDTO{
+		ID:        res.ID,
+		DeviceID:  res.DeviceID,
+		HolderID:  optional(res.HolderID),
+		Note:      res.Note,
+		StartsAt:  res.StartsAt,
+		EndsAt:    res.EndsAt,
+		Status:    string(res.Status),
+		CreatedAt: res.CreatedAt,
+	}
+}
+
+// parsePeriod parses the optional RFC 3339 from and to query parameters. A
+// missing parameter is the zero time.
+func parsePeriod(query url.Values) (from, to time.Time, err error) {
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		value := query.Get(p.name)
+		if value == "" {
+			continue
+		}
+		if *p.t, err = time.Parse(time.RFC3339, value); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid %s value: must be an RFC 3339 time", p.name)
+		}
+	}
+	return from, to, nil
+}
+
+// ListDeviceReservations godoc
+// @Summary List the reservations of a device
+// @Description List the reservations of a device in order of start, optionally only those overlapping the period from from to to.
+// @Tags devices
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Device ID"
+// @Param from query string false "Only reservations ending after this time (RFC 3339)"
+// @Param to query string false "Only reservations starting before this time (RFC 3339)"
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.ReservationDTO
+// @Failure 400 {object} map[string]string "invalid from or to"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/reservations [get]
+func (h *Handler) ListDeviceReservations(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := parsePeriod(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	reservations, err := h.svc.DeviceReservations(r.Context(), chi.URLParam(r, "id"), from, to, limit, offset)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if reservations == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	out := make([]ReservationDTO, len(reservations))
+	for i := range reservations {
+		out[i] = toReservationDTO(&reservations[i])
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+// ReserveDevice godoc
+// @Summary Reserve a device
+// @Description Book a device for a period, optionally for a holder. Reservations of a device cannot overlap, which the database enforces with an exclusion constraint. When the period starts the device is put in use if it is available, and when it ends it is made available again unless it has been assigned. Inactive devices cannot be reserved.
+// @Tags devices
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Device ID"
+// @Param reservation body api.ReserveDeviceDTO true "Period to reserve"
+// @Success 201 {object} api.ReservationDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body or period, unknown holder or inactive device"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "period overlaps another reservation"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/reservations [post]
+func (h *Handler) ReserveDevice(w http.ResponseWriter, r *http.Request) {
+	var req ReserveDeviceDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	res, err := h.svc.Reserve(r.Context(), chi.URLParam(r, "id"), service.ReservationInput{
+		HolderID: req.HolderID,
+		Note:     req.Note,
+		StartsAt: req.StartsAt,
+		EndsAt:   req.EndsAt,
+	})
+	if writeReservationError(w, r, err) {
+		return
+	}
+	if res == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, toReservationDTO(res))
+}
+
+// CancelDeviceReservation godoc
+// @Summary Cancel a reservation
+// @Description Remove a reservation of a device that has not started.
+// @Tags devices
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Device ID"
+// @Param reservationId path string true "Reservation ID"
+// @Success 204 "no content"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "reservation has started"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/reservations/{reservationId} [delete]
+func (h *Handler) CancelDeviceReservation(w http.ResponseWriter, r *http.Request) {
+	deleted, err := h.svc.CancelReservation(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "reservationId"))
+	if err != nil {
+		if strings.Contains(err.Error(), "cannot ") {
+			writeError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !deleted {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListAvailableDevices godoc
+// @Summary List available devices
+// @Description List the devices that are free for the whole period from from to to, newest first: they are not inactive, not assigned and not reserved for any part of it. The brand, state, selector and attribute filters of GET /devices apply.
+// @Tags devices
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param from query string true "Start of the period (RFC 3339)"
+// @Param to query string true "End of the period (RFC 3339)"
+// @Param brand query string false "Filter by brand"
+// @Param state query string false "Filter by state"
+// @Param selector query string false "Label selector, e.g. env=prod,team in (a,b),!deprecated"
+// @Param attr.name query string false "Attribute filter: attr.<name>=<value>"
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.DeviceDTO
+// @Failure 400 {object} map[string]string "missing or invalid period, or invalid filter"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/availability [get]
+func (h *Handler) ListAvailableDevices(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := parseDeviceFilter(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	from, to, err := parsePeriod(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	devices, err := h.svc.Availability(r.Context(), filter, from, to, limit, offset)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid") || strings.Contains(err.Error(), "required") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeDevices(w, r, http.StatusOK, devices)
+}
+
+// writeReservationError writes the response for an error returned when
+// reserving a device. It returns false, writing nothing, if err is nil.
+func writeReservationError(w http.ResponseWriter, r *http.Request, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case writeValidationFailure(w, r, err):
+	case errors.Is(err, model.ErrReservationConflict):
+		writeError(w, r, http.StatusConflict, err.Error())
+	case strings.Contains(err.Error(), "cannot "):
+		writeError(w, r, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+// availabilityRepo is a service.ReservationStore that records the period it is
+// asked for availability over.
+type availabilityRepo struct {
+	service.ReservationStore
+	from, to time.Time
+}
+
+func (r *availabilityRepo) Available(ctx context.Context, filter model.DeviceFilter, from, to time.Time, limit, offset int) ([]model.Device, error) {
+	r.from, r.to = from, to
+	return []model.Device{{ID: "1", Name: "Phone", Brand: "Apple", State: model.StateAvailable, CreatedAt: time.Now()}}, nil
+}
+
+func TestListAvailableDevices(t *testing.T) {
+	repo := &availabilityRepo{}
+	routes := NewHandler(service.NewDeviceService(service.Stores{Reservations: repo}), nil).Routes()
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = withTenant(req, "acme")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/devices/availability?from=2026-03-02T09:00:00Z&to=2026-03-02T17:00:00Z")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if want := time.Date(2026, time.March, 2, 17, 0, 0, 0, time.UTC); !repo.to.Equal(want) {
+		t.Fatalf("expected the period to end at %v, got %v", want, repo.to)
+	}
+
+	for _, target := range []string{
+		"/devices/availability",
+		"/devices/availability?from=2026-03-02&to=2026-03-03",
+		"/devices/availability?from=2026-03-02T17:00:00Z&to=2026-03-02T09:00:00Z",
+	} {
+		if rec := get(target); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d: %s", target, rec.Code, rec.Body.String())
+		}
+	}
+}
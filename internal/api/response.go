@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// DeviceDTO is the device representation served by the API. It is mapped
+// explicitly from model.Device so that internal fields do not leak into
+// responses. Every version currently shares it; a version that needs a
+// different shape gets its own DTO and mapping function.
+type DeviceDTO struct {
+	ID         string            `json:"id"`
+	Name       string            `json:"name"`
+	Brand      string            `json:"brand"`
+	BrandID    string            `json:"brand_id"`
+	ModelID    *string           `json:"model_id"`
+	LocationID *string           `json:"location_id"`
+	ParentID   *string           `json:"parent_id"`
+	State      string            `json:"state" enums:"available,in-use,inactive"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	Labels     map[string]string `json:"labels"`
+	// SerialNumber and AssetTag are null when the device has none.
+	SerialNumber *string `json:"serial_number"`
+	AssetTag     *string `json:"asset_tag"`
+	// Attributes hold brand-specific metadata; see the brand's schema.
+	Attributes map[string]any `json:"attributes"`
+	// AgeDays is the number of whole days since the device was created.
+	AgeDays int      `json:"age_days"`
+	Links   LinksDTO `json:"links"`
+}
+
+// LinksDTO holds the hypermedia links of a resource.
+type LinksDTO struct {
+	Self string `json:"self"`
+}
+
+// deviceFields are the names accepted by the fields query parameter.
+var deviceFields = map[string]bool{
+	"id": true, "name": true, "brand": true, "brand_id": true, "model_id": true, "location_id": true,
+	"parent_id": true, "serial_number": true, "asset_tag": true, "state": true, "created_at": true,
+	"updated_at": true, "labels": true, "attributes": true, "age_days": true, "links": true,
+}
+
+func toDeviceDTO(r *http.Request, d *model.Device) DeviceDTO {
+	labels := d.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	attributes := d.Attributes
+	if attributes == nil {
+		attributes = map[string]any{}
+	}
+
+	return DeviceDTO{
+		ID:           d.ID,
+		Name:         d.Name,
+		Brand:        d.Brand,
+		BrandID:      d.BrandID,
+		ModelID:      optional(d.ModelID),
+		LocationID:   optional(d.LocationID),
+		ParentID:     optional(d.ParentID),
+		State:        string(d.State),
+		CreatedAt:    d.CreatedAt,
+		UpdatedAt:    d.UpdatedAt,
+		Labels:       labels,
+		SerialNumber: optional(d.SerialNumber),
+		AssetTag:     optional(d.AssetTag),
+		Attributes:   attributes,
+		AgeDays:      int(time.Since(d.CreatedAt).Hours() / 24),
+		Links:        LinksDTO{Self: versionPrefix(r) + "/devices/" + d.ID},
+	}
+}
+
+// optional represents an empty string as null.
+func optional(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// deref reads null as an empty string.
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func toDeviceDTOs(r *http.Request, devices []model.Device) []DeviceDTO {
+	out := make([]DeviceDTO, len(devices))
+	for i := range devices {
+		out[i] = toDeviceDTO(r, &devices[i])
+	}
+	return out
+}
+
+// versionPrefix is the path prefix of the API version serving r. Links from
+// the deprecated unversioned routes point to v1.
+func versionPrefix(r *http.Request) string {
+	return fmt.Sprintf("/api/v%d", apiVersion(r))
+}
+
+// parseFields parses the fields query parameter. A nil result means that
+// every field is requested.
+func parseFields(r *http.Request) ([]string, error) {
+	v := r.URL.Query().Get("fields")
+	if v == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	for _, f := range strings.Split(v, ",") {
+		f = strings.TrimSpace(f)
+		if !deviceFields[f] {
+			return nil, fmt.Errorf("invalid fields value: unknown field %q", f)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// sparse keeps only the given fields of a JSON object. It returns v
+// unchanged when fields is nil.
+func sparse(v any, fields []string) any {
+	if fields == nil {
+		return v
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return v
+	}
+
+	out := make(map[string]json.RawMessage, len(fields))
+	for _, f := range fields {
+		if value, ok := all[f]; ok {
+			out[f] = value
+		}
+	}
+	return out
+}
+
+// writeDevice writes a single device, honoring the fields query parameter.
+func writeDevice(w http.ResponseWriter, r *http.Request, status int, d *model.Device) {
+	fields, err := parseFields(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, r, status, sparse(toDeviceDTO(r, d), fields))
+}
+
+// writeDevices writes a list of devices, honoring the fields query
+// parameter.
+func writeDevices(w http.ResponseWriter, r *http.Request, status int, devices []model.Device) {
+	fields, err := parseFields(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	dtos := toDeviceDTOs(r, devices)
+	if fields == nil {
+		writeJSON(w, r, status, dtos)
+		return
+	}
+
+	out := make([]any, len(dtos))
+	for i := range dtos {
+		out[i] = sparse(dtos[i], fields)
+	}
+	writeJSON(w, r, status, out)
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+func TestToDeviceDTO(t *testing.T) {
+	d := &model.Device{
+		ID:        "1",
+		TenantID:  "tenant-a",
+		Name:      "Phone",
+		Brand:     "Acme",
+		State:     model.StateAvailable,
+		CreatedAt: time.Now().Add(-72*time.Hour - time.Minute),
+		UpdatedAt: time.Now(),
+	}
+
+	dto := toDeviceDTO(httptest.NewRequest(http.MethodGet, "/devices/1", nil), d)
+	if dto.AgeDays != 3 {
+		t.Fatalf("expected age_days 3, got %d", dto.AgeDays)
+	}
+	if dto.Links.Self != "/api/v1/devices/1" {
+		t.Fatalf("unexpected self link %q", dto.Links.Self)
+	}
+
+	data, _ := json.Marshal(dto)
+	var out map[string]any
+	_ = json.Unmarshal(data, &out)
+	if _, ok := out["tenant_id"]; ok {
+		t.Fatalf("tenant_id must not be exposed: %s", data)
+	}
+
+	var self string
+	Version(2)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		self = toDeviceDTO(r, d).Links.Self
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v2/devices/1", nil))
+	if self != "/api/v2/devices/1" {
+		t.Fatalf("unexpected v2 self link %q", self)
+	}
+}
+
+func TestWriteDevice_SparseFields(t *testing.T) {
+	d := &model.Device{ID: "1", Name: "Phone", Brand: "Acme", State: model.StateInUse}
+
+	rec := httptest.NewRecorder()
+	writeDevice(rec, httptest.NewRequest(http.MethodGet, "/devices/1?fields=id,state", nil), http.StatusOK, d)
+
+	var out map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if len(out) != 2 || out["id"] != "1" || out["state"] != "in-use" {
+		t.Fatalf("unexpected sparse response %v", out)
+	}
+
+	rec = httptest.NewRecorder()
+	writeDevices(rec, httptest.NewRequest(http.MethodGet, "/devices?fields=id,serial", nil), http.StatusOK, []model.Device{*d})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown field, got %d", rec.Code)
+	}
+}
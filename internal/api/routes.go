@@ -1,17 +1,105 @@
 package api
 
-import "github.com/go-chi/chi/v5"
+import (
+    "time"
+
+    "github.com/go-chi/chi/v5"
+    "github.com/go-chi/chi/v5/middleware"
+)
+
+// requestTimeout bounds every route except the streaming ones.
+const requestTimeout = 60 * time.Second
 
 
 func (h *Handler) Routes() *chi.Mux {
     r := chi.NewRouter()
+    r.Use(resolveTenant)
+
+    // Imports and exports stream arbitrarily large files, so they are bound
+    // to the client connection instead of the request timeout, and are not
+    // buffered for idempotent replay. Imports with upsert_by can be retried
+    // safely as they are.
+    r.Post("/devices/import", h.ImportDevices)
+    r.Get("/devices/export", h.ExportDevices)
+
+    r.Group(func(r chi.Router) {
+        r.Use(middleware.Timeout(requestTimeout))
+        r.Use(limitBody)
+        r.Use(h.idempotent)
+
+        r.Post("/devices", h.CreateDevice)
+        r.Post("/devices:batchCreate", h.BatchCreateDevices)
+        r.Patch("/devices:batchUpdate", h.BatchUpdateDevices)
+        r.Post("/devices:batchDelete", h.BatchDeleteDevices)
+        r.Get("/devices/{id}", h.GetDeviceByID)
+        r.Get("/devices/by-serial/{serial}", h.GetDeviceBySerialNumber)
+        r.Get("/devices/by-asset-tag/{tag}", h.GetDeviceByAssetTag)
+        r.Get("/devices/availability", h.ListAvailableDevices)
+        r.Get("/devices/stats", h.DeviceStats)
+        r.Get("/devices", h.ListDevices)
+        r.Put("/devices/{id}", h.ReplaceDevice)
+        r.Patch("/devices/{id}", h.UpdateDevice)
+        r.Put("/devices/{id}/labels", h.SetDeviceLabels)
+        r.Put("/devices/{id}/model", h.SetDeviceModel)
+        r.Put("/devices/{id}/location", h.MoveDevice)
+        r.Get("/devices/{id}/moves", h.ListDeviceMoves)
+        r.Put("/devices/{id}/parent", h.SetDeviceParent)
+        r.Get("/devices/{id}/children", h.ListDeviceChildren)
+        r.Get("/devices/{id}/ancestors", h.ListDeviceAncestors)
+        r.Get("/devices/{id}/assignments", h.ListDeviceAssignments)
+        r.Post("/devices/{id}/assignments", h.AssignDevice)
+        r.Post("/devices/{id}/assignments:end", h.EndDeviceAssignment)
+        r.Get("/devices/{id}/reservations", h.ListDeviceReservations)
+        r.Post("/devices/{id}/reservations", h.ReserveDevice)
+        r.Delete("/devices/{id}/reservations/{reservationId}", h.CancelDeviceReservation)
+        r.Get("/devices/{id}/maintenance", h.ListDeviceMaintenance)
+        r.Post("/devices/{id}/maintenance", h.OpenDeviceMaintenance)
+        r.Post("/devices/{id}/maintenance:close", h.CloseDeviceMaintenance)
+        r.Get("/devices/{id}/utilization", h.GetDeviceUtilization)
+        r.Get("/devices/{id}/diff", h.DiffDevice)
+        r.Delete("/devices/{id}", h.DeleteDevice)
+
+        r.Get("/brands", h.ListBrands)
+        r.Post("/brands", h.CreateBrand)
+        r.Get("/brands/{id}", h.GetBrand)
+        r.Put("/brands/{id}", h.UpdateBrand)
+        r.Delete("/brands/{id}", h.DeleteBrand)
+        r.Get("/brands/{brand}/schema", h.GetBrandSchema)
+        r.Put("/brands/{brand}/schema", h.PutBrandSchema)
+        r.Delete("/brands/{brand}/schema", h.DeleteBrandSchema)
 
-    r.Post("/devices", h.CreateDevice)
-    r.Get("/devices/{id}", h.GetDeviceByID)
-    r.Get("/devices", h.ListDevices)
-    r.Patch("/devices/{id}", h.UpdateDevice)
-    r.Delete("/devices/{id}", h.DeleteDevice)
+        r.Get("/models", h.ListDeviceModels)
+        r.Post("/models", h.CreateDeviceModel)
+        r.Get("/models/{id}", h.GetDeviceModel)
+        r.Put("/models/{id}", h.UpdateDeviceModel)
+        r.Delete("/models/{id}", h.DeleteDeviceModel)
+        r.Get("/models/{id}/devices", h.ListDeviceModelUnits)
+
+        r.Get("/locations", h.ListLocations)
+        r.Post("/locations", h.CreateLocation)
+        r.Get("/locations/{id}", h.GetLocation)
+        r.Put("/locations/{id}", h.UpdateLocation)
+        r.Delete("/locations/{id}", h.DeleteLocation)
+        r.Get("/locations/{id}/devices", h.ListLocationDevices)
+
+        r.Get("/holders", h.ListHolders)
+        r.Post("/holders", h.CreateHolder)
+        r.Get("/holders/{id}", h.GetHolder)
+        r.Put("/holders/{id}", h.UpdateHolder)
+        r.Delete("/holders/{id}", h.DeleteHolder)
+        r.Get("/holders/{id}/devices", h.ListHolderDevices)
+
+        r.Get("/maintenance", h.ListOpenMaintenance)
+
+        r.Get("/scheduled-actions", h.ListScheduledActions)
+        r.Post("/scheduled-actions", h.CreateScheduledAction)
+        r.Get("/scheduled-actions/{id}", h.GetScheduledAction)
+        r.Post("/scheduled-actions/{id}:cancel", h.CancelScheduledAction)
+
+        r.Get("/reports/end-of-support", h.EndOfSupportReport)
+        r.Get("/reports/mttr", h.RepairTimeReport)
+        r.Get("/reports/utilization", h.UtilizationReport)
+    })
 
     return r
 }
-
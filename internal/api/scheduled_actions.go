@@ -0,0 +1,186 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+// CreateScheduledActionDTO represents the payload to schedule an action on a
+// device. state is the state to set for set_state, and must be empty for
+// delete.
+type CreateScheduledActionDTO struct {
+	DeviceID string    `json:"device_id" validate:"trim,required"`
+	Action   string    `json:"action" validate:"trim,lower,required,oneof=set_state delete" enums:"set_state,delete"`
+	State    string    `json:"state,omitempty" validate:"trim,lower" enums:"available,in-use,inactive"`
+	RunAt    time.Time `json:"run_at"`
+}
+
+// ScheduledActionDTO is an action the scheduler makes on a device at run_at.
+// run_at moves forward on every retry. State is null for delete, and
+// CompletedAt until the action has run for the last time or is cancelled.
+type ScheduledActionDTO struct {
+	ID          string     `json:"id"`
+	DeviceID    string     `json:"device_id"`
+	Action      string     `json:"action" enums:"set_state,delete"`
+	State       *string    `json:"state"`
+	RunAt       time.Time  `json:"run_at"`
+	Status      string     `json:"status" enums:"pending,done,failed,cancelled"`
+	Attempts    int        `json:"attempts"`
+	MaxAttempts int        `json:"max_attempts"`
+	LastError   *string    `json:"last_error"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+func toScheduledActionDTO(a *model.ScheduledAction) ScheduledActionDTO {
+	return ScheduledActionDTO{
+		ID:          a.ID,
+		DeviceID:    a.DeviceID,
+		Action:      string(a.Action),
+		State:       optional(string(a.State)),
+		RunAt:       a.RunAt,
+		Status:      string(a.Status),
+		Attempts:    a.Attempts,
+		MaxAttempts: a.MaxAttempts,
+		LastError:   optional(a.LastError),
+		CreatedAt:   a.CreatedAt,
+		UpdatedAt:   a.UpdatedAt,
+		CompletedAt: a.CompletedAt,
+	}
+}
+
+// ListScheduledActions godoc
+// @Summary List scheduled actions
+// @Description List the scheduled actions, the soonest to run first, optionally of one device or with one status.
+// @Tags scheduled-actions
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param device_id query string false "Only the actions on this device"
+// @Param status query string false "Only the actions with this status" Enums(pending, done, failed, cancelled)
+// @Param limit query int false "Page size (default 100)"
+// @Param offset query int false "Offset (default 0)"
+// @Success 200 {array} api.ScheduledActionDTO
+// @Failure 400 {object} map[string]string "invalid status"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /scheduled-actions [get]
+func (h *Handler) ListScheduledActions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := parseIntQuery(query.Get("limit"), 100)
+	offset := parseIntQuery(query.Get("offset"), 0)
+
+	filter := model.ScheduledActionFilter{DeviceID: query.Get("device_id"), Status: query.Get("status")}
+	actions, err := h.svc.ListScheduledActions(r.Context(), filter, limit, offset)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := make([]ScheduledActionDTO, len(actions))
+	for i := range actions {
+		out[i] = toScheduledActionDTO(&actions[i])
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+// GetScheduledAction godoc
+// @Summary Get a scheduled action
+// @Description Get a scheduled action by ID, with its status and the error of its last failed attempt.
+// @Tags scheduled-actions
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Scheduled action ID"
+// @Success 200 {object} api.ScheduledActionDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /scheduled-actions/{id} [get]
+func (h *Handler) GetScheduledAction(w http.ResponseWriter, r *http.Request) {
+	a, err := h.svc.GetScheduledAction(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if a == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toScheduledActionDTO(a))
+}
+
+// CreateScheduledAction godoc
+// @Summary Schedule an action
+// @Description Schedule a state change (set_state) or the deletion (delete) of a device at run_at. The scheduler runs it through the same rules as PATCH and DELETE /devices/{id}, and retries a failed attempt with a growing delay until it runs out of attempts. An action due in the past runs at the next run of the scheduler.
+// @Tags scheduled-actions
+// @Accept json
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param action body api.CreateScheduledActionDTO true "Action to schedule"
+// @Success 201 {object} api.ScheduledActionDTO
+// @Failure 400 {object} api.ValidationErrorDTO "invalid body or unknown device"
+// @Failure 413 {object} map[string]string "request body too large"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /scheduled-actions [post]
+func (h *Handler) CreateScheduledAction(w http.ResponseWriter, r *http.Request) {
+	var req CreateScheduledActionDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+
+	a, err := h.svc.ScheduleAction(r.Context(), service.ScheduledActionInput{
+		DeviceID: req.DeviceID,
+		Action:   req.Action,
+		State:    req.State,
+		RunAt:    req.RunAt,
+	})
+	if writeValidationFailure(w, r, err) {
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeJSON(w, r, http.StatusCreated, toScheduledActionDTO(a))
+}
+
+// CancelScheduledAction godoc
+// @Summary Cancel a scheduled action
+// @Description Cancel a pending scheduled action. Actions that are running, or have run for the last time, cannot be cancelled.
+// @Tags scheduled-actions
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param Idempotency-Key header string false "Key that makes retries of this request safe"
+// @Param id path string true "Scheduled action ID"
+// @Success 200 {object} api.ScheduledActionDTO
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 409 {object} map[string]string "action is not pending or is running"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /scheduled-actions/{id}:cancel [post]
+func (h *Handler) CancelScheduledAction(w http.ResponseWriter, r *http.Request) {
+	a, err := h.svc.CancelScheduledAction(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		if strings.Contains(err.Error(), "cannot ") {
+			writeError(w, r, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if a == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, toScheduledActionDTO(a))
+}
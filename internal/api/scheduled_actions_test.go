@@ -0,0 +1,61 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+// scheduledActionRepo is a service.ScheduleStore holding one scheduled action.
+type scheduledActionRepo struct {
+	service.ScheduleStore
+	action model.ScheduledAction
+}
+
+func (r *scheduledActionRepo) ScheduledAction(ctx context.Context, id string) (*model.ScheduledAction, error) {
+	if id != r.action.ID {
+		return nil, nil
+	}
+	a := r.action
+	return &a, nil
+}
+
+func (r *scheduledActionRepo) CancelScheduledAction(ctx context.Context, id string, at time.Time) (bool, error) {
+	if r.action.Status != model.ActionPending {
+		return false, nil
+	}
+	r.action.Status = model.ActionCancelled
+	return true, nil
+}
+
+func TestCancelScheduledAction(t *testing.T) {
+	const id = "0f8b7c52-43c1-4d0e-a6a3-3d7f5c0e9b21"
+	repo := &scheduledActionRepo{action: model.ScheduledAction{ID: id, DeviceID: "1", Action: model.ActionDelete, Status: model.ActionPending, RunAt: time.Now()}}
+	routes := NewHandler(service.NewDeviceService(service.Stores{Schedule: repo}), nil).Routes()
+
+	cancel := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/scheduled-actions/"+id+":cancel", nil)
+		req = withTenant(req, "acme")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := cancel()
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var out ScheduledActionDTO
+	if err := json.Unmarshal(rec.Body.Bytes(), &out); err != nil || out.Status != "cancelled" || out.State != nil {
+		t.Fatalf("expected a cancelled delete, got %s, %v", rec.Body.String(), err)
+	}
+	if rec := cancel(); rec.Code != http.StatusConflict {
+		t.Fatalf("expected 409 once cancelled, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
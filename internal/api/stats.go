@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// DeviceStatsDTO counts devices grouped by the dimensions in GroupBy. Total
+// is the number of devices counted in all groups.
+type DeviceStatsDTO struct {
+	GroupBy []string         `json:"group_by"`
+	Total   int              `json:"total"`
+	Groups  []DeviceCountDTO `json:"groups"`
+}
+
+// DeviceCountDTO is the number of devices in a group. Every field is always
+// present, and those of the dimensions the devices were not grouped by are
+// null. Month is the creation month of the devices, in UTC, as YYYY-MM.
+type DeviceCountDTO struct {
+	Brand *string `json:"brand"`
+	State *string `json:"state" enums:"available,in-use,inactive"`
+	Month *string `json:"month" example:"2024-05"`
+	Count int     `json:"count"`
+}
+
+// DeviceStats godoc
+// @Summary Count devices
+// @Description Count the devices matching the filters, grouped by any combination of brand, state and creation month (in UTC), in the order given. Without group_by, a single group counts every matching device. Groups are ordered by their values. The CSV form always has the columns brand, state, month and count, leaving those of the dimensions not grouped by empty.
+// @Tags devices
+// @Produce json
+// @Produce text/csv
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param group_by query string false "Comma-separated dimensions to group by, e.g. brand,state" Enums(brand, state, month)
+// @Param format query string false "Response format (default json)" Enums(json, csv)
+// @Param brand query string false "Filter by brand"
+// @Param state query string false "Filter by state"
+// @Param selector query string false "Label selector, e.g. env=prod,team in (a,b),!deprecated"
+// @Param attr.name query string false "Attribute filter: attr.<name>=<value> matches devices whose top-level attribute equals the value"
+// @Success 200 {object} api.DeviceStatsDTO
+// @Failure 400 {object} map[string]string "invalid group_by, format or filter"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/stats [get]
+func (h *Handler) DeviceStats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := parseDeviceFilter(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		writeError(w, r, http.StatusBadRequest, "invalid format value")
+		return
+	}
+
+	groupBy := []string{}
+	for _, value := range query["group_by"] {
+		for _, d := range strings.Split(value, ",") {
+			if d = strings.TrimSpace(d); d != "" {
+				groupBy = append(groupBy, d)
+			}
+		}
+	}
+
+	counts, err := h.svc.DeviceStats(r.Context(), filter, groupBy)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := DeviceStatsDTO{GroupBy: groupBy, Groups: make([]DeviceCountDTO, len(counts))}
+	for i, c := range counts {
+		out.Groups[i] = toDeviceCountDTO(groupBy, c)
+		out.Total += c.Count
+	}
+
+	if format == "csv" {
+		writeDeviceStatsCSV(w, out)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+func toDeviceCountDTO(groupBy []string, c model.DeviceCount) DeviceCountDTO {
+	dto := DeviceCountDTO{Count: c.Count}
+	for _, d := range groupBy {
+		switch model.StatsDimension(d) {
+		case model.StatsByBrand:
+			dto.Brand = &c.Brand
+		case model.StatsByState:
+			state := string(c.State)
+			dto.State = &state
+		case model.StatsByMonth:
+			month := c.Month.Format("2006-01")
+			dto.Month = &month
+		}
+	}
+	return dto
+}
+
+func writeDeviceStatsCSV(w http.ResponseWriter, stats DeviceStatsDTO) {
+	w.Header().Set("Content-Type", "text/csv")
+	w.WriteHeader(http.StatusOK)
+
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"brand", "state", "month", "count"})
+	for _, g := range stats.Groups {
+		_ = cw.Write([]string{deref(g.Brand), deref(g.State), deref(g.Month), strconv.Itoa(g.Count)})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+// statsRepo is a service.StatsStore that counts devices by brand and month.
+type statsRepo struct {
+	service.StatsStore
+	filter model.DeviceFilter
+}
+
+func (r *statsRepo) CountDevices(ctx context.Context, filter model.DeviceFilter, by []model.StatsDimension) ([]model.DeviceCount, error) {
+	r.filter = filter
+	march := time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+	return []model.DeviceCount{
+		{Brand: "Apple", Month: march, Count: 3},
+		{Brand: "Dell", Month: march, Count: 2},
+	}, nil
+}
+
+func TestDeviceStats(t *testing.T) {
+	repo := &statsRepo{}
+	routes := NewHandler(service.NewDeviceService(service.Stores{Stats: repo}), nil).Routes()
+
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req = withTenant(req, "acme")
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/devices/stats?group_by=brand,month&state=available&selector=env%3Dprod")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if repo.filter.State != "available" || len(repo.filter.Selector) != 1 {
+		t.Fatalf("expected the list filters to be applied, got %+v", repo.filter)
+	}
+
+	var stats map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if stats["total"] != float64(5) {
+		t.Fatalf("expected a total of 5, got %v", stats["total"])
+	}
+	group := stats["groups"].([]any)[0].(map[string]any)
+	if group["brand"] != "Apple" || group["month"] != "2026-03" || group["count"] != float64(3) {
+		t.Fatalf("unexpected group %v", group)
+	}
+	if state, ok := group["state"]; !ok || state != nil {
+		t.Fatalf("expected state to be present and null, got %v", group)
+	}
+
+	rec = get("/devices/stats?group_by=brand&group_by=month&format=csv")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if want := "brand,state,month,count\nApple,,2026-03,3\nDell,,2026-03,2\n"; rec.Body.String() != want {
+		t.Fatalf("expected CSV %q, got %q", want, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Fatalf("expected text/csv, got %q", ct)
+	}
+
+	for _, target := range []string{
+		"/devices/stats?group_by=model",
+		"/devices/stats?group_by=brand,brand",
+		"/devices/stats?format=xml",
+		"/devices/stats?state=broken",
+	} {
+		if rec := get(target); rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected 400 for %s, got %d: %s", target, rec.Code, rec.Body.String())
+		}
+	}
+}
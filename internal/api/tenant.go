@@ -0,0 +1,43 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/lucast-ruiz/devices-api/internal/auth"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+const tenantHeader = "X-Tenant-ID"
+
+// resolveTenant puts the tenant of the request into its context. The tenant
+// of an authenticated principal always wins; the X-Tenant-ID header may not
+// contradict it, and only selects the tenant of principals that have none.
+// Unauthenticated requests are rejected, so that no caller can pick a tenant
+// without a key.
+func resolveTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := auth.PrincipalFrom(r.Context())
+		if !ok {
+			writeError(w, r, http.StatusUnauthorized, "missing "+apiKeyHeader+" header")
+			return
+		}
+
+		header := strings.TrimSpace(r.Header.Get(tenantHeader))
+		tenantID := header
+		if p.TenantID != "" {
+			if header != "" && header != p.TenantID {
+				writeError(w, r, http.StatusForbidden, "tenant does not match principal")
+				return
+			}
+			tenantID = p.TenantID
+		}
+
+		if tenantID == "" {
+			writeError(w, r, http.StatusBadRequest, "missing "+tenantHeader+" header")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(tenant.WithID(r.Context(), tenantID)))
+	})
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucast-ruiz/devices-api/internal/auth"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestResolveTenant(t *testing.T) {
+	tests := []struct {
+		name      string
+		header    string
+		principal *auth.Principal
+		status    int
+		tenant    string
+	}{
+		{name: "header", header: "acme", status: http.StatusUnauthorized},
+		{name: "missing", status: http.StatusUnauthorized},
+		{name: "tenantless principal and header", header: "acme", principal: &auth.Principal{Subject: "admin"}, status: http.StatusOK, tenant: "acme"},
+		{name: "tenantless principal", principal: &auth.Principal{Subject: "admin"}, status: http.StatusBadRequest},
+		{name: "principal", principal: &auth.Principal{Subject: "u1", TenantID: "acme"}, status: http.StatusOK, tenant: "acme"},
+		{name: "principal and matching header", header: "acme", principal: &auth.Principal{Subject: "u1", TenantID: "acme"}, status: http.StatusOK, tenant: "acme"},
+		{name: "principal and other header", header: "globex", principal: &auth.Principal{Subject: "u1", TenantID: "acme"}, status: http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			h := resolveTenant(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got, _ = tenant.FromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/devices", nil)
+			if tc.header != "" {
+				req.Header.Set(tenantHeader, tc.header)
+			}
+			if tc.principal != nil {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), *tc.principal))
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tc.status {
+				t.Fatalf("expected status %d, got %d", tc.status, rec.Code)
+			}
+			if got != tc.tenant {
+				t.Fatalf("expected tenant %q, got %q", tc.tenant, got)
+			}
+		})
+	}
+}
+
+// withTenant authenticates r as a principal of tenantID, as Authenticate
+// does for an API key of that tenant.
+func withTenant(r *http.Request, tenantID string) *http.Request {
+	return r.WithContext(auth.WithPrincipal(r.Context(), auth.Principal{Subject: "test", TenantID: tenantID}))
+}
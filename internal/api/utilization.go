@@ -0,0 +1,120 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// UtilizationDTO is the time devices spent in each state over a period, in
+// hours. Idle is the time they were available, and Utilization the fraction
+// of the tracked time they were in use. Transitions counts their changes of
+// state in the period. BrandID and Brand are null unless grouped by brand,
+// and DeviceID unless about a single device.
+type UtilizationDTO struct {
+	DeviceID      *string `json:"device_id,omitempty"`
+	BrandID       *string `json:"brand_id"`
+	Brand         *string `json:"brand"`
+	Devices       int     `json:"devices"`
+	InUseHours    float64 `json:"in_use_hours"`
+	IdleHours     float64 `json:"idle_hours"`
+	InactiveHours float64 `json:"inactive_hours"`
+	TrackedHours  float64 `json:"tracked_hours"`
+	Utilization   float64 `json:"utilization" minimum:"0" maximum:"1"`
+	Transitions   int     `json:"transitions"`
+}
+
+func toUtilizationDTO(u *model.Utilization) UtilizationDTO {
+	return UtilizationDTO{
+		BrandID:       optional(u.BrandID),
+		Brand:         optional(u.Brand),
+		Devices:       u.Devices,
+		InUseHours:    u.InUse.Hours(),
+		IdleHours:     u.Idle.Hours(),
+		InactiveHours: u.Inactive.Hours(),
+		TrackedHours:  u.Tracked().Hours(),
+		Utilization:   u.Ratio(),
+		Transitions:   u.Transitions,
+	}
+}
+
+// GetDeviceUtilization godoc
+// @Summary Get the utilization of a device
+// @Description Report how long a device was in use, idle (available) and inactive over the period from from to to, from its recorded changes of state, and how many times its state changed. Without from the period starts when its history starts, and without to, or with a to in the future, it ends now.
+// @Tags devices
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param id path string true "Device ID"
+// @Param from query string false "Start of the period (RFC 3339)"
+// @Param to query string false "End of the period (RFC 3339)"
+// @Success 200 {object} api.UtilizationDTO
+// @Failure 400 {object} map[string]string "invalid from or to"
+// @Failure 404 {object} map[string]string "not found"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /devices/{id}/utilization [get]
+func (h *Handler) GetDeviceUtilization(w http.ResponseWriter, r *http.Request) {
+	from, to, err := parsePeriod(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+	u, err := h.svc.DeviceUtilization(r.Context(), id, from, to)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if u == nil {
+		writeError(w, r, http.StatusNotFound, "not found")
+		return
+	}
+
+	out := toUtilizationDTO(u)
+	out.DeviceID = &id
+	writeJSON(w, r, http.StatusOK, out)
+}
+
+// UtilizationReport godoc
+// @Summary Report fleet utilization
+// @Description Report how long the devices were in use, idle (available) and inactive over the period from from to to, from their recorded changes of state, and how many times their states changed, for the whole fleet or per brand. The period is as for GET /devices/{id}/utilization.
+// @Tags reports
+// @Produce json
+// @Param X-Tenant-ID header string true "Tenant ID"
+// @Param group_by query string false "Group by brand" Enums(brand)
+// @Param from query string false "Start of the period (RFC 3339)"
+// @Param to query string false "End of the period (RFC 3339)"
+// @Success 200 {array} api.UtilizationDTO
+// @Failure 400 {object} map[string]string "invalid group_by, from or to"
+// @Failure 500 {object} map[string]string "internal error"
+// @Router /reports/utilization [get]
+func (h *Handler) UtilizationReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := parsePeriod(query)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	utilization, err := h.svc.FleetUtilization(r.Context(), query.Get("group_by"), from, to)
+	if err != nil {
+		if strings.Contains(err.Error(), "invalid") {
+			writeError(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	out := make([]UtilizationDTO, len(utilization))
+	for i := range utilization {
+		out[i] = toUtilizationDTO(&utilization[i])
+	}
+	writeJSON(w, r, http.StatusOK, out)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// maxBodyBytes bounds the body of every buffered request. Imports stream
+// their body and are not subject to it.
+const maxBodyBytes = 1 << 20
+
+// ValidationErrorDTO is the v1 response for a request that failed
+// validation. Fields maps each invalid field to its violations.
+type ValidationErrorDTO struct {
+	Error  string              `json:"error"`
+	Fields map[string][]string `json:"fields"`
+}
+
+// limitBody rejects request bodies larger than maxBodyBytes. Reads past the
+// limit fail with *http.MaxBytesError.
+func limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// readJSON decodes the request body into v, rejecting unknown fields, and
+// applies its validation rules. It writes the error response and returns
+// false if the body is invalid.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err == nil && dec.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("trailing data after JSON value")
+	}
+	if err == nil {
+		err = validate.Struct(v)
+	}
+	if err == nil {
+		return true
+	}
+
+	writeBodyError(w, r, err)
+	return false
+}
+
+// writeBodyError writes the response for a body that could not be read,
+// decoded or validated.
+func writeBodyError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytes *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	var errs validate.Errors
+	switch {
+	case errors.As(err, &maxBytes):
+		writeError(w, r, http.StatusRequestEntityTooLarge, "request body exceeds "+strconv.FormatInt(maxBytes.Limit, 10)+" bytes")
+	case errors.As(err, &errs):
+		writeValidationError(w, r, errs)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		writeValidationError(w, r, validate.Errors{typeErr.Field: {"must be a " + jsonType(typeErr.Type.String())}})
+	case unknownField(err) != "":
+		writeValidationError(w, r, validate.Errors{unknownField(err): {"is not a known field"}})
+	default:
+		writeError(w, r, http.StatusBadRequest, "invalid body")
+	}
+}
+
+// writeValidationError writes every violation of a request, keyed by field.
+func writeValidationError(w http.ResponseWriter, r *http.Request, errs validate.Errors) {
+	if apiVersion(r) >= 2 {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(ProblemDTO{
+			Type:     "about:blank",
+			Title:    http.StatusText(http.StatusBadRequest),
+			Status:   http.StatusBadRequest,
+			Detail:   "validation failed",
+			Instance: r.URL.Path,
+			Errors:   errs,
+		})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(ValidationErrorDTO{Error: "validation failed", Fields: errs})
+}
+
+// writeValidationFailure writes the response for a service error that lists
+// field violations, such as attributes that do not match their brand's
+// schema. It returns false, writing nothing, for any other error.
+func writeValidationFailure(w http.ResponseWriter, r *http.Request, err error) bool {
+	var errs validate.Errors
+	if !errors.As(err, &errs) {
+		return false
+	}
+	writeValidationError(w, r, errs)
+	return true
+}
+
+// unknownField returns the field named by a DisallowUnknownFields error, or
+// "" for any other error. encoding/json exposes it only in the message.
+func unknownField(err error) string {
+	name, ok := strings.CutPrefix(err.Error(), "json: unknown field ")
+	if !ok {
+		return ""
+	}
+	name, err = strconv.Unquote(name)
+	if err != nil {
+		return ""
+	}
+	return name
+}
+
+// jsonType names the JSON type expected for a Go type.
+func jsonType(goType string) string {
+	switch {
+	case goType == "string", goType == "*string":
+		return "string"
+	case goType == "bool":
+		return "boolean"
+	case strings.HasPrefix(goType, "[]"):
+		return "array"
+	case strings.Contains(goType, "int"), strings.Contains(goType, "float"):
+		return "number"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,106 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lucast-ruiz/devices-api/internal/service"
+)
+
+func postJSON(t *testing.T, h http.Handler, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/devices", strings.NewReader(body)))
+	return rec
+}
+
+func readCreate(w http.ResponseWriter, r *http.Request) {
+	var req CreateDeviceDTO
+	if !readJSON(w, r, &req) {
+		return
+	}
+	writeJSON(w, r, http.StatusOK, req)
+}
+
+func TestReadJSON_NormalizesAndValidates(t *testing.T) {
+	h := http.HandlerFunc(readCreate)
+
+	rec := postJSON(t, h, `{"name":"  Phone ","brand":"Acme","state":"In-Use"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `{"name":"Phone","brand":"Acme","state":"in-use"}`) {
+		t.Fatalf("expected normalized body, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = postJSON(t, h, `{"name":"","brand":"`+strings.Repeat("x", 51)+`","state":"broken"}`)
+	var resp ValidationErrorDTO
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected a validation error, got %d %s", rec.Code, rec.Body.String())
+	}
+	want := map[string][]string{
+		"name":  {"is required"},
+		"brand": {"must be at most 50 characters"},
+		"state": {"must be one of available, in-use, inactive"},
+	}
+	if !reflect.DeepEqual(resp.Fields, want) {
+		t.Fatalf("unexpected fields %v", resp.Fields)
+	}
+}
+
+func TestReadJSON_RejectsMalformedBodies(t *testing.T) {
+	h := http.HandlerFunc(readCreate)
+
+	cases := map[string]string{
+		`{"name":"Phone","brand":"Acme","state":"available","color":"red"}`: `"color":["is not a known field"]`,
+		`{"name":1,"brand":"Acme","state":"available"}`:                     `"name":["must be a string"]`,
+		`{"name":"Phone","brand":"Acme","state":"available"} {}`:            `"invalid body"`,
+	}
+	for body, want := range cases {
+		rec := postJSON(t, h, body)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("%s: expected 400 with %s, got %d %s", body, want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestLimitBody(t *testing.T) {
+	h := limitBody(http.HandlerFunc(readCreate))
+
+	rec := postJSON(t, h, `{"name":"`+strings.Repeat("x", maxBodyBytes)+`"}`)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413, got %d", rec.Code)
+	}
+}
+
+func TestRunBatch_MergesRejectedItems(t *testing.T) {
+	rejected := func() []service.BatchResult {
+		return []service.BatchResult{{}, {Err: errTest}, {}}
+	}
+	ran := false
+	run := func() ([]service.BatchResult, error) {
+		ran = true
+		return []service.BatchResult{{ID: "a"}, {ID: "c"}}, nil
+	}
+
+	results, err := runBatch(service.BatchAtomic, rejected(), []int{0, 2}, run)
+	if err != nil || ran {
+		t.Fatalf("atomic batch with a rejected item must not run (err %v)", err)
+	}
+	if results[0].Err != service.ErrBatchAborted || results[1].Err != errTest {
+		t.Fatalf("unexpected atomic results %+v", results)
+	}
+
+	results, err = runBatch(service.BatchBestEffort, rejected(), []int{0, 2}, run)
+	if err != nil || !ran {
+		t.Fatalf("best_effort batch must run its valid items (err %v)", err)
+	}
+	if results[0].ID != "a" || results[1].Err != errTest || results[2].ID != "c" {
+		t.Fatalf("unexpected best_effort results %+v", results)
+	}
+}
+
+var errTest = errors.New("test")
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type versionKey struct{}
+
+// Version marks the requests it wraps as belonging to the given API version.
+// Version 2 wraps successful responses in an EnvelopeDTO and reports errors
+// as application/problem+json; version 1 is the default.
+func Version(v int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), versionKey{}, v)))
+		})
+	}
+}
+
+func apiVersion(r *http.Request) int {
+	if v, ok := r.Context().Value(versionKey{}).(int); ok {
+		return v
+	}
+	return 1
+}
+
+// Deprecated announces that the routes it wraps are deprecated since
+// deprecatedAt and will be removed at sunset (RFC 9745 and RFC 8594). The
+// Link header points to the same path under successorPrefix.
+func Deprecated(deprecatedAt, sunset time.Time, successorPrefix string) func(http.Handler) http.Handler {
+	deprecation := "@" + strconv.FormatInt(deprecatedAt.Unix(), 10)
+	sunsetDate := sunset.UTC().Format(http.TimeFormat)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("Deprecation", deprecation)
+			h.Set("Sunset", sunsetDate)
+			h.Add("Link", "<"+successorPrefix+r.URL.Path+`>; rel="successor-version"`)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// EnvelopeDTO wraps every successful v2 response.
+type EnvelopeDTO struct {
+	Data any `json:"data"`
+}
+
+// ProblemDTO is a v2 error response, as defined by RFC 9457.
+type ProblemDTO struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Errors lists the violations of each invalid field, for validation
+	// failures.
+	Errors map[string][]string `json:"errors,omitempty"`
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVersion2_EnvelopesAndProblems(t *testing.T) {
+	h := Version(2)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			writeError(w, r, http.StatusNotFound, "not found")
+			return
+		}
+		writeJSON(w, r, http.StatusOK, map[string]string{"id": "1"})
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v2/devices/1", nil))
+
+	var env struct {
+		Data map[string]string `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &env); err != nil || env.Data["id"] != "1" {
+		t.Fatalf("expected enveloped response, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v2/devices/1?fail=1", nil))
+
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("expected problem+json, got %q", ct)
+	}
+	var problem ProblemDTO
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatalf("invalid problem: %v", err)
+	}
+	if problem.Status != http.StatusNotFound || problem.Detail != "not found" || problem.Instance != "/api/v2/devices/1" {
+		t.Fatalf("unexpected problem: %+v", problem)
+	}
+}
+
+func TestDeprecated(t *testing.T) {
+	deprecatedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h := Deprecated(deprecatedAt, sunset, "/api/v1")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/devices/1", nil))
+
+	if got := rec.Header().Get("Deprecation"); got != "@1767225600" {
+		t.Fatalf("unexpected Deprecation %q", got)
+	}
+	if got := rec.Header().Get("Sunset"); got != "Fri, 01 Jan 2027 00:00:00 GMT" {
+		t.Fatalf("unexpected Sunset %q", got)
+	}
+	if got := rec.Header().Get("Link"); got != `</api/v1/devices/1>; rel="successor-version"` {
+		t.Fatalf("unexpected Link %q", got)
+	}
+}
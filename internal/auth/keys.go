@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+)
+
+// Keys maps the API keys accepted by the server to the principals they
+// authenticate.
+type Keys map[string]Principal
+
+// ParseKeys parses API keys configured as a comma-separated list of
+// key=subject:tenant entries. The tenant may be left out, in which case the
+// caller picks it with the X-Tenant-ID header.
+func ParseKeys(s string) (Keys, error) {
+	keys := Keys{}
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, principal, ok := strings.Cut(entry, "=")
+		subject, tenantID, _ := strings.Cut(principal, ":")
+		if !ok || key == "" || subject == "" {
+			return nil, fmt.Errorf("invalid API key entry %q: must be key=subject:tenant", entry)
+		}
+		if _, ok := keys[key]; ok {
+			return nil, fmt.Errorf("API key of %q is configured twice", subject)
+		}
+		keys[key] = Principal{Subject: subject, TenantID: tenantID}
+	}
+	return keys, nil
+}
+
+// Authenticate returns the principal that key authenticates. Every key is
+// compared in constant time, so the time taken does not reveal how much of
+// a key was right.
+func (k Keys) Authenticate(key string) (Principal, bool) {
+	var found Principal
+	ok := false
+	for candidate, p := range k {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(key)) == 1 {
+			found, ok = p, true
+		}
+	}
+	return found, ok
+}
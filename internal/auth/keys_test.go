@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys(" k1=ci-bot:acme, k2=admin ,")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := Keys{"k1": {Subject: "ci-bot", TenantID: "acme"}, "k2": {Subject: "admin"}}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("expected %+v, got %+v", want, keys)
+	}
+
+	for _, s := range []string{"k1", "=ci-bot:acme", "k1=:acme", "k1=a,k1=b"} {
+		if _, err := ParseKeys(s); err == nil {
+			t.Fatalf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestKeys_Authenticate(t *testing.T) {
+	keys := Keys{"k1": {Subject: "ci-bot", TenantID: "acme"}}
+
+	if p, ok := keys.Authenticate("k1"); !ok || p.Subject != "ci-bot" {
+		t.Fatalf("expected the principal of k1, got %+v, %v", p, ok)
+	}
+	for _, key := range []string{"k", "k10", ""} {
+		if _, ok := keys.Authenticate(key); ok {
+			t.Fatalf("%q: expected no principal", key)
+		}
+	}
+}
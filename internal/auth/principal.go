@@ -0,0 +1,21 @@
+package auth
+
+import "context"
+
+// Principal is the authenticated caller of a request. It is placed in the
+// request context by the authentication middleware of the API.
+type Principal struct {
+	Subject  string
+	TenantID string
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
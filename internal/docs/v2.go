@@ -0,0 +1,94 @@
+package docs
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/swaggo/swag"
+)
+
+// v2Doc is the Swagger document of /api/v2. Both versions serve the same
+// operations, so it is derived from the generated v1 document rather than
+// annotated separately: successful JSON responses are wrapped in the v2
+// envelope and error responses become problem documents. Operations marked
+// with x-streaming are served as-is by both versions.
+type v2Doc struct{}
+
+func (v2Doc) ReadDoc() string {
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(SwaggerInfov1.ReadDoc()), &doc); err != nil {
+		return SwaggerInfov1.ReadDoc()
+	}
+
+	doc["basePath"] = strings.Replace(SwaggerInfov1.BasePath, "/v1", "/v2", 1)
+	if info, ok := doc["info"].(map[string]any); ok {
+		info["version"] = "2.0"
+	}
+
+	definitions, _ := doc["definitions"].(map[string]any)
+	if definitions == nil {
+		definitions = make(map[string]any)
+		doc["definitions"] = definitions
+	}
+	definitions["api.ProblemDTO"] = problemSchema
+
+	paths, _ := doc["paths"].(map[string]any)
+	for _, p := range paths {
+		operations, _ := p.(map[string]any)
+		for _, o := range operations {
+			op, _ := o.(map[string]any)
+			if op == nil || op["x-streaming"] == true {
+				continue
+			}
+			responses, _ := op["responses"].(map[string]any)
+			for code, r := range responses {
+				resp, _ := r.(map[string]any)
+				status, err := strconv.Atoi(code)
+				if resp == nil || err != nil {
+					continue
+				}
+				if status >= 400 {
+					resp["schema"] = map[string]any{"$ref": "#/definitions/api.ProblemDTO"}
+					continue
+				}
+				if schema, ok := resp["schema"]; ok {
+					resp["schema"] = map[string]any{
+						"type":       "object",
+						"properties": map[string]any{"data": schema},
+					}
+				}
+			}
+		}
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return SwaggerInfov1.ReadDoc()
+	}
+	return string(out)
+}
+
+var problemSchema = map[string]any{
+	"type":        "object",
+	"description": "Error response (RFC 9457), served as application/problem+json",
+	"properties": map[string]any{
+		"type":     map[string]any{"type": "string"},
+		"title":    map[string]any{"type": "string"},
+		"status":   map[string]any{"type": "integer"},
+		"detail":   map[string]any{"type": "string"},
+		"instance": map[string]any{"type": "string"},
+		"errors": map[string]any{
+			"type":        "object",
+			"description": "Violations of each invalid field, for validation failures",
+			"additionalProperties": map[string]any{
+				"type":  "array",
+				"items": map[string]any{"type": "string"},
+			},
+		},
+	},
+}
+
+func init() {
+	swag.Register("v2", v2Doc{})
+}
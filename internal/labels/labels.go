@@ -0,0 +1,77 @@
+// Package labels validates device labels and parses label selectors, both
+// following the Kubernetes syntax.
+package labels
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// MaxLabels is the largest number of labels a device may carry.
+const MaxLabels = 64
+
+const (
+	maxNameLength   = 63
+	maxPrefixLength = 253
+	maxValueLength  = 63
+)
+
+var (
+	nameRE   = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9_.-]*[A-Za-z0-9])?$`)
+	prefixRE = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*$`)
+)
+
+// Validate checks every key and value of a label set. Violations are keyed
+// by "labels.<key>".
+func Validate(labels map[string]string) error {
+	errs := validate.Errors{}
+	if len(labels) > MaxLabels {
+		errs.Add("labels", fmt.Sprintf("must have at most %d entries", MaxLabels))
+	}
+	for k, v := range labels {
+		field := "labels." + k
+		if err := ValidateKey(k); err != nil {
+			errs.Add(field, err.Error())
+		}
+		if err := ValidateValue(v); err != nil {
+			errs.Add(field, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ValidateKey checks a label key: an optional DNS subdomain prefix and a
+// slash, followed by a name of up to 63 alphanumerics, '-', '_' or '.',
+// starting and ending with an alphanumeric.
+func ValidateKey(key string) error {
+	name := key
+	if prefix, rest, ok := strings.Cut(key, "/"); ok {
+		if prefix == "" || len(prefix) > maxPrefixLength || !prefixRE.MatchString(prefix) {
+			return fmt.Errorf("key prefix must be a lowercase DNS subdomain of at most %d characters", maxPrefixLength)
+		}
+		name = rest
+	}
+	if name == "" || len(name) > maxNameLength || !nameRE.MatchString(name) {
+		return fmt.Errorf("key name must be 1-%d alphanumerics, '-', '_' or '.', starting and ending with an alphanumeric", maxNameLength)
+	}
+	return nil
+}
+
+// ValidateValue checks a label value: empty, or up to 63 alphanumerics, '-',
+// '_' or '.', starting and ending with an alphanumeric.
+func ValidateValue(value string) error {
+	if value == "" {
+		return nil
+	}
+	if len(value) > maxValueLength || !nameRE.MatchString(value) {
+		return fmt.Errorf("value must be at most %d alphanumerics, '-', '_' or '.', starting and ending with an alphanumeric", maxValueLength)
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package labels
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+func TestParse(t *testing.T) {
+	got, err := Parse("env=prod, tier==web,team in (a, b),region notin (eu),!deprecated,example.com/owner,zone!=,track!=beta")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := Selector{
+		{Key: "env", Operator: Equals, Values: []string{"prod"}},
+		{Key: "tier", Operator: Equals, Values: []string{"web"}},
+		{Key: "team", Operator: In, Values: []string{"a", "b"}},
+		{Key: "region", Operator: NotIn, Values: []string{"eu"}},
+		{Key: "deprecated", Operator: NotExists},
+		{Key: "example.com/owner", Operator: Exists},
+		{Key: "zone", Operator: NotEquals, Values: []string{""}},
+		{Key: "track", Operator: NotEquals, Values: []string{"beta"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected selector:\n got %+v\nwant %+v", got, want)
+	}
+
+	if sel, err := Parse("  "); err != nil || sel != nil {
+		t.Fatalf("expected empty selector, got %+v (%v)", sel, err)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, s := range []string{
+		"env=prod,",
+		"env prod",
+		"team in a,b",
+		"team in (a,b",
+		"-env=prod",
+		"env=-prod",
+		"Example.com/env=prod",
+		"!",
+		"env=prod=x",
+	} {
+		if sel, err := Parse(s); err == nil {
+			t.Errorf("%q: expected an error, got %+v", s, sel)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	err := Validate(map[string]string{
+		"env":               "prod",
+		"example.com/owner": "",
+		"bad key":           "x",
+		"team":              strings.Repeat("a", 64),
+	})
+
+	var errs validate.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected validate.Errors, got %v", err)
+	}
+	if len(errs) != 2 || errs["labels.bad key"] == nil || errs["labels.team"] == nil {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	many := map[string]string{}
+	for i := 0; i <= MaxLabels; i++ {
+		many["k"+strings.Repeat("x", i)] = ""
+	}
+	if err := Validate(many); err == nil {
+		t.Fatalf("expected an error for more than %d labels", MaxLabels)
+	}
+}
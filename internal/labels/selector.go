@@ -0,0 +1,214 @@
+package labels
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operator is the comparison of a selector requirement.
+type Operator string
+
+const (
+	Exists    Operator = "exists"
+	NotExists Operator = "!"
+	Equals    Operator = "="
+	NotEquals Operator = "!="
+	In        Operator = "in"
+	NotIn     Operator = "notin"
+)
+
+// Requirement is one comma-separated term of a selector. Values holds the
+// compared value for Equals and NotEquals, the set for In and NotIn, and is
+// empty for Exists and NotExists.
+type Requirement struct {
+	Key      string
+	Operator Operator
+	Values   []string
+}
+
+// Selector matches the devices whose labels satisfy every requirement.
+type Selector []Requirement
+
+// Parse parses a selector such as "env=prod,team in (a,b),!deprecated".
+// Supported terms are "key", "!key", "key=value", "key==value",
+// "key!=value", "key in (v1,v2)" and "key notin (v1,v2)". As in Kubernetes,
+// "!=" and "notin" also match devices without the key. An empty string
+// parses to a nil selector, which matches every device.
+func Parse(s string) (Selector, error) {
+	p := &parser{tokens: lex(s)}
+	if p.peek().kind == tokenEOF {
+		return nil, nil
+	}
+
+	var sel Selector
+	for {
+		req, err := p.requirement()
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector: %w", err)
+		}
+		sel = append(sel, req)
+
+		switch t := p.next(); t.kind {
+		case tokenEOF:
+			return sel, nil
+		case tokenComma:
+		default:
+			return nil, fmt.Errorf("invalid selector: expected ',' but found %q", t.text)
+		}
+	}
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenIdent
+	tokenBang
+	tokenEquals
+	tokenNotEquals
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// lex splits a selector into tokens. Whitespace only separates tokens.
+func lex(s string) []token {
+	var tokens []token
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, ","})
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, ")"})
+			i++
+		case strings.HasPrefix(s[i:], "!="):
+			tokens = append(tokens, token{tokenNotEquals, "!="})
+			i += 2
+		case c == '!':
+			tokens = append(tokens, token{tokenBang, "!"})
+			i++
+		case strings.HasPrefix(s[i:], "=="):
+			tokens = append(tokens, token{tokenEquals, "=="})
+			i += 2
+		case c == '=':
+			tokens = append(tokens, token{tokenEquals, "="})
+			i++
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t,()!=", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, token{tokenIdent, s[i:j]})
+			i = j
+		}
+	}
+	return tokens
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	if p.pos >= len(p.tokens) {
+		return token{kind: tokenEOF, text: "end of selector"}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) requirement() (Requirement, error) {
+	if p.peek().kind == tokenBang {
+		p.next()
+		key, err := p.key()
+		return Requirement{Key: key, Operator: NotExists}, err
+	}
+
+	key, err := p.key()
+	if err != nil {
+		return Requirement{}, err
+	}
+
+	switch t := p.peek(); {
+	case t.kind == tokenEOF || t.kind == tokenComma:
+		return Requirement{Key: key, Operator: Exists}, nil
+	case t.kind == tokenEquals || t.kind == tokenNotEquals:
+		p.next()
+		value, err := p.value()
+		op := Equals
+		if t.kind == tokenNotEquals {
+			op = NotEquals
+		}
+		return Requirement{Key: key, Operator: op, Values: []string{value}}, err
+	case t.kind == tokenIdent && (t.text == "in" || t.text == "notin"):
+		p.next()
+		values, err := p.set()
+		return Requirement{Key: key, Operator: Operator(t.text), Values: values}, err
+	default:
+		return Requirement{}, fmt.Errorf("expected an operator after %q but found %q", key, t.text)
+	}
+}
+
+func (p *parser) key() (string, error) {
+	t := p.next()
+	if t.kind != tokenIdent {
+		return "", fmt.Errorf("expected a label key but found %q", t.text)
+	}
+	if err := ValidateKey(t.text); err != nil {
+		return "", fmt.Errorf("%q: %w", t.text, err)
+	}
+	return t.text, nil
+}
+
+// value reads a value, which is empty when the requirement ends right
+// after the operator.
+func (p *parser) value() (string, error) {
+	if t := p.peek(); t.kind != tokenIdent {
+		return "", nil
+	}
+	v := p.next().text
+	if err := ValidateValue(v); err != nil {
+		return "", fmt.Errorf("%q: %w", v, err)
+	}
+	return v, nil
+}
+
+func (p *parser) set() ([]string, error) {
+	if t := p.next(); t.kind != tokenLParen {
+		return nil, fmt.Errorf("expected '(' but found %q", t.text)
+	}
+
+	var values []string
+	for {
+		v, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+
+		switch t := p.next(); t.kind {
+		case tokenRParen:
+			return values, nil
+		case tokenComma:
+		default:
+			return nil, fmt.Errorf("expected ',' or ')' but found %q", t.text)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// Brand is the canonical brand of a device. The brand names sent by clients
+// resolve to it through its name or one of its aliases, compared by their
+// normalized key.
+type Brand struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Aliases   []string  `json:"aliases"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Keys returns the normalized keys of the brand's name and aliases.
+func (b *Brand) Keys() []string {
+	keys := []string{BrandKey(b.Name)}
+	for _, alias := range b.Aliases {
+		keys = append(keys, BrandKey(alias))
+	}
+	return keys
+}
+
+// CleanBrandName trims a brand name and collapses its inner whitespace.
+func CleanBrandName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// BrandKey normalizes a brand name for comparison, ignoring case and
+// whitespace differences, so that "Apple", "apple " and "APPLE" share a key.
+func BrandKey(name string) string {
+	return strings.ToLower(CleanBrandName(name))
+}
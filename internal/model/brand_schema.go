@@ -0,0 +1,14 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// BrandSchema is the attribute schema of a brand's devices, in the JSON
+// Schema subset of package schema.
+type BrandSchema struct {
+	Brand     string          `json:"brand"`
+	Schema    json.RawMessage `json:"schema"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
@@ -10,12 +10,32 @@ const (
 	StateInactive  DeviceState = "inactive"
 )
 
+// Device is an inventoried device. Brand holds the name of the canonical
+// brand identified by BrandID. ModelID is its catalog model, or empty if it
+// has none, and LocationID where it is kept, or empty if unknown. ParentID
+// is the device it is attached to, such as the laptop of a dock, or empty.
+// SerialNumber and AssetTag identify the physical unit; each is unique
+// within the brand, and empty when unknown.
 type Device struct {
-	ID        string      `json:"id"`
-	Name      string      `json:"name"`
-	Brand     string      `json:"brand"`
-	State     DeviceState `json:"state"`
-	CreatedAt time.Time   `json:"created_at"`
+	ID           string      `json:"id"`
+	TenantID     string      `json:"tenant_id"`
+	Name         string      `json:"name"`
+	Brand        string      `json:"brand"`
+	BrandID      string      `json:"brand_id"`
+	ModelID      string      `json:"model_id,omitempty"`
+	LocationID   string      `json:"location_id,omitempty"`
+	ParentID     string      `json:"parent_id,omitempty"`
+	SerialNumber string      `json:"serial_number,omitempty"`
+	AssetTag     string      `json:"asset_tag,omitempty"`
+	State        DeviceState `json:"state"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	// Labels are free-form key/value pairs used to organize devices and to
+	// select them with label selectors.
+	Labels map[string]string `json:"labels"`
+	// Attributes hold brand-specific metadata, validated against the
+	// brand's attribute schema when it has one.
+	Attributes map[string]any `json:"attributes"`
 }
 
 func IsValidState(s string) bool {
@@ -26,3 +46,12 @@ func IsValidState(s string) bool {
 		return false
 	}
 }
+
+// Composition is how a device is attached to others, as it matters for
+// deleting it. Children counts the devices attached to it, and
+// InUseAncestorID is the nearest device it is attached to, directly or
+// through others, that is in use, or empty if there is none.
+type Composition struct {
+	Children        int
+	InUseAncestorID string
+}
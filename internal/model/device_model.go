@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// DeviceModel is a catalog entry for a model of device, such as
+// "iPhone 15 Pro", of which devices are units.
+type DeviceModel struct {
+	ID      string `json:"id"`
+	BrandID string `json:"brand_id"`
+	// Brand is the name of the brand, read along with the model.
+	Brand string         `json:"brand"`
+	Name  string         `json:"name"`
+	Specs map[string]any `json:"specs"`
+	// ReleaseDate and EndOfSupport are dates, at midnight UTC, or nil when
+	// unknown.
+	ReleaseDate  *time.Time `json:"release_date"`
+	EndOfSupport *time.Time `json:"end_of_support"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// UnsupportedDevice is a device whose model has passed its end of support.
+type UnsupportedDevice struct {
+	Device Device
+	Model  DeviceModel
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrParentCycle is returned when attaching a device to a parent would make
+// it its own ancestor.
+var ErrParentCycle = errors.New("cannot attach a device to itself or to one of its descendants")
+
+// ErrAlreadyAssigned is returned when assigning a device that already has an
+// active assignment.
+var ErrAlreadyAssigned = errors.New("device already has an active assignment")
+
+// ErrReservationConflict is returned when a reservation overlaps another
+// reservation of the same device.
+var ErrReservationConflict = errors.New("device is already reserved for part of this period")
+
+// ErrUnderMaintenance is returned when opening a maintenance record for a
+// device that already has an open one.
+var ErrUnderMaintenance = errors.New("device already has an open maintenance record")
+
+// ErrQuotaExceeded is returned when creating devices would give a tenant
+// more devices than its quota allows.
+var ErrQuotaExceeded = errors.New("device quota exceeded for tenant")
+
+// DuplicateError is returned when a write would give a field a value that
+// must be unique and is already taken. Field is empty when the storage
+// cannot tell which field conflicts.
+type DuplicateError struct {
+	Field string
+}
+
+func (e *DuplicateError) Error() string {
+	if e.Field == "" {
+		return "value already in use"
+	}
+	return fmt.Sprintf("%s already in use", e.Field)
+}
@@ -0,0 +1,25 @@
+package model
+
+import "github.com/lucast-ruiz/devices-api/internal/labels"
+
+// DeviceFilter selects devices by field and by label. Empty fields match
+// every device.
+type DeviceFilter struct {
+	Brand string
+	// BrandID selects the devices of a canonical brand. It is set from
+	// Brand by the service, which resolves names and aliases.
+	BrandID string
+	ModelID string
+	// ParentID selects the devices attached to a device.
+	ParentID string
+	// LocationID selects the devices kept in a location, and with
+	// WithinLocation also those kept anywhere under it.
+	LocationID     string
+	WithinLocation bool
+	State          string
+	Selector       labels.Selector
+	// Attributes selects devices whose top-level attribute equals the
+	// given value. Values that read as JSON numbers or booleans also match
+	// the typed value.
+	Attributes map[string]string
+}
@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// FieldChange is a field of a device whose value differs between two of its
+// versions, by its JSON name. From or To is nil where the field is empty or
+// the device did not exist.
+type FieldChange struct {
+	Field string
+	From  any
+	To    any
+}
+
+// DeviceDiff compares a device as it was at two times. Before and After are
+// nil where the device did not exist, and Changes lists the fields that
+// differ, by name.
+type DeviceDiff struct {
+	From    time.Time
+	To      time.Time
+	Before  *Device
+	After   *Device
+	Changes []FieldChange
+}
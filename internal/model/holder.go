@@ -0,0 +1,48 @@
+package model
+
+import "time"
+
+type HolderKind string
+
+const (
+	HolderPerson HolderKind = "person"
+	HolderTeam   HolderKind = "team"
+)
+
+func IsValidHolderKind(s string) bool {
+	switch HolderKind(s) {
+	case HolderPerson, HolderTeam:
+		return true
+	}
+	return false
+}
+
+// Holder is a person or team devices are assigned to. ExternalID is its ID
+// in the directory it comes from, unique per kind, or empty if it has none.
+type Holder struct {
+	ID         string     `json:"id"`
+	Kind       HolderKind `json:"kind"`
+	Name       string     `json:"name"`
+	ExternalID string     `json:"external_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Assignment is a period during which a device is held by a holder. EndedAt
+// is nil while the assignment is active.
+type Assignment struct {
+	ID        string     `json:"id"`
+	DeviceID  string     `json:"device_id"`
+	HolderID  string     `json:"holder_id"`
+	Note      string     `json:"note,omitempty"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+// AssignmentFilter selects assignments. Empty fields match every
+// assignment, and Active restricts them to those that have not ended.
+type AssignmentFilter struct {
+	DeviceID string
+	HolderID string
+	Active   bool
+}
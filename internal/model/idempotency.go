@@ -0,0 +1,16 @@
+package model
+
+// IdempotencyRecord is the stored outcome of a request sent with an
+// Idempotency-Key header. StatusCode is zero while the first request with
+// the key is still being processed.
+type IdempotencyRecord struct {
+	Key          string
+	Fingerprint  string
+	StatusCode   int
+	ContentType  string
+	ResponseBody []byte
+}
+
+func (r *IdempotencyRecord) Completed() bool {
+	return r.StatusCode != 0
+}
@@ -0,0 +1,65 @@
+package model
+
+import "time"
+
+type LocationKind string
+
+const (
+	LocationSite     LocationKind = "site"
+	LocationBuilding LocationKind = "building"
+	LocationRoom     LocationKind = "room"
+	LocationShelf    LocationKind = "shelf"
+)
+
+// locationKinds are the levels of the location tree, from the root down.
+var locationKinds = []LocationKind{LocationSite, LocationBuilding, LocationRoom, LocationShelf}
+
+// Level returns the depth of the kind in the location tree, where sites
+// are 0, or -1 if the kind is not valid.
+func (k LocationKind) Level() int {
+	for i, kind := range locationKinds {
+		if kind == k {
+			return i
+		}
+	}
+	return -1
+}
+
+// ParentKind returns the kind a location of kind k is placed in. Sites
+// have none.
+func (k LocationKind) ParentKind() LocationKind {
+	if level := k.Level(); level > 0 {
+		return locationKinds[level-1]
+	}
+	return ""
+}
+
+func IsValidLocationKind(s string) bool {
+	return LocationKind(s).Level() >= 0
+}
+
+// Location is a place devices are kept in. Locations form a tree of sites,
+// buildings, rooms and shelves, each placed in a location of the level
+// above. ParentID is empty for sites.
+type Location struct {
+	ID       string       `json:"id"`
+	ParentID string       `json:"parent_id,omitempty"`
+	Kind     LocationKind `json:"kind"`
+	Name     string       `json:"name"`
+	// Path holds the names of the location's ancestors and its own, from
+	// the site down.
+	Path      []string  `json:"path"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DeviceMove records a device changing location. An empty location ID
+// means no location, or one that has since been deleted.
+type DeviceMove struct {
+	ID             string    `json:"id"`
+	DeviceID       string    `json:"device_id"`
+	FromLocationID string    `json:"from_location_id,omitempty"`
+	ToLocationID   string    `json:"to_location_id,omitempty"`
+	Note           string    `json:"note,omitempty"`
+	MovedAt        time.Time `json:"moved_at"`
+}
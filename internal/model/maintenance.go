@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+// MaintenanceRecord is a repair of a device, from when it was found broken
+// to when it was fixed. ClosedAt is nil while the record is open, and
+// CostCents is nil when the cost is unknown.
+type MaintenanceRecord struct {
+	ID       string `json:"id"`
+	DeviceID string `json:"device_id"`
+	// Brand is the name of the brand of the device, read along with the
+	// record.
+	Brand      string `json:"brand"`
+	Diagnosis  string `json:"diagnosis,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+	CostCents  *int64 `json:"cost_cents,omitempty"`
+	// PreviousState is the state of the device when the record was opened.
+	PreviousState DeviceState `json:"previous_state"`
+	OpenedAt      time.Time   `json:"opened_at"`
+	ClosedAt      *time.Time  `json:"closed_at,omitempty"`
+}
+
+// MaintenanceFilter selects maintenance records. Empty fields match every
+// record, and Open restricts them to those that have not been closed.
+type MaintenanceFilter struct {
+	DeviceID string
+	BrandID  string
+	Open     bool
+}
+
+// RepairTime summarizes the closed maintenance records of the devices of a
+// brand.
+type RepairTime struct {
+	BrandID string
+	Brand   string
+	Repairs int
+	// MeanTimeToRepair is the mean time from opening to closing a record.
+	MeanTimeToRepair time.Duration
+	// CostCents is the sum of the known costs of the repairs.
+	CostCents int64
+}
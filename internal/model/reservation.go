@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+type ReservationStatus string
+
+const (
+	ReservationScheduled ReservationStatus = "scheduled"
+	ReservationActive    ReservationStatus = "active"
+	ReservationCompleted ReservationStatus = "completed"
+)
+
+// Reservation books a device for the period from StartsAt to EndsAt,
+// optionally for a holder. Status follows the period as the reservation job
+// reaches its start and end, and Applied is set when the job put the device
+// in use at its start.
+type Reservation struct {
+	ID        string            `json:"id"`
+	DeviceID  string            `json:"device_id"`
+	HolderID  string            `json:"holder_id,omitempty"`
+	Note      string            `json:"note,omitempty"`
+	StartsAt  time.Time         `json:"starts_at"`
+	EndsAt    time.Time         `json:"ends_at"`
+	Status    ReservationStatus `json:"status"`
+	Applied   bool              `json:"applied"`
+	CreatedAt time.Time         `json:"created_at"`
+}
@@ -0,0 +1,63 @@
+package model
+
+import "time"
+
+type ScheduledActionKind string
+
+const (
+	ActionSetState ScheduledActionKind = "set_state"
+	ActionDelete   ScheduledActionKind = "delete"
+)
+
+func IsValidScheduledActionKind(s string) bool {
+	switch ScheduledActionKind(s) {
+	case ActionSetState, ActionDelete:
+		return true
+	}
+	return false
+}
+
+type ScheduledActionStatus string
+
+const (
+	ActionPending   ScheduledActionStatus = "pending"
+	ActionDone      ScheduledActionStatus = "done"
+	ActionFailed    ScheduledActionStatus = "failed"
+	ActionCancelled ScheduledActionStatus = "cancelled"
+)
+
+func IsValidScheduledActionStatus(s string) bool {
+	switch ScheduledActionStatus(s) {
+	case ActionPending, ActionDone, ActionFailed, ActionCancelled:
+		return true
+	}
+	return false
+}
+
+// ScheduledAction is a change to a device that the scheduler makes at
+// RunAt: a change to State for ActionSetState, or the deletion of the
+// device for ActionDelete. A failed attempt is retried later, with RunAt
+// moved forward, until MaxAttempts is reached, and LastError holds the
+// error of the last failed attempt.
+type ScheduledAction struct {
+	ID          string                `json:"id"`
+	TenantID    string                `json:"-"`
+	DeviceID    string                `json:"device_id"`
+	Action      ScheduledActionKind   `json:"action"`
+	State       DeviceState           `json:"state,omitempty"`
+	RunAt       time.Time             `json:"run_at"`
+	Status      ScheduledActionStatus `json:"status"`
+	Attempts    int                   `json:"attempts"`
+	MaxAttempts int                   `json:"max_attempts"`
+	LastError   string                `json:"last_error,omitempty"`
+	CreatedAt   time.Time             `json:"created_at"`
+	UpdatedAt   time.Time             `json:"updated_at"`
+	CompletedAt *time.Time            `json:"completed_at,omitempty"`
+}
+
+// ScheduledActionFilter selects scheduled actions. Empty fields match every
+// action.
+type ScheduledActionFilter struct {
+	DeviceID string
+	Status   string
+}
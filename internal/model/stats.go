@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// StatsDimension is a property that devices can be counted by.
+type StatsDimension string
+
+const (
+	StatsByBrand StatsDimension = "brand"
+	StatsByState StatsDimension = "state"
+	// StatsByMonth counts devices by the calendar month, in UTC, in which
+	// they were created.
+	StatsByMonth StatsDimension = "month"
+)
+
+// IsValidStatsDimension reports whether d is a known StatsDimension.
+func IsValidStatsDimension(d string) bool {
+	switch StatsDimension(d) {
+	case StatsByBrand, StatsByState, StatsByMonth:
+		return true
+	default:
+		return false
+	}
+}
+
+// DeviceCount is the number of devices sharing the values of the dimensions
+// they were counted by. The fields of the other dimensions are empty.
+type DeviceCount struct {
+	Brand string
+	State DeviceState
+	// Month is the start of the creation month of the devices, in UTC.
+	Month time.Time
+	Count int
+}
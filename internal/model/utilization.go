@@ -0,0 +1,36 @@
+package model
+
+import "time"
+
+// Utilization is the time that devices spent in each state over a period,
+// from their recorded changes of state. Idle is the time they were
+// available. Devices without recorded history before the end of the period
+// are not counted.
+type Utilization struct {
+	// BrandID and Brand are set when utilization is grouped by brand.
+	BrandID string
+	Brand   string
+	Devices int
+	InUse   time.Duration
+	Idle    time.Duration
+	// Inactive is the time the devices were inactive, such as under
+	// maintenance.
+	Inactive time.Duration
+	// Transitions is the number of changes of state in the period.
+	Transitions int
+}
+
+// Tracked is the time covered by the recorded history of the devices.
+func (u Utilization) Tracked() time.Duration {
+	return u.InUse + u.Idle + u.Inactive
+}
+
+// Ratio is the fraction of the tracked time that the devices were in use, or
+// 0 when no time is tracked.
+func (u Utilization) Ratio() float64 {
+	tracked := u.Tracked()
+	if tracked == 0 {
+		return 0
+	}
+	return float64(u.InUse) / float64(tracked)
+}
@@ -0,0 +1,427 @@
+// Package patch applies JSON Merge Patch (RFC 7396) and JSON Patch
+// (RFC 6902) documents to JSON values.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidPatch is returned for patch documents that are malformed.
+	ErrInvalidPatch = errors.New("invalid patch")
+	// ErrInvalidPath is returned for paths that are not valid JSON Pointers
+	// or that address an array with an invalid index.
+	ErrInvalidPath = errors.New("invalid path")
+	// ErrPathNotFound is returned when a path does not exist in the document.
+	ErrPathNotFound = errors.New("path not found")
+	// ErrTestFailed is returned when a test operation does not match.
+	ErrTestFailed = errors.New("test failed")
+)
+
+// OpError reports which operation of a JSON Patch failed.
+type OpError struct {
+	Index int
+	Op    string
+	Path  string
+	Err   error
+}
+
+func (e *OpError) Error() string {
+	return fmt.Sprintf("operation %d (%s %q): %v", e.Index, e.Op, e.Path, e.Err)
+}
+
+func (e *OpError) Unwrap() error {
+	return e.Err
+}
+
+// MergePatch applies an RFC 7396 merge patch to doc.
+func MergePatch(doc, mergePatch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decode(mergePatch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return json.Marshal(merge(target, p))
+}
+
+func merge(target, p any) any {
+	obj, ok := p.(map[string]any)
+	if !ok {
+		return p
+	}
+
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+	for k, v := range obj {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = merge(t[k], v)
+	}
+	return t
+}
+
+type operation struct {
+	Op    string           `json:"op"`
+	Path  *string          `json:"path"`
+	From  *string          `json:"from"`
+	Value *json.RawMessage `json:"value"`
+}
+
+// JSONPatch applies an RFC 6902 patch to doc. Operations are applied in
+// order and the patch is atomic: if any operation fails, an *OpError is
+// returned and doc is not modified.
+func JSONPatch(doc, jsonPatch []byte) ([]byte, error) {
+	var ops []operation
+	if err := json.Unmarshal(jsonPatch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: must be an array of operations", ErrInvalidPatch)
+	}
+
+	root, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, op := range ops {
+		if op.Path == nil {
+			return nil, &OpError{Index: i, Op: op.Op, Err: fmt.Errorf("%w: missing path", ErrInvalidPatch)}
+		}
+		root, err = apply(root, op)
+		if err != nil {
+			return nil, &OpError{Index: i, Op: op.Op, Path: *op.Path, Err: err}
+		}
+	}
+
+	return json.Marshal(root)
+}
+
+func apply(root any, op operation) (any, error) {
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, fmt.Errorf("%w: missing value", ErrInvalidPatch)
+		}
+		value, err := decode(*op.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+		}
+		switch op.Op {
+		case "add":
+			return add(root, path, value)
+		case "replace":
+			return replace(root, path, value)
+		default:
+			current, err := get(root, path)
+			if err != nil {
+				return nil, err
+			}
+			if !equal(current, value) {
+				return nil, ErrTestFailed
+			}
+			return root, nil
+		}
+
+	case "remove":
+		return remove(root, path)
+
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("%w: missing from", ErrInvalidPatch)
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+		value, err := get(root, from)
+		if err != nil {
+			return nil, fmt.Errorf("from: %w", err)
+		}
+
+		if op.Op == "copy" {
+			return add(root, path, deepCopy(value))
+		}
+		if isProperPrefix(from, path) {
+			return nil, fmt.Errorf("%w: cannot move a value into one of its children", ErrInvalidPath)
+		}
+		root, err = remove(root, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(root, path, value)
+
+	default:
+		return nil, fmt.Errorf("%w: unknown op %q", ErrInvalidPatch, op.Op)
+	}
+}
+
+func add(root any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(root, path, func(parent any, key string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			p[key] = value
+			return p, nil
+		case []any:
+			i, err := arrayIndex(key, len(p), true)
+			if err != nil {
+				return nil, err
+			}
+			p = append(p, nil)
+			copy(p[i+1:], p[i:])
+			p[i] = value
+			return p, nil
+		default:
+			return nil, ErrPathNotFound
+		}
+	})
+}
+
+func remove(root any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: cannot remove the whole document", ErrInvalidPath)
+	}
+	return update(root, path, func(parent any, key string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			if _, ok := p[key]; !ok {
+				return nil, ErrPathNotFound
+			}
+			delete(p, key)
+			return p, nil
+		case []any:
+			i, err := arrayIndex(key, len(p), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(p[:i], p[i+1:]...), nil
+		default:
+			return nil, ErrPathNotFound
+		}
+	})
+}
+
+func replace(root any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(root, path, func(parent any, key string) (any, error) {
+		switch p := parent.(type) {
+		case map[string]any:
+			if _, ok := p[key]; !ok {
+				return nil, ErrPathNotFound
+			}
+			p[key] = value
+			return p, nil
+		case []any:
+			i, err := arrayIndex(key, len(p), false)
+			if err != nil {
+				return nil, err
+			}
+			p[i] = value
+			return p, nil
+		default:
+			return nil, ErrPathNotFound
+		}
+	})
+}
+
+func get(root any, path []string) (any, error) {
+	node := root
+	for _, key := range path {
+		switch n := node.(type) {
+		case map[string]any:
+			child, ok := n[key]
+			if !ok {
+				return nil, ErrPathNotFound
+			}
+			node = child
+		case []any:
+			i, err := arrayIndex(key, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, ErrPathNotFound
+		}
+	}
+	return node, nil
+}
+
+// update walks to the container holding the last token of path and replaces
+// it with the result of fn, rebuilding the containers above it.
+func update(node any, path []string, fn func(parent any, key string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[path[0]]
+		if !ok {
+			return nil, ErrPathNotFound
+		}
+		updated, err := update(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = updated
+		return n, nil
+	case []any:
+		i, err := arrayIndex(path[0], len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := update(n[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = updated
+		return n, nil
+	default:
+		return nil, ErrPathNotFound
+	}
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into its unescaped tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: %q must start with /", ErrInvalidPath, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		if strings.Contains(strings.NewReplacer("~0", "", "~1", "").Replace(t), "~") {
+			return nil, fmt.Errorf("%w: bad escape in %q", ErrInvalidPath, pointer)
+		}
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses an array index token. "-" and n itself are only valid
+// when the index is an insertion point.
+func arrayIndex(token string, n int, insert bool) (int, error) {
+	if token == "-" && insert {
+		return n, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: bad array index %q", ErrInvalidPath, token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%w: bad array index %q", ErrInvalidPath, token)
+	}
+	if i > n || (i == n && !insert) {
+		return 0, fmt.Errorf("%w: array index %d out of range", ErrPathNotFound, i)
+	}
+	return i, nil
+}
+
+func isProperPrefix(prefix, path []string) bool {
+	if len(prefix) >= len(path) {
+		return false
+	}
+	for i := range prefix {
+		if prefix[i] != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after JSON value")
+	}
+	return v, nil
+}
+
+func deepCopy(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		c := make(map[string]any, len(t))
+		for k, e := range t {
+			c[k] = deepCopy(e)
+		}
+		return c
+	case []any:
+		c := make([]any, len(t))
+		for i, e := range t {
+			c[i] = deepCopy(e)
+		}
+		return c
+	default:
+		return v
+	}
+}
+
+// equal compares JSON values as RFC 6902 test requires: numbers by value,
+// objects regardless of member order.
+func equal(a, b any) bool {
+	switch x := a.(type) {
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			w, ok := y[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		fx, _, errx := big.ParseFloat(string(x), 10, 256, big.ToNearestEven)
+		fy, _, erry := big.ParseFloat(string(y), 10, 256, big.ToNearestEven)
+		return errx == nil && erry == nil && fx.Cmp(fy) == 0
+	default:
+		return a == b
+	}
+}
@@ -0,0 +1,100 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func assertJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("invalid result %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("invalid expectation %s: %v", want, err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396, appendix A.
+	tests := []struct{ doc, patch, want string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":"b","b":"c"}`, `{"a":null}`, `{"b":"c"}`},
+		{`{"a":["b"]}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+	}
+
+	for _, tc := range tests {
+		got, err := MergePatch([]byte(tc.doc), []byte(tc.patch))
+		if err != nil {
+			t.Fatalf("MergePatch(%s, %s): %v", tc.doc, tc.patch, err)
+		}
+		assertJSON(t, got, tc.want)
+	}
+}
+
+func TestJSONPatch(t *testing.T) {
+	// Examples from RFC 6902, appendix A.
+	tests := []struct{ doc, patch, want string }{
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"remove","path":"/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`},
+		{`{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`},
+		{`{"foo":["all","grass","cows","eat"]}`, `[{"op":"move","from":"/foo/1","path":"/foo/3"}]`, `{"foo":["all","cows","eat","grass"]}`},
+		{`{"baz":"qux","foo":["a",2,"c"]}`, `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2.0}]`, `{"baz":"qux","foo":["a",2,"c"]}`},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/child","value":{"grandchild":{}}}]`, `{"foo":"bar","child":{"grandchild":{}}}`},
+		{`{"foo":["bar"]}`, `[{"op":"add","path":"/foo/-","value":["abc","def"]}]`, `{"foo":["bar",["abc","def"]]}`},
+		{`{"/":9,"~1":10}`, `[{"op":"test","path":"/~01","value":10}]`, `{"/":9,"~1":10}`},
+		{`{"foo":"bar"}`, `[{"op":"copy","from":"/foo","path":"/baz"}]`, `{"foo":"bar","baz":"bar"}`},
+	}
+
+	for _, tc := range tests {
+		got, err := JSONPatch([]byte(tc.doc), []byte(tc.patch))
+		if err != nil {
+			t.Fatalf("JSONPatch(%s, %s): %v", tc.doc, tc.patch, err)
+		}
+		assertJSON(t, got, tc.want)
+	}
+}
+
+func TestJSONPatch_Errors(t *testing.T) {
+	tests := []struct {
+		doc, patch string
+		want       error
+		index      int
+	}{
+		{`{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, ErrTestFailed, 0},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, ErrPathNotFound, 0},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"/foo","value":1},{"op":"remove","path":"/missing"}]`, ErrPathNotFound, 1},
+		{`{"foo":["a"]}`, `[{"op":"add","path":"/foo/01","value":"b"}]`, ErrInvalidPath, 0},
+		{`{"foo":"bar"}`, `[{"op":"replace","path":"foo","value":1}]`, ErrInvalidPath, 0},
+		{`{"foo":"bar"}`, `[{"op":"frobnicate","path":"/foo"}]`, ErrInvalidPatch, 0},
+		{`{"foo":"bar"}`, `[{"op":"add","path":"/foo"}]`, ErrInvalidPatch, 0},
+		{`{"a":{"b":1}}`, `[{"op":"move","from":"/a","path":"/a/c"}]`, ErrInvalidPath, 0},
+	}
+
+	for _, tc := range tests {
+		_, err := JSONPatch([]byte(tc.doc), []byte(tc.patch))
+		if !errors.Is(err, tc.want) {
+			t.Fatalf("JSONPatch(%s, %s): expected %v, got %v", tc.doc, tc.patch, tc.want, err)
+		}
+		var opErr *OpError
+		if !errors.As(err, &opErr) || opErr.Index != tc.index {
+			t.Fatalf("JSONPatch(%s, %s): expected failure at operation %d, got %v", tc.doc, tc.patch, tc.index, err)
+		}
+	}
+}
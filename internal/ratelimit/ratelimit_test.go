@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore_TokenBucket(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	limit := Limit{Rate: 1, Burst: 2}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		res, _ := s.Allow(ctx, "client", limit)
+		if !res.Allowed {
+			t.Fatalf("request %d should be allowed", i)
+		}
+	}
+
+	res, _ := s.Allow(ctx, "client", limit)
+	if res.Allowed {
+		t.Fatalf("request over burst should be rejected")
+	}
+	if res.RetryAfter != time.Second {
+		t.Fatalf("expected retry after 1s, got %s", res.RetryAfter)
+	}
+	if res.Remaining != 0 {
+		t.Fatalf("expected 0 remaining, got %d", res.Remaining)
+	}
+
+	other, _ := s.Allow(ctx, "other", limit)
+	if !other.Allowed {
+		t.Fatalf("buckets must be independent per key")
+	}
+
+	now = now.Add(time.Second)
+	res, _ = s.Allow(ctx, "client", limit)
+	if !res.Allowed {
+		t.Fatalf("request after refill should be allowed")
+	}
+}
+
+func TestMemoryStore_SweepsFullBuckets(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	limit := Limit{Rate: 10, Burst: 10}
+	_, _ = s.Allow(context.Background(), "client", limit)
+
+	now = now.Add(2 * sweepInterval)
+	_, _ = s.Allow(context.Background(), "another", limit)
+
+	if _, ok := s.buckets["client"]; ok {
+		t.Fatalf("idle bucket should have been swept")
+	}
+}
@@ -0,0 +1,334 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// brandColumns reads aliases as JSON, which database/sql can scan.
+const brandColumns = `id, name, array_to_json(aliases), created_at, updated_at`
+
+func scanBrand(row rowScanner, b *model.Brand) error {
+	var aliases []byte
+	if err := row.Scan(&b.ID, &b.Name, &aliases, &b.CreatedAt, &b.UpdatedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal(aliases, &b.Aliases)
+}
+
+// Brands returns every brand of the current tenant, by name.
+func (r *DeviceRepository) Brands(ctx context.Context) ([]model.Brand, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + brandColumns + ` FROM brands WHERE tenant_id = $1 ORDER BY lower(name)`
+	rows, err := tx.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	brands := []model.Brand{}
+	for rows.Next() {
+		var b model.Brand
+		if err := scanBrand(rows, &b); err != nil {
+			return nil, err
+		}
+		brands = append(brands, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return brands, tx.Commit()
+}
+
+// Brand returns the brand with the given ID, or nil if it does not exist or
+// the ID is not a valid UUID.
+func (r *DeviceRepository) Brand(ctx context.Context, id string) (*model.Brand, error) {
+	brandID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	query := `SELECT ` + brandColumns + ` FROM brands WHERE id = $1 AND tenant_id = $2`
+	return r.queryBrand(ctx, query, brandID)
+}
+
+// BrandByKey returns the brand whose name or alias normalizes to key, or nil
+// if there is none.
+func (r *DeviceRepository) BrandByKey(ctx context.Context, key string) (*model.Brand, error) {
+	query := `
+		SELECT ` + brandColumns + `
+		FROM brands
+		WHERE id = (SELECT brand_id FROM brand_keys WHERE key = $1 AND tenant_id = $2)
+	`
+	return r.queryBrand(ctx, query, key)
+}
+
+// queryBrand runs a single-row brand query for the current tenant. The query
+// must take the argument as $1 and the tenant as $2.
+func (r *DeviceRepository) queryBrand(ctx context.Context, query string, arg any) (*model.Brand, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var b model.Brand
+	err = scanBrand(tx.QueryRowContext(ctx, query, arg, tenantID), &b)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &b, tx.Commit()
+}
+
+// CreateBrand saves a new brand along with the keys of its name and aliases.
+func (r *DeviceRepository) CreateBrand(ctx context.Context, b *model.Brand) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO brands (id, tenant_id, name, aliases, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := tx.ExecContext(ctx, query, b.ID, tenantID, b.Name, aliasArray(b), b.CreatedAt, b.UpdatedAt); err != nil {
+		return duplicateError(err)
+	}
+	if err := insertBrandKeys(ctx, tx, tenantID, b); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// brandRef is the brand, by ID and name, that a device or model being
+// written refers to.
+type brandRef struct {
+	id, name *string
+}
+
+// ensureBrand is ensureBrands for a single brand.
+func ensureBrand(ctx context.Context, tx *sql.Tx, tenantID string, id, name *string) error {
+	return ensureBrands(ctx, tx, tenantID, []brandRef{{id, name}})
+}
+
+// ensureBrands creates, within tx and in a single statement, the brands
+// that devices or models being written refer to and that do not exist yet,
+// so that they are only saved along with the writes. If another transaction
+// has registered a brand of the same name meanwhile, that brand is used
+// instead: the refs to it are set to its ID and name.
+func ensureBrands(ctx context.Context, tx *sql.Tx, tenantID string, refs []brandRef) error {
+	var ids, names, keys []string
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		if !seen[*ref.id] {
+			seen[*ref.id] = true
+			ids, names, keys = append(ids, *ref.id), append(names, *ref.name), append(keys, model.BrandKey(*ref.name))
+		}
+	}
+
+	// Brands created here whose key is taken lost the race to register it.
+	query := `
+		WITH v AS (
+			SELECT * FROM unnest($2::uuid[], $3::text[], $4::text[]) AS v(id, name, key)
+		), created AS (
+			INSERT INTO brands (id, tenant_id, name)
+			SELECT id, $1, name FROM v
+			ON CONFLICT (id) DO NOTHING
+			RETURNING id
+		), keyed AS (
+			INSERT INTO brand_keys (tenant_id, key, brand_id)
+			SELECT $1, v.key, v.id FROM v JOIN created USING (id)
+			ON CONFLICT (tenant_id, key) DO NOTHING
+			RETURNING brand_id
+		)
+		SELECT v.id, v.key FROM created JOIN v USING (id)
+		WHERE created.id NOT IN (SELECT brand_id FROM keyed)
+	`
+	rows, err := tx.QueryContext(ctx, query, tenantID, ids, names, keys)
+	if err != nil {
+		return err
+	}
+	lost := make(map[string]string)
+	for rows.Next() {
+		var id, key string
+		if err := rows.Scan(&id, &key); err != nil {
+			rows.Close()
+			return err
+		}
+		lost[id] = key
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(lost) == 0 {
+		return err
+	}
+
+	lostIDs := make([]string, 0, len(lost))
+	lostKeys := make([]string, 0, len(lost))
+	for id, key := range lost {
+		lostIDs, lostKeys = append(lostIDs, id), append(lostKeys, key)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM brands WHERE tenant_id = $1 AND id = ANY($2::uuid[])`, tenantID, lostIDs); err != nil {
+		return err
+	}
+
+	query = `
+		SELECT k.key, b.id, b.name
+		FROM brand_keys k
+		JOIN brands b ON b.id = k.brand_id
+		WHERE k.tenant_id = $1 AND k.key = ANY($2)
+	`
+	rows, err = tx.QueryContext(ctx, query, tenantID, lostKeys)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	winners := make(map[string]model.Brand)
+	for rows.Next() {
+		var key string
+		var b model.Brand
+		if err := rows.Scan(&key, &b.ID, &b.Name); err != nil {
+			return err
+		}
+		winners[key] = b
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, ref := range refs {
+		if key, ok := lost[*ref.id]; ok {
+			winner := winners[key]
+			*ref.id, *ref.name = winner.ID, winner.Name
+		}
+	}
+	return nil
+}
+
+// UpdateBrand saves the name and aliases of a brand and replaces its keys.
+// A new name is copied to the brand's devices and attribute schema, which
+// store it alongside the brand ID.
+func (r *DeviceRepository) UpdateBrand(ctx context.Context, b *model.Brand) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previous string
+	err = tx.QueryRowContext(ctx, `SELECT name FROM brands WHERE id = $1 AND tenant_id = $2 FOR UPDATE`, b.ID, tenantID).Scan(&previous)
+	if err != nil {
+		return err
+	}
+
+	query := `UPDATE brands SET name = $1, aliases = $2, updated_at = $3 WHERE id = $4 AND tenant_id = $5`
+	if _, err := tx.ExecContext(ctx, query, b.Name, aliasArray(b), b.UpdatedAt, b.ID, tenantID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM brand_keys WHERE brand_id = $1 AND tenant_id = $2`, b.ID, tenantID); err != nil {
+		return err
+	}
+	if err := insertBrandKeys(ctx, tx, tenantID, b); err != nil {
+		return err
+	}
+
+	if previous != b.Name {
+		ids, err := renameDevicesBrand(ctx, tx, tenantID, b)
+		if err != nil {
+			return err
+		}
+		if err := recordVersions(ctx, tx, tenantID, ids...); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE brand_schemas SET brand = $1 WHERE brand = $2 AND tenant_id = $3`, b.Name, previous, tenantID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// aliasArray returns the aliases of b for a TEXT[] column, where nil is
+// stored as an empty array.
+func aliasArray(b *model.Brand) []string {
+	if b.Aliases == nil {
+		return []string{}
+	}
+	return b.Aliases
+}
+
+func insertBrandKeys(ctx context.Context, tx *sql.Tx, tenantID string, b *model.Brand) error {
+	query := `
+		INSERT INTO brand_keys (tenant_id, key, brand_id)
+		SELECT $1::text, key, $2::uuid FROM (SELECT DISTINCT unnest($3::text[]) AS key) k
+	`
+	_, err := tx.ExecContext(ctx, query, tenantID, b.ID, b.Keys())
+	return duplicateError(err)
+}
+
+// renameDevicesBrand stores the name of b as the brand of its devices
+// within tx, and returns their IDs.
+func renameDevicesBrand(ctx context.Context, tx *sql.Tx, tenantID string, b *model.Brand) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, `UPDATE devices SET brand = $1 WHERE brand_id = $2 AND tenant_id = $3 RETURNING id`, b.Name, b.ID, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// DeleteBrand removes a brand and its attribute schema. The boolean is false
+// if it did not exist, or the ID is not a valid UUID. Brands that still have
+// devices cannot be deleted.
+func (r *DeviceRepository) DeleteBrand(ctx context.Context, id string) (bool, error) {
+	brandID, err := uuid.Parse(id)
+	if err != nil {
+		return false, nil
+	}
+
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var name string
+	err = tx.QueryRowContext(ctx, `DELETE FROM brands WHERE id = $1 AND tenant_id = $2 RETURNING name`, brandID, tenantID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM brand_schemas WHERE brand = $1 AND tenant_id = $2`, name, tenantID); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
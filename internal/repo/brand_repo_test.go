@@ -0,0 +1,110 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestDeviceRepository_BrandKeysAndRename(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	brand := createTestBrand(t, r, ctx, "Apple", "Apple Inc")
+
+	got, err := r.BrandByKey(ctx, model.BrandKey("  APPLE   inc "))
+	if err != nil {
+		t.Fatalf("brand by key: %v", err)
+	}
+	if got == nil || got.ID != brand.ID || len(got.Aliases) != 1 {
+		t.Fatalf("expected the alias to resolve to the brand, got %+v", got)
+	}
+
+	d := &model.Device{ID: uuid.NewString(), Name: "Phone", Brand: brand.Name, BrandID: brand.ID, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := r.Create(ctx, d); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+
+	brand.Name, brand.Aliases = "Apple Computer", []string{"Apple"}
+	if err := r.UpdateBrand(ctx, brand); err != nil {
+		t.Fatalf("update brand: %v", err)
+	}
+
+	if got, err := r.BrandByKey(ctx, "apple inc"); err != nil || got != nil {
+		t.Fatalf("expected the removed alias to resolve to nothing, got %+v, %v", got, err)
+	}
+	if got, err := r.BrandByKey(ctx, "apple"); err != nil || got == nil || got.ID != brand.ID {
+		t.Fatalf("expected the new alias to resolve to the brand, got %+v, %v", got, err)
+	}
+	renamed, err := r.GetByID(ctx, d.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if renamed.Brand != "Apple Computer" {
+		t.Fatalf("expected the device to follow the new name, got %q", renamed.Brand)
+	}
+}
+
+func TestDeviceRepository_CreatesNewBrandWithDevice(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	device := func(brand, serial string) *model.Device {
+		id := uuid.NewString()
+		t.Cleanup(func() { _, _ = r.DeleteBrand(ctx, id) })
+		d := &model.Device{ID: uuid.NewString(), Name: "Phone", Brand: brand, BrandID: id, SerialNumber: serial, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+		return d
+	}
+
+	first := device("Nokia", "SN1")
+	if err := r.Create(ctx, first); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if got, err := r.BrandByKey(ctx, "nokia"); err != nil || got == nil || got.ID != first.BrandID {
+		t.Fatalf("expected the brand to be created with the device, got %+v, %v", got, err)
+	}
+
+	// A second writer that resolved the same name before the brand existed
+	// uses the brand saved by the first.
+	second := device("NOKIA", "SN2")
+	registered := second.BrandID
+	if err := r.Create(ctx, second); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if second.BrandID != first.BrandID || second.Brand != "Nokia" {
+		t.Fatalf("expected the existing brand, got %q (%q)", second.Brand, second.BrandID)
+	}
+	if got, err := r.Brand(ctx, registered); err != nil || got != nil {
+		t.Fatalf("expected the brand it registered to be dropped, got %+v, %v", got, err)
+	}
+
+	failed := device("Acme", "SN1")
+	if err := r.Create(ctx, failed); err == nil {
+		t.Fatalf("expected the taken serial number to fail the device")
+	}
+	if got, err := r.Brand(ctx, failed.BrandID); err != nil || got != nil {
+		t.Fatalf("expected no brand for a device that failed, got %+v, %v", got, err)
+	}
+}
+
+func TestDeviceRepository_BrandIgnoresInvalidIDs(t *testing.T) {
+	// Invalid IDs never reach the database.
+	r := NewDeviceRepository(nil)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	if got, err := r.Brand(ctx, "not-a-uuid"); err != nil || got != nil {
+		t.Fatalf("expected no brand, got %+v, %v", got, err)
+	}
+	if deleted, err := r.DeleteBrand(ctx, "not-a-uuid"); err != nil || deleted {
+		t.Fatalf("expected nothing to be deleted, got %v, %v", deleted, err)
+	}
+}
@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// BrandSchema returns the attribute schema of brand, or nil if it has none.
+func (r *DeviceRepository) BrandSchema(ctx context.Context, brand string) (*model.BrandSchema, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT brand, schema, updated_at FROM brand_schemas WHERE tenant_id = $1 AND brand = $2`
+
+	var s model.BrandSchema
+	var schema []byte
+	err = tx.QueryRowContext(ctx, query, tenantID, brand).Scan(&s.Brand, &schema, &s.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Schema = schema
+
+	return &s, tx.Commit()
+}
+
+// SaveBrandSchema creates or replaces the attribute schema of a brand.
+func (r *DeviceRepository) SaveBrandSchema(ctx context.Context, s *model.BrandSchema) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO brand_schemas (tenant_id, brand, schema, updated_at)
+		VALUES ($1, $2, $3::jsonb, $4)
+		ON CONFLICT (tenant_id, brand)
+		DO UPDATE SET schema = EXCLUDED.schema, updated_at = EXCLUDED.updated_at
+	`
+	if _, err := tx.ExecContext(ctx, query, tenantID, s.Brand, string(s.Schema), s.UpdatedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteBrandSchema removes the attribute schema of brand. The boolean is
+// false if it had none.
+func (r *DeviceRepository) DeleteBrandSchema(ctx context.Context, brand string) (bool, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM brand_schemas WHERE tenant_id = $1 AND brand = $2`, tenantID, brand)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, tx.Commit()
+}
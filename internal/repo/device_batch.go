@@ -0,0 +1,424 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// CreateMany inserts devices in one transaction, with a single multi-row
+// INSERT. A device whose serial number or asset tag is taken fails with a
+// *model.DuplicateError, and the devices beyond the quota of the tenant
+// with model.ErrQuotaExceeded, without failing the others unless atomic is
+// set, in which case nothing is created. It returns nil errors if every
+// device was created, or else the error of each device. An atomic batch
+// that claims an identifier another request took since it was checked
+// fails as a whole with a *model.DuplicateError.
+func (r *DeviceRepository) CreateMany(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+	if len(devices) == 0 {
+		return nil, nil
+	}
+
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	remaining, limited, err := lockQuota(ctx, tx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	errs, err := takenIdentifiers(ctx, tx, tenantID, devices)
+	if err != nil {
+		return nil, err
+	}
+	for i := range devices {
+		if errs[i] != nil {
+			continue
+		}
+		if limited && remaining < 1 {
+			errs[i] = model.ErrQuotaExceeded
+			continue
+		}
+		remaining--
+	}
+	if atomic && failed(errs) {
+		return errs, nil
+	}
+
+	created, err := writeBulk(ctx, tx, devices, errs, atomic,
+		func(devices []*model.Device) error { return insertDevices(ctx, tx, tenantID, devices) },
+		func(d *model.Device) error { return insertDevice(ctx, tx, tenantID, d) },
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(created) > 0 {
+		if err := recordStates(ctx, tx, tenantID, created...); err != nil {
+			return nil, err
+		}
+		if err := recordVersions(ctx, tx, tenantID, deviceIDs(created)...); err != nil {
+			return nil, err
+		}
+	}
+
+	if !failed(errs) {
+		errs = nil
+	}
+	return errs, tx.Commit()
+}
+
+// insertDevices inserts devices for the tenant within tx with a single
+// multi-row INSERT, after their new brands. A value already taken by
+// another device is reported as a *model.DuplicateError.
+func insertDevices(ctx context.Context, tx *sql.Tx, tenantID string, devices []*model.Device) error {
+	if err := ensureBrands(ctx, tx, tenantID, deviceBrands(devices)); err != nil {
+		return err
+	}
+
+	const cols = 11
+	var sb strings.Builder
+	sb.WriteString(`INSERT INTO devices (id, tenant_id, name, brand, brand_id, serial_number, asset_tag, state, created_at, updated_at, attributes) VALUES `)
+	args := make([]any, 0, len(devices)*cols)
+	for i, d := range devices {
+		attributes, err := jsonObject(d.Attributes)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		n := i * cols
+		fmt.Fprintf(&sb, "($%d, $%d, $%d, $%d, $%d, NULLIF($%d, ''), NULLIF($%d, ''), $%d, $%d, $%d, $%d::jsonb)", n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11)
+		args = append(args, d.ID, tenantID, d.Name, d.Brand, d.BrandID, d.SerialNumber, d.AssetTag, d.State, d.CreatedAt, d.UpdatedAt, attributes)
+	}
+
+	if _, err := tx.ExecContext(ctx, sb.String(), args...); err != nil {
+		return duplicateError(err)
+	}
+	for _, d := range devices {
+		d.TenantID = tenantID
+	}
+	return nil
+}
+
+// takenIdentifiers returns the error of each device: a
+// *model.DuplicateError if a device of the tenant other than those of
+// devices has its serial number or asset tag within the same brand, or
+// else nil. It checks every device with a single query.
+func takenIdentifiers(ctx context.Context, tx *sql.Tx, tenantID string, devices []*model.Device) ([]error, error) {
+	errs := make([]error, len(devices))
+	var serials, tags []string
+	for _, d := range devices {
+		if d.SerialNumber != "" {
+			serials = append(serials, d.SerialNumber)
+		}
+		if d.AssetTag != "" {
+			tags = append(tags, d.AssetTag)
+		}
+	}
+	if len(serials) == 0 && len(tags) == 0 {
+		return errs, nil
+	}
+
+	query := `
+		SELECT brand_id, COALESCE(serial_number, ''), COALESCE(asset_tag, '')
+		FROM devices
+		WHERE tenant_id = $1 AND (serial_number = ANY($2::text[]) OR asset_tag = ANY($3::text[]))
+			AND id <> ALL($4::uuid[])
+	`
+	rows, err := tx.QueryContext(ctx, query, tenantID, serials, tags, deviceIDs(devices))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	taken := make(map[[3]string]bool)
+	for rows.Next() {
+		var brandID, serial, tag string
+		if err := rows.Scan(&brandID, &serial, &tag); err != nil {
+			return nil, err
+		}
+		if serial != "" {
+			taken[[3]string{"serial_number", brandID, serial}] = true
+		}
+		if tag != "" {
+			taken[[3]string{"asset_tag", brandID, tag}] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, d := range devices {
+		switch {
+		case d.SerialNumber != "" && taken[[3]string{"serial_number", d.BrandID, d.SerialNumber}]:
+			errs[i] = &model.DuplicateError{Field: "serial_number"}
+		case d.AssetTag != "" && taken[[3]string{"asset_tag", d.BrandID, d.AssetTag}]:
+			errs[i] = &model.DuplicateError{Field: "asset_tag"}
+		}
+	}
+	return errs, nil
+}
+
+// writeBulk writes, within tx and with writeAll, the devices whose error in
+// errs is nil, and returns them. A single statement writes them all, but
+// another transaction may have taken one of their identifiers since they
+// were checked. In atomic mode, that fails them all with a
+// *model.DuplicateError. Otherwise each of them is written again by
+// writeOne, so that the devices that fail fail alone; their error is set
+// in errs and they are left out of the devices returned.
+func writeBulk(ctx context.Context, tx *sql.Tx, devices []*model.Device, errs []error, atomic bool, writeAll func([]*model.Device) error, writeOne func(*model.Device) error) ([]*model.Device, error) {
+	var valid []*model.Device
+	var index []int
+	for i, d := range devices {
+		if errs[i] == nil {
+			valid = append(valid, d)
+			index = append(index, i)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, nil
+	}
+	if atomic {
+		return valid, writeAll(valid)
+	}
+
+	if _, err := tx.ExecContext(ctx, `SAVEPOINT batch`); err != nil {
+		return nil, err
+	}
+	err := writeAll(valid)
+	var dup *model.DuplicateError
+	if !errors.As(err, &dup) {
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.ExecContext(ctx, `RELEASE SAVEPOINT batch`)
+		return valid, err
+	}
+	if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT batch`); err != nil {
+		return nil, err
+	}
+
+	written, itemErrs, err := writeEach(ctx, tx, valid, writeOne)
+	if err != nil {
+		return nil, err
+	}
+	for j, err := range itemErrs {
+		errs[index[j]] = err
+	}
+	return written, nil
+}
+
+// writeEach calls write for each device within tx, under a savepoint of its
+// own, so that a device that fails with a *model.DuplicateError fails
+// alone. Other errors fail every device. It returns the devices written,
+// and nil errors if every device was written, or else the error of each
+// device.
+func writeEach(ctx context.Context, tx *sql.Tx, devices []*model.Device, write func(*model.Device) error) ([]*model.Device, []error, error) {
+	written := make([]*model.Device, 0, len(devices))
+	var errs []error
+	for i, d := range devices {
+		if _, err := tx.ExecContext(ctx, `SAVEPOINT batch_item`); err != nil {
+			return nil, nil, err
+		}
+
+		err := write(d)
+		var dup *model.DuplicateError
+		if err != nil && !errors.As(err, &dup) {
+			return nil, nil, err
+		}
+		if err != nil {
+			if _, err := tx.ExecContext(ctx, `ROLLBACK TO SAVEPOINT batch_item`); err != nil {
+				return nil, nil, err
+			}
+			if errs == nil {
+				errs = make([]error, len(devices))
+			}
+			errs[i] = err
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, `RELEASE SAVEPOINT batch_item`); err != nil {
+			return nil, nil, err
+		}
+		written = append(written, d)
+	}
+	return written, errs, nil
+}
+
+// failed reports whether any of errs is not nil.
+func failed(errs []error) bool {
+	for _, err := range errs {
+		if err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// deviceBrands returns the brands of devices.
+func deviceBrands(devices []*model.Device) []brandRef {
+	refs := make([]brandRef, len(devices))
+	for i, d := range devices {
+		refs[i] = brandRef{&d.BrandID, &d.Brand}
+	}
+	return refs
+}
+
+// GetByIDs returns the devices with the given IDs, keyed by ID. IDs that do
+// not exist, or are not valid UUIDs, are absent from the map.
+func (r *DeviceRepository) GetByIDs(ctx context.Context, ids []string) (map[string]*model.Device, error) {
+	valid := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err == nil {
+			valid = append(valid, id)
+		}
+	}
+
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE tenant_id = $1 AND id = ANY($2::uuid[])
+	`
+	rows, err := tx.QueryContext(ctx, query, tenantID, valid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices, err := scanDevices(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*model.Device, len(devices))
+	for i := range devices {
+		byID[devices[i].ID] = &devices[i]
+	}
+
+	return byID, tx.Commit()
+}
+
+// UpdateMany saves devices in one transaction, with a single statement. A
+// device given a serial number or asset tag that is taken fails with a
+// *model.DuplicateError without failing the others, unless atomic is set,
+// in which case nothing is saved. It returns nil errors if every device
+// was saved, or else the error of each device. An atomic batch that claims
+// an identifier another request took since it was checked fails as a whole
+// with a *model.DuplicateError.
+func (r *DeviceRepository) UpdateMany(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+	if len(devices) == 0 {
+		return nil, nil
+	}
+
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	errs, err := takenIdentifiers(ctx, tx, tenantID, devices)
+	if err != nil {
+		return nil, err
+	}
+	if atomic && failed(errs) {
+		return errs, nil
+	}
+
+	updated, err := writeBulk(ctx, tx, devices, errs, atomic,
+		func(devices []*model.Device) error { return updateDevices(ctx, tx, tenantID, devices) },
+		func(d *model.Device) error { return updateDevice(ctx, tx, tenantID, d) },
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(updated) > 0 {
+		if err := recordStates(ctx, tx, tenantID, updated...); err != nil {
+			return nil, err
+		}
+		if err := recordVersions(ctx, tx, tenantID, deviceIDs(updated)...); err != nil {
+			return nil, err
+		}
+	}
+
+	if !failed(errs) {
+		errs = nil
+	}
+	return errs, tx.Commit()
+}
+
+// updateDevices saves the fields of devices within tx with a single
+// statement, after their new brands. A value already taken by another
+// device is reported as a *model.DuplicateError.
+func updateDevices(ctx context.Context, tx *sql.Tx, tenantID string, devices []*model.Device) error {
+	if err := ensureBrands(ctx, tx, tenantID, deviceBrands(devices)); err != nil {
+		return err
+	}
+
+	ids := make([]string, len(devices))
+	names := make([]string, len(devices))
+	brands := make([]string, len(devices))
+	brandIDs := make([]string, len(devices))
+	serials := make([]string, len(devices))
+	tags := make([]string, len(devices))
+	states := make([]string, len(devices))
+	updated := make([]time.Time, len(devices))
+	attributes := make([]string, len(devices))
+	for i, d := range devices {
+		ids[i], names[i], brands[i], brandIDs[i], states[i], updated[i] = d.ID, d.Name, d.Brand, d.BrandID, string(d.State), d.UpdatedAt
+		serials[i], tags[i] = d.SerialNumber, d.AssetTag
+		var err error
+		if attributes[i], err = jsonObject(d.Attributes); err != nil {
+			return err
+		}
+	}
+
+	query := `
+		UPDATE devices d
+		SET name = v.name, brand = v.brand, brand_id = v.brand_id,
+			serial_number = NULLIF(v.serial_number, ''), asset_tag = NULLIF(v.asset_tag, ''), state = v.state,
+			updated_at = v.updated_at, attributes = v.attributes::jsonb
+		FROM unnest($1::uuid[], $2::text[], $3::text[], $4::uuid[], $5::text[], $6::text[], $7::text[], $8::timestamptz[], $9::text[])
+			AS v(id, name, brand, brand_id, serial_number, asset_tag, state, updated_at, attributes)
+		WHERE d.id = v.id AND d.tenant_id = $10
+	`
+	_, err := tx.ExecContext(ctx, query, ids, names, brands, brandIDs, serials, tags, states, updated, attributes, tenantID)
+	return duplicateError(err)
+}
+
+// DeleteMany deletes the devices with the given IDs in a single statement.
+func (r *DeviceRepository) DeleteMany(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM devices WHERE tenant_id = $1 AND id = ANY($2::uuid[])`, tenantID, ids); err != nil {
+		return err
+	}
+	if err := recordVersions(ctx, tx, tenantID, ids...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,71 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// exportBatchSize is the number of rows fetched from the export cursor at a
+// time.
+const exportBatchSize = 1000
+
+// Export calls fn for every device matching filter, in creation order. Rows
+// are read from a server-side cursor in batches, so the table is never loaded
+// into memory as a whole. afterBatch, if not nil, is called after each batch.
+func (r *DeviceRepository) Export(ctx context.Context, filter model.DeviceFilter, fn func(*model.Device) error, afterBatch func()) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	where, args := whereDevices(tenantID, filter)
+	declare := `
+		DECLARE devices_export NO SCROLL CURSOR FOR
+		SELECT ` + deviceColumns + `
+		FROM devices
+		` + where + `
+		ORDER BY created_at, id
+	`
+	if _, err := tx.ExecContext(ctx, declare, args...); err != nil {
+		return err
+	}
+
+	fetch := fmt.Sprintf(`FETCH FORWARD %d FROM devices_export`, exportBatchSize)
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {
+			return err
+		}
+
+		n := 0
+		for rows.Next() {
+			var d model.Device
+			if err := scanDevice(rows, &d); err != nil {
+				rows.Close()
+				return err
+			}
+			if err := fn(&d); err != nil {
+				rows.Close()
+				return err
+			}
+			n++
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return err
+		}
+		rows.Close()
+
+		if afterBatch != nil {
+			afterBatch()
+		}
+		if n < exportBatchSize {
+			break
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/lucast-ruiz/devices-api/internal/labels"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// whereDevices builds the WHERE clause selecting the devices of tenantID
+// that match filter, along with its arguments.
+func whereDevices(tenantID string, filter model.DeviceFilter) (string, []any) {
+	conds := []string{"tenant_id = $1"}
+	args := []any{tenantID}
+
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if filter.Brand != "" {
+		add("brand = $%d", filter.Brand)
+	}
+	if filter.BrandID != "" {
+		add("brand_id = $%d", filter.BrandID)
+	}
+	if filter.ModelID != "" {
+		add("model_id = $%d", filter.ModelID)
+	}
+	if filter.ParentID != "" {
+		add("parent_id = $%d", filter.ParentID)
+	}
+	if filter.LocationID != "" {
+		if filter.WithinLocation {
+			add("location_id IN (SELECT descendant_id FROM location_paths WHERE ancestor_id = $%d)", filter.LocationID)
+		} else {
+			add("location_id = $%d", filter.LocationID)
+		}
+	}
+	if filter.State != "" {
+		add("state = $%d", filter.State)
+	}
+
+	names := make([]string, 0, len(filter.Attributes))
+	for name := range filter.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		var cond string
+		cond, args = attributeCondition(name, filter.Attributes[name], args)
+		conds = append(conds, cond)
+	}
+
+	for _, req := range filter.Selector {
+		var cond string
+		cond, args = labelCondition(req, args)
+		conds = append(conds, cond)
+	}
+
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
+
+// attributeCondition matches devices whose top-level attribute name equals
+// value, appending its arguments to args. Query values are text, so a value
+// that is also a JSON number or boolean matches either form. Containment is
+// used so that the GIN index on attributes applies.
+func attributeCondition(name, value string, args []any) (string, []any) {
+	contains := func(v any) string {
+		doc, _ := json.Marshal(map[string]any{name: v})
+		args = append(args, string(doc))
+		return fmt.Sprintf("attributes @> $%d::jsonb", len(args))
+	}
+
+	cond := contains(value)
+	var typed any
+	if err := json.Unmarshal([]byte(value), &typed); err == nil {
+		switch typed.(type) {
+		case float64, bool:
+			cond = "(" + cond + " OR " + contains(json.RawMessage(value)) + ")"
+		}
+	}
+	return cond, args
+}
+
+// labelCondition translates a selector requirement into a condition on the
+// labels column, appending its arguments to args. Only the containment (@>)
+// and key existence (?) operators are used so that the GIN index on labels
+// applies.
+func labelCondition(req labels.Requirement, args []any) (string, []any) {
+	param := func(arg any) string {
+		args = append(args, arg)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	contains := func(value string) string {
+		doc, _ := json.Marshal(map[string]string{req.Key: value})
+		return "labels @> " + param(string(doc)) + "::jsonb"
+	}
+	anyOf := func(values []string) string {
+		conds := make([]string, len(values))
+		for i, v := range values {
+			conds[i] = contains(v)
+		}
+		return "(" + strings.Join(conds, " OR ") + ")"
+	}
+
+	switch req.Operator {
+	case labels.Exists:
+		return "labels ? " + param(req.Key), args
+	case labels.NotExists:
+		return "NOT labels ? " + param(req.Key), args
+	case labels.Equals:
+		return contains(req.Values[0]), args
+	case labels.NotEquals:
+		return "NOT " + contains(req.Values[0]), args
+	case labels.In:
+		return anyOf(req.Values), args
+	case labels.NotIn:
+		return "NOT " + anyOf(req.Values), args
+	default:
+		panic("repo: unknown selector operator " + string(req.Operator))
+	}
+}
+
+// List returns a page of the devices matching filter, newest first.
+func (r *DeviceRepository) List(ctx context.Context, filter model.DeviceFilter, limit, offset int) ([]model.Device, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	where, args := whereDevices(tenantID, filter)
+	args = append(args, limit, offset)
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		` + where + `
+		ORDER BY created_at DESC
+		LIMIT $` + fmt.Sprint(len(args)-1) + ` OFFSET $` + fmt.Sprint(len(args))
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices, err := scanDevices(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, tx.Commit()
+}
@@ -0,0 +1,80 @@
+package repo
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/labels"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestWhereDevices_Selector(t *testing.T) {
+	sel, err := labels.Parse("env=prod,team in (a,b),!deprecated")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	where, args := whereDevices("t1", model.DeviceFilter{State: "available", Selector: sel})
+
+	wantWhere := "WHERE tenant_id = $1 AND state = $2 AND labels @> $3::jsonb" +
+		" AND (labels @> $4::jsonb OR labels @> $5::jsonb) AND NOT labels ? $6"
+	if where != wantWhere {
+		t.Fatalf("unexpected where:\n got %s\nwant %s", where, wantWhere)
+	}
+	wantArgs := []any{"t1", "available", `{"env":"prod"}`, `{"team":"a"}`, `{"team":"b"}`, "deprecated"}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("unexpected args %v", args)
+	}
+}
+
+func TestWhereDevices_Attributes(t *testing.T) {
+	where, args := whereDevices("t1", model.DeviceFilter{Attributes: map[string]string{"rooted": "true", "firmware": "v1.2"}})
+
+	wantWhere := "WHERE tenant_id = $1 AND attributes @> $2::jsonb" +
+		" AND (attributes @> $3::jsonb OR attributes @> $4::jsonb)"
+	if where != wantWhere {
+		t.Fatalf("unexpected where:\n got %s\nwant %s", where, wantWhere)
+	}
+	wantArgs := []any{"t1", `{"firmware":"v1.2"}`, `{"rooted":"true"}`, `{"rooted":true}`}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Fatalf("unexpected args %v", args)
+	}
+}
+
+func TestDeviceRepository_ListBySelector(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	brand := createTestBrand(t, r, ctx, "Acme")
+	create := func(name string, set map[string]string) *model.Device {
+		d := &model.Device{ID: uuid.NewString(), Name: name, Brand: brand.Name, BrandID: brand.ID, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if err := r.Create(ctx, d); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+
+		d.Labels = set
+		if err := r.SetLabels(ctx, d); err != nil {
+			t.Fatalf("set labels: %v", err)
+		}
+		return d
+	}
+	prod := create("prod", map[string]string{"env": "prod", "team": "a"})
+	create("staging", map[string]string{"env": "staging", "team": "a"})
+	create("old", map[string]string{"env": "prod", "deprecated": ""})
+
+	sel, _ := labels.Parse("env=prod,team in (a,b),!deprecated")
+	devices, err := r.List(ctx, model.DeviceFilter{Selector: sel}, 100, 0)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(devices) != 1 || devices[0].ID != prod.ID || devices[0].Labels["team"] != "a" {
+		t.Fatalf("expected only the prod device, got %+v", devices)
+	}
+}
@@ -0,0 +1,35 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// SetLabels replaces the labels of a device and stores its updated_at.
+func (r *DeviceRepository) SetLabels(ctx context.Context, d *model.Device) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	labels, err := jsonObject(d.Labels)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE devices
+		SET labels = $1::jsonb, updated_at = $2
+		WHERE id = $3 AND tenant_id = $4
+	`
+	if _, err := tx.ExecContext(ctx, query, labels, d.UpdatedAt, d.ID, tenantID); err != nil {
+		return err
+	}
+	if err := recordVersions(ctx, tx, tenantID, d.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
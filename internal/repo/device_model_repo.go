@@ -0,0 +1,270 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// modelColumns are read from device_models joined with brands as b.
+const modelColumns = `m.id, m.brand_id, b.name, m.name, m.specs, m.release_date, m.end_of_support, m.created_at, m.updated_at`
+
+const modelsFrom = `device_models m JOIN brands b ON b.id = m.brand_id`
+
+func scanModel(row rowScanner, m *model.DeviceModel) error {
+	var specs []byte
+	if err := row.Scan(&m.ID, &m.BrandID, &m.Brand, &m.Name, &specs, &m.ReleaseDate, &m.EndOfSupport, &m.CreatedAt, &m.UpdatedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal(specs, &m.Specs)
+}
+
+func scanModels(rows *sql.Rows) ([]model.DeviceModel, error) {
+	models := []model.DeviceModel{}
+	for rows.Next() {
+		var m model.DeviceModel
+		if err := scanModel(rows, &m); err != nil {
+			return nil, err
+		}
+		models = append(models, m)
+	}
+	return models, rows.Err()
+}
+
+// Models returns a page of the catalog, by brand and name. A non-empty
+// brandID restricts it to the models of that brand.
+func (r *DeviceRepository) Models(ctx context.Context, brandID string, limit, offset int) ([]model.DeviceModel, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + modelColumns + `
+		FROM ` + modelsFrom + `
+		WHERE m.tenant_id = $1 AND ($2 = '' OR m.brand_id::text = $2)
+		ORDER BY lower(b.name), lower(m.name)
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := tx.QueryContext(ctx, query, tenantID, brandID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	models, err := scanModels(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return models, tx.Commit()
+}
+
+// Model returns the catalog model with the given ID, or nil if it does not
+// exist.
+func (r *DeviceRepository) Model(ctx context.Context, id string) (*model.DeviceModel, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + modelColumns + ` FROM ` + modelsFrom + ` WHERE m.id::text = $1 AND m.tenant_id = $2`
+
+	var m model.DeviceModel
+	err = scanModel(tx.QueryRowContext(ctx, query, id, tenantID), &m)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, tx.Commit()
+}
+
+// ModelByName returns the model of a brand with the given name, compared
+// case-insensitively, or nil if there is none.
+func (r *DeviceRepository) ModelByName(ctx context.Context, brandID, name string) (*model.DeviceModel, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + modelColumns + `
+		FROM ` + modelsFrom + `
+		WHERE m.tenant_id = $1 AND m.brand_id = $2 AND lower(m.name) = lower($3)
+	`
+
+	var m model.DeviceModel
+	err = scanModel(tx.QueryRowContext(ctx, query, tenantID, brandID, name), &m)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &m, tx.Commit()
+}
+
+// CreateModel adds a model to the catalog.
+func (r *DeviceRepository) CreateModel(ctx context.Context, m *model.DeviceModel) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := ensureBrand(ctx, tx, tenantID, &m.BrandID, &m.Brand); err != nil {
+		return err
+	}
+	specs, err := jsonObject(m.Specs)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO device_models (id, tenant_id, brand_id, name, specs, release_date, end_of_support, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5::jsonb, $6, $7, $8, $9)
+	`
+	if _, err := tx.ExecContext(ctx, query, m.ID, tenantID, m.BrandID, m.Name, specs, m.ReleaseDate, m.EndOfSupport, m.CreatedAt, m.UpdatedAt); err != nil {
+		return duplicateError(err)
+	}
+
+	return tx.Commit()
+}
+
+// UpdateModel saves every field of a catalog model except its brand.
+func (r *DeviceRepository) UpdateModel(ctx context.Context, m *model.DeviceModel) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	specs, err := jsonObject(m.Specs)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE device_models
+		SET name = $1, specs = $2::jsonb, release_date = $3, end_of_support = $4, updated_at = $5
+		WHERE id = $6 AND tenant_id = $7
+	`
+	if _, err := tx.ExecContext(ctx, query, m.Name, specs, m.ReleaseDate, m.EndOfSupport, m.UpdatedAt, m.ID, tenantID); err != nil {
+		return duplicateError(err)
+	}
+
+	return tx.Commit()
+}
+
+// DeleteModel removes a model from the catalog. The boolean is false if it
+// did not exist.
+func (r *DeviceRepository) DeleteModel(ctx context.Context, id string) (bool, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM device_models WHERE id::text = $1 AND tenant_id = $2`, id, tenantID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, tx.Commit()
+}
+
+// SetModel stores the model of a device, where an empty ModelID clears it,
+// and its updated_at.
+func (r *DeviceRepository) SetModel(ctx context.Context, d *model.Device) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE devices
+		SET model_id = NULLIF($1, '')::uuid, updated_at = $2
+		WHERE id = $3 AND tenant_id = $4
+	`
+	if _, err := tx.ExecContext(ctx, query, d.ModelID, d.UpdatedAt, d.ID, tenantID); err != nil {
+		return err
+	}
+	if err := recordVersions(ctx, tx, tenantID, d.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UnsupportedDevices returns a page of the devices whose model's end of
+// support is before asOf, along with their model, the longest unsupported
+// first.
+func (r *DeviceRepository) UnsupportedDevices(ctx context.Context, asOf time.Time, limit, offset int) ([]model.UnsupportedDevice, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + modelColumns + `
+		FROM ` + modelsFrom + `
+		WHERE m.tenant_id = $1 AND m.end_of_support < $2
+	`
+	rows, err := tx.QueryContext(ctx, query, tenantID, asOf)
+	if err != nil {
+		return nil, err
+	}
+	models, err := scanModels(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]model.DeviceModel, len(models))
+	ids := make([]string, len(models))
+	for i, m := range models {
+		byID[m.ID] = m
+		ids[i] = m.ID
+	}
+
+	query = `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		WHERE tenant_id = $1 AND model_id = ANY($2::uuid[])
+		ORDER BY (SELECT m.end_of_support FROM device_models m WHERE m.id = devices.model_id), created_at, id
+		LIMIT $3 OFFSET $4
+	`
+	rows, err = tx.QueryContext(ctx, query, tenantID, ids, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices, err := scanDevices(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	unsupported := make([]model.UnsupportedDevice, len(devices))
+	for i, d := range devices {
+		unsupported[i] = model.UnsupportedDevice{Device: d, Model: byID[d.ModelID]}
+	}
+
+	return unsupported, tx.Commit()
+}
@@ -0,0 +1,56 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestDeviceRepository_UnsupportedDevices(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	brand := createTestBrand(t, r, ctx, "Apple")
+	date := func(s string) *time.Time {
+		d, _ := time.Parse(time.DateOnly, s)
+		return &d
+	}
+
+	var units []string
+	for _, eos := range []string{"2020-01-01", "2030-01-01"} {
+		m := &model.DeviceModel{ID: uuid.NewString(), BrandID: brand.ID, Name: "Model " + eos, Specs: map[string]any{"storage_gb": 64}, EndOfSupport: date(eos), CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if err := r.CreateModel(ctx, m); err != nil {
+			t.Fatalf("create model: %v", err)
+		}
+		t.Cleanup(func() { _, _ = r.DeleteModel(ctx, m.ID) })
+
+		d := &model.Device{ID: uuid.NewString(), Name: "Phone", Brand: brand.Name, BrandID: brand.ID, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if err := r.Create(ctx, d); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+
+		d.ModelID = m.ID
+		if err := r.SetModel(ctx, d); err != nil {
+			t.Fatalf("set model: %v", err)
+		}
+		units = append(units, d.ID)
+	}
+
+	got, err := r.UnsupportedDevices(ctx, *date("2026-01-01"), 10, 0)
+	if err != nil {
+		t.Fatalf("unsupported devices: %v", err)
+	}
+	if len(got) != 1 || got[0].Device.ID != units[0] || got[0].Model.Name != "Model 2020-01-01" {
+		t.Fatalf("expected only the device of the unsupported model, got %+v", got)
+	}
+	if got[0].Model.Brand != "Apple" || got[0].Model.Specs["storage_gb"] != float64(64) {
+		t.Fatalf("expected the model with its brand and specs, got %+v", got[0].Model)
+	}
+}
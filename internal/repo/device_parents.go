@@ -0,0 +1,149 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// SetParent stores the parent of a device, where an empty ParentID detaches
+// it, and its updated_at. It returns model.ErrParentCycle if the parent is
+// the device itself or one of its descendants. Links are serialized per
+// tenant, so that two concurrent links cannot close a cycle between them.
+func (r *DeviceRepository) SetParent(ctx context.Context, d *model.Device) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('device_parents:' || $1, 0))`, tenantID); err != nil {
+		return err
+	}
+
+	if d.ParentID != "" {
+		// Walk up from the new parent; reaching the device means the link
+		// would close a cycle.
+		query := `
+			WITH RECURSIVE up (id, parent_id) AS (
+				SELECT id, parent_id FROM devices WHERE id = $1::uuid AND tenant_id = $3
+				UNION
+				SELECT d.id, d.parent_id FROM devices d JOIN up ON d.id = up.parent_id WHERE d.tenant_id = $3
+			)
+			SELECT EXISTS (SELECT 1 FROM up WHERE id = $2::uuid)
+		`
+		var cycle bool
+		if err := tx.QueryRowContext(ctx, query, d.ParentID, d.ID, tenantID).Scan(&cycle); err != nil {
+			return err
+		}
+		if cycle {
+			return model.ErrParentCycle
+		}
+	}
+
+	query := `
+		UPDATE devices
+		SET parent_id = NULLIF($1, '')::uuid, updated_at = $2
+		WHERE id = $3 AND tenant_id = $4
+	`
+	if _, err := tx.ExecContext(ctx, query, d.ParentID, d.UpdatedAt, d.ID, tenantID); err != nil {
+		return err
+	}
+	if err := recordVersions(ctx, tx, tenantID, d.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Ancestors returns the devices a device is attached to, directly or
+// through others, from its parent up.
+func (r *DeviceRepository) Ancestors(ctx context.Context, id string) ([]model.Device, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		WITH RECURSIVE up (id, depth) AS (
+			SELECT parent_id, 1 FROM devices WHERE id::text = $1 AND tenant_id = $2 AND parent_id IS NOT NULL
+			UNION ALL
+			SELECT d.parent_id, up.depth + 1 FROM devices d JOIN up ON d.id = up.id
+			WHERE d.tenant_id = $2 AND d.parent_id IS NOT NULL
+		)
+		SELECT ` + deviceColumns + `
+		FROM devices JOIN up USING (id)
+		WHERE tenant_id = $2
+		ORDER BY up.depth
+	`
+	rows, err := tx.QueryContext(ctx, query, id, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices, err := scanDevices(rows)
+	if err != nil {
+		return nil, err
+	}
+	if devices == nil {
+		devices = []model.Device{}
+	}
+
+	return devices, tx.Commit()
+}
+
+// Compositions returns how each of the given devices is attached to others,
+// keyed by ID. Devices that do not exist are reported with no children and
+// no ancestors.
+func (r *DeviceRepository) Compositions(ctx context.Context, ids []string) (map[string]model.Composition, error) {
+	compositions := make(map[string]model.Composition, len(ids))
+	if len(ids) == 0 {
+		return compositions, nil
+	}
+
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// up pairs each device with its ancestors, nearest first.
+	query := `
+		WITH RECURSIVE up (device_id, ancestor_id, depth) AS (
+			SELECT id, parent_id, 1 FROM devices
+			WHERE tenant_id = $1 AND id = ANY($2::uuid[]) AND parent_id IS NOT NULL
+			UNION ALL
+			SELECT up.device_id, d.parent_id, up.depth + 1 FROM devices d JOIN up ON d.id = up.ancestor_id
+			WHERE d.tenant_id = $1 AND d.parent_id IS NOT NULL
+		)
+		SELECT i.id::text,
+			(SELECT count(*) FROM devices c WHERE c.tenant_id = $1 AND c.parent_id = i.id),
+			COALESCE((
+				SELECT a.id::text FROM up JOIN devices a ON a.id = up.ancestor_id
+				WHERE up.device_id = i.id AND a.state = $3
+				ORDER BY up.depth LIMIT 1
+			), '')
+		FROM unnest($2::uuid[]) AS i (id)
+	`
+	rows, err := tx.QueryContext(ctx, query, tenantID, ids, string(model.StateInUse))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var c model.Composition
+		if err := rows.Scan(&id, &c.Children, &c.InUseAncestorID); err != nil {
+			return nil, err
+		}
+		compositions[id] = c
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return compositions, tx.Commit()
+}
@@ -0,0 +1,69 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestDeviceRepository_Parents(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	brand := createTestBrand(t, r, ctx, "Dell")
+	var created []*model.Device
+	device := func(name string, state model.DeviceState, parent *model.Device) *model.Device {
+		d := &model.Device{ID: uuid.NewString(), Name: name, Brand: brand.Name, BrandID: brand.ID, State: state, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if err := r.Create(ctx, d); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		created = append(created, d)
+		if parent != nil {
+			d.ParentID = parent.ID
+			if err := r.SetParent(ctx, d); err != nil {
+				t.Fatalf("set parent: %v", err)
+			}
+		}
+		return d
+	}
+	t.Cleanup(func() {
+		for i := len(created) - 1; i >= 0; i-- {
+			_ = r.Delete(ctx, created[i].ID)
+		}
+	})
+
+	laptop := device("Laptop", model.StateInUse, nil)
+	dock := device("Dock", model.StateAvailable, laptop)
+	mouse := device("Mouse", model.StateAvailable, dock)
+
+	laptop.ParentID = mouse.ID
+	if err := r.SetParent(ctx, laptop); !errors.Is(err, model.ErrParentCycle) {
+		t.Fatalf("expected ErrParentCycle, got %v", err)
+	}
+
+	ancestors, err := r.Ancestors(ctx, mouse.ID)
+	if err != nil {
+		t.Fatalf("ancestors: %v", err)
+	}
+	if len(ancestors) != 2 || ancestors[0].ID != dock.ID || ancestors[1].ID != laptop.ID {
+		t.Fatalf("expected the dock then the laptop, got %+v", ancestors)
+	}
+
+	compositions, err := r.Compositions(ctx, []string{laptop.ID, dock.ID, mouse.ID})
+	if err != nil {
+		t.Fatalf("compositions: %v", err)
+	}
+	if compositions[laptop.ID].Children != 1 || compositions[laptop.ID].InUseAncestorID != "" {
+		t.Fatalf("unexpected laptop composition %+v", compositions[laptop.ID])
+	}
+	if compositions[mouse.ID].Children != 0 || compositions[mouse.ID].InUseAncestorID != laptop.ID {
+		t.Fatalf("expected the mouse to be under the in-use laptop, got %+v", compositions[mouse.ID])
+	}
+}
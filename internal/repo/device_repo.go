@@ -3,10 +3,17 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
 
 	"github.com/lucast-ruiz/devices-api/internal/model"
 )
 
+// deviceColumns reads a missing model, location, parent or identifier as an
+// empty string.
+const deviceColumns = `id, tenant_id, name, brand, brand_id, COALESCE(model_id::text, ''), COALESCE(location_id::text, ''), COALESCE(parent_id::text, ''), COALESCE(serial_number, ''), COALESCE(asset_tag, ''), state, created_at, updated_at, labels, attributes`
+
 type DeviceRepository struct {
 	db *sql.DB
 }
@@ -15,26 +22,109 @@ func NewDeviceRepository(db *sql.DB) *DeviceRepository {
 	return &DeviceRepository{db}
 }
 
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanDevice(row rowScanner, d *model.Device) error {
+	var labels, attributes []byte
+	if err := row.Scan(&d.ID, &d.TenantID, &d.Name, &d.Brand, &d.BrandID, &d.ModelID, &d.LocationID, &d.ParentID, &d.SerialNumber, &d.AssetTag, &d.State, &d.CreatedAt, &d.UpdatedAt, &labels, &attributes); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(labels, &d.Labels); err != nil {
+		return err
+	}
+	return json.Unmarshal(attributes, &d.Attributes)
+}
+
+// jsonObject encodes a map for a JSONB object column, where nil is stored as
+// an empty object.
+func jsonObject[V any](m map[string]V) (string, error) {
+	if m == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(m)
+	return string(data), err
+}
+
+func scanDevices(rows *sql.Rows) ([]model.Device, error) {
+	var devices []model.Device
+	for rows.Next() {
+		var d model.Device
+		if err := scanDevice(rows, &d); err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
 func (r *DeviceRepository) Create(ctx context.Context, d *model.Device) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if remaining, limited, err := lockQuota(ctx, tx, tenantID); err != nil {
+		return err
+	} else if limited && remaining < 1 {
+		return model.ErrQuotaExceeded
+	}
+
+	if err := insertDevice(ctx, tx, tenantID, d); err != nil {
+		return err
+	}
+	if err := recordStates(ctx, tx, tenantID, d); err != nil {
+		return err
+	}
+	if err := recordVersions(ctx, tx, tenantID, d.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertDevice inserts d for the tenant within tx, along with its brand if
+// it is new. A value already taken by another device is reported as a
+// *model.DuplicateError.
+func insertDevice(ctx context.Context, tx *sql.Tx, tenantID string, d *model.Device) error {
+	if err := ensureBrand(ctx, tx, tenantID, &d.BrandID, &d.Brand); err != nil {
+		return err
+	}
+	attributes, err := jsonObject(d.Attributes)
+	if err != nil {
+		return err
+	}
+
 	query := `
-		INSERT INTO devices (id, name, brand, state, created_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO devices (id, tenant_id, name, brand, brand_id, serial_number, asset_tag, state, created_at, updated_at, attributes)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8, $9, $10, $11::jsonb)
 	`
-	_, err := r.db.ExecContext(ctx, query, d.ID, d.Name, d.Brand, d.State, d.CreatedAt)
-	return err
+	if _, err := tx.ExecContext(ctx, query, d.ID, tenantID, d.Name, d.Brand, d.BrandID, d.SerialNumber, d.AssetTag, d.State, d.CreatedAt, d.UpdatedAt, attributes); err != nil {
+		return duplicateError(err)
+	}
+	d.TenantID = tenantID
+	return nil
 }
 
 func (r *DeviceRepository) GetByID(ctx context.Context, id string) (*model.Device, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	query := `
-		SELECT id, name, brand, state, created_at
+		SELECT ` + deviceColumns + `
 		FROM devices
-		WHERE id = $1
+		WHERE id = $1 AND tenant_id = $2
 	`
 
-	row := r.db.QueryRowContext(ctx, query, id)
+	row := tx.QueryRowContext(ctx, query, id, tenantID)
 
 	var d model.Device
-	err := row.Scan(&d.ID, &d.Name, &d.Brand, &d.State, &d.CreatedAt)
+	err = scanDevice(row, &d)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -42,90 +132,215 @@ func (r *DeviceRepository) GetByID(ctx context.Context, id string) (*model.Devic
 		return nil, err
 	}
 
-	return &d, nil
+	return &d, tx.Commit()
 }
 
-func (r *DeviceRepository) GetByBrand(ctx context.Context, brand string) ([]model.Device, error) {
-	query := `SELECT id, name, brand, state, created_at FROM devices WHERE brand = $1`
-
-	rows, err := r.db.QueryContext(ctx, query, brand)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var devices []model.Device
-	for rows.Next() {
-		var d model.Device
-		if err := rows.Scan(&d.ID, &d.Name, &d.Brand, &d.State, &d.CreatedAt); err != nil {
-			return nil, err
-		}
-		devices = append(devices, d)
-	}
-
-	return devices, nil
+// GetByBrand returns the devices of the canonical brand with the given ID.
+func (r *DeviceRepository) GetByBrand(ctx context.Context, brandID string) ([]model.Device, error) {
+	query := `SELECT ` + deviceColumns + ` FROM devices WHERE brand_id = $1 AND tenant_id = $2`
+	return r.queryDevices(ctx, query, brandID)
 }
 
 func (r *DeviceRepository) GetByState(ctx context.Context, state string) ([]model.Device, error) {
-	query := `SELECT id, name, brand, state, created_at FROM devices WHERE state = $1`
+	query := `SELECT ` + deviceColumns + ` FROM devices WHERE state = $1 AND tenant_id = $2`
+	return r.queryDevices(ctx, query, state)
+}
 
-	rows, err := r.db.QueryContext(ctx, query, state)
+func (r *DeviceRepository) Update(ctx context.Context, d *model.Device) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	defer tx.Rollback()
 
-	var devices []model.Device
-	for rows.Next() {
-		var d model.Device
-		if err := rows.Scan(&d.ID, &d.Name, &d.Brand, &d.State, &d.CreatedAt); err != nil {
-			return nil, err
-		}
-		devices = append(devices, d)
+	if err := updateDevice(ctx, tx, tenantID, d); err != nil {
+		return err
+	}
+	if err := recordStates(ctx, tx, tenantID, d); err != nil {
+		return err
+	}
+	if err := recordVersions(ctx, tx, tenantID, d.ID); err != nil {
+		return err
 	}
 
-	return devices, nil
+	return tx.Commit()
 }
 
-func (r *DeviceRepository) Update(ctx context.Context, d *model.Device) error {
+// updateDevice saves the fields of d within tx, along with its brand if it
+// is new. A value already taken by another device is reported as a
+// *model.DuplicateError.
+func updateDevice(ctx context.Context, tx *sql.Tx, tenantID string, d *model.Device) error {
+	if err := ensureBrand(ctx, tx, tenantID, &d.BrandID, &d.Brand); err != nil {
+		return err
+	}
+	attributes, err := jsonObject(d.Attributes)
+	if err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE devices
-		SET name = $1, brand = $2, state = $3
-		WHERE id = $4
+		SET name = $1, brand = $2, brand_id = $3, serial_number = NULLIF($4, ''), asset_tag = NULLIF($5, ''),
+			state = $6, updated_at = $7, attributes = $8::jsonb
+		WHERE id = $9 AND tenant_id = $10
 	`
-	_, err := r.db.ExecContext(ctx, query, d.Name, d.Brand, d.State, d.ID)
-	return err
+	_, err = tx.ExecContext(ctx, query, d.Name, d.Brand, d.BrandID, d.SerialNumber, d.AssetTag, d.State, d.UpdatedAt, attributes, d.ID, tenantID)
+	return duplicateError(err)
 }
 
 func (r *DeviceRepository) Delete(ctx context.Context, id string) error {
-	query := `DELETE FROM devices WHERE id = $1`
-	_, err := r.db.ExecContext(ctx, query, id)
-	return err
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM devices WHERE id = $1 AND tenant_id = $2`
+	if _, err := tx.ExecContext(ctx, query, id, tenantID); err != nil {
+		return err
+	}
+	if err := recordVersions(ctx, tx, tenantID, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (r *DeviceRepository) ListAll(ctx context.Context, limit, offset int) ([]model.Device, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	query := `
-		SELECT id, name, brand, state, created_at
+		SELECT ` + deviceColumns + `
 		FROM devices
+		WHERE tenant_id = $1
 		ORDER BY created_at DESC
-		LIMIT $1 OFFSET $2
+		LIMIT $2 OFFSET $3
 	`
 
-	rows, err := r.db.QueryContext(ctx, query, limit, offset)
+	rows, err := tx.QueryContext(ctx, query, tenantID, limit, offset)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var devices []model.Device
+	devices, err := scanDevices(rows)
+	if err != nil {
+		return nil, err
+	}
 
-	for rows.Next() {
-		var d model.Device
-		if err := rows.Scan(&d.ID, &d.Name, &d.Brand, &d.State, &d.CreatedAt); err != nil {
-			return nil, err
+	return devices, tx.Commit()
+}
+
+// RemainingQuota returns how many more devices the current tenant may own.
+// The boolean is false when the tenant has no quota. The quota and the
+// count are read under the lock of the quota, so that they agree.
+func (r *DeviceRepository) RemainingQuota(ctx context.Context) (int, bool, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	remaining, limited, err := lockQuota(ctx, tx, tenantID)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return remaining, limited, tx.Commit()
+}
+
+// lockQuota returns how many more devices the tenant may own. The boolean
+// is false when the tenant has no quota. It locks the quota of the tenant
+// until tx ends, so that concurrent creations are counted one after the
+// other instead of each seeing room for itself.
+func lockQuota(ctx context.Context, tx *sql.Tx, tenantID string) (int, bool, error) {
+	var max int
+	err := tx.QueryRowContext(ctx, `SELECT max_devices FROM tenant_quotas WHERE tenant_id = $1 FOR UPDATE`, tenantID).Scan(&max)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	var count int
+	if err := tx.QueryRowContext(ctx, `SELECT count(*) FROM devices WHERE tenant_id = $1`, tenantID).Scan(&count); err != nil {
+		return 0, false, err
+	}
+	if count >= max {
+		return 0, true, nil
+	}
+
+	return max - count, true, nil
+}
+
+// queryDevices runs a single-argument device query for the current tenant.
+// The query must take the argument as $1 and the tenant as $2.
+func (r *DeviceRepository) queryDevices(ctx context.Context, query string, arg any) ([]model.Device, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, arg, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices, err := scanDevices(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, tx.Commit()
+}
+
+// matchableColumns are the columns FindByFields may filter on.
+var matchableColumns = map[string]bool{"name": true, "brand": true, "brand_id": true, "serial_number": true, "asset_tag": true}
+
+// FindByFields returns up to limit devices whose columns equal the values in
+// match.
+func (r *DeviceRepository) FindByFields(ctx context.Context, match map[string]string, limit int) ([]model.Device, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	columns := make([]string, 0, len(match))
+	for column := range match {
+		if !matchableColumns[column] {
+			return nil, fmt.Errorf("cannot match on column %q", column)
 		}
-		devices = append(devices, d)
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	query := `SELECT ` + deviceColumns + ` FROM devices WHERE tenant_id = $1`
+	args := []any{tenantID}
+	for _, column := range columns {
+		args = append(args, match[column])
+		query += fmt.Sprintf(" AND %s = $%d", column, len(args))
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY created_at LIMIT $%d", len(args))
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices, err := scanDevices(rows)
+	if err != nil {
+		return nil, err
 	}
 
-	return devices, nil
+	return devices, tx.Commit()
 }
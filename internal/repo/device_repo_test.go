@@ -0,0 +1,358 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+// openTestDB connects to the database in TEST_DATABASE_URL, which must have
+// the migrations applied. Tests that need it are skipped otherwise.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// openAdminTestDB connects to the database in TEST_ADMIN_DATABASE_URL, as a
+// role that may set up what the API cannot, such as quotas. Tests that need
+// it are skipped otherwise.
+func openAdminTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	url := os.Getenv("TEST_ADMIN_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_ADMIN_DATABASE_URL not set")
+	}
+
+	db, err := sql.Open("pgx", url)
+	if err != nil {
+		t.Fatalf("open admin db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+// createTestBrand saves a brand for the tenant of ctx, which devices
+// created by the tests refer to.
+func createTestBrand(t *testing.T, r *DeviceRepository, ctx context.Context, name string, aliases ...string) *model.Brand {
+	t.Helper()
+
+	b := &model.Brand{ID: uuid.NewString(), Name: name, Aliases: aliases, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := r.CreateBrand(ctx, b); err != nil {
+		t.Fatalf("create brand: %v", err)
+	}
+	t.Cleanup(func() { _, _ = r.DeleteBrand(ctx, b.ID) })
+
+	return b
+}
+
+func TestDeviceRepository_TenantIsolation(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+
+	tenantA := "tenant-a-" + uuid.NewString()
+	tenantB := "tenant-b-" + uuid.NewString()
+	ctxA := tenant.WithID(context.Background(), tenantA)
+	ctxB := tenant.WithID(context.Background(), tenantB)
+
+	brand := createTestBrand(t, r, ctxA, "BrandA")
+	d := &model.Device{
+		ID:        uuid.NewString(),
+		Name:      "Isolated",
+		Brand:     brand.Name,
+		BrandID:   brand.ID,
+		State:     model.StateAvailable,
+		CreatedAt: time.Now(),
+	}
+	if err := r.Create(ctxA, d); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Delete(ctxA, d.ID) })
+
+	if got, err := r.GetByID(ctxB, d.ID); err != nil || got != nil {
+		t.Fatalf("tenant B read tenant A device: %v, %v", got, err)
+	}
+
+	for name, list := range map[string]func() ([]model.Device, error){
+		"ListAll":    func() ([]model.Device, error) { return r.ListAll(ctxB, 100, 0) },
+		"GetByBrand": func() ([]model.Device, error) { return r.GetByBrand(ctxB, d.BrandID) },
+		"GetByState": func() ([]model.Device, error) { return r.GetByState(ctxB, string(d.State)) },
+	} {
+		devices, err := list()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, got := range devices {
+			if got.ID == d.ID {
+				t.Fatalf("%s: tenant B listed tenant A device", name)
+			}
+		}
+	}
+
+	hijacked := *d
+	hijacked.Name = "Hijacked"
+	if err := r.Update(ctxB, &hijacked); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := r.Delete(ctxB, d.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	got, err := r.GetByID(ctxA, d.ID)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if got == nil {
+		t.Fatalf("tenant B deleted tenant A device")
+	}
+	if got.Name != d.Name {
+		t.Fatalf("tenant B updated tenant A device: name is %q", got.Name)
+	}
+	if got.TenantID != tenantA {
+		t.Fatalf("expected tenant %q, got %q", tenantA, got.TenantID)
+	}
+}
+
+// TestDeviceRepository_RowLevelSecurity checks that the policies alone keep
+// tenants apart, with a query that does not filter by tenant_id, for the role
+// the API connects as.
+func TestDeviceRepository_RowLevelSecurity(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+
+	ctxA := tenant.WithID(context.Background(), "tenant-a-"+uuid.NewString())
+	ctxB := tenant.WithID(context.Background(), "tenant-b-"+uuid.NewString())
+	var ids []string
+	for _, ctx := range []context.Context{ctxA, ctxB} {
+		brand := createTestBrand(t, r, ctx, "Brand")
+		d := &model.Device{ID: uuid.NewString(), Name: "Isolated", Brand: brand.Name, BrandID: brand.ID, State: model.StateAvailable, CreatedAt: time.Now()}
+		if err := r.Create(ctx, d); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+		ids = append(ids, d.ID)
+	}
+
+	tx, tenantID, err := beginTenantTx(ctxA, db)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Superusers and roles with BYPASSRLS see every row, so a test database
+	// reached as one takes the role of the API for the transaction.
+	var bypasses bool
+	if err := tx.QueryRowContext(ctxA, `SELECT rolsuper OR rolbypassrls FROM pg_roles WHERE rolname = current_user`).Scan(&bypasses); err != nil {
+		t.Fatalf("role: %v", err)
+	}
+	if bypasses {
+		if _, err := tx.ExecContext(ctxA, `SET LOCAL ROLE devices_app`); err != nil {
+			t.Fatalf("set role: %v", err)
+		}
+	}
+
+	rows, err := tx.QueryContext(ctxA, `SELECT id, tenant_id FROM devices`)
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	defer rows.Close()
+
+	seen := map[string]bool{}
+	for rows.Next() {
+		var id, owner string
+		if err := rows.Scan(&id, &owner); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		if owner != tenantID {
+			t.Fatalf("tenant %q saw device %s of tenant %q", tenantID, id, owner)
+		}
+		seen[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("rows: %v", err)
+	}
+	if !seen[ids[0]] || seen[ids[1]] {
+		t.Fatalf("expected only the device of tenant A, saw %v", seen)
+	}
+}
+
+func TestDeviceRepository_EnforcesQuota(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	tenantID := "tenant-" + uuid.NewString()
+	ctx := tenant.WithID(context.Background(), tenantID)
+
+	admin := openAdminTestDB(t)
+	if _, err := admin.ExecContext(ctx, `INSERT INTO tenant_quotas (tenant_id, max_devices) VALUES ($1, 2)`, tenantID); err != nil {
+		t.Fatalf("quota: %v", err)
+	}
+	t.Cleanup(func() { _, _ = admin.Exec(`DELETE FROM tenant_quotas WHERE tenant_id = $1`, tenantID) })
+
+	brand := createTestBrand(t, r, ctx, "Brand")
+	device := func() *model.Device {
+		d := &model.Device{ID: uuid.NewString(), Name: "Quota", Brand: brand.Name, BrandID: brand.ID, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+		return d
+	}
+
+	if err := r.Create(ctx, device()); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	errs, err := r.CreateMany(ctx, []*model.Device{device(), device()}, true)
+	if err != nil || len(errs) != 2 || errs[0] != nil || !errors.Is(errs[1], model.ErrQuotaExceeded) {
+		t.Fatalf("expected the device over quota to fail, got %v, %v", errs, err)
+	}
+	if err := r.Create(ctx, device()); err != nil {
+		t.Fatalf("create within quota: %v", err)
+	}
+	if err := r.Create(ctx, device()); !errors.Is(err, model.ErrQuotaExceeded) {
+		t.Fatalf("expected create over quota to fail, got %v", err)
+	}
+}
+
+func TestDeviceRepository_CreateManyFailsDuplicatesAlone(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	brand := createTestBrand(t, r, ctx, "Brand")
+	device := func(serial string) *model.Device {
+		d := &model.Device{ID: uuid.NewString(), Name: "Phone", Brand: brand.Name, BrandID: brand.ID, SerialNumber: serial, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+		return d
+	}
+
+	if err := r.Create(ctx, device("SN1")); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	for _, atomic := range []bool{true, false} {
+		taken, free := device("SN1"), device("SN-"+uuid.NewString())
+		errs, err := r.CreateMany(ctx, []*model.Device{taken, free}, atomic)
+		var dup *model.DuplicateError
+		if err != nil || len(errs) != 2 || !errors.As(errs[0], &dup) || errs[1] != nil {
+			t.Fatalf("atomic %v: expected only the taken serial number to fail, got %v, %v", atomic, errs, err)
+		}
+		got, err := r.GetByID(ctx, free.ID)
+		if err != nil || (got != nil) == atomic {
+			t.Fatalf("atomic %v: unexpected device %+v, %v", atomic, got, err)
+		}
+	}
+}
+
+func TestDeviceRepository_UpdateManyFailsTakenIdentifiersAlone(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	brand := createTestBrand(t, r, ctx, "Brand")
+	var devices []*model.Device
+	for _, tag := range []string{"T1", "T2", "T3"} {
+		d := &model.Device{ID: uuid.NewString(), Name: "Phone", Brand: brand.Name, BrandID: brand.ID, AssetTag: tag, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+		devices = append(devices, d)
+	}
+	if errs, err := r.CreateMany(ctx, devices, true); err != nil || errs != nil {
+		t.Fatalf("create: %v, %v", errs, err)
+	}
+
+	// The first device takes the tag of a device outside the batch, while
+	// the second keeps its own.
+	devices[0].AssetTag, devices[1].Name = "T3", "Renamed"
+	errs, err := r.UpdateMany(ctx, devices[:2], false)
+	var dup *model.DuplicateError
+	if err != nil || len(errs) != 2 || !errors.As(errs[0], &dup) || dup.Field != "asset_tag" || errs[1] != nil {
+		t.Fatalf("expected only the taken asset tag to fail, got %v, %v", errs, err)
+	}
+	if got, err := r.GetByID(ctx, devices[1].ID); err != nil || got.Name != "Renamed" {
+		t.Fatalf("expected the other device to be saved, got %+v, %v", got, err)
+	}
+}
+
+func TestDeviceRepository_CreateManyCreatesNewBrandsOnce(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	brandID := uuid.NewString()
+	t.Cleanup(func() { _, _ = r.DeleteBrand(ctx, brandID) })
+	var devices []*model.Device
+	for i := 0; i < 3; i++ {
+		d := &model.Device{ID: uuid.NewString(), Name: "Phone", Brand: "Nokia", BrandID: brandID, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+		devices = append(devices, d)
+	}
+
+	if errs, err := r.CreateMany(ctx, devices, false); err != nil || errs != nil {
+		t.Fatalf("create: %v, %v", errs, err)
+	}
+	got, err := r.BrandByKey(ctx, "nokia")
+	if err != nil || got == nil || got.ID != brandID {
+		t.Fatalf("expected the brand to be created with the devices, got %+v, %v", got, err)
+	}
+}
+
+func TestDeviceRepository_RequiresTenant(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+
+	if _, err := r.ListAll(context.Background(), 10, 0); err != tenant.ErrMissing {
+		t.Fatalf("expected tenant.ErrMissing, got %v", err)
+	}
+}
+
+func TestDeviceRepository_SerialNumberUniquePerBrand(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	apple := createTestBrand(t, r, ctx, "Apple")
+	samsung := createTestBrand(t, r, ctx, "Samsung")
+
+	create := func(b *model.Brand, serial string) error {
+		d := &model.Device{ID: uuid.NewString(), Name: "Phone", Brand: b.Name, BrandID: b.ID, SerialNumber: serial, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		err := r.Create(ctx, d)
+		if err == nil {
+			t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+		}
+		return err
+	}
+
+	if err := create(apple, "SN1"); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := create(samsung, "SN1"); err != nil {
+		t.Fatalf("expected the serial number to be free in another brand: %v", err)
+	}
+	var dup *model.DuplicateError
+	if err := create(apple, "SN1"); !errors.As(err, &dup) || dup.Field != "serial_number" {
+		t.Fatalf("expected a duplicate serial_number, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := create(apple, ""); err != nil {
+			t.Fatalf("expected devices without a serial number not to conflict: %v", err)
+		}
+	}
+}
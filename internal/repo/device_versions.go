@@ -0,0 +1,117 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// recordVersions closes the current versions of the devices with the given
+// IDs and records their rows as the new current versions, within tx and as
+// of its start. Deleted devices are left without a current version.
+//
+// These are two statements because the sub-statements of a WITH run after
+// the main one when it does not read them, which would record the new
+// version before the current one is closed.
+func recordVersions(ctx context.Context, tx *sql.Tx, tenantID string, ids ...string) error {
+	query := `
+		UPDATE device_versions SET valid_to = GREATEST(now(), valid_from)
+		WHERE tenant_id = $1 AND id = ANY($2::uuid[]) AND valid_to IS NULL
+	`
+	if _, err := tx.ExecContext(ctx, query, tenantID, ids); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO device_versions (tenant_id, id, name, brand, brand_id, model_id, location_id, parent_id, serial_number, asset_tag, state, created_at, updated_at, labels, attributes, valid_from)
+		SELECT tenant_id, id, name, brand, brand_id, model_id, location_id, parent_id, serial_number, asset_tag, state, created_at, updated_at, labels, attributes, now()
+		FROM devices
+		WHERE tenant_id = $1 AND id = ANY($2::uuid[])
+	`
+	_, err := tx.ExecContext(ctx, query, tenantID, ids)
+	return err
+}
+
+// deviceIDs returns the IDs of devices.
+func deviceIDs(devices []*model.Device) []string {
+	ids := make([]string, len(devices))
+	for i, d := range devices {
+		ids[i] = d.ID
+	}
+	return ids
+}
+
+// currentAt is the condition selecting the versions of device_versions that
+// were current at the time in the given parameter.
+func currentAt(param int) string {
+	return fmt.Sprintf("valid_from <= $%d AND (valid_to IS NULL OR valid_to > $%d)", param, param)
+}
+
+// GetByIDAsOf returns the device with the given ID as it was at the given
+// time, or nil if it did not exist then or the ID is not a valid UUID.
+func (r *DeviceRepository) GetByIDAsOf(ctx context.Context, id string, at time.Time) (*model.Device, error) {
+	deviceID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM device_versions
+		WHERE id = $1 AND tenant_id = $2 AND ` + currentAt(3)
+
+	var d model.Device
+	err = scanDevice(tx.QueryRowContext(ctx, query, deviceID, tenantID, at), &d)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &d, tx.Commit()
+}
+
+// ListAsOf returns a page of the devices that matched filter at the given
+// time, as they were then, newest first.
+func (r *DeviceRepository) ListAsOf(ctx context.Context, filter model.DeviceFilter, at time.Time, limit, offset int) ([]model.Device, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// device_versions has the columns of devices that whereDevices filters
+	// on.
+	where, args := whereDevices(tenantID, filter)
+	args = append(args, at, limit, offset)
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM device_versions
+		` + where + ` AND ` + currentAt(len(args)-2) + `
+		ORDER BY created_at DESC, id
+		LIMIT $` + fmt.Sprint(len(args)-1) + ` OFFSET $` + fmt.Sprint(len(args))
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices, err := scanDevices(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, tx.Commit()
+}
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestDeviceRepository_VersionsAsOf(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	// Versions are stamped by the database clock.
+	clock := func() time.Time {
+		t.Helper()
+		var now time.Time
+		if err := db.QueryRowContext(ctx, `SELECT clock_timestamp()`).Scan(&now); err != nil {
+			t.Fatalf("clock: %v", err)
+		}
+		return now
+	}
+
+	brand := createTestBrand(t, r, ctx, "Google")
+	beforeCreate := clock()
+	d := &model.Device{ID: uuid.NewString(), Name: "Pixel", Brand: brand.Name, BrandID: brand.ID, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := r.Create(ctx, d); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	created := clock()
+
+	d.State, d.UpdatedAt = model.StateInUse, time.Now()
+	if err := r.Update(ctx, d); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	updated := clock()
+
+	if err := r.Delete(ctx, d.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	for _, tc := range []struct {
+		at    time.Time
+		state model.DeviceState
+	}{
+		{beforeCreate, ""},
+		{created, model.StateAvailable},
+		{updated, model.StateInUse},
+		{clock(), ""},
+	} {
+		got, err := r.GetByIDAsOf(ctx, d.ID, tc.at)
+		if err != nil {
+			t.Fatalf("get as of %v: %v", tc.at, err)
+		}
+		if tc.state == "" && got != nil || tc.state != "" && (got == nil || got.State != tc.state) {
+			t.Fatalf("as of %v: expected state %q, got %+v", tc.at, tc.state, got)
+		}
+	}
+
+	devices, err := r.ListAsOf(ctx, model.DeviceFilter{State: string(model.StateAvailable)}, created, 10, 0)
+	if err != nil {
+		t.Fatalf("list as of: %v", err)
+	}
+	if len(devices) != 1 || devices[0].ID != d.ID {
+		t.Fatalf("expected the device as it was, got %+v", devices)
+	}
+	devices, err = r.ListAsOf(ctx, model.DeviceFilter{State: string(model.StateAvailable)}, updated, 10, 0)
+	if err != nil || len(devices) != 0 {
+		t.Fatalf("expected no available device once in use, got %+v, %v", devices, err)
+	}
+}
+
+func TestDeviceRepository_VersionsAsOfIgnoreInvalidIDs(t *testing.T) {
+	// Invalid IDs never reach the database.
+	r := NewDeviceRepository(nil)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	if got, err := r.GetByIDAsOf(ctx, "not-a-uuid", time.Now()); err != nil || got != nil {
+		t.Fatalf("expected no device, got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// uniqueViolation is the SQLSTATE of a unique constraint violation.
+const uniqueViolation = "23505"
+
+// exclusionViolation is the SQLSTATE of an exclusion constraint violation.
+const exclusionViolation = "23P01"
+
+// uniqueIndexFields maps the unique indexes to the field they guard.
+var uniqueIndexFields = map[string]string{
+	"devices_serial_number_idx": "serial_number",
+	"devices_asset_tag_idx":     "asset_tag",
+	"device_models_name_idx":    "name",
+	"locations_name_idx":        "name",
+	"holders_external_id_idx":   "external_id",
+}
+
+// duplicateError turns a unique violation into a *model.DuplicateError
+// naming the field guarded by the violated index. Other errors are returned
+// unchanged.
+func duplicateError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return &model.DuplicateError{Field: uniqueIndexFields[pgErr.ConstraintName]}
+	}
+	return err
+}
+
+// violatesExclusion reports whether err is a violation of the named
+// exclusion constraint.
+func violatesExclusion(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == exclusionViolation && pgErr.ConstraintName == constraint
+}
+
+// violatesUnique reports whether err is a violation of the named unique
+// index.
+func violatesUnique(err error, index string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation && pgErr.ConstraintName == index
+}
@@ -0,0 +1,52 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+func TestDuplicateError(t *testing.T) {
+	err := duplicateError(fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505", ConstraintName: "devices_serial_number_idx"}))
+	var dup *model.DuplicateError
+	if !errors.As(err, &dup) || dup.Field != "serial_number" {
+		t.Fatalf("expected a duplicate serial_number, got %v", err)
+	}
+	if err.Error() != "serial_number already in use" {
+		t.Fatalf("unexpected message %q", err.Error())
+	}
+
+	other := &pgconn.PgError{Code: "23503", ConstraintName: "devices_model_id_fkey"}
+	if err := duplicateError(other); err != other {
+		t.Fatalf("expected other errors unchanged, got %v", err)
+	}
+}
+
+func TestViolatesExclusion(t *testing.T) {
+	err := fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23P01", ConstraintName: "device_assignments_no_overlap"})
+	if !violatesExclusion(err, "device_assignments_no_overlap") {
+		t.Fatalf("expected the exclusion violation to be recognized")
+	}
+	if violatesExclusion(err, "other_constraint") {
+		t.Fatalf("expected other constraints not to match")
+	}
+	if violatesExclusion(&pgconn.PgError{Code: "23505", ConstraintName: "device_assignments_no_overlap"}, "device_assignments_no_overlap") {
+		t.Fatalf("expected other violations not to match")
+	}
+}
+
+func TestViolatesUnique(t *testing.T) {
+	err := fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23505", ConstraintName: "maintenance_records_open_idx"})
+	if !violatesUnique(err, "maintenance_records_open_idx") {
+		t.Fatalf("expected the unique violation to be recognized")
+	}
+	if violatesUnique(err, "devices_serial_number_idx") {
+		t.Fatalf("expected other indexes not to match")
+	}
+	if violatesUnique(&pgconn.PgError{Code: "23P01", ConstraintName: "maintenance_records_open_idx"}, "maintenance_records_open_idx") {
+		t.Fatalf("expected other violations not to match")
+	}
+}
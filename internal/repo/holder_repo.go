@@ -0,0 +1,312 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+const holderColumns = `id, kind, name, COALESCE(external_id, ''), created_at, updated_at`
+
+const assignmentColumns = `id, device_id, holder_id, note, started_at, ended_at`
+
+func scanHolder(row rowScanner, h *model.Holder) error {
+	return row.Scan(&h.ID, &h.Kind, &h.Name, &h.ExternalID, &h.CreatedAt, &h.UpdatedAt)
+}
+
+func scanAssignment(row rowScanner, a *model.Assignment) error {
+	return row.Scan(&a.ID, &a.DeviceID, &a.HolderID, &a.Note, &a.StartedAt, &a.EndedAt)
+}
+
+// Holders returns a page of holders by name. A non-empty kind restricts it
+// to the holders of that kind, and a non-empty externalID to the holders
+// with that external ID.
+func (r *DeviceRepository) Holders(ctx context.Context, kind, externalID string, limit, offset int) ([]model.Holder, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + holderColumns + `
+		FROM holders
+		WHERE tenant_id = $1 AND ($2 = '' OR kind = $2) AND ($3 = '' OR external_id = $3)
+		ORDER BY lower(name), id
+		LIMIT $4 OFFSET $5
+	`
+	rows, err := tx.QueryContext(ctx, query, tenantID, kind, externalID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holders := []model.Holder{}
+	for rows.Next() {
+		var h model.Holder
+		if err := scanHolder(rows, &h); err != nil {
+			return nil, err
+		}
+		holders = append(holders, h)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return holders, tx.Commit()
+}
+
+// Holder returns the holder with the given ID, or nil if it does not exist.
+func (r *DeviceRepository) Holder(ctx context.Context, id string) (*model.Holder, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + holderColumns + ` FROM holders WHERE id::text = $1 AND tenant_id = $2`
+
+	var h model.Holder
+	err = scanHolder(tx.QueryRowContext(ctx, query, id, tenantID), &h)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &h, tx.Commit()
+}
+
+// CreateHolder adds a holder.
+func (r *DeviceRepository) CreateHolder(ctx context.Context, h *model.Holder) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO holders (id, tenant_id, kind, name, external_id, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)
+	`
+	if _, err := tx.ExecContext(ctx, query, h.ID, tenantID, h.Kind, h.Name, h.ExternalID, h.CreatedAt, h.UpdatedAt); err != nil {
+		return duplicateError(err)
+	}
+
+	return tx.Commit()
+}
+
+// UpdateHolder saves every field of a holder.
+func (r *DeviceRepository) UpdateHolder(ctx context.Context, h *model.Holder) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE holders
+		SET kind = $1, name = $2, external_id = NULLIF($3, ''), updated_at = $4
+		WHERE id = $5 AND tenant_id = $6
+	`
+	if _, err := tx.ExecContext(ctx, query, h.Kind, h.Name, h.ExternalID, h.UpdatedAt, h.ID, tenantID); err != nil {
+		return duplicateError(err)
+	}
+
+	return tx.Commit()
+}
+
+// DeleteHolder removes a holder. The boolean is false if it did not exist.
+func (r *DeviceRepository) DeleteHolder(ctx context.Context, id string) (bool, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM holders WHERE id::text = $1 AND tenant_id = $2`, id, tenantID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, tx.Commit()
+}
+
+// HolderDevices returns a page of the devices a holder currently holds, the
+// most recently assigned first.
+func (r *DeviceRepository) HolderDevices(ctx context.Context, holderID string, limit, offset int) ([]model.Device, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		JOIN (
+			SELECT device_id, started_at FROM device_assignments
+			WHERE holder_id = $1 AND tenant_id = $2 AND ended_at IS NULL
+		) a ON a.device_id = devices.id
+		WHERE tenant_id = $2
+		ORDER BY a.started_at DESC, id
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := tx.QueryContext(ctx, query, holderID, tenantID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices, err := scanDevices(rows)
+	if err != nil {
+		return nil, err
+	}
+	if devices == nil {
+		devices = []model.Device{}
+	}
+
+	return devices, tx.Commit()
+}
+
+// Assignments returns a page of the assignments matching filter, the most
+// recently started first.
+func (r *DeviceRepository) Assignments(ctx context.Context, filter model.AssignmentFilter, limit, offset int) ([]model.Assignment, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	conds := []string{"tenant_id = $1"}
+	args := []any{tenantID}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.DeviceID != "" {
+		add("device_id = $%d", filter.DeviceID)
+	}
+	if filter.HolderID != "" {
+		add("holder_id = $%d", filter.HolderID)
+	}
+	if filter.Active {
+		conds = append(conds, "ended_at IS NULL")
+	}
+	args = append(args, limit, offset)
+
+	query := fmt.Sprintf(`
+		SELECT `+assignmentColumns+`
+		FROM device_assignments
+		WHERE %s
+		ORDER BY started_at DESC, id
+		LIMIT $%d OFFSET $%d
+	`, strings.Join(conds, " AND "), len(args)-1, len(args))
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	assignments := []model.Assignment{}
+	for rows.Next() {
+		var a model.Assignment
+		if err := scanAssignment(rows, &a); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return assignments, tx.Commit()
+}
+
+// Assign records a new assignment along with the state and updated_at of
+// its device. It returns model.ErrAlreadyAssigned if the device already has
+// an active assignment.
+func (r *DeviceRepository) Assign(ctx context.Context, d *model.Device, a *model.Assignment) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO device_assignments (id, tenant_id, device_id, holder_id, note, started_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := tx.ExecContext(ctx, query, a.ID, tenantID, a.DeviceID, a.HolderID, a.Note, a.StartedAt); err != nil {
+		if violatesExclusion(err, "device_assignments_no_overlap") {
+			return model.ErrAlreadyAssigned
+		}
+		return err
+	}
+
+	if err := setState(ctx, tx, tenantID, d); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// EndAssignment stores the end of an assignment along with the state and
+// updated_at of its device. A device made available while an active
+// reservation covers the end stays in use for that reservation instead,
+// which then frees it when it ends.
+func (r *DeviceRepository) EndAssignment(ctx context.Context, d *model.Device, a *model.Assignment) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE device_assignments SET ended_at = $1 WHERE id = $2 AND tenant_id = $3`
+	if _, err := tx.ExecContext(ctx, query, a.EndedAt, a.ID, tenantID); err != nil {
+		return err
+	}
+
+	if d.State == model.StateAvailable {
+		query := `
+			UPDATE device_reservations SET applied = true
+			WHERE tenant_id = $1 AND device_id = $2 AND status = $3 AND starts_at <= $4 AND ends_at > $4
+		`
+		res, err := tx.ExecContext(ctx, query, tenantID, d.ID, model.ReservationActive, a.EndedAt)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n > 0 {
+			d.State = model.StateInUse
+		}
+	}
+
+	if err := setState(ctx, tx, tenantID, d); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// setState stores the state and updated_at of a device within tx, and
+// records the change of state and the new version of the device.
+func setState(ctx context.Context, tx *sql.Tx, tenantID string, d *model.Device) error {
+	query := `UPDATE devices SET state = $1, updated_at = $2 WHERE id = $3 AND tenant_id = $4`
+	if _, err := tx.ExecContext(ctx, query, d.State, d.UpdatedAt, d.ID, tenantID); err != nil {
+		return err
+	}
+	if err := recordStates(ctx, tx, tenantID, d); err != nil {
+		return err
+	}
+	return recordVersions(ctx, tx, tenantID, d.ID)
+}
@@ -0,0 +1,126 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestDeviceRepository_OneActiveAssignment(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	brand := createTestBrand(t, r, ctx, "Dell")
+	d := &model.Device{ID: uuid.NewString(), Name: "Laptop", Brand: brand.Name, BrandID: brand.ID, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := r.Create(ctx, d); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	var holders []*model.Holder
+	for _, name := range []string{"Ana", "Platform"} {
+		h := &model.Holder{ID: uuid.NewString(), Kind: model.HolderPerson, Name: name, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if err := r.CreateHolder(ctx, h); err != nil {
+			t.Fatalf("create holder: %v", err)
+		}
+		holders = append(holders, h)
+	}
+	// Deleting the device deletes its assignments, which the holders need
+	// gone first.
+	t.Cleanup(func() {
+		_ = r.Delete(ctx, d.ID)
+		for _, h := range holders {
+			_, _ = r.DeleteHolder(ctx, h.ID)
+		}
+	})
+
+	assign := func(h *model.Holder) (*model.Assignment, error) {
+		a := &model.Assignment{ID: uuid.NewString(), DeviceID: d.ID, HolderID: h.ID, StartedAt: time.Now()}
+		d.State, d.UpdatedAt = model.StateInUse, a.StartedAt
+		return a, r.Assign(ctx, d, a)
+	}
+
+	first, err := assign(holders[0])
+	if err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+	if _, err := assign(holders[1]); !errors.Is(err, model.ErrAlreadyAssigned) {
+		t.Fatalf("expected ErrAlreadyAssigned, got %v", err)
+	}
+
+	ended := time.Now()
+	first.EndedAt = &ended
+	d.State, d.UpdatedAt = model.StateAvailable, ended
+	if err := r.EndAssignment(ctx, d, first); err != nil {
+		t.Fatalf("end assignment: %v", err)
+	}
+	if _, err := assign(holders[1]); err != nil {
+		t.Fatalf("expected a new assignment once the first ended, got %v", err)
+	}
+
+	devices, err := r.HolderDevices(ctx, holders[1].ID, 10, 0)
+	if err != nil {
+		t.Fatalf("holder devices: %v", err)
+	}
+	if len(devices) != 1 || devices[0].ID != d.ID || devices[0].State != model.StateInUse {
+		t.Fatalf("expected the device to be held by the second holder, got %+v", devices)
+	}
+}
+
+func TestDeviceRepository_EndAssignmentKeepsReservedDeviceInUse(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	brand := createTestBrand(t, r, ctx, "Dell")
+	d := &model.Device{ID: uuid.NewString(), Name: "Laptop", Brand: brand.Name, BrandID: brand.ID, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := r.Create(ctx, d); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	h := &model.Holder{ID: uuid.NewString(), Kind: model.HolderPerson, Name: "Ana", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := r.CreateHolder(ctx, h); err != nil {
+		t.Fatalf("create holder: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = r.Delete(ctx, d.ID)
+		_, _ = r.DeleteHolder(ctx, h.ID)
+	})
+
+	a := &model.Assignment{ID: uuid.NewString(), DeviceID: d.ID, HolderID: h.ID, StartedAt: time.Now()}
+	d.State, d.UpdatedAt = model.StateInUse, a.StartedAt
+	if err := r.Assign(ctx, d, a); err != nil {
+		t.Fatalf("assign: %v", err)
+	}
+
+	// The reservation started while the device was assigned, so it did not
+	// put the device in use itself.
+	now := time.Now()
+	res := &model.Reservation{ID: uuid.NewString(), DeviceID: d.ID, StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour), Status: model.ReservationActive, CreatedAt: now}
+	if err := r.CreateReservation(ctx, res); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+
+	a.EndedAt = &now
+	d.State, d.UpdatedAt = model.StateAvailable, now
+	if err := r.EndAssignment(ctx, d, a); err != nil {
+		t.Fatalf("end assignment: %v", err)
+	}
+	if d.State != model.StateInUse {
+		t.Fatalf("expected the device to stay in use, got %s", d.State)
+	}
+
+	got, err := r.GetByID(ctx, d.ID)
+	if err != nil || got.State != model.StateInUse {
+		t.Fatalf("expected the stored device to be in use, got %+v, %v", got, err)
+	}
+	stored, err := r.Reservation(ctx, res.ID)
+	if err != nil || !stored.Applied {
+		t.Fatalf("expected the reservation to hold the device, got %+v, %v", stored, err)
+	}
+}
@@ -0,0 +1,106 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+type IdempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db}
+}
+
+// Reserve claims key for the current tenant. If the key is new (or its
+// previous record has expired) it is stored with the given fingerprint and
+// Reserve returns true. Otherwise the existing record is returned.
+func (r *IdempotencyRepository) Reserve(ctx context.Context, key, fingerprint string, ttl time.Duration) (*model.IdempotencyRecord, bool, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx,
+		`DELETE FROM idempotency_keys WHERE tenant_id = $1 AND key = $2 AND expires_at < now()`,
+		tenantID, key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	query := `
+		INSERT INTO idempotency_keys (tenant_id, key, fingerprint, expires_at)
+		VALUES ($1, $2, $3, now() + $4 * interval '1 second')
+		ON CONFLICT (tenant_id, key) DO NOTHING
+	`
+	res, err := tx.ExecContext(ctx, query, tenantID, key, fingerprint, int64(ttl.Seconds()))
+	if err != nil {
+		return nil, false, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, false, err
+	} else if n == 1 {
+		return &model.IdempotencyRecord{Key: key, Fingerprint: fingerprint}, true, tx.Commit()
+	}
+
+	query = `
+		SELECT fingerprint, COALESCE(status_code, 0), COALESCE(content_type, ''), response_body
+		FROM idempotency_keys
+		WHERE tenant_id = $1 AND key = $2
+	`
+	rec := model.IdempotencyRecord{Key: key}
+	err = tx.QueryRowContext(ctx, query, tenantID, key).
+		Scan(&rec.Fingerprint, &rec.StatusCode, &rec.ContentType, &rec.ResponseBody)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &rec, false, tx.Commit()
+}
+
+// Complete stores the response of the request that reserved key.
+func (r *IdempotencyRepository) Complete(ctx context.Context, key string, statusCode int, contentType string, body []byte) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE idempotency_keys
+		SET status_code = $1, content_type = $2, response_body = $3
+		WHERE tenant_id = $4 AND key = $5
+	`
+	if _, err := tx.ExecContext(ctx, query, statusCode, contentType, body, tenantID, key); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Release drops the reservation of key so that the request can be retried.
+func (r *IdempotencyRepository) Release(ctx context.Context, key string) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE tenant_id = $1 AND key = $2`, tenantID, key); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PurgeExpired deletes the keys of every tenant that expired before the
+// given time. It reads across tenants, so it runs without a tenant.
+func (r *IdempotencyRepository) PurgeExpired(ctx context.Context, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `SELECT purge_idempotency_keys($1)`, at)
+	return err
+}
@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestIdempotencyRepository_PurgeExpired(t *testing.T) {
+	db := openTestDB(t)
+	r := NewIdempotencyRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	for key, ttl := range map[string]time.Duration{"expired": -time.Hour, "live": time.Hour} {
+		if _, reserved, err := r.Reserve(ctx, key, "fingerprint", ttl); err != nil || !reserved {
+			t.Fatalf("reserve %s: %v, %v", key, reserved, err)
+		}
+		t.Cleanup(func() { _ = r.Release(ctx, key) })
+	}
+
+	if err := r.PurgeExpired(context.Background(), time.Now()); err != nil {
+		t.Fatalf("purge: %v", err)
+	}
+
+	tx, tenantID, err := beginTenantTx(ctx, db)
+	if err != nil {
+		t.Fatalf("begin: %v", err)
+	}
+	defer tx.Rollback()
+
+	var keys []string
+	rows, err := tx.QueryContext(ctx, `SELECT key FROM idempotency_keys WHERE tenant_id = $1`, tenantID)
+	if err != nil {
+		t.Fatalf("select: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			t.Fatalf("scan: %v", err)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) != 1 || keys[0] != "live" {
+		t.Fatalf("expected only the live key to remain, got %v", keys)
+	}
+}
@@ -0,0 +1,252 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// locationColumns are read from locations as l. The path is built from the
+// closure table, from the site down.
+const locationColumns = `l.id, COALESCE(l.parent_id::text, ''), l.kind, l.name,
+	(SELECT array_to_json(array_agg(a.name ORDER BY p.depth DESC))
+	 FROM location_paths p JOIN locations a ON a.id = p.ancestor_id
+	 WHERE p.descendant_id = l.id),
+	l.created_at, l.updated_at`
+
+func scanLocation(row rowScanner, l *model.Location) error {
+	var path []byte
+	if err := row.Scan(&l.ID, &l.ParentID, &l.Kind, &l.Name, &path, &l.CreatedAt, &l.UpdatedAt); err != nil {
+		return err
+	}
+	return json.Unmarshal(path, &l.Path)
+}
+
+// Locations returns a page of locations by name. A non-empty parentID
+// restricts it to the children of that location, and a non-empty kind to
+// the locations of that kind.
+func (r *DeviceRepository) Locations(ctx context.Context, parentID, kind string, limit, offset int) ([]model.Location, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + locationColumns + `
+		FROM locations l
+		WHERE l.tenant_id = $1 AND ($2 = '' OR l.parent_id::text = $2) AND ($3 = '' OR l.kind = $3)
+		ORDER BY lower(l.name), l.id
+		LIMIT $4 OFFSET $5
+	`
+	rows, err := tx.QueryContext(ctx, query, tenantID, parentID, kind, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	locations := []model.Location{}
+	for rows.Next() {
+		var l model.Location
+		if err := scanLocation(rows, &l); err != nil {
+			return nil, err
+		}
+		locations = append(locations, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return locations, tx.Commit()
+}
+
+// Location returns the location with the given ID, or nil if it does not
+// exist.
+func (r *DeviceRepository) Location(ctx context.Context, id string) (*model.Location, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + locationColumns + ` FROM locations l WHERE l.id::text = $1 AND l.tenant_id = $2`
+
+	var l model.Location
+	err = scanLocation(tx.QueryRowContext(ctx, query, id, tenantID), &l)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &l, tx.Commit()
+}
+
+// CreateLocation adds a location under its parent, along with its paths to
+// itself and to each of the parent's ancestors.
+func (r *DeviceRepository) CreateLocation(ctx context.Context, l *model.Location) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO locations (id, tenant_id, parent_id, kind, name, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5, $6, $7)
+	`
+	if _, err := tx.ExecContext(ctx, query, l.ID, tenantID, l.ParentID, l.Kind, l.Name, l.CreatedAt, l.UpdatedAt); err != nil {
+		return duplicateError(err)
+	}
+
+	query = `
+		INSERT INTO location_paths (tenant_id, ancestor_id, descendant_id, depth)
+		SELECT $1::text, ancestor_id, $2::uuid, depth + 1 FROM location_paths
+		WHERE descendant_id = NULLIF($3, '')::uuid AND tenant_id = $1
+		UNION ALL
+		SELECT $1::text, $2::uuid, $2::uuid, 0
+	`
+	if _, err := tx.ExecContext(ctx, query, tenantID, l.ID, l.ParentID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateLocation saves the name and parent of a location. The paths of the
+// location and everything under it are rebuilt under the new parent, so the
+// subtree moves with it.
+func (r *DeviceRepository) UpdateLocation(ctx context.Context, l *model.Location) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE locations
+		SET parent_id = NULLIF($1, '')::uuid, name = $2, updated_at = $3
+		WHERE id = $4 AND tenant_id = $5
+	`
+	if _, err := tx.ExecContext(ctx, query, l.ParentID, l.Name, l.UpdatedAt, l.ID, tenantID); err != nil {
+		return duplicateError(err)
+	}
+
+	// Detach the subtree from the ancestors of its old parent, then attach
+	// it to those of the new one.
+	query = `
+		DELETE FROM location_paths
+		WHERE tenant_id = $1
+		  AND descendant_id IN (SELECT descendant_id FROM location_paths WHERE ancestor_id = $2)
+		  AND ancestor_id NOT IN (SELECT descendant_id FROM location_paths WHERE ancestor_id = $2)
+	`
+	if _, err := tx.ExecContext(ctx, query, tenantID, l.ID); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO location_paths (tenant_id, ancestor_id, descendant_id, depth)
+		SELECT $1::text, above.ancestor_id, below.descendant_id, above.depth + below.depth + 1
+		FROM location_paths above CROSS JOIN location_paths below
+		WHERE above.descendant_id = NULLIF($2, '')::uuid AND above.tenant_id = $1
+		  AND below.ancestor_id = $3::uuid AND below.tenant_id = $1
+	`
+	if _, err := tx.ExecContext(ctx, query, tenantID, l.ParentID, l.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteLocation removes a location and its paths. The boolean is false if
+// it did not exist.
+func (r *DeviceRepository) DeleteLocation(ctx context.Context, id string) (bool, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM locations WHERE id::text = $1 AND tenant_id = $2`, id, tenantID)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, tx.Commit()
+}
+
+// MoveDevice stores the location of a device, where an empty LocationID
+// clears it, and its updated_at, and records the move in its history.
+func (r *DeviceRepository) MoveDevice(ctx context.Context, d *model.Device, m *model.DeviceMove) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE devices
+		SET location_id = NULLIF($1, '')::uuid, updated_at = $2
+		WHERE id = $3 AND tenant_id = $4
+	`
+	if _, err := tx.ExecContext(ctx, query, d.LocationID, d.UpdatedAt, d.ID, tenantID); err != nil {
+		return err
+	}
+	if err := recordVersions(ctx, tx, tenantID, d.ID); err != nil {
+		return err
+	}
+
+	query = `
+		INSERT INTO device_moves (id, tenant_id, device_id, from_location_id, to_location_id, note, moved_at)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, NULLIF($5, '')::uuid, $6, $7)
+	`
+	if _, err := tx.ExecContext(ctx, query, m.ID, tenantID, m.DeviceID, m.FromLocationID, m.ToLocationID, m.Note, m.MovedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeviceMoves returns a page of the location history of a device, the most
+// recent move first.
+func (r *DeviceRepository) DeviceMoves(ctx context.Context, deviceID string, limit, offset int) ([]model.DeviceMove, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT id, device_id, COALESCE(from_location_id::text, ''), COALESCE(to_location_id::text, ''), note, moved_at
+		FROM device_moves
+		WHERE device_id = $1 AND tenant_id = $2
+		ORDER BY moved_at DESC, id
+		LIMIT $3 OFFSET $4
+	`
+	rows, err := tx.QueryContext(ctx, query, deviceID, tenantID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	moves := []model.DeviceMove{}
+	for rows.Next() {
+		var m model.DeviceMove
+		if err := rows.Scan(&m.ID, &m.DeviceID, &m.FromLocationID, &m.ToLocationID, &m.Note, &m.MovedAt); err != nil {
+			return nil, err
+		}
+		moves = append(moves, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return moves, tx.Commit()
+}
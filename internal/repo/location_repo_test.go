@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestDeviceRepository_LocationSubtree(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	brand := createTestBrand(t, r, ctx, "Apple")
+	var created []*model.Location
+	location := func(parent *model.Location, kind model.LocationKind, name string) *model.Location {
+		l := &model.Location{ID: uuid.NewString(), Kind: kind, Name: name, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if parent != nil {
+			l.ParentID = parent.ID
+		}
+		if err := r.CreateLocation(ctx, l); err != nil {
+			t.Fatalf("create location: %v", err)
+		}
+		created = append(created, l)
+		return l
+	}
+	t.Cleanup(func() {
+		for i := len(created) - 1; i >= 0; i-- {
+			_, _ = r.DeleteLocation(ctx, created[i].ID)
+		}
+	})
+
+	site := location(nil, model.LocationSite, "Lisbon")
+	hq := location(site, model.LocationBuilding, "HQ")
+	annex := location(site, model.LocationBuilding, "Annex")
+	lab := location(hq, model.LocationRoom, "Lab")
+	shelf := location(lab, model.LocationShelf, "A1")
+
+	d := &model.Device{ID: uuid.NewString(), Name: "Phone", Brand: brand.Name, BrandID: brand.ID, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := r.Create(ctx, d); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+
+	d.LocationID, d.UpdatedAt = shelf.ID, time.Now()
+	move := &model.DeviceMove{ID: uuid.NewString(), DeviceID: d.ID, ToLocationID: shelf.ID, MovedAt: d.UpdatedAt}
+	if err := r.MoveDevice(ctx, d, move); err != nil {
+		t.Fatalf("move device: %v", err)
+	}
+
+	within := func(l *model.Location) int {
+		devices, err := r.List(ctx, model.DeviceFilter{LocationID: l.ID, WithinLocation: true}, 10, 0)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		return len(devices)
+	}
+	if within(site) != 1 || within(hq) != 1 || within(annex) != 0 {
+		t.Fatalf("expected the device under the site and HQ only")
+	}
+
+	// Moving the room to the annex moves its shelf and device with it.
+	lab.ParentID, lab.UpdatedAt = annex.ID, time.Now()
+	if err := r.UpdateLocation(ctx, lab); err != nil {
+		t.Fatalf("update location: %v", err)
+	}
+	if within(hq) != 0 || within(annex) != 1 || within(site) != 1 {
+		t.Fatalf("expected the device to move with the room")
+	}
+
+	got, err := r.Location(ctx, shelf.ID)
+	if err != nil {
+		t.Fatalf("location: %v", err)
+	}
+	if strings.Join(got.Path, "/") != "Lisbon/Annex/Lab/A1" {
+		t.Fatalf("expected the path through the annex, got %v", got.Path)
+	}
+
+	moves, err := r.DeviceMoves(ctx, d.ID, 10, 0)
+	if err != nil {
+		t.Fatalf("device moves: %v", err)
+	}
+	if len(moves) != 1 || moves[0].FromLocationID != "" || moves[0].ToLocationID != shelf.ID {
+		t.Fatalf("unexpected moves %+v", moves)
+	}
+}
@@ -0,0 +1,172 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+const maintenanceColumns = `m.id, m.device_id, d.brand, m.diagnosis, m.resolution, m.cost_cents, m.previous_state, m.opened_at, m.closed_at`
+
+const maintenanceFrom = `maintenance_records m JOIN devices d ON d.id = m.device_id`
+
+func scanMaintenance(row rowScanner, rec *model.MaintenanceRecord) error {
+	return row.Scan(&rec.ID, &rec.DeviceID, &rec.Brand, &rec.Diagnosis, &rec.Resolution, &rec.CostCents, &rec.PreviousState, &rec.OpenedAt, &rec.ClosedAt)
+}
+
+// MaintenanceRecords returns a page of the maintenance records matching
+// filter, the most recently opened first.
+func (r *DeviceRepository) MaintenanceRecords(ctx context.Context, filter model.MaintenanceFilter, limit, offset int) ([]model.MaintenanceRecord, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	conds := []string{"m.tenant_id = $1"}
+	args := []any{tenantID}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.DeviceID != "" {
+		add("m.device_id = $%d", filter.DeviceID)
+	}
+	if filter.BrandID != "" {
+		add("d.brand_id = $%d", filter.BrandID)
+	}
+	if filter.Open {
+		conds = append(conds, "m.closed_at IS NULL")
+	}
+	args = append(args, limit, offset)
+
+	query := fmt.Sprintf(`
+		SELECT `+maintenanceColumns+`
+		FROM `+maintenanceFrom+`
+		WHERE %s
+		ORDER BY m.opened_at DESC, m.id
+		LIMIT $%d OFFSET $%d
+	`, strings.Join(conds, " AND "), len(args)-1, len(args))
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []model.MaintenanceRecord{}
+	for rows.Next() {
+		var rec model.MaintenanceRecord
+		if err := scanMaintenance(rows, &rec); err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return records, tx.Commit()
+}
+
+// OpenMaintenance records a new maintenance record along with the state and
+// updated_at of its device. It returns model.ErrUnderMaintenance if the
+// device already has an open record.
+func (r *DeviceRepository) OpenMaintenance(ctx context.Context, d *model.Device, rec *model.MaintenanceRecord) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO maintenance_records (id, tenant_id, device_id, diagnosis, previous_state, opened_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	if _, err := tx.ExecContext(ctx, query, rec.ID, tenantID, rec.DeviceID, rec.Diagnosis, rec.PreviousState, rec.OpenedAt); err != nil {
+		if violatesUnique(err, "maintenance_records_open_idx") {
+			return model.ErrUnderMaintenance
+		}
+		return err
+	}
+
+	if err := setState(ctx, tx, tenantID, d); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CloseMaintenance stores the diagnosis, resolution, cost and closing time
+// of a maintenance record along with the state and updated_at of its
+// device.
+func (r *DeviceRepository) CloseMaintenance(ctx context.Context, d *model.Device, rec *model.MaintenanceRecord) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE maintenance_records
+		SET diagnosis = $1, resolution = $2, cost_cents = $3, closed_at = $4
+		WHERE id = $5 AND tenant_id = $6
+	`
+	if _, err := tx.ExecContext(ctx, query, rec.Diagnosis, rec.Resolution, rec.CostCents, rec.ClosedAt, rec.ID, tenantID); err != nil {
+		return err
+	}
+
+	if err := setState(ctx, tx, tenantID, d); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RepairTimes summarizes, per brand, the maintenance records closed from
+// from to to, by brand name. A non-empty brandID restricts it to that brand,
+// and a zero from or to leaves that side of the period open.
+func (r *DeviceRepository) RepairTimes(ctx context.Context, brandID string, from, to time.Time) ([]model.RepairTime, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT b.id, b.name, count(*),
+		       EXTRACT(EPOCH FROM avg(m.closed_at - m.opened_at))::float8,
+		       COALESCE(sum(m.cost_cents), 0)::bigint
+		FROM ` + maintenanceFrom + `
+		JOIN brands b ON b.id = d.brand_id
+		WHERE m.tenant_id = $1 AND m.closed_at IS NOT NULL
+		  AND ($2::text = '' OR b.id::text = $2::text)
+		  AND ($3::timestamptz IS NULL OR m.closed_at >= $3::timestamptz)
+		  AND ($4::timestamptz IS NULL OR m.closed_at < $4::timestamptz)
+		GROUP BY b.id, b.name
+		ORDER BY lower(b.name), b.id
+	`
+	rows, err := tx.QueryContext(ctx, query, tenantID, brandID, nullTime(from), nullTime(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	times := []model.RepairTime{}
+	for rows.Next() {
+		var t model.RepairTime
+		var seconds float64
+		if err := rows.Scan(&t.BrandID, &t.Brand, &t.Repairs, &seconds, &t.CostCents); err != nil {
+			return nil, err
+		}
+		t.MeanTimeToRepair = time.Duration(seconds * float64(time.Second))
+		times = append(times, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return times, tx.Commit()
+}
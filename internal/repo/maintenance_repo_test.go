@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestDeviceRepository_MaintenanceAndRepairTimes(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	brand := createTestBrand(t, r, ctx, "Dell")
+	d := &model.Device{ID: uuid.NewString(), Name: "Laptop", Brand: brand.Name, BrandID: brand.ID, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := r.Create(ctx, d); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+
+	opened := time.Now().Add(-3 * time.Hour)
+	open := func() (*model.MaintenanceRecord, error) {
+		rec := &model.MaintenanceRecord{ID: uuid.NewString(), DeviceID: d.ID, Diagnosis: "fan noise", PreviousState: d.State, OpenedAt: opened}
+		d.State, d.UpdatedAt = model.StateInactive, opened
+		return rec, r.OpenMaintenance(ctx, d, rec)
+	}
+
+	rec, err := open()
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if _, err := open(); !errors.Is(err, model.ErrUnderMaintenance) {
+		t.Fatalf("expected ErrUnderMaintenance, got %v", err)
+	}
+
+	records, err := r.MaintenanceRecords(ctx, model.MaintenanceFilter{BrandID: brand.ID, Open: true}, 10, 0)
+	if err != nil {
+		t.Fatalf("maintenance records: %v", err)
+	}
+	if len(records) != 1 || records[0].ID != rec.ID || records[0].Brand != brand.Name {
+		t.Fatalf("expected the open record of the brand, got %+v", records)
+	}
+
+	closed := opened.Add(2 * time.Hour)
+	cost := int64(4500)
+	rec.Resolution, rec.CostCents, rec.ClosedAt = "replaced the fan", &cost, &closed
+	d.State, d.UpdatedAt = model.StateAvailable, closed
+	if err := r.CloseMaintenance(ctx, d, rec); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	times, err := r.RepairTimes(ctx, brand.ID, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("repair times: %v", err)
+	}
+	if len(times) != 1 || times[0].Repairs != 1 || times[0].MeanTimeToRepair.Round(time.Second) != 2*time.Hour || times[0].CostCents != cost {
+		t.Fatalf("expected one repair of two hours, got %+v", times)
+	}
+}
@@ -0,0 +1,266 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+const reservationColumns = `id, device_id, COALESCE(holder_id::text, ''), note, starts_at, ends_at, status, applied, created_at`
+
+func scanReservation(row rowScanner, res *model.Reservation) error {
+	return row.Scan(&res.ID, &res.DeviceID, &res.HolderID, &res.Note, &res.StartsAt, &res.EndsAt, &res.Status, &res.Applied, &res.CreatedAt)
+}
+
+func scanReservations(rows *sql.Rows) ([]model.Reservation, error) {
+	reservations := []model.Reservation{}
+	for rows.Next() {
+		var res model.Reservation
+		if err := scanReservation(rows, &res); err != nil {
+			return nil, err
+		}
+		reservations = append(reservations, res)
+	}
+	return reservations, rows.Err()
+}
+
+// Reservations returns a page of the reservations of a device that overlap
+// the period from from to to, in order of start. A zero from or to leaves
+// that side of the period open.
+func (r *DeviceRepository) Reservations(ctx context.Context, deviceID string, from, to time.Time, limit, offset int) ([]model.Reservation, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + reservationColumns + `
+		FROM device_reservations
+		WHERE device_id = $1 AND tenant_id = $2
+		  AND tstzrange(starts_at, ends_at, '[)') && tstzrange($3, $4, '[)')
+		ORDER BY starts_at, id
+		LIMIT $5 OFFSET $6
+	`
+	rows, err := tx.QueryContext(ctx, query, deviceID, tenantID, nullTime(from), nullTime(to), limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations, err := scanReservations(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return reservations, tx.Commit()
+}
+
+// Reservation returns the reservation with the given ID, or nil if it does
+// not exist.
+func (r *DeviceRepository) Reservation(ctx context.Context, id string) (*model.Reservation, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + reservationColumns + ` FROM device_reservations WHERE id::text = $1 AND tenant_id = $2`
+
+	var res model.Reservation
+	err = scanReservation(tx.QueryRowContext(ctx, query, id, tenantID), &res)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &res, tx.Commit()
+}
+
+// CreateReservation adds a reservation. It returns
+// model.ErrReservationConflict if it overlaps another reservation of the
+// device.
+func (r *DeviceRepository) CreateReservation(ctx context.Context, res *model.Reservation) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO device_reservations (id, tenant_id, device_id, holder_id, note, starts_at, ends_at, status, applied, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, $6, $7, $8, $9, $10)
+	`
+	_, err = tx.ExecContext(ctx, query, res.ID, tenantID, res.DeviceID, res.HolderID, res.Note, res.StartsAt, res.EndsAt, res.Status, res.Applied, res.CreatedAt)
+	if violatesExclusion(err, "device_reservations_no_overlap") {
+		return model.ErrReservationConflict
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteReservation removes a reservation that has not started. The boolean
+// is false if there is no such reservation.
+func (r *DeviceRepository) DeleteReservation(ctx context.Context, id string) (bool, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `DELETE FROM device_reservations WHERE id::text = $1 AND tenant_id = $2 AND status = $3`
+	res, err := tx.ExecContext(ctx, query, id, tenantID, model.ReservationScheduled)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, tx.Commit()
+}
+
+// Available returns a page of the devices matching filter that are free for
+// the whole period from from to to, newest first. Inactive devices, devices
+// with an active assignment and devices with a reservation overlapping the
+// period are not free.
+func (r *DeviceRepository) Available(ctx context.Context, filter model.DeviceFilter, from, to time.Time, limit, offset int) ([]model.Device, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	where, args := whereDevices(tenantID, filter)
+	args = append(args, model.StateInactive, from, to, limit, offset)
+	n := len(args)
+	query := `
+		SELECT ` + deviceColumns + `
+		FROM devices
+		` + where + fmt.Sprintf(`
+		  AND state <> $%d
+		  AND NOT EXISTS (
+			SELECT 1 FROM device_assignments a
+			WHERE a.device_id = devices.id AND a.ended_at IS NULL
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM device_reservations res
+			WHERE res.device_id = devices.id
+			  AND tstzrange(res.starts_at, res.ends_at, '[)') && tstzrange($%d, $%d, '[)')
+		  )
+		ORDER BY created_at DESC
+		LIMIT $%d OFFSET $%d`, n-4, n-3, n-2, n-1, n)
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices, err := scanDevices(rows)
+	if err != nil {
+		return nil, err
+	}
+	if devices == nil {
+		devices = []model.Device{}
+	}
+
+	return devices, tx.Commit()
+}
+
+// ReservationTenants returns the tenants that have reservations to start or
+// end at the given time. It reads across tenants, so it is the only
+// reservation query that runs without a tenant.
+func (r *DeviceRepository) ReservationTenants(ctx context.Context, at time.Time) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT due_reservation_tenants($1)`, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenants []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, id)
+	}
+	return tenants, rows.Err()
+}
+
+// DueReservations returns up to limit reservations of the tenant that are
+// scheduled to start, or active and due to end, at the given time, the
+// earliest first.
+func (r *DeviceRepository) DueReservations(ctx context.Context, at time.Time, limit int) ([]model.Reservation, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT ` + reservationColumns + `
+		FROM device_reservations
+		WHERE tenant_id = $1
+		  AND ((status = $2 AND starts_at <= $4) OR (status = $3 AND ends_at <= $4))
+		ORDER BY LEAST(starts_at, ends_at), id
+		LIMIT $5
+	`
+	rows, err := tx.QueryContext(ctx, query, tenantID, model.ReservationScheduled, model.ReservationActive, at, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reservations, err := scanReservations(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return reservations, tx.Commit()
+}
+
+// TransitionReservation stores the status and applied flag of a
+// reservation if its stored status is still from. The boolean is false if
+// it was not, such as when another replica of the job got to it first.
+func (r *DeviceRepository) TransitionReservation(ctx context.Context, res *model.Reservation, from model.ReservationStatus) (bool, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE device_reservations
+		SET status = $1, applied = $2
+		WHERE id = $3 AND tenant_id = $4 AND status = $5
+	`
+	result, err := tx.ExecContext(ctx, query, res.Status, res.Applied, res.ID, tenantID, from)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, tx.Commit()
+}
+
+// nullTime represents the zero time as NULL, which leaves a range open.
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,56 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestDeviceRepository_ReservationsDoNotOverlap(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	brand := createTestBrand(t, r, ctx, "Apple")
+	d := &model.Device{ID: uuid.NewString(), Name: "Phone", Brand: brand.Name, BrandID: brand.ID, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := r.Create(ctx, d); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+
+	start := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+	reserve := func(from, to time.Time) error {
+		res := &model.Reservation{ID: uuid.NewString(), DeviceID: d.ID, StartsAt: from, EndsAt: to, Status: model.ReservationScheduled, CreatedAt: time.Now()}
+		return r.CreateReservation(ctx, res)
+	}
+
+	if err := reserve(start, start.Add(2*time.Hour)); err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if err := reserve(start.Add(time.Hour), start.Add(3*time.Hour)); !errors.Is(err, model.ErrReservationConflict) {
+		t.Fatalf("expected ErrReservationConflict, got %v", err)
+	}
+	if err := reserve(start.Add(2*time.Hour), start.Add(3*time.Hour)); err != nil {
+		t.Fatalf("expected a back-to-back reservation to be allowed, got %v", err)
+	}
+
+	available := func(from, to time.Time) bool {
+		devices, err := r.Available(ctx, model.DeviceFilter{BrandID: brand.ID}, from, to, 10, 0)
+		if err != nil {
+			t.Fatalf("available: %v", err)
+		}
+		return len(devices) == 1 && devices[0].ID == d.ID
+	}
+	if available(start.Add(30*time.Minute), start.Add(time.Hour)) {
+		t.Fatalf("expected the device not to be available while reserved")
+	}
+	if !available(start.Add(3*time.Hour), start.Add(4*time.Hour)) {
+		t.Fatalf("expected the device to be available after its reservations")
+	}
+}
@@ -0,0 +1,199 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+const scheduledActionColumns = `id, tenant_id, device_id, action, COALESCE(state, ''), run_at, status, attempts, max_attempts, last_error, created_at, updated_at, completed_at`
+
+func scanScheduledAction(row rowScanner, a *model.ScheduledAction) error {
+	return row.Scan(&a.ID, &a.TenantID, &a.DeviceID, &a.Action, &a.State, &a.RunAt, &a.Status, &a.Attempts, &a.MaxAttempts, &a.LastError, &a.CreatedAt, &a.UpdatedAt, &a.CompletedAt)
+}
+
+func scanScheduledActions(rows *sql.Rows) ([]model.ScheduledAction, error) {
+	actions := []model.ScheduledAction{}
+	for rows.Next() {
+		var a model.ScheduledAction
+		if err := scanScheduledAction(rows, &a); err != nil {
+			return nil, err
+		}
+		actions = append(actions, a)
+	}
+	return actions, rows.Err()
+}
+
+// ScheduledActions returns a page of the scheduled actions matching filter,
+// the soonest to run first.
+func (r *DeviceRepository) ScheduledActions(ctx context.Context, filter model.ScheduledActionFilter, limit, offset int) ([]model.ScheduledAction, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	conds := []string{"tenant_id = $1"}
+	args := []any{tenantID}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+	if filter.DeviceID != "" {
+		add("device_id = $%d", filter.DeviceID)
+	}
+	if filter.Status != "" {
+		add("status = $%d", filter.Status)
+	}
+	args = append(args, limit, offset)
+
+	query := fmt.Sprintf(`
+		SELECT `+scheduledActionColumns+`
+		FROM scheduled_actions
+		WHERE %s
+		ORDER BY run_at, id
+		LIMIT $%d OFFSET $%d
+	`, strings.Join(conds, " AND "), len(args)-1, len(args))
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions, err := scanScheduledActions(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return actions, tx.Commit()
+}
+
+// ScheduledAction returns the scheduled action with the given ID, or nil if
+// it does not exist.
+func (r *DeviceRepository) ScheduledAction(ctx context.Context, id string) (*model.ScheduledAction, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + scheduledActionColumns + ` FROM scheduled_actions WHERE id::text = $1 AND tenant_id = $2`
+
+	var a model.ScheduledAction
+	err = scanScheduledAction(tx.QueryRowContext(ctx, query, id, tenantID), &a)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, tx.Commit()
+}
+
+// CreateScheduledAction adds a scheduled action.
+func (r *DeviceRepository) CreateScheduledAction(ctx context.Context, a *model.ScheduledAction) error {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO scheduled_actions (id, tenant_id, device_id, action, state, run_at, status, max_attempts, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10)
+	`
+	_, err = tx.ExecContext(ctx, query, a.ID, tenantID, a.DeviceID, a.Action, a.State, a.RunAt, a.Status, a.MaxAttempts, a.CreatedAt, a.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	a.TenantID = tenantID
+
+	return tx.Commit()
+}
+
+// CancelScheduledAction marks a pending scheduled action cancelled, unless
+// a replica of the scheduler holds a lease on it at the given time. The
+// boolean is false if the action was not cancelled, or the ID is not a
+// valid UUID.
+func (r *DeviceRepository) CancelScheduledAction(ctx context.Context, id string, at time.Time) (bool, error) {
+	actionID, err := uuid.Parse(id)
+	if err != nil {
+		return false, nil
+	}
+
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE scheduled_actions
+		SET status = $1, updated_at = $2, completed_at = $2
+		WHERE id = $3 AND tenant_id = $4 AND status = $5
+		  AND (locked_until IS NULL OR locked_until <= $2)
+	`
+	res, err := tx.ExecContext(ctx, query, model.ActionCancelled, at, actionID, tenantID, model.ActionPending)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, tx.Commit()
+}
+
+// ClaimScheduledActions leases up to limit pending actions of any tenant
+// that are due at the given time, until at plus lease, and counts the
+// attempt. Actions leased by another replica are skipped. It reads across
+// tenants, so it runs without a tenant.
+func (r *DeviceRepository) ClaimScheduledActions(ctx context.Context, at time.Time, lease time.Duration, limit int) ([]model.ScheduledAction, error) {
+	query := `
+		SELECT ` + scheduledActionColumns + `
+		FROM claim_scheduled_actions($1, $2 * interval '1 second', $3)
+		ORDER BY run_at, id
+	`
+	rows, err := r.db.QueryContext(ctx, query, at, lease.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanScheduledActions(rows)
+}
+
+// FinishScheduledAction stores the outcome of an attempt at a scheduled
+// action and releases its lease: its status, run_at, last_error and
+// completed_at. Nothing is stored if the action is no longer pending or has
+// been claimed again since, in which case the boolean is false.
+func (r *DeviceRepository) FinishScheduledAction(ctx context.Context, a *model.ScheduledAction) (bool, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	query := `
+		UPDATE scheduled_actions
+		SET status = $1, run_at = $2, last_error = $3, completed_at = $4, updated_at = $5, locked_until = NULL
+		WHERE id = $6 AND tenant_id = $7 AND status = $8 AND attempts = $9
+	`
+	res, err := tx.ExecContext(ctx, query, a.Status, a.RunAt, a.LastError, a.CompletedAt, a.UpdatedAt, a.ID, tenantID, model.ActionPending, a.Attempts)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, tx.Commit()
+}
@@ -0,0 +1,85 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestDeviceRepository_ClaimScheduledActions(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	tenantID := "tenant-" + uuid.NewString()
+	ctx := tenant.WithID(context.Background(), tenantID)
+
+	brand := createTestBrand(t, r, ctx, "Dell")
+	d := &model.Device{ID: uuid.NewString(), Name: "Laptop", Brand: brand.Name, BrandID: brand.ID, State: model.StateAvailable, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := r.Create(ctx, d); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+
+	// Due long ago, so that no other test's actions are due before them.
+	runAt := time.Date(1990, time.January, 1, 0, 0, 0, 0, time.UTC)
+	ids := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		a := &model.ScheduledAction{ID: uuid.NewString(), DeviceID: d.ID, Action: model.ActionSetState, State: model.StateInactive, RunAt: runAt.Add(time.Duration(i) * time.Hour), Status: model.ActionPending, MaxAttempts: 3, CreatedAt: time.Now(), UpdatedAt: time.Now()}
+		if err := r.CreateScheduledAction(ctx, a); err != nil {
+			t.Fatalf("create scheduled action: %v", err)
+		}
+		ids[a.ID] = true
+	}
+
+	at := runAt.Add(2 * time.Hour)
+	claim := func() []model.ScheduledAction {
+		claimed, err := r.ClaimScheduledActions(context.Background(), at, time.Hour, 1)
+		if err != nil {
+			t.Fatalf("claim: %v", err)
+		}
+		return claimed
+	}
+
+	first, second := claim(), claim()
+	if len(first) != 1 || len(second) != 1 || first[0].ID == second[0].ID || !ids[first[0].ID] || !ids[second[0].ID] {
+		t.Fatalf("expected each claim to lease a different action, got %+v and %+v", first, second)
+	}
+	if first[0].TenantID != tenantID || first[0].Attempts != 1 {
+		t.Fatalf("expected the claim to carry the tenant and count the attempt, got %+v", first[0])
+	}
+	if leased := claim(); len(leased) != 0 && ids[leased[0].ID] {
+		t.Fatalf("expected leased actions not to be claimed again, got %+v", leased)
+	}
+
+	a := first[0]
+	now := time.Now()
+	a.Status, a.CompletedAt, a.UpdatedAt = model.ActionDone, &now, now
+	if ok, err := r.FinishScheduledAction(ctx, &a); err != nil || !ok {
+		t.Fatalf("finish: %v, %v", ok, err)
+	}
+	if ok, err := r.CancelScheduledAction(ctx, a.ID, now); err != nil || ok {
+		t.Fatalf("expected a done action not to be cancelled, got %v, %v", ok, err)
+	}
+
+	pending, err := r.ScheduledActions(ctx, model.ScheduledActionFilter{Status: string(model.ActionPending)}, 10, 0)
+	if err != nil {
+		t.Fatalf("scheduled actions: %v", err)
+	}
+	if len(pending) != 1 || pending[0].ID != second[0].ID {
+		t.Fatalf("expected the second action to be pending, got %+v", pending)
+	}
+}
+
+func TestDeviceRepository_CancelScheduledActionIgnoresInvalidIDs(t *testing.T) {
+	// Invalid IDs never reach the database.
+	r := NewDeviceRepository(nil)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	if cancelled, err := r.CancelScheduledAction(ctx, "not-a-uuid", time.Now()); err != nil || cancelled {
+		t.Fatalf("expected nothing to be cancelled, got %v, %v", cancelled, err)
+	}
+}
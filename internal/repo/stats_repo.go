@@ -0,0 +1,78 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// statsColumns are the expressions devices are grouped by for each
+// dimension.
+var statsColumns = map[model.StatsDimension]string{
+	model.StatsByBrand: "brand",
+	model.StatsByState: "state",
+	model.StatsByMonth: "date_trunc('month', created_at, 'UTC')",
+}
+
+// CountDevices counts the devices matching filter, grouped by the given
+// dimensions in that order, and ordered by them. With no dimensions it
+// returns a single count of every matching device.
+func (r *DeviceRepository) CountDevices(ctx context.Context, filter model.DeviceFilter, by []model.StatsDimension) ([]model.DeviceCount, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	columns := make([]string, 0, len(by)+1)
+	positions := make([]string, len(by))
+	for i, d := range by {
+		column, ok := statsColumns[d]
+		if !ok {
+			return nil, fmt.Errorf("repo: unknown stats dimension %q", d)
+		}
+		columns = append(columns, column)
+		positions[i] = fmt.Sprint(i + 1)
+	}
+	columns = append(columns, "count(*)")
+
+	where, args := whereDevices(tenantID, filter)
+	query := `SELECT ` + strings.Join(columns, ", ") + ` FROM devices ` + where
+	if len(by) > 0 {
+		query += ` GROUP BY ` + strings.Join(positions, ", ") + ` ORDER BY ` + strings.Join(positions, ", ")
+	}
+
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []model.DeviceCount{}
+	for rows.Next() {
+		var c model.DeviceCount
+		dest := make([]any, 0, len(by)+1)
+		for _, d := range by {
+			switch d {
+			case model.StatsByBrand:
+				dest = append(dest, &c.Brand)
+			case model.StatsByState:
+				dest = append(dest, &c.State)
+			case model.StatsByMonth:
+				dest = append(dest, &c.Month)
+			}
+		}
+		if err := rows.Scan(append(dest, &c.Count)...); err != nil {
+			return nil, err
+		}
+		c.Month = c.Month.UTC()
+		counts = append(counts, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return counts, tx.Commit()
+}
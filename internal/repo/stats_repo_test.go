@@ -0,0 +1,60 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestDeviceRepository_CountDevices(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	apple := createTestBrand(t, r, ctx, "Apple")
+	dell := createTestBrand(t, r, ctx, "Dell")
+	march := time.Date(2026, time.March, 31, 23, 30, 0, 0, time.UTC)
+	april := time.Date(2026, time.April, 2, 8, 0, 0, 0, time.UTC)
+	for _, d := range []*model.Device{
+		{Name: "Phone", Brand: apple.Name, BrandID: apple.ID, State: model.StateAvailable, CreatedAt: march},
+		{Name: "Tablet", Brand: apple.Name, BrandID: apple.ID, State: model.StateInUse, CreatedAt: april},
+		{Name: "Laptop", Brand: dell.Name, BrandID: dell.ID, State: model.StateAvailable, CreatedAt: march},
+	} {
+		d.ID, d.UpdatedAt = uuid.NewString(), d.CreatedAt
+		if err := r.Create(ctx, d); err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+	}
+
+	counts, err := r.CountDevices(ctx, model.DeviceFilter{}, []model.StatsDimension{model.StatsByBrand, model.StatsByMonth})
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	want := []model.DeviceCount{
+		{Brand: "Apple", Month: time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC), Count: 1},
+		{Brand: "Apple", Month: time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC), Count: 1},
+		{Brand: "Dell", Month: time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC), Count: 1},
+	}
+	if len(counts) != len(want) {
+		t.Fatalf("expected %d groups, got %+v", len(want), counts)
+	}
+	for i := range want {
+		if counts[i].Brand != want[i].Brand || !counts[i].Month.Equal(want[i].Month) || counts[i].Count != want[i].Count {
+			t.Fatalf("group %d: expected %+v, got %+v", i, want[i], counts[i])
+		}
+	}
+
+	counts, err = r.CountDevices(ctx, model.DeviceFilter{State: string(model.StateAvailable)}, nil)
+	if err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if len(counts) != 1 || counts[0].Count != 2 {
+		t.Fatalf("expected a single count of 2 available devices, got %+v", counts)
+	}
+}
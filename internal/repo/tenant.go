@@ -0,0 +1,31 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+// beginTenantTx starts a transaction for the tenant carried by ctx.
+// app.tenant_id is set locally to the transaction so the row-level security
+// policies apply to every statement run on it, on top of the explicit
+// tenant_id filters in the queries.
+func beginTenantTx(ctx context.Context, db *sql.DB) (*sql.Tx, string, error) {
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, "", tenant.ErrMissing
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if _, err := tx.ExecContext(ctx, `SELECT set_config('app.tenant_id', $1, true)`, tenantID); err != nil {
+		_ = tx.Rollback()
+		return nil, "", err
+	}
+
+	return tx, tenantID, nil
+}
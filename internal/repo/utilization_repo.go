@@ -0,0 +1,146 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// recordStates records the state of each device, as of its updated_at,
+// within tx. A device whose state has not changed since its last recorded
+// change is skipped, so that only changes of state are recorded.
+func recordStates(ctx context.Context, tx *sql.Tx, tenantID string, devices ...*model.Device) error {
+	ids := make([]string, len(devices))
+	states := make([]string, len(devices))
+	at := make([]time.Time, len(devices))
+	for i, d := range devices {
+		ids[i], states[i], at[i] = d.ID, string(d.State), d.UpdatedAt
+	}
+
+	query := `
+		INSERT INTO device_state_changes (tenant_id, device_id, state, changed_at)
+		SELECT $1::text, v.id, v.state, v.changed_at
+		FROM unnest($2::uuid[], $3::text[], $4::timestamptz[]) WITH ORDINALITY AS v(id, state, changed_at, n)
+		WHERE v.state IS DISTINCT FROM (
+			SELECT c.state FROM device_state_changes c
+			WHERE c.device_id = v.id AND c.tenant_id = $1
+			ORDER BY c.changed_at DESC, c.id DESC
+			LIMIT 1
+		)
+		ORDER BY v.n
+	`
+	_, err := tx.ExecContext(ctx, query, tenantID, ids, states, at)
+	return err
+}
+
+// stateIntervals is a query that takes the tenant ID as $1, an optional
+// start of the period as $2, its end as $3, and an optional device ID as $4.
+// It returns the intervals that the devices spent in each state, clipped to
+// the period, and whether each began with a transition in the period. An
+// interval runs from a change of state to the next one, or to the end of the
+// period.
+const stateIntervals = `
+	SELECT device_id, state,
+	       lag(state) OVER w IS NOT NULL AND changed_at >= COALESCE($2::timestamptz, '-infinity') AS transition,
+	       GREATEST(
+	         LEAST(COALESCE(lead(changed_at) OVER w, $3::timestamptz), $3::timestamptz)
+	           - GREATEST(changed_at, COALESCE($2::timestamptz, changed_at)),
+	         interval '0'
+	       ) AS duration
+	FROM device_state_changes
+	WHERE tenant_id = $1 AND changed_at < $3::timestamptz
+	  AND ($4::text = '' OR device_id::text = $4::text)
+	WINDOW w AS (PARTITION BY device_id ORDER BY changed_at, id)
+`
+
+// utilizationColumns aggregate the rows of stateIntervals, aliased as i.
+const utilizationColumns = `
+	count(DISTINCT i.device_id),
+	COALESCE(EXTRACT(EPOCH FROM sum(i.duration) FILTER (WHERE i.state = 'in-use')), 0)::float8,
+	COALESCE(EXTRACT(EPOCH FROM sum(i.duration) FILTER (WHERE i.state = 'available')), 0)::float8,
+	COALESCE(EXTRACT(EPOCH FROM sum(i.duration) FILTER (WHERE i.state = 'inactive')), 0)::float8,
+	count(*) FILTER (WHERE i.transition)
+`
+
+// DeviceUtilization returns the time a device spent in each state from from
+// to to, and its number of changes of state. A zero from starts the period at
+// the first recorded change.
+func (r *DeviceRepository) DeviceUtilization(ctx context.Context, deviceID string, from, to time.Time) (*model.Utilization, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + utilizationColumns + ` FROM (` + stateIntervals + `) i`
+	rows, err := tx.QueryContext(ctx, query, tenantID, nullTime(from), to, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	utilization, err := scanUtilizations(rows, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return &utilization[0], tx.Commit()
+}
+
+// FleetUtilization returns the time the devices spent in each state from
+// from to to, and their number of changes of state, for the whole fleet or,
+// with byBrand, per brand. A zero from starts the period at the first
+// recorded change.
+func (r *DeviceRepository) FleetUtilization(ctx context.Context, byBrand bool, from, to time.Time) ([]model.Utilization, error) {
+	tx, tenantID, err := beginTenantTx(ctx, r.db)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `SELECT ` + utilizationColumns + ` FROM (` + stateIntervals + `) i`
+	if byBrand {
+		query = `
+			SELECT b.id, b.name, ` + utilizationColumns + `
+			FROM (` + stateIntervals + `) i
+			JOIN devices d ON d.id = i.device_id
+			JOIN brands b ON b.id = d.brand_id
+			GROUP BY b.id, b.name
+			ORDER BY lower(b.name), b.id
+		`
+	}
+	rows, err := tx.QueryContext(ctx, query, tenantID, nullTime(from), to, "")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	utilization, err := scanUtilizations(rows, byBrand)
+	if err != nil {
+		return nil, err
+	}
+
+	return utilization, tx.Commit()
+}
+
+func scanUtilizations(rows *sql.Rows, byBrand bool) ([]model.Utilization, error) {
+	utilization := []model.Utilization{}
+	for rows.Next() {
+		var u model.Utilization
+		var inUse, idle, inactive float64
+		dest := []any{&u.Devices, &inUse, &idle, &inactive, &u.Transitions}
+		if byBrand {
+			dest = append([]any{&u.BrandID, &u.Brand}, dest...)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		u.InUse = time.Duration(inUse * float64(time.Second))
+		u.Idle = time.Duration(idle * float64(time.Second))
+		u.Inactive = time.Duration(inactive * float64(time.Second))
+		utilization = append(utilization, u)
+	}
+	return utilization, rows.Err()
+}
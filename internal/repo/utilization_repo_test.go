@@ -0,0 +1,59 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+)
+
+func TestDeviceRepository_Utilization(t *testing.T) {
+	db := openTestDB(t)
+	r := NewDeviceRepository(db)
+	ctx := tenant.WithID(context.Background(), "tenant-"+uuid.NewString())
+
+	brand := createTestBrand(t, r, ctx, "Lenovo")
+	start := time.Now().Add(-4 * time.Hour).Truncate(time.Second)
+	d := &model.Device{ID: uuid.NewString(), Name: "Laptop", Brand: brand.Name, BrandID: brand.ID, State: model.StateAvailable, CreatedAt: start, UpdatedAt: start}
+	if err := r.Create(ctx, d); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	t.Cleanup(func() { _ = r.Delete(ctx, d.ID) })
+
+	d.State, d.UpdatedAt = model.StateInUse, start.Add(time.Hour)
+	if err := r.Update(ctx, d); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	// A change that keeps the state is not a transition.
+	d.Name, d.UpdatedAt = "Laptop 2", start.Add(2*time.Hour)
+	if err := r.Update(ctx, d); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	rec := &model.MaintenanceRecord{ID: uuid.NewString(), DeviceID: d.ID, PreviousState: d.State, OpenedAt: start.Add(3 * time.Hour)}
+	d.State, d.UpdatedAt = model.StateInactive, rec.OpenedAt
+	if err := r.OpenMaintenance(ctx, d, rec); err != nil {
+		t.Fatalf("open maintenance: %v", err)
+	}
+
+	u, err := r.DeviceUtilization(ctx, d.ID, start.Add(30*time.Minute), start.Add(4*time.Hour))
+	if err != nil {
+		t.Fatalf("device utilization: %v", err)
+	}
+	want := model.Utilization{Devices: 1, InUse: 2 * time.Hour, Idle: 30 * time.Minute, Inactive: time.Hour, Transitions: 2}
+	if *u != want {
+		t.Fatalf("expected %+v, got %+v", want, *u)
+	}
+
+	fleet, err := r.FleetUtilization(ctx, true, time.Time{}, start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("fleet utilization: %v", err)
+	}
+	want = model.Utilization{BrandID: brand.ID, Brand: brand.Name, Devices: 1, InUse: time.Hour, Idle: time.Hour, Transitions: 1}
+	if len(fleet) != 1 || fleet[0] != want {
+		t.Fatalf("expected %+v, got %+v", want, fleet)
+	}
+}
@@ -0,0 +1,244 @@
+// Package schema implements the subset of JSON Schema used to describe the
+// custom attributes of a brand's devices.
+//
+// Supported keywords are type (object, array, string, integer, number,
+// boolean), properties, required, additionalProperties (as a boolean),
+// items, enum, minLength, maxLength, pattern, minimum, maximum, format and
+// description. The formats "mac" (a colon- or hyphen-separated MAC address)
+// and "imei" (15 digits with a valid Luhn check digit) are recognized. Any
+// other keyword is rejected when the schema is parsed, so a schema never
+// silently accepts more than its author intended.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// ErrInvalidSchema is returned by Parse for schemas that are malformed or
+// use unsupported keywords.
+var ErrInvalidSchema = errors.New("invalid schema")
+
+// Schema is a parsed attribute schema.
+type Schema struct {
+	Type                 string             `json:"type,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Format               string             `json:"format,omitempty"`
+
+	pattern *regexp.Regexp
+}
+
+var types = map[string]bool{
+	"object": true, "array": true, "string": true, "integer": true, "number": true, "boolean": true,
+}
+
+var formats = map[string]func(string) bool{
+	"mac":  isMAC,
+	"imei": isIMEI,
+}
+
+// Parse parses and checks a schema. The root schema must describe an
+// object.
+func Parse(data []byte) (*Schema, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	var s Schema
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+	if s.Type != "object" {
+		return nil, fmt.Errorf("%w: the root type must be object", ErrInvalidSchema)
+	}
+	if err := s.compile("(root)"); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+// compile checks s and its subschemas and compiles their patterns.
+func (s *Schema) compile(path string) error {
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%w: %s: %s", ErrInvalidSchema, path, fmt.Sprintf(format, args...))
+	}
+
+	if s.Type != "" && !types[s.Type] {
+		return fail("unsupported type %q", s.Type)
+	}
+	if s.Format != "" && formats[s.Format] == nil {
+		return fail("unsupported format %q", s.Format)
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fail("invalid pattern: %v", err)
+		}
+		s.pattern = re
+	}
+	for _, name := range s.Required {
+		if _, ok := s.Properties[name]; !ok {
+			return fail("required property %q is not defined in properties", name)
+		}
+	}
+
+	for name, prop := range s.Properties {
+		if prop == nil {
+			return fail("property %q has no schema", name)
+		}
+		if err := prop.compile(path + "." + name); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.compile(path + "[]"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Validate checks a decoded JSON value against the schema. Violations are
+// keyed by the path of the offending value below prefix, such as
+// "attributes.imei".
+func (s *Schema) Validate(prefix string, value any) error {
+	errs := validate.Errors{}
+	s.check(prefix, value, errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (s *Schema) check(path string, value any, errs validate.Errors) {
+	if s.Type != "" && !hasType(value, s.Type) {
+		errs.Add(path, "must be of type "+s.Type)
+		return
+	}
+
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		errs.Add(path, "must be one of the allowed values")
+	}
+
+	switch v := value.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			errs.Add(path, fmt.Sprintf("must be at least %d characters", *s.MinLength))
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			errs.Add(path, fmt.Sprintf("must be at most %d characters", *s.MaxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			errs.Add(path, "must match pattern "+s.Pattern)
+		}
+		if s.Format != "" && !formats[s.Format](v) {
+			errs.Add(path, "must be a valid "+s.Format)
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			errs.Add(path, fmt.Sprintf("must be at least %v", *s.Minimum))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			errs.Add(path, fmt.Sprintf("must be at most %v", *s.Maximum))
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.check(fmt.Sprintf("%s[%d]", path, i), item, errs)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				errs.Add(path+"."+name, "is required")
+			}
+		}
+		for name, item := range v {
+			prop, ok := s.Properties[name]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					errs.Add(path+"."+name, "is not a known attribute")
+				}
+				continue
+			}
+			prop.check(path+"."+name, item, errs)
+		}
+	}
+}
+
+func hasType(value any, typ string) bool {
+	switch v := value.(type) {
+	case map[string]any:
+		return typ == "object"
+	case []any:
+		return typ == "array"
+	case string:
+		return typ == "string"
+	case bool:
+		return typ == "boolean"
+	case float64:
+		return typ == "number" || (typ == "integer" && v == math.Trunc(v))
+	default:
+		return false
+	}
+}
+
+func inEnum(value any, enum []any) bool {
+	for _, e := range enum {
+		if reflect.DeepEqual(value, e) {
+			return true
+		}
+	}
+	return false
+}
+
+var macRE = regexp.MustCompile(`^[0-9A-Fa-f]{2}([:-][0-9A-Fa-f]{2}){5}$`)
+
+func isMAC(s string) bool {
+	// Every separator must be the same as the first one.
+	return macRE.MatchString(s) && strings.Count(s, s[2:3]) == 5
+}
+
+// isIMEI reports whether s is 15 digits with a valid Luhn check digit.
+func isIMEI(s string) bool {
+	if len(s) != 15 {
+		return false
+	}
+
+	sum := 0
+	for i := 0; i < len(s); i++ {
+		d := int(s[i]) - '0'
+		if d < 0 || d > 9 {
+			return false
+		}
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
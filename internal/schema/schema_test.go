@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+const phoneSchema = `{
+	"type": "object",
+	"properties": {
+		"imei": {"type": "string", "format": "imei"},
+		"storage_gb": {"type": "integer", "enum": [64, 128, 256]},
+		"color": {"type": "string", "maxLength": 5, "pattern": "^[a-z]+$"},
+		"mac": {"type": "string", "format": "mac"},
+		"bands": {"type": "array", "items": {"type": "number", "minimum": 1}}
+	},
+	"required": ["imei"],
+	"additionalProperties": false
+}`
+
+func decode(t *testing.T, s string) map[string]any {
+	t.Helper()
+
+	var v map[string]any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	s, err := Parse([]byte(phoneSchema))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	valid := decode(t, `{"imei": "490154203237518", "storage_gb": 128, "color": "black", "mac": "00:1A:2b:3c:4d:5e", "bands": [3, 7]}`)
+	if err := s.Validate("attributes", valid); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	invalid := decode(t, `{"imei": "490154203237519", "storage_gb": 100.5, "color": "Dark Blue", "mac": "00:1A-2b:3c:4d:5e", "bands": [0], "sim": 2}`)
+	var errs validate.Errors
+	if !errors.As(s.Validate("attributes", invalid), &errs) {
+		t.Fatalf("expected validate.Errors")
+	}
+	want := validate.Errors{
+		"attributes.imei":       {"must be a valid imei"},
+		"attributes.storage_gb": {"must be of type integer"},
+		"attributes.color":      {"must be at most 5 characters", "must match pattern ^[a-z]+$"},
+		"attributes.mac":        {"must be a valid mac"},
+		"attributes.bands[0]":   {"must be at least 1"},
+		"attributes.sim":        {"is not a known attribute"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Fatalf("unexpected errors:\n got %v\nwant %v", errs, want)
+	}
+
+	if err := s.Validate("attributes", map[string]any{}); err == nil {
+		t.Fatalf("expected the required imei to be reported")
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, s := range []string{
+		`{"type": "string"}`,
+		`{"type": "object", "properties": {"a": {"type": "date"}}}`,
+		`{"type": "object", "properties": {"a": {"type": "string", "pattern": "("}}}`,
+		`{"type": "object", "properties": {"a": {"type": "string", "format": "email"}}}`,
+		`{"type": "object", "required": ["a"]}`,
+		`{"type": "object", "oneOf": []}`,
+	} {
+		if _, err := Parse([]byte(s)); !errors.Is(err, ErrInvalidSchema) {
+			t.Errorf("%s: expected ErrInvalidSchema, got %v", s, err)
+		}
+	}
+}
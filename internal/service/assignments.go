@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// HolderStore stores holders and the assignments of devices to them.
+type HolderStore interface {
+	Holders(ctx context.Context, kind, externalID string, limit, offset int) ([]model.Holder, error)
+	Holder(ctx context.Context, id string) (*model.Holder, error)
+	CreateHolder(ctx context.Context, h *model.Holder) error
+	UpdateHolder(ctx context.Context, h *model.Holder) error
+	DeleteHolder(ctx context.Context, id string) (bool, error)
+	HolderDevices(ctx context.Context, holderID string, limit, offset int) ([]model.Device, error)
+	Assignments(ctx context.Context, filter model.AssignmentFilter, limit, offset int) ([]model.Assignment, error)
+	Assign(ctx context.Context, d *model.Device, a *model.Assignment) error
+	EndAssignment(ctx context.Context, d *model.Device, a *model.Assignment) error
+}
+
+// ErrNotAssigned is returned when ending the assignment of a device that has
+// no active assignment.
+var ErrNotAssigned = errors.New("device has no active assignment")
+
+// HolderInput holds the fields of a holder.
+type HolderInput struct {
+	Kind       string
+	Name       string
+	ExternalID string
+}
+
+// ListHolders returns a page of holders. A non-empty kind restricts it to
+// the holders of that kind, and a non-empty externalID to the holders with
+// that external ID.
+func (s *DeviceService) ListHolders(ctx context.Context, kind, externalID string, limit, offset int) ([]model.Holder, error) {
+	if kind != "" && !model.IsValidHolderKind(kind) {
+		return nil, fmt.Errorf("invalid kind value")
+	}
+	return s.holders.Holders(ctx, kind, externalID, limit, offset)
+}
+
+// GetHolder returns the holder with the given ID, or nil if it does not
+// exist.
+func (s *DeviceService) GetHolder(ctx context.Context, id string) (*model.Holder, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil
+	}
+	return s.holders.Holder(ctx, id)
+}
+
+// CreateHolder adds a person or team that devices can be assigned to.
+func (s *DeviceService) CreateHolder(ctx context.Context, in HolderInput) (*model.Holder, error) {
+	if err := checkHolder(in); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	h := &model.Holder{
+		ID:         uuid.New().String(),
+		Kind:       model.HolderKind(in.Kind),
+		Name:       in.Name,
+		ExternalID: in.ExternalID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := s.holders.CreateHolder(ctx, h); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// UpdateHolder replaces the fields of a holder. It returns nil if the holder
+// does not exist.
+func (s *DeviceService) UpdateHolder(ctx context.Context, id string, in HolderInput) (*model.Holder, error) {
+	if err := checkHolder(in); err != nil {
+		return nil, err
+	}
+
+	h, err := s.GetHolder(ctx, id)
+	if err != nil || h == nil {
+		return nil, err
+	}
+
+	h.Kind, h.Name, h.ExternalID = model.HolderKind(in.Kind), in.Name, in.ExternalID
+	h.UpdatedAt = time.Now()
+	if err := s.holders.UpdateHolder(ctx, h); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// DeleteHolder removes a holder. The boolean is false if it did not exist.
+// Holders that have been assigned devices cannot be deleted, so that the
+// assignment history stays complete.
+func (s *DeviceService) DeleteHolder(ctx context.Context, id string) (bool, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return false, nil
+	}
+
+	assignments, err := s.holders.Assignments(ctx, model.AssignmentFilter{HolderID: id}, 1, 0)
+	if err != nil {
+		return false, err
+	}
+	if len(assignments) > 0 {
+		return false, fmt.Errorf("cannot delete holder that has assignments")
+	}
+
+	return s.holders.DeleteHolder(ctx, id)
+}
+
+// HolderDevices returns a page of the devices a holder currently holds. It
+// returns nil if the holder does not exist.
+func (s *DeviceService) HolderDevices(ctx context.Context, id string, limit, offset int) ([]model.Device, error) {
+	h, err := s.GetHolder(ctx, id)
+	if err != nil || h == nil {
+		return nil, err
+	}
+	return s.holders.HolderDevices(ctx, h.ID, limit, offset)
+}
+
+// DeviceAssignments returns a page of the assignment history of a device,
+// the most recent first. It returns nil if the device does not exist.
+func (s *DeviceService) DeviceAssignments(ctx context.Context, id string, limit, offset int) ([]model.Assignment, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+	return s.holders.Assignments(ctx, model.AssignmentFilter{DeviceID: device.ID}, limit, offset)
+}
+
+// Assign starts an assignment of a device to a holder and puts the device
+// in use. Inactive devices cannot be assigned, and a device has at most one
+// active assignment. It returns nil if the device does not exist.
+func (s *DeviceService) Assign(ctx context.Context, id, holderID, note string) (*model.Assignment, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	holder, err := s.GetHolder(ctx, holderID)
+	if err != nil {
+		return nil, err
+	}
+	if holder == nil {
+		return nil, validate.Errors{"holder_id": {"does not exist"}}
+	}
+	if device.State == model.StateInactive {
+		return nil, fmt.Errorf("cannot assign device that is inactive")
+	}
+
+	active, err := s.holders.Assignments(ctx, model.AssignmentFilter{DeviceID: device.ID, Active: true}, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(active) > 0 {
+		return nil, model.ErrAlreadyAssigned
+	}
+
+	now := time.Now()
+	a := &model.Assignment{ID: uuid.New().String(), DeviceID: device.ID, HolderID: holder.ID, Note: note, StartedAt: now}
+	device.State = model.StateInUse
+	device.UpdatedAt = now
+
+	// The database rejects overlapping assignments too, for concurrent
+	// requests that both passed the check above.
+	if err := s.holders.Assign(ctx, device, a); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// EndAssignment ends the active assignment of a device and makes the device
+// available again, unless an active reservation keeps it in use. It returns
+// nil if the device does not exist, and ErrNotAssigned if it has no active
+// assignment.
+func (s *DeviceService) EndAssignment(ctx context.Context, id string) (*model.Assignment, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	active, err := s.holders.Assignments(ctx, model.AssignmentFilter{DeviceID: device.ID, Active: true}, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(active) == 0 {
+		return nil, ErrNotAssigned
+	}
+
+	now := time.Now()
+	a := &active[0]
+	a.EndedAt = &now
+	if device.State == model.StateInUse {
+		device.State = model.StateAvailable
+	}
+	device.UpdatedAt = now
+
+	if err := s.holders.EndAssignment(ctx, device, a); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func checkHolder(in HolderInput) error {
+	if in.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if !model.IsValidHolderKind(in.Kind) {
+		return validate.Errors{"kind": {"must be one of person, team"}}
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/schema"
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// SchemaStore stores the attribute schemas of brands.
+type SchemaStore interface {
+	BrandSchema(ctx context.Context, brand string) (*model.BrandSchema, error)
+	SaveBrandSchema(ctx context.Context, s *model.BrandSchema) error
+	DeleteBrandSchema(ctx context.Context, brand string) (bool, error)
+}
+
+// GetBrandSchema returns the attribute schema of the brand that brand
+// resolves to, or nil if it has none.
+func (s *DeviceService) GetBrandSchema(ctx context.Context, brand string) (*model.BrandSchema, error) {
+	b, err := s.brandResolver().lookup(ctx, brand)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return s.schemas.BrandSchema(ctx, b.Name)
+}
+
+// PutBrandSchema creates or replaces the attribute schema of the brand that
+// brand resolves to, registering the brand if needed. Errors
+// for schemas that cannot be parsed wrap schema.ErrInvalidSchema. Existing
+// devices are not revalidated; they must conform the next time their brand
+// or attributes change.
+func (s *DeviceService) PutBrandSchema(ctx context.Context, brand string, raw json.RawMessage) (*model.BrandSchema, error) {
+	if model.BrandKey(brand) == "" {
+		return nil, fmt.Errorf("brand is required")
+	}
+	if _, err := schema.Parse(raw); err != nil {
+		return nil, err
+	}
+
+	brands := s.brandResolver()
+	if _, _, err := brands.canonical(ctx, brand); err != nil {
+		return nil, err
+	}
+	if err := brands.save(ctx); err != nil {
+		return nil, err
+	}
+	// The brand is looked up again, as save may have replaced it.
+	b, err := brands.lookup(ctx, brand)
+	if err != nil {
+		return nil, err
+	}
+
+	bs := &model.BrandSchema{Brand: b.Name, Schema: raw, UpdatedAt: time.Now()}
+	if err := s.schemas.SaveBrandSchema(ctx, bs); err != nil {
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+// DeleteBrandSchema removes the attribute schema of the brand that brand
+// resolves to, after which its devices accept any attributes. The boolean is
+// false if it had none.
+func (s *DeviceService) DeleteBrandSchema(ctx context.Context, brand string) (bool, error) {
+	b, err := s.brandResolver().lookup(ctx, brand)
+	if err != nil || b == nil {
+		return false, err
+	}
+	return s.schemas.DeleteBrandSchema(ctx, b.Name)
+}
+
+// attributeChecker validates device attributes against the schemas of
+// their brands. It loads each brand's schema once, so a single checker
+// serves a whole batch or import chunk.
+type attributeChecker struct {
+	store   SchemaStore
+	schemas map[string]*schema.Schema
+}
+
+func (s *DeviceService) attributeChecker() *attributeChecker {
+	return &attributeChecker{store: s.schemas, schemas: make(map[string]*schema.Schema)}
+}
+
+// check validates the attributes of d against the schema of its brand.
+// Brands without a schema accept any attributes. Violations are returned
+// as validate.Errors.
+func (c *attributeChecker) check(ctx context.Context, d *model.Device) error {
+	if d.Attributes == nil {
+		d.Attributes = map[string]any{}
+	}
+
+	sch, ok := c.schemas[d.Brand]
+	if !ok {
+		bs, err := c.store.BrandSchema(ctx, d.Brand)
+		if err != nil {
+			return err
+		}
+		if bs != nil {
+			if sch, err = schema.Parse(bs.Schema); err != nil {
+				return fmt.Errorf("stored schema of brand %q: %w", d.Brand, err)
+			}
+		}
+		c.schemas[d.Brand] = sch
+	}
+	if sch == nil {
+		return nil
+	}
+
+	return sch.Validate("attributes", d.Attributes)
+}
+
+// isValidationError reports whether err lists attribute violations, as
+// opposed to a failure to load a schema.
+func isValidationError(err error) bool {
+	var errs validate.Errors
+	return errors.As(err, &errs)
+}
+
+// checkChanged validates the attributes of d only when they or its brand
+// differ from before, so that devices saved under an older schema can still
+// change state without first being brought up to date.
+func (c *attributeChecker) checkChanged(ctx context.Context, before model.Device, d *model.Device) error {
+	if d.Attributes == nil {
+		d.Attributes = map[string]any{}
+	}
+	if d.Brand == before.Brand && reflect.DeepEqual(d.Attributes, before.Attributes) {
+		return nil
+	}
+	return c.check(ctx, d)
+}
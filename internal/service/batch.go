@@ -0,0 +1,378 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// MaxBatchSize is the largest number of items accepted by a batch operation.
+const MaxBatchSize = 1000
+
+var (
+	// ErrInvalidBatch is returned for batches that are empty or too large.
+	ErrInvalidBatch = errors.New("invalid batch")
+	// ErrNotFound is reported for batch items whose device does not exist.
+	ErrNotFound = errors.New("device not found")
+	// ErrBatchAborted is reported for valid items of an atomic batch that
+	// was not applied because another item failed.
+	ErrBatchAborted = errors.New("not applied: another item in the batch failed")
+)
+
+// BatchMode selects how a batch reacts to failing items.
+type BatchMode string
+
+const (
+	// BatchAtomic applies every item or none of them.
+	BatchAtomic BatchMode = "atomic"
+	// BatchBestEffort applies the valid items and reports the others.
+	BatchBestEffort BatchMode = "best_effort"
+)
+
+func IsValidBatchMode(m string) bool {
+	switch BatchMode(m) {
+	case BatchAtomic, BatchBestEffort:
+		return true
+	default:
+		return false
+	}
+}
+
+// CreateInput holds the fields of a device to create or replace. Empty
+// identifiers mean the device has none.
+type CreateInput struct {
+	Name         string
+	Brand        string
+	State        string
+	SerialNumber string
+	AssetTag     string
+	Attributes   map[string]any
+}
+
+// UpdateInput holds a partial update of a device. Nil fields are left
+// unchanged, and an empty identifier clears it.
+type UpdateInput struct {
+	ID           string
+	Name         *string
+	Brand        *string
+	State        *string
+	SerialNumber *string
+	AssetTag     *string
+	// Attributes replace the current ones when non-nil.
+	Attributes map[string]any
+}
+
+// BatchResult is the outcome of one batch item, in request order.
+type BatchResult struct {
+	ID     string
+	Device *model.Device
+	Err    error
+}
+
+// BatchCreate creates devices with the same rules as Create. In atomic mode
+// nothing is written unless every item is valid and fits in the quota.
+func (s *DeviceService) BatchCreate(ctx context.Context, mode BatchMode, items []CreateInput) ([]BatchResult, error) {
+	if err := checkBatchSize(len(items)); err != nil {
+		return nil, err
+	}
+
+	brands := s.brandResolver()
+	checker := s.attributeChecker()
+	results := make([]BatchResult, len(items))
+	var valid []*model.Device
+	for i, item := range items {
+		brand, brandID, err := brands.canonical(ctx, item.Brand)
+		if err != nil {
+			return nil, err
+		}
+
+		item.Brand = brand
+		device, err := newDevice(item)
+		if err == nil {
+			device.BrandID = brandID
+			if err = checker.check(ctx, device); err != nil && !isValidationError(err) {
+				return nil, err
+			}
+		}
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].ID = device.ID
+		results[i].Device = device
+		valid = append(valid, device)
+	}
+
+	valid = failDevices(results, valid, duplicateIdentifiers(valid))
+	if mode == BatchAtomic && hasFailures(results) {
+		return abortBatch(results), nil
+	}
+
+	// Items can still fail when they are written: their identifiers may be
+	// taken since they were checked, and the repository fails the items
+	// that do not fit in the quota.
+	errs, err := s.devices.CreateMany(ctx, valid, mode == BatchAtomic)
+	if err != nil {
+		return nil, err
+	}
+	failDevices(results, valid, errs)
+	if mode == BatchAtomic && hasFailures(results) {
+		return abortBatch(results), nil
+	}
+
+	return results, nil
+}
+
+// BatchUpdate applies partial updates with the same rules as Update.
+func (s *DeviceService) BatchUpdate(ctx context.Context, mode BatchMode, items []UpdateInput) ([]BatchResult, error) {
+	if err := checkBatchSize(len(items)); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	existing, err := s.devices.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	brands := s.brandResolver()
+	checker := s.attributeChecker()
+	results := make([]BatchResult, len(items))
+	var valid []*model.Device
+	queued := make(map[string]bool)
+	for i, item := range items {
+		results[i].ID = item.ID
+
+		current, ok := existing[item.ID]
+		if !ok {
+			results[i].Err = ErrNotFound
+			continue
+		}
+
+		// Items are applied in order, so a later item for the same device
+		// sees the changes of the earlier ones.
+		brand, brandID, err := brands.canonicalUpdate(ctx, item.Brand)
+		if err != nil {
+			return nil, err
+		}
+
+		device := *current
+		item.Brand = brand
+		if err := applyUpdate(&device, item); err != nil {
+			results[i].Err = err
+			continue
+		}
+		if brand != nil {
+			device.BrandID = brandID
+		}
+		if err := checker.checkChanged(ctx, *current, &device); err != nil {
+			if !isValidationError(err) {
+				return nil, err
+			}
+			results[i].Err = err
+			continue
+		}
+		*current = device
+
+		results[i].Device = current
+		if !queued[current.ID] {
+			queued[current.ID] = true
+			valid = append(valid, current)
+		}
+	}
+
+	valid = failDevices(results, valid, duplicateIdentifiers(valid))
+	if mode == BatchAtomic && hasFailures(results) {
+		return abortBatch(results), nil
+	}
+
+	errs, err := s.devices.UpdateMany(ctx, valid, mode == BatchAtomic)
+	if err != nil {
+		return nil, err
+	}
+	failDevices(results, valid, errs)
+	if mode == BatchAtomic && hasFailures(results) {
+		return abortBatch(results), nil
+	}
+
+	return results, nil
+}
+
+// BatchDelete deletes devices with the same rules as Delete.
+func (s *DeviceService) BatchDelete(ctx context.Context, mode BatchMode, ids []string) ([]BatchResult, error) {
+	if err := checkBatchSize(len(ids)); err != nil {
+		return nil, err
+	}
+
+	existing, err := s.devices.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]string, 0, len(existing))
+	for id := range existing {
+		found = append(found, id)
+	}
+	compositions, err := s.parents.Compositions(ctx, found)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := deletedChildren(existing, compositions)
+
+	results := make([]BatchResult, len(ids))
+	var valid []string
+	for i, id := range ids {
+		results[i].ID = id
+
+		device, ok := existing[id]
+		if !ok {
+			results[i].Err = ErrNotFound
+			continue
+		}
+		c := compositions[device.ID]
+		c.Children -= deleted[device.ID]
+		if err := checkDeletable(device, c); err != nil {
+			results[i].Err = err
+			continue
+		}
+		valid = append(valid, id)
+	}
+
+	if mode == BatchAtomic && hasFailures(results) {
+		return abortBatch(results), nil
+	}
+
+	if err := s.devices.DeleteMany(ctx, valid); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// deletedChildren returns how many of the attached devices of each device
+// are deleted along with it. A device is deleted if it is deletable once
+// its own children that are deleted are discounted, so devices are settled
+// from the leaves up until none is left to settle.
+func deletedChildren(devices map[string]*model.Device, compositions map[string]model.Composition) map[string]int {
+	children := make(map[string]int)
+	deleted := make(map[string]bool)
+	for settled := true; settled; {
+		settled = false
+		for id, device := range devices {
+			if deleted[id] {
+				continue
+			}
+			c := compositions[id]
+			c.Children -= children[id]
+			if checkDeletable(device, c) != nil {
+				continue
+			}
+			deleted[id] = true
+			settled = true
+			if device.ParentID != "" {
+				children[device.ParentID]++
+			}
+		}
+	}
+	return children
+}
+
+func checkBatchSize(n int) error {
+	if n == 0 {
+		return fmt.Errorf("%w: no items", ErrInvalidBatch)
+	}
+	if n > MaxBatchSize {
+		return fmt.Errorf("%w: at most %d items are allowed", ErrInvalidBatch, MaxBatchSize)
+	}
+	return nil
+}
+
+func hasFailures(results []BatchResult) bool {
+	for _, r := range results {
+		if r.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// duplicateIdentifiers returns, for each device, a *model.DuplicateError if
+// an earlier device of the list has its serial number or asset tag within
+// the same brand, which the storage would reject. It returns nil if there
+// are none.
+func duplicateIdentifiers(devices []*model.Device) []error {
+	var errs []error
+	taken := make(map[[3]string]bool)
+	for i, d := range devices {
+		var keys [][3]string
+		if d.SerialNumber != "" {
+			keys = append(keys, [3]string{"serial_number", d.BrandID, d.SerialNumber})
+		}
+		if d.AssetTag != "" {
+			keys = append(keys, [3]string{"asset_tag", d.BrandID, d.AssetTag})
+		}
+
+		var dup error
+		for _, key := range keys {
+			if taken[key] {
+				dup = &model.DuplicateError{Field: key[0]}
+				break
+			}
+		}
+		if dup != nil {
+			if errs == nil {
+				errs = make([]error, len(devices))
+			}
+			errs[i] = dup
+			continue
+		}
+		for _, key := range keys {
+			taken[key] = true
+		}
+	}
+	return errs
+}
+
+// failDevices reports the error of each device that failed on the items of
+// results that write it, and returns the devices that did not fail. errs
+// holds the error of each device, and is nil if none failed.
+func failDevices(results []BatchResult, devices []*model.Device, errs []error) []*model.Device {
+	if errs == nil {
+		return devices
+	}
+
+	failed := make(map[*model.Device]error)
+	var ok []*model.Device
+	for i, d := range devices {
+		if errs[i] != nil {
+			failed[d] = errs[i]
+		} else {
+			ok = append(ok, d)
+		}
+	}
+	for i := range results {
+		if err, found := failed[results[i].Device]; found {
+			results[i].Err = err
+			results[i].Device = nil
+		}
+	}
+	return ok
+}
+
+// abortBatch marks the successful items of a failed atomic batch as not
+// applied.
+func abortBatch(results []BatchResult) []BatchResult {
+	for i := range results {
+		if results[i].Err == nil {
+			results[i].Err = ErrBatchAborted
+			results[i].Device = nil
+		}
+	}
+	return results
+}
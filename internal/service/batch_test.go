@@ -0,0 +1,253 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+
+    "github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+func TestBatchCreate_AtomicWritesNothingOnInvalidItem(t *testing.T) {
+    called := false
+    repo := &mockRepo{
+        CreateManyFn: func(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+            called = true
+            return nil, nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+
+    results, err := svc.BatchCreate(context.Background(), BatchAtomic, []CreateInput{
+        {Name: "A", Brand: "X", State: "available"},
+        {Name: "", Brand: "X", State: "available"},
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if called {
+        t.Fatalf("atomic batch with an invalid item must not write")
+    }
+    if !errors.Is(results[0].Err, ErrBatchAborted) {
+        t.Fatalf("expected valid item to be aborted, got %v", results[0].Err)
+    }
+    if results[1].Err == nil || errors.Is(results[1].Err, ErrBatchAborted) {
+        t.Fatalf("expected validation error on invalid item, got %v", results[1].Err)
+    }
+}
+
+func TestBatchCreate_AtomicAbortsOverQuota(t *testing.T) {
+    repo := &mockRepo{
+        CreateManyFn: func(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+            if !atomic {
+                t.Fatalf("expected an atomic write")
+            }
+            return []error{nil, ErrQuotaExceeded}, nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+
+    results, err := svc.BatchCreate(context.Background(), BatchAtomic, []CreateInput{
+        {Name: "A", Brand: "X", State: "available"},
+        {Name: "B", Brand: "X", State: "available"},
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if !errors.Is(results[0].Err, ErrBatchAborted) || results[0].Device != nil {
+        t.Fatalf("expected first item to be aborted, got %+v", results[0])
+    }
+    if !errors.Is(results[1].Err, ErrQuotaExceeded) {
+        t.Fatalf("expected quota error on second item, got %v", results[1].Err)
+    }
+}
+
+func TestBatchCreate_ReportsQuotaExceededPerItem(t *testing.T) {
+    repo := &mockRepo{
+        CreateManyFn: func(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+            return []error{ErrQuotaExceeded}, nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+
+    results, err := svc.BatchCreate(context.Background(), BatchBestEffort, []CreateInput{
+        {Name: "A", Brand: "X", State: "available"},
+        {Name: "", Brand: "X", State: "available"},
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if !errors.Is(results[0].Err, ErrQuotaExceeded) || results[0].Device != nil {
+        t.Fatalf("expected quota error on first item, got %+v", results[0])
+    }
+    if results[1].Err == nil || errors.Is(results[1].Err, ErrQuotaExceeded) {
+        t.Fatalf("expected validation error on second item, got %v", results[1].Err)
+    }
+}
+
+func TestBatchCreate_ReportsDuplicateIdentifiersPerItem(t *testing.T) {
+    var written []*model.Device
+    repo := &mockRepo{
+        CreateManyFn: func(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+            written = devices
+            errs := make([]error, len(devices))
+            for i, d := range devices {
+                if d.AssetTag == "TAKEN" {
+                    errs[i] = &model.DuplicateError{Field: "asset_tag"}
+                }
+            }
+            return errs, nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+
+    results, err := svc.BatchCreate(context.Background(), BatchBestEffort, []CreateInput{
+        {Name: "A", Brand: "X", State: "available", SerialNumber: "SN1"},
+        {Name: "B", Brand: "X", State: "available", SerialNumber: "SN1"},
+        {Name: "C", Brand: "X", State: "available", AssetTag: "TAKEN"},
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(written) != 2 {
+        t.Fatalf("expected the duplicate within the batch not to be written, got %d devices", len(written))
+    }
+    if results[0].Err != nil || results[0].Device == nil {
+        t.Fatalf("expected first item to be created, got %v", results[0].Err)
+    }
+    var dup *model.DuplicateError
+    if !errors.As(results[1].Err, &dup) || dup.Field != "serial_number" {
+        t.Fatalf("expected serial_number conflict on second item, got %v", results[1].Err)
+    }
+    if !errors.As(results[2].Err, &dup) || dup.Field != "asset_tag" || results[2].Device != nil {
+        t.Fatalf("expected asset_tag conflict on third item, got %+v", results[2])
+    }
+}
+
+func TestBatchUpdate_AppliesInUseRulesPerItem(t *testing.T) {
+    var saved []*model.Device
+    repo := &mockRepo{
+        GetByIDsFn: func(ctx context.Context, ids []string) (map[string]*model.Device, error) {
+            return map[string]*model.Device{
+                "1": {ID: "1", Name: "A", Brand: "X", State: model.StateInUse, CreatedAt: time.Now()},
+                "2": {ID: "2", Name: "B", Brand: "X", State: model.StateAvailable, CreatedAt: time.Now()},
+            }, nil
+        },
+        UpdateManyFn: func(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+            saved = devices
+            return nil, nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+
+    name := "Renamed"
+    results, err := svc.BatchUpdate(context.Background(), BatchBestEffort, []UpdateInput{
+        {ID: "1", Name: &name},
+        {ID: "2", Name: &name},
+        {ID: "3", Name: &name},
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if results[0].Err == nil {
+        t.Fatalf("expected in-use device rename to fail")
+    }
+    if results[1].Err != nil || results[1].Device.Name != name {
+        t.Fatalf("expected available device to be renamed, got %v", results[1].Err)
+    }
+    if !errors.Is(results[2].Err, ErrNotFound) {
+        t.Fatalf("expected ErrNotFound for missing device, got %v", results[2].Err)
+    }
+    if len(saved) != 1 || saved[0].ID != "2" {
+        t.Fatalf("expected only device 2 to be saved")
+    }
+}
+
+func TestBatchDelete_AtomicAbortsOnInUseDevice(t *testing.T) {
+    called := false
+    repo := &mockRepo{
+        GetByIDsFn: func(ctx context.Context, ids []string) (map[string]*model.Device, error) {
+            return map[string]*model.Device{
+                "1": {ID: "1", State: model.StateAvailable},
+                "2": {ID: "2", State: model.StateInUse},
+            }, nil
+        },
+        DeleteManyFn: func(ctx context.Context, ids []string) error {
+            called = true
+            return nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+
+    results, err := svc.BatchDelete(context.Background(), BatchAtomic, []string{"1", "2"})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if called {
+        t.Fatalf("atomic batch with an in-use device must not delete")
+    }
+    if !errors.Is(results[0].Err, ErrBatchAborted) || results[1].Err == nil {
+        t.Fatalf("unexpected results: %+v", results)
+    }
+}
+
+func TestBatchDelete_DeletesChildrenAlongWithTheirParent(t *testing.T) {
+    var deleted []string
+    repo := &mockRepo{
+        GetByIDsFn: func(ctx context.Context, ids []string) (map[string]*model.Device, error) {
+            return map[string]*model.Device{
+                "laptop":  {ID: "laptop", State: model.StateAvailable},
+                "dock":    {ID: "dock", ParentID: "laptop", State: model.StateAvailable},
+                "charger": {ID: "charger", ParentID: "dock", State: model.StateAvailable},
+                "hub":     {ID: "hub", State: model.StateAvailable},
+            }, nil
+        },
+        DeleteManyFn: func(ctx context.Context, ids []string) error {
+            deleted = ids
+            return nil
+        },
+    }
+    // The hub keeps a mouse attached that is not in the batch.
+    parents := &mockParents{
+        CompositionsFn: func(ctx context.Context, ids []string) (map[string]model.Composition, error) {
+            return map[string]model.Composition{
+                "laptop": {Children: 1},
+                "dock":   {Children: 1},
+                "hub":    {Children: 1},
+            }, nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{Parents: parents})
+
+    results, err := svc.BatchDelete(context.Background(), BatchBestEffort, []string{"laptop", "dock", "charger", "hub"})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if results[0].Err != nil || results[1].Err != nil || results[2].Err != nil || len(deleted) != 3 {
+        t.Fatalf("expected the laptop to be deleted with its dock and charger, got %+v, deleted %v", results, deleted)
+    }
+    if results[3].Err == nil {
+        t.Fatalf("expected the hub to keep its attached mouse")
+    }
+}
+
+func TestBatch_RejectsEmptyAndOversizedBatches(t *testing.T) {
+    svc := newTestService(&mockRepo{}, Stores{})
+
+    if _, err := svc.BatchDelete(context.Background(), BatchAtomic, nil); !errors.Is(err, ErrInvalidBatch) {
+        t.Fatalf("expected ErrInvalidBatch for empty batch, got %v", err)
+    }
+
+    ids := make([]string, MaxBatchSize+1)
+    if _, err := svc.BatchDelete(context.Background(), BatchAtomic, ids); !errors.Is(err, ErrInvalidBatch) {
+        t.Fatalf("expected ErrInvalidBatch for oversized batch, got %v", err)
+    }
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// BrandStore stores the canonical brands and the keys they resolve by.
+type BrandStore interface {
+	Brands(ctx context.Context) ([]model.Brand, error)
+	Brand(ctx context.Context, id string) (*model.Brand, error)
+	BrandByKey(ctx context.Context, key string) (*model.Brand, error)
+	CreateBrand(ctx context.Context, b *model.Brand) error
+	UpdateBrand(ctx context.Context, b *model.Brand) error
+	DeleteBrand(ctx context.Context, id string) (bool, error)
+}
+
+// ErrBrandConflict is returned when a brand name or alias already resolves
+// to another brand.
+var ErrBrandConflict = errors.New("brand name or alias already in use")
+
+// maxBrandLength bounds brand names and aliases, like the brand of a device.
+const maxBrandLength = 50
+
+func (s *DeviceService) ListBrands(ctx context.Context) ([]model.Brand, error) {
+	return s.brands.Brands(ctx)
+}
+
+// GetBrand returns the brand with the given ID, or nil if it does not exist.
+func (s *DeviceService) GetBrand(ctx context.Context, id string) (*model.Brand, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil
+	}
+	return s.brands.Brand(ctx, id)
+}
+
+// CreateBrand registers a canonical brand. Its name and aliases must not
+// resolve to another brand.
+func (s *DeviceService) CreateBrand(ctx context.Context, name string, aliases []string) (*model.Brand, error) {
+	now := time.Now()
+	brand := &model.Brand{ID: uuid.New().String(), CreatedAt: now, UpdatedAt: now}
+	if err := s.setBrandNames(ctx, brand, name, aliases); err != nil {
+		return nil, err
+	}
+
+	if err := s.brands.CreateBrand(ctx, brand); err != nil {
+		return nil, err
+	}
+
+	return brand, nil
+}
+
+// UpdateBrand replaces the name and aliases of a brand. Its devices and
+// attribute schema follow a new name. It returns nil if the brand does not
+// exist.
+func (s *DeviceService) UpdateBrand(ctx context.Context, id, name string, aliases []string) (*model.Brand, error) {
+	brand, err := s.GetBrand(ctx, id)
+	if err != nil || brand == nil {
+		return nil, err
+	}
+
+	if err := s.setBrandNames(ctx, brand, name, aliases); err != nil {
+		return nil, err
+	}
+	brand.UpdatedAt = time.Now()
+
+	if err := s.brands.UpdateBrand(ctx, brand); err != nil {
+		return nil, err
+	}
+
+	return brand, nil
+}
+
+// DeleteBrand removes a brand along with its attribute schema. The boolean
+// is false if it did not exist. Brands that still have devices or models
+// cannot be deleted.
+func (s *DeviceService) DeleteBrand(ctx context.Context, id string) (bool, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return false, nil
+	}
+
+	devices, err := s.devices.List(ctx, model.DeviceFilter{BrandID: id}, 1, 0)
+	if err != nil {
+		return false, err
+	}
+	if len(devices) > 0 {
+		return false, fmt.Errorf("cannot delete brand that has devices")
+	}
+	models, err := s.models.Models(ctx, id, 1, 0)
+	if err != nil {
+		return false, err
+	}
+	if len(models) > 0 {
+		return false, fmt.Errorf("cannot delete brand that has models")
+	}
+
+	return s.brands.DeleteBrand(ctx, id)
+}
+
+// setBrandNames cleans and validates a brand's name and aliases and sets
+// them on brand. Aliases that normalize to the name or to each other are
+// dropped.
+func (s *DeviceService) setBrandNames(ctx context.Context, brand *model.Brand, name string, aliases []string) error {
+	name = model.CleanBrandName(name)
+	errs := validate.Errors{}
+	if name == "" {
+		errs.Add("name", "is required")
+	}
+
+	seen := map[string]bool{model.BrandKey(name): true}
+	cleaned := []string{}
+	for i, alias := range aliases {
+		alias = model.CleanBrandName(alias)
+		field := fmt.Sprintf("aliases[%d]", i)
+		switch {
+		case alias == "":
+			errs.Add(field, "must not be blank")
+			continue
+		case utf8.RuneCountInString(alias) > maxBrandLength:
+			errs.Add(field, fmt.Sprintf("must be at most %d characters", maxBrandLength))
+			continue
+		case strings.IndexFunc(alias, unicode.IsControl) >= 0:
+			errs.Add(field, "must not contain control characters")
+			continue
+		}
+		if key := model.BrandKey(alias); !seen[key] {
+			seen[key] = true
+			cleaned = append(cleaned, alias)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+
+	candidate := model.Brand{Name: name, Aliases: cleaned}
+	for i, key := range candidate.Keys() {
+		other, err := s.brands.BrandByKey(ctx, key)
+		if err != nil {
+			return err
+		}
+		if other != nil && other.ID != brand.ID {
+			spelling := name
+			if i > 0 {
+				spelling = cleaned[i-1]
+			}
+			return fmt.Errorf("%w: %q resolves to brand %q", ErrBrandConflict, spelling, other.Name)
+		}
+	}
+
+	brand.Name, brand.Aliases = name, cleaned
+	return nil
+}
+
+// brandResolver maps the brand names sent by clients to canonical brands.
+// Names that match no brand register a new one, named after them. The
+// repository creates it in the transaction of the device or model that
+// refers to it, so that rejected, failed or dry-run writes leave no trace;
+// other writes save it with save. It caches lookups, so a single resolver
+// serves a whole batch or import.
+type brandResolver struct {
+	store   BrandStore
+	byKey   map[string]*model.Brand
+	pending []*model.Brand
+}
+
+func (s *DeviceService) brandResolver() *brandResolver {
+	return &brandResolver{store: s.brands, byKey: make(map[string]*model.Brand)}
+}
+
+// lookup returns the brand that name or one of its aliases normalizes to,
+// or nil if there is none.
+func (r *brandResolver) lookup(ctx context.Context, name string) (*model.Brand, error) {
+	key := model.BrandKey(name)
+	if b, ok := r.byKey[key]; ok {
+		return b, nil
+	}
+
+	b, err := r.store.BrandByKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if b != nil {
+		r.byKey[key] = b
+	}
+	return b, nil
+}
+
+// canonical returns the canonical name and brand ID that name resolves to,
+// registering a new brand if needed. Blank names are returned unchanged, so
+// that the caller reports them as missing.
+func (r *brandResolver) canonical(ctx context.Context, name string) (string, string, error) {
+	if model.BrandKey(name) == "" {
+		return name, "", nil
+	}
+
+	b, err := r.lookup(ctx, name)
+	if err != nil {
+		return "", "", err
+	}
+	if b == nil {
+		now := time.Now()
+		b = &model.Brand{ID: uuid.New().String(), Name: model.CleanBrandName(name), Aliases: []string{}, CreatedAt: now, UpdatedAt: now}
+		r.byKey[model.BrandKey(name)] = b
+		r.pending = append(r.pending, b)
+	}
+	return b.Name, b.ID, nil
+}
+
+// canonicalUpdate is canonical for an optional brand. A nil brand resolves
+// to nil and an empty ID.
+func (r *brandResolver) canonicalUpdate(ctx context.Context, name *string) (*string, string, error) {
+	if name == nil {
+		return nil, "", nil
+	}
+	brand, id, err := r.canonical(ctx, *name)
+	if err != nil {
+		return nil, "", err
+	}
+	return &brand, id, nil
+}
+
+// save creates the brands registered since the last save. A brand that
+// another request has registered meanwhile is replaced by the one it saved.
+func (r *brandResolver) save(ctx context.Context) error {
+	for _, b := range r.pending {
+		err := r.store.CreateBrand(ctx, b)
+		var dup *model.DuplicateError
+		if !errors.As(err, &dup) {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		saved, err := r.store.BrandByKey(ctx, model.BrandKey(b.Name))
+		if err != nil {
+			return err
+		}
+		if saved == nil {
+			return dup
+		}
+		*b = *saved
+	}
+	r.pending = nil
+	return nil
+}
+
+// resolveFilter replaces the brand name of filter with the canonical brand
+// it resolves to. The boolean is false if it resolves to none, in which case
+// no device can match.
+func (s *DeviceService) resolveFilter(ctx context.Context, filter *model.DeviceFilter) (bool, error) {
+	if filter.Brand == "" {
+		return true, nil
+	}
+
+	b, err := s.brandResolver().lookup(ctx, filter.Brand)
+	if err != nil || b == nil {
+		return false, err
+	}
+	filter.Brand, filter.BrandID = "", b.ID
+	return true, nil
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// ModelStore stores the model catalog and the models of devices.
+type ModelStore interface {
+	Models(ctx context.Context, brandID string, limit, offset int) ([]model.DeviceModel, error)
+	Model(ctx context.Context, id string) (*model.DeviceModel, error)
+	ModelByName(ctx context.Context, brandID, name string) (*model.DeviceModel, error)
+	CreateModel(ctx context.Context, m *model.DeviceModel) error
+	UpdateModel(ctx context.Context, m *model.DeviceModel) error
+	DeleteModel(ctx context.Context, id string) (bool, error)
+	SetModel(ctx context.Context, d *model.Device) error
+	UnsupportedDevices(ctx context.Context, asOf time.Time, limit, offset int) ([]model.UnsupportedDevice, error)
+}
+
+// ErrModelConflict is returned when a brand already has a model with the
+// same name.
+var ErrModelConflict = errors.New("model name already in use")
+
+// ModelInput holds the fields of a catalog model.
+type ModelInput struct {
+	Brand        string
+	Name         string
+	Specs        map[string]any
+	ReleaseDate  *time.Time
+	EndOfSupport *time.Time
+}
+
+// ListModels returns a page of the catalog. A non-empty brand restricts it
+// to the models of the brand it resolves to.
+func (s *DeviceService) ListModels(ctx context.Context, brand string, limit, offset int) ([]model.DeviceModel, error) {
+	var brandID string
+	if brand != "" {
+		b, err := s.brandResolver().lookup(ctx, brand)
+		if err != nil || b == nil {
+			return nil, err
+		}
+		brandID = b.ID
+	}
+	return s.models.Models(ctx, brandID, limit, offset)
+}
+
+// GetModel returns the catalog model with the given ID, or nil if it does
+// not exist.
+func (s *DeviceService) GetModel(ctx context.Context, id string) (*model.DeviceModel, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil
+	}
+	return s.models.Model(ctx, id)
+}
+
+// CreateModel adds a model to the catalog. Its brand resolves like the brand
+// of a device, and its name must be unique within the brand.
+func (s *DeviceService) CreateModel(ctx context.Context, in ModelInput) (*model.DeviceModel, error) {
+	if model.BrandKey(in.Brand) == "" {
+		return nil, fmt.Errorf("brand is required")
+	}
+	if err := checkModelDates(in); err != nil {
+		return nil, err
+	}
+
+	brands := s.brandResolver()
+	brand, brandID, err := brands.canonical(ctx, in.Brand)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	m := &model.DeviceModel{ID: uuid.New().String(), BrandID: brandID, Brand: brand, CreatedAt: now}
+	if err := s.setModelFields(ctx, m, in, now); err != nil {
+		return nil, err
+	}
+
+	if err := s.models.CreateModel(ctx, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// UpdateModel replaces the fields of a catalog model. Its brand cannot
+// change; an empty brand keeps it. It returns nil if the model does not
+// exist.
+func (s *DeviceService) UpdateModel(ctx context.Context, id string, in ModelInput) (*model.DeviceModel, error) {
+	if err := checkModelDates(in); err != nil {
+		return nil, err
+	}
+
+	m, err := s.GetModel(ctx, id)
+	if err != nil || m == nil {
+		return nil, err
+	}
+
+	if in.Brand != "" {
+		b, err := s.brandResolver().lookup(ctx, in.Brand)
+		if err != nil {
+			return nil, err
+		}
+		if b == nil || b.ID != m.BrandID {
+			return nil, fmt.Errorf("cannot change the brand of a model")
+		}
+	}
+
+	if err := s.setModelFields(ctx, m, in, time.Now()); err != nil {
+		return nil, err
+	}
+
+	if err := s.models.UpdateModel(ctx, m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// DeleteModel removes a model from the catalog. The boolean is false if it
+// did not exist. Models that still have devices cannot be deleted.
+func (s *DeviceService) DeleteModel(ctx context.Context, id string) (bool, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return false, nil
+	}
+
+	devices, err := s.devices.List(ctx, model.DeviceFilter{ModelID: id}, 1, 0)
+	if err != nil {
+		return false, err
+	}
+	if len(devices) > 0 {
+		return false, fmt.Errorf("cannot delete model that has devices")
+	}
+
+	return s.models.DeleteModel(ctx, id)
+}
+
+// SetModel assigns a catalog model to a device, or clears it when modelID is
+// empty. The model must be of the device's brand. It returns nil if the
+// device does not exist.
+func (s *DeviceService) SetModel(ctx context.Context, id, modelID string) (*model.Device, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	if modelID != "" {
+		m, err := s.GetModel(ctx, modelID)
+		if err != nil {
+			return nil, err
+		}
+		if m == nil {
+			return nil, validate.Errors{"model_id": {"does not exist"}}
+		}
+		if m.BrandID != device.BrandID {
+			return nil, fmt.Errorf("cannot assign a model of brand %q to a device of brand %q", m.Brand, device.Brand)
+		}
+	}
+
+	device.ModelID = modelID
+	device.UpdatedAt = time.Now()
+
+	if err := s.models.SetModel(ctx, device); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// UnsupportedDevices returns a page of the devices whose model's end of
+// support is before asOf, the longest unsupported first.
+func (s *DeviceService) UnsupportedDevices(ctx context.Context, asOf time.Time, limit, offset int) ([]model.UnsupportedDevice, error) {
+	return s.models.UnsupportedDevices(ctx, asOf, limit, offset)
+}
+
+// setModelFields sets the fields of in on m, other than its brand, after
+// checking that no other model of the brand has its name.
+func (s *DeviceService) setModelFields(ctx context.Context, m *model.DeviceModel, in ModelInput, now time.Time) error {
+	if in.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	other, err := s.models.ModelByName(ctx, m.BrandID, in.Name)
+	if err != nil {
+		return err
+	}
+	if other != nil && other.ID != m.ID {
+		return fmt.Errorf("%w: brand %q already has a model named %q", ErrModelConflict, m.Brand, other.Name)
+	}
+
+	specs := in.Specs
+	if specs == nil {
+		specs = map[string]any{}
+	}
+	m.Name, m.Specs = in.Name, specs
+	m.ReleaseDate, m.EndOfSupport = in.ReleaseDate, in.EndOfSupport
+	m.UpdatedAt = now
+	return nil
+}
+
+func checkModelDates(in ModelInput) error {
+	if in.ReleaseDate != nil && in.EndOfSupport != nil && in.EndOfSupport.Before(*in.ReleaseDate) {
+		return validate.Errors{"end_of_support": {"must not be before release_date"}}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// ParentStore stores which devices are attached to which.
+type ParentStore interface {
+	SetParent(ctx context.Context, d *model.Device) error
+	Ancestors(ctx context.Context, id string) ([]model.Device, error)
+	Compositions(ctx context.Context, ids []string) (map[string]model.Composition, error)
+}
+
+// SetParent attaches a device to a parent device, such as a dock to the
+// laptop it belongs to, or detaches it when parentID is empty. A device
+// cannot be attached to itself or to one of its descendants. It returns nil
+// if the device does not exist.
+func (s *DeviceService) SetParent(ctx context.Context, id, parentID string) (*model.Device, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	if parentID != "" {
+		var parent *model.Device
+		if _, err := uuid.Parse(parentID); err == nil {
+			parent, err = s.devices.GetByID(ctx, parentID)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if parent == nil {
+			return nil, validate.Errors{"parent_id": {"does not exist"}}
+		}
+		if parent.ID == device.ID {
+			return nil, model.ErrParentCycle
+		}
+		parentID = parent.ID
+	}
+
+	device.ParentID = parentID
+	device.UpdatedAt = time.Now()
+
+	if err := s.parents.SetParent(ctx, device); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// Children returns a page of the devices attached to a device, newest
+// first. It returns nil if the device does not exist.
+func (s *DeviceService) Children(ctx context.Context, id string, limit, offset int) ([]model.Device, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	children, err := s.devices.List(ctx, model.DeviceFilter{ParentID: device.ID}, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if children == nil {
+		children = []model.Device{}
+	}
+	return children, nil
+}
+
+// Ancestors returns the devices a device is attached to, from its parent
+// up. It returns nil if the device does not exist.
+func (s *DeviceService) Ancestors(ctx context.Context, id string) ([]model.Device, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+	return s.parents.Ancestors(ctx, device.ID)
+}
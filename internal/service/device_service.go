@@ -9,56 +9,151 @@ import (
 	"github.com/lucast-ruiz/devices-api/internal/model"
 )
 
+// ErrQuotaExceeded is returned by Create when the tenant already owns as many
+// devices as its quota allows. The repository enforces the quota in the
+// transaction that writes the devices.
+var ErrQuotaExceeded = model.ErrQuotaExceeded
+
 type DeviceService struct {
-    repo DeviceRepo
+    devices      DeviceStore
+    history      HistoryStore
+    stats        StatsStore
+    utilization  UtilizationStore
+    schemas      SchemaStore
+    brands       BrandStore
+    models       ModelStore
+    locations    LocationStore
+    parents      ParentStore
+    holders      HolderStore
+    reservations ReservationStore
+    maintenance  MaintenanceStore
+    schedule     ScheduleStore
 }
 
 
-func NewDeviceService(r DeviceRepo) *DeviceService {
-    return &DeviceService{repo: r}
+func NewDeviceService(st Stores) *DeviceService {
+    return &DeviceService{
+        devices:      st.Devices,
+        history:      st.History,
+        stats:        st.Stats,
+        utilization:  st.Utilization,
+        schemas:      st.Schemas,
+        brands:       st.Brands,
+        models:       st.Models,
+        locations:    st.Locations,
+        parents:      st.Parents,
+        holders:      st.Holders,
+        reservations: st.Reservations,
+        maintenance:  st.Maintenance,
+        schedule:     st.Schedule,
+    }
 }
 
-func (s *DeviceService) Create(ctx context.Context, name, brand, state string) (*model.Device, error) {
-	if name == "" || brand == "" {
-		return nil, fmt.Errorf("name and brand are required")
-	}
-	if !model.IsValidState(state) {
-		return nil, fmt.Errorf("invalid state value")
+// Create adds a device. Its brand resolves to a canonical brand by name or
+// alias, and a brand that matches none is registered.
+func (s *DeviceService) Create(ctx context.Context, in CreateInput) (*model.Device, error) {
+	brands := s.brandResolver()
+	brand, brandID, err := brands.canonical(ctx, in.Brand)
+	if err != nil {
+		return nil, err
 	}
 
-	device := &model.Device{
-		ID:        uuid.New().String(),
-		Name:      name,
-		Brand:     brand,
-		State:     model.DeviceState(state),
-		CreatedAt: time.Now(),
+	in.Brand = brand
+	device, err := newDevice(in)
+	if err != nil {
+		return nil, err
+	}
+	device.BrandID = brandID
+	if err := s.attributeChecker().check(ctx, device); err != nil {
+		return nil, err
 	}
 
-	if err := s.repo.Create(ctx, device); err != nil {
+	if err := s.devices.Create(ctx, device); err != nil {
 		return nil, err
 	}
 
 	return device, nil
 }
 
+// newDevice validates the creation fields and builds a new device from them.
+func newDevice(in CreateInput) (*model.Device, error) {
+	if in.Name == "" || in.Brand == "" {
+		return nil, fmt.Errorf("name and brand are required")
+	}
+	if !model.IsValidState(in.State) {
+		return nil, fmt.Errorf("invalid state value")
+	}
+
+	attributes := in.Attributes
+	if attributes == nil {
+		attributes = map[string]any{}
+	}
+
+	now := time.Now()
+	return &model.Device{
+		ID:           uuid.New().String(),
+		Name:         in.Name,
+		Brand:        in.Brand,
+		SerialNumber: in.SerialNumber,
+		AssetTag:     in.AssetTag,
+		State:        model.DeviceState(in.State),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		Labels:       map[string]string{},
+		Attributes:   attributes,
+	}, nil
+}
+
 func (s *DeviceService) GetByID(ctx context.Context, id string) (*model.Device, error) {
-	return s.repo.GetByID(ctx, id)
+	return s.devices.GetByID(ctx, id)
 }
 
 func (s *DeviceService) ListAll(ctx context.Context, limit, offset int) ([]model.Device, error) {
-	return s.repo.ListAll(ctx, limit, offset)
+	return s.devices.ListAll(ctx, limit, offset)
 }
 
+// GetByBrand returns the devices of the canonical brand that brand resolves
+// to by name or alias.
 func (s *DeviceService) GetByBrand(ctx context.Context, brand string) ([]model.Device, error) {
-	return s.repo.GetByBrand(ctx, brand)
+	b, err := s.brandResolver().lookup(ctx, brand)
+	if err != nil || b == nil {
+		return nil, err
+	}
+	return s.devices.GetByBrand(ctx, b.ID)
 }
 
 func (s *DeviceService) GetByState(ctx context.Context, state string) ([]model.Device, error) {
-	return s.repo.GetByState(ctx, state)
+	return s.devices.GetByState(ctx, state)
+}
+
+// List returns a page of the devices matching filter, newest first. The
+// brand of filter matches through its canonical brand.
+func (s *DeviceService) List(ctx context.Context, filter model.DeviceFilter, limit, offset int) ([]model.Device, error) {
+	if filter.State != "" && !model.IsValidState(filter.State) {
+		return nil, fmt.Errorf("invalid state value")
+	}
+	if ok, err := s.resolveFilter(ctx, &filter); !ok {
+		return nil, err
+	}
+	return s.devices.List(ctx, filter, limit, offset)
 }
 
-func (s *DeviceService) Update(ctx context.Context, id string, name, brand, state *string) (*model.Device, error) {
-	device, err := s.repo.GetByID(ctx, id)
+// Export streams every device matching filter to fn. afterBatch is called
+// each time a batch of rows has been passed to fn.
+func (s *DeviceService) Export(ctx context.Context, filter model.DeviceFilter, fn func(*model.Device) error, afterBatch func()) error {
+	if filter.State != "" && !model.IsValidState(filter.State) {
+		return fmt.Errorf("invalid state value")
+	}
+	if ok, err := s.resolveFilter(ctx, &filter); !ok {
+		return err
+	}
+	return s.devices.Export(ctx, filter, fn, afterBatch)
+}
+
+// Update applies a partial update to the device with in.ID. Nil fields are
+// left unchanged; non-nil attributes replace the current ones.
+func (s *DeviceService) Update(ctx context.Context, in UpdateInput) (*model.Device, error) {
+	device, err := s.devices.GetByID(ctx, in.ID)
 	if err != nil {
 		return nil, err
 	}
@@ -66,42 +161,113 @@ func (s *DeviceService) Update(ctx context.Context, id string, name, brand, stat
 		return nil, nil
 	}
 
-	// Regra: não pode alterar name/brand se o device está "in-use"
-	if device.State == model.StateInUse {
-		if name != nil && *name != device.Name {
-			return nil, fmt.Errorf("cannot change name when device is in-use")
-		}
-		if brand != nil && *brand != device.Brand {
-			return nil, fmt.Errorf("cannot change brand when device is in-use")
-		}
-	}
-
-	// Valida estado, se enviado
-	if state != nil {
-		if !model.IsValidState(*state) {
-			return nil, fmt.Errorf("invalid state value")
-		}
-		device.State = model.DeviceState(*state)
+	brands := s.brandResolver()
+	brand, brandID, err := brands.canonicalUpdate(ctx, in.Brand)
+	if err != nil {
+		return nil, err
 	}
 
-	// Apply patch
-	if name != nil {
-		device.Name = *name
+	before := *device
+	in.Brand = brand
+	if err := applyUpdate(device, in); err != nil {
+		return nil, err
 	}
 	if brand != nil {
-		device.Brand = *brand
+		device.BrandID = brandID
+	}
+	if err := s.attributeChecker().checkChanged(ctx, before, device); err != nil {
+		return nil, err
 	}
 
 	// Save
-	if err := s.repo.Update(ctx, device); err != nil {
+	if err := s.devices.Update(ctx, device); err != nil {
 		return nil, err
 	}
 
 	return device, nil
 }
 
+// Replace overwrites every mutable field of a device, with the same in-use
+// rules as Update. createdAt, when given, must match the stored value. If the
+// device does not exist and upsert is set, it is created with the given ID,
+// which must be a UUID, and a server-assigned created_at; the boolean reports
+// whether it was created. Labels are kept, as they are not part of the
+// replaced representation.
+func (s *DeviceService) Replace(ctx context.Context, id string, in CreateInput, createdAt *time.Time, upsert bool) (*model.Device, bool, error) {
+	brands := s.brandResolver()
+	brand, brandID, err := brands.canonical(ctx, in.Brand)
+	if err != nil {
+		return nil, false, err
+	}
+
+	in.Brand = brand
+	replacement, err := newDevice(in)
+	if err != nil {
+		return nil, false, err
+	}
+	replacement.BrandID = brandID
+	checker := s.attributeChecker()
+
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if device == nil {
+		if !upsert {
+			return nil, false, nil
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, false, fmt.Errorf("invalid id: must be a UUID to create a device with PUT")
+		}
+		if err := checker.check(ctx, replacement); err != nil {
+			return nil, false, err
+		}
+
+		replacement.ID = id
+		if err := s.devices.Create(ctx, replacement); err != nil {
+			return nil, false, err
+		}
+		return replacement, true, nil
+	}
+
+	if createdAt != nil && !createdAt.Equal(device.CreatedAt) {
+		return nil, false, fmt.Errorf("cannot change created_at")
+	}
+
+	before := *device
+	if err := applyUpdate(device, replacementUpdate(replacement)); err != nil {
+		return nil, false, err
+	}
+	device.BrandID = brandID
+	if err := checker.checkChanged(ctx, before, device); err != nil {
+		return nil, false, err
+	}
+
+	if err := s.devices.Update(ctx, device); err != nil {
+		return nil, false, err
+	}
+
+	return device, false, nil
+}
+
+// replacementUpdate is the update that gives a device every mutable field
+// of replacement.
+func replacementUpdate(replacement *model.Device) UpdateInput {
+	state := string(replacement.State)
+	return UpdateInput{
+		ID:           replacement.ID,
+		Name:         &replacement.Name,
+		Brand:        &replacement.Brand,
+		State:        &state,
+		SerialNumber: &replacement.SerialNumber,
+		AssetTag:     &replacement.AssetTag,
+		Attributes:   replacement.Attributes,
+	}
+}
+
 func (s *DeviceService) Delete(ctx context.Context, id string) error {
-	device, err := s.repo.GetByID(ctx, id)
+	device, err := s.devices.GetByID(ctx, id)
 	if err != nil {
 		return err
 	}
@@ -109,21 +275,116 @@ func (s *DeviceService) Delete(ctx context.Context, id string) error {
 		return nil
 	}
 
+	compositions, err := s.parents.Compositions(ctx, []string{device.ID})
+	if err != nil {
+		return err
+	}
+	if err := checkDeletable(device, compositions[device.ID]); err != nil {
+		return err
+	}
+
+	return s.devices.Delete(ctx, id)
+}
+
+// applyUpdate applies a partial update to device, enforcing the in-use
+// rules. device is left untouched when an error is returned.
+func applyUpdate(device *model.Device, in UpdateInput) error {
+	// Regra: não pode alterar name/brand se o device está "in-use"
+	if device.State == model.StateInUse {
+		if in.Name != nil && *in.Name != device.Name {
+			return fmt.Errorf("cannot change name when device is in-use")
+		}
+		if in.Brand != nil && *in.Brand != device.Brand {
+			return fmt.Errorf("cannot change brand when device is in-use")
+		}
+	}
+	// The model of a device is of its brand.
+	if device.ModelID != "" && in.Brand != nil && *in.Brand != device.Brand {
+		return fmt.Errorf("cannot change brand of a device that has a model")
+	}
+
+	// Valida estado, se enviado
+	if in.State != nil {
+		if !model.IsValidState(*in.State) {
+			return fmt.Errorf("invalid state value")
+		}
+		device.State = model.DeviceState(*in.State)
+	}
+
+	// Apply patch
+	if in.Name != nil {
+		device.Name = *in.Name
+	}
+	if in.Brand != nil {
+		device.Brand = *in.Brand
+	}
+	if in.SerialNumber != nil {
+		device.SerialNumber = *in.SerialNumber
+	}
+	if in.AssetTag != nil {
+		device.AssetTag = *in.AssetTag
+	}
+	if in.Attributes != nil {
+		device.Attributes = in.Attributes
+	}
+	device.UpdatedAt = time.Now()
+
+	return nil
+}
+
+// checkDeletable enforces the deletion rules. A device attached to an
+// in-use device is treated as in use itself, and a device cannot be deleted
+// before the devices attached to it are detached or deleted.
+func checkDeletable(device *model.Device, c model.Composition) error {
 	// Regra: não pode deletar se in-use
 	if device.State == model.StateInUse {
 		return fmt.Errorf("cannot delete device that is in-use")
 	}
-
-	return s.repo.Delete(ctx, id)
+	if c.InUseAncestorID != "" {
+		return fmt.Errorf("cannot delete device attached to in-use device %s", c.InUseAncestorID)
+	}
+	if c.Children > 0 {
+		return fmt.Errorf("cannot delete device that has %d attached devices", c.Children)
+	}
+	return nil
 }
 
-type DeviceRepo interface {
+// DeviceStore stores the devices of the current tenant.
+type DeviceStore interface {
     Create(ctx context.Context, d *model.Device) error
     GetByID(ctx context.Context, id string) (*model.Device, error)
     ListAll(ctx context.Context, limit, offset int) ([]model.Device, error)
-    GetByBrand(ctx context.Context, brand string) ([]model.Device, error)
+    GetByBrand(ctx context.Context, brandID string) ([]model.Device, error)
     GetByState(ctx context.Context, state string) ([]model.Device, error)
     Update(ctx context.Context, d *model.Device) error
     Delete(ctx context.Context, id string) error
+    CreateMany(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error)
+    GetByIDs(ctx context.Context, ids []string) (map[string]*model.Device, error)
+    UpdateMany(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error)
+    DeleteMany(ctx context.Context, ids []string) error
+    FindByFields(ctx context.Context, match map[string]string, limit int) ([]model.Device, error)
+    Export(ctx context.Context, filter model.DeviceFilter, fn func(*model.Device) error, afterBatch func()) error
+    List(ctx context.Context, filter model.DeviceFilter, limit, offset int) ([]model.Device, error)
+    SetLabels(ctx context.Context, d *model.Device) error
+    RemainingQuota(ctx context.Context) (int, bool, error)
+}
+
+// Stores holds the storage of each feature of the service. A single
+// repository may implement all of them. A store that none of the calls
+// made on the service uses may be left nil.
+type Stores struct {
+    Devices      DeviceStore
+    History      HistoryStore
+    Stats        StatsStore
+    Utilization  UtilizationStore
+    Schemas      SchemaStore
+    Brands       BrandStore
+    Models       ModelStore
+    Locations    LocationStore
+    Parents      ParentStore
+    Holders      HolderStore
+    Reservations ReservationStore
+    Maintenance  MaintenanceStore
+    Schedule     ScheduleStore
 }
 
@@ -2,18 +2,33 @@ package service
 
 import (
     "context"
+    "errors"
+    "strings"
     "testing"
     "time"
 
     "github.com/lucast-ruiz/devices-api/internal/model"
+    "github.com/lucast-ruiz/devices-api/internal/tenant"
 )
 
 
 type mockRepo struct {
-    CreateFn   func(ctx context.Context, d *model.Device) error
-    GetByIDFn  func(ctx context.Context, id string) (*model.Device, error)
-    UpdateFn   func(ctx context.Context, d *model.Device) error
-    DeleteFn   func(ctx context.Context, id string) error
+    CreateFn         func(ctx context.Context, d *model.Device) error
+    GetByIDFn        func(ctx context.Context, id string) (*model.Device, error)
+    UpdateFn         func(ctx context.Context, d *model.Device) error
+    DeleteFn         func(ctx context.Context, id string) error
+    RemainingQuotaFn func(ctx context.Context) (int, bool, error)
+    CreateManyFn     func(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error)
+    GetByIDsFn       func(ctx context.Context, ids []string) (map[string]*model.Device, error)
+    UpdateManyFn     func(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error)
+    DeleteManyFn     func(ctx context.Context, ids []string) error
+    FindByFieldsFn   func(ctx context.Context, match map[string]string, limit int) ([]model.Device, error)
+    ExportFn         func(ctx context.Context, filter model.DeviceFilter, fn func(*model.Device) error, afterBatch func()) error
+    ListFn           func(ctx context.Context, filter model.DeviceFilter, limit, offset int) ([]model.Device, error)
+    SetLabelsFn      func(ctx context.Context, d *model.Device) error
+    BrandSchemaFn    func(ctx context.Context, brand string) (*model.BrandSchema, error)
+    BrandByKeyFn     func(ctx context.Context, key string) (*model.Brand, error)
+    CreateBrandFn    func(ctx context.Context, b *model.Brand) error
 }
 
 func (m *mockRepo) Create(ctx context.Context, d *model.Device) error {
@@ -56,6 +71,473 @@ func (m *mockRepo) Delete(ctx context.Context, id string) error {
     return nil
 }
 
+func (m *mockRepo) RemainingQuota(ctx context.Context) (int, bool, error) {
+    if m.RemainingQuotaFn != nil {
+        return m.RemainingQuotaFn(ctx)
+    }
+    return 0, false, nil
+}
+
+func (m *mockRepo) CreateMany(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+    if m.CreateManyFn != nil {
+        return m.CreateManyFn(ctx, devices, atomic)
+    }
+    return nil, nil
+}
+
+func (m *mockRepo) GetByIDs(ctx context.Context, ids []string) (map[string]*model.Device, error) {
+    if m.GetByIDsFn != nil {
+        return m.GetByIDsFn(ctx, ids)
+    }
+    return map[string]*model.Device{}, nil
+}
+
+func (m *mockRepo) UpdateMany(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+    if m.UpdateManyFn != nil {
+        return m.UpdateManyFn(ctx, devices, atomic)
+    }
+    return nil, nil
+}
+
+func (m *mockRepo) DeleteMany(ctx context.Context, ids []string) error {
+    if m.DeleteManyFn != nil {
+        return m.DeleteManyFn(ctx, ids)
+    }
+    return nil
+}
+
+func (m *mockRepo) FindByFields(ctx context.Context, match map[string]string, limit int) ([]model.Device, error) {
+    if m.FindByFieldsFn != nil {
+        return m.FindByFieldsFn(ctx, match, limit)
+    }
+    return nil, nil
+}
+
+func (m *mockRepo) List(ctx context.Context, filter model.DeviceFilter, limit, offset int) ([]model.Device, error) {
+    if m.ListFn != nil {
+        return m.ListFn(ctx, filter, limit, offset)
+    }
+    return nil, nil
+}
+
+func (m *mockRepo) SetLabels(ctx context.Context, d *model.Device) error {
+    if m.SetLabelsFn != nil {
+        return m.SetLabelsFn(ctx, d)
+    }
+    return nil
+}
+
+func (m *mockRepo) BrandSchema(ctx context.Context, brand string) (*model.BrandSchema, error) {
+    if m.BrandSchemaFn != nil {
+        return m.BrandSchemaFn(ctx, brand)
+    }
+    return nil, nil
+}
+
+func (m *mockRepo) SaveBrandSchema(ctx context.Context, s *model.BrandSchema) error {
+    return nil
+}
+
+func (m *mockRepo) DeleteBrandSchema(ctx context.Context, brand string) (bool, error) {
+    return false, nil
+}
+
+func (m *mockRepo) Brands(ctx context.Context) ([]model.Brand, error) {
+    return nil, nil
+}
+
+func (m *mockRepo) Brand(ctx context.Context, id string) (*model.Brand, error) {
+    return nil, nil
+}
+
+func (m *mockRepo) BrandByKey(ctx context.Context, key string) (*model.Brand, error) {
+    if m.BrandByKeyFn != nil {
+        return m.BrandByKeyFn(ctx, key)
+    }
+    return nil, nil
+}
+
+func (m *mockRepo) CreateBrand(ctx context.Context, b *model.Brand) error {
+    if m.CreateBrandFn != nil {
+        return m.CreateBrandFn(ctx, b)
+    }
+    return nil
+}
+
+func (m *mockRepo) UpdateBrand(ctx context.Context, b *model.Brand) error {
+    return nil
+}
+
+func (m *mockRepo) DeleteBrand(ctx context.Context, id string) (bool, error) {
+    return false, nil
+}
+
+func (m *mockRepo) Export(ctx context.Context, filter model.DeviceFilter, fn func(*model.Device) error, afterBatch func()) error {
+    if m.ExportFn != nil {
+        return m.ExportFn(ctx, filter, fn, afterBatch)
+    }
+    return nil
+}
+
+type mockHistory struct {
+    GetByIDAsOfFn func(ctx context.Context, id string, at time.Time) (*model.Device, error)
+}
+
+func (m *mockHistory) GetByIDAsOf(ctx context.Context, id string, at time.Time) (*model.Device, error) {
+    if m.GetByIDAsOfFn != nil {
+        return m.GetByIDAsOfFn(ctx, id, at)
+    }
+    return nil, nil
+}
+
+func (m *mockHistory) ListAsOf(ctx context.Context, filter model.DeviceFilter, at time.Time, limit, offset int) ([]model.Device, error) {
+    return []model.Device{}, nil
+}
+
+type mockStats struct {
+    CountDevicesFn func(ctx context.Context, filter model.DeviceFilter, by []model.StatsDimension) ([]model.DeviceCount, error)
+}
+
+func (m *mockStats) CountDevices(ctx context.Context, filter model.DeviceFilter, by []model.StatsDimension) ([]model.DeviceCount, error) {
+    if m.CountDevicesFn != nil {
+        return m.CountDevicesFn(ctx, filter, by)
+    }
+    return []model.DeviceCount{}, nil
+}
+
+type mockUtilization struct {
+    DeviceUtilizationFn func(ctx context.Context, deviceID string, from, to time.Time) (*model.Utilization, error)
+}
+
+func (m *mockUtilization) DeviceUtilization(ctx context.Context, deviceID string, from, to time.Time) (*model.Utilization, error) {
+    if m.DeviceUtilizationFn != nil {
+        return m.DeviceUtilizationFn(ctx, deviceID, from, to)
+    }
+    return &model.Utilization{}, nil
+}
+
+func (m *mockUtilization) FleetUtilization(ctx context.Context, byBrand bool, from, to time.Time) ([]model.Utilization, error) {
+    return []model.Utilization{}, nil
+}
+
+type mockModels struct {
+    ModelFn    func(ctx context.Context, id string) (*model.DeviceModel, error)
+    SetModelFn func(ctx context.Context, d *model.Device) error
+}
+
+func (m *mockModels) Models(ctx context.Context, brandID string, limit, offset int) ([]model.DeviceModel, error) {
+    return nil, nil
+}
+
+func (m *mockModels) Model(ctx context.Context, id string) (*model.DeviceModel, error) {
+    if m.ModelFn != nil {
+        return m.ModelFn(ctx, id)
+    }
+    return nil, nil
+}
+
+func (m *mockModels) ModelByName(ctx context.Context, brandID, name string) (*model.DeviceModel, error) {
+    return nil, nil
+}
+
+func (m *mockModels) CreateModel(ctx context.Context, dm *model.DeviceModel) error {
+    return nil
+}
+
+func (m *mockModels) UpdateModel(ctx context.Context, dm *model.DeviceModel) error {
+    return nil
+}
+
+func (m *mockModels) DeleteModel(ctx context.Context, id string) (bool, error) {
+    return false, nil
+}
+
+func (m *mockModels) SetModel(ctx context.Context, d *model.Device) error {
+    if m.SetModelFn != nil {
+        return m.SetModelFn(ctx, d)
+    }
+    return nil
+}
+
+func (m *mockModels) UnsupportedDevices(ctx context.Context, asOf time.Time, limit, offset int) ([]model.UnsupportedDevice, error) {
+    return nil, nil
+}
+
+type mockLocations struct {
+    LocationFn   func(ctx context.Context, id string) (*model.Location, error)
+    MoveDeviceFn func(ctx context.Context, d *model.Device, mv *model.DeviceMove) error
+}
+
+func (m *mockLocations) Locations(ctx context.Context, parentID, kind string, limit, offset int) ([]model.Location, error) {
+    return nil, nil
+}
+
+func (m *mockLocations) Location(ctx context.Context, id string) (*model.Location, error) {
+    if m.LocationFn != nil {
+        return m.LocationFn(ctx, id)
+    }
+    return nil, nil
+}
+
+func (m *mockLocations) CreateLocation(ctx context.Context, l *model.Location) error {
+    return nil
+}
+
+func (m *mockLocations) UpdateLocation(ctx context.Context, l *model.Location) error {
+    return nil
+}
+
+func (m *mockLocations) DeleteLocation(ctx context.Context, id string) (bool, error) {
+    return false, nil
+}
+
+func (m *mockLocations) MoveDevice(ctx context.Context, d *model.Device, mv *model.DeviceMove) error {
+    if m.MoveDeviceFn != nil {
+        return m.MoveDeviceFn(ctx, d, mv)
+    }
+    return nil
+}
+
+func (m *mockLocations) DeviceMoves(ctx context.Context, deviceID string, limit, offset int) ([]model.DeviceMove, error) {
+    return nil, nil
+}
+
+type mockParents struct {
+    SetParentFn    func(ctx context.Context, d *model.Device) error
+    CompositionsFn func(ctx context.Context, ids []string) (map[string]model.Composition, error)
+}
+
+func (m *mockParents) SetParent(ctx context.Context, d *model.Device) error {
+    if m.SetParentFn != nil {
+        return m.SetParentFn(ctx, d)
+    }
+    return nil
+}
+
+func (m *mockParents) Ancestors(ctx context.Context, id string) ([]model.Device, error) {
+    return []model.Device{}, nil
+}
+
+func (m *mockParents) Compositions(ctx context.Context, ids []string) (map[string]model.Composition, error) {
+    if m.CompositionsFn != nil {
+        return m.CompositionsFn(ctx, ids)
+    }
+    return map[string]model.Composition{}, nil
+}
+
+type mockHolders struct {
+    HolderFn        func(ctx context.Context, id string) (*model.Holder, error)
+    AssignmentsFn   func(ctx context.Context, filter model.AssignmentFilter, limit, offset int) ([]model.Assignment, error)
+    AssignFn        func(ctx context.Context, d *model.Device, a *model.Assignment) error
+    EndAssignmentFn func(ctx context.Context, d *model.Device, a *model.Assignment) error
+}
+
+func (m *mockHolders) Holders(ctx context.Context, kind, externalID string, limit, offset int) ([]model.Holder, error) {
+    return nil, nil
+}
+
+func (m *mockHolders) Holder(ctx context.Context, id string) (*model.Holder, error) {
+    if m.HolderFn != nil {
+        return m.HolderFn(ctx, id)
+    }
+    return nil, nil
+}
+
+func (m *mockHolders) CreateHolder(ctx context.Context, h *model.Holder) error {
+    return nil
+}
+
+func (m *mockHolders) UpdateHolder(ctx context.Context, h *model.Holder) error {
+    return nil
+}
+
+func (m *mockHolders) DeleteHolder(ctx context.Context, id string) (bool, error) {
+    return false, nil
+}
+
+func (m *mockHolders) HolderDevices(ctx context.Context, holderID string, limit, offset int) ([]model.Device, error) {
+    return nil, nil
+}
+
+func (m *mockHolders) Assignments(ctx context.Context, filter model.AssignmentFilter, limit, offset int) ([]model.Assignment, error) {
+    if m.AssignmentsFn != nil {
+        return m.AssignmentsFn(ctx, filter, limit, offset)
+    }
+    return nil, nil
+}
+
+func (m *mockHolders) Assign(ctx context.Context, d *model.Device, a *model.Assignment) error {
+    if m.AssignFn != nil {
+        return m.AssignFn(ctx, d, a)
+    }
+    return nil
+}
+
+func (m *mockHolders) EndAssignment(ctx context.Context, d *model.Device, a *model.Assignment) error {
+    if m.EndAssignmentFn != nil {
+        return m.EndAssignmentFn(ctx, d, a)
+    }
+    return nil
+}
+
+type mockReservations struct {
+    CreateReservationFn     func(ctx context.Context, res *model.Reservation) error
+    ReservationTenantsFn    func(ctx context.Context, at time.Time) ([]string, error)
+    DueReservationsFn       func(ctx context.Context, at time.Time, limit int) ([]model.Reservation, error)
+    TransitionReservationFn func(ctx context.Context, res *model.Reservation, from model.ReservationStatus) (bool, error)
+}
+
+func (m *mockReservations) Reservations(ctx context.Context, deviceID string, from, to time.Time, limit, offset int) ([]model.Reservation, error) {
+    return nil, nil
+}
+
+func (m *mockReservations) Reservation(ctx context.Context, id string) (*model.Reservation, error) {
+    return nil, nil
+}
+
+func (m *mockReservations) CreateReservation(ctx context.Context, res *model.Reservation) error {
+    if m.CreateReservationFn != nil {
+        return m.CreateReservationFn(ctx, res)
+    }
+    return nil
+}
+
+func (m *mockReservations) DeleteReservation(ctx context.Context, id string) (bool, error) {
+    return false, nil
+}
+
+func (m *mockReservations) Available(ctx context.Context, filter model.DeviceFilter, from, to time.Time, limit, offset int) ([]model.Device, error) {
+    return nil, nil
+}
+
+func (m *mockReservations) ReservationTenants(ctx context.Context, at time.Time) ([]string, error) {
+    if m.ReservationTenantsFn != nil {
+        return m.ReservationTenantsFn(ctx, at)
+    }
+    return nil, nil
+}
+
+func (m *mockReservations) DueReservations(ctx context.Context, at time.Time, limit int) ([]model.Reservation, error) {
+    if m.DueReservationsFn != nil {
+        return m.DueReservationsFn(ctx, at, limit)
+    }
+    return nil, nil
+}
+
+func (m *mockReservations) TransitionReservation(ctx context.Context, res *model.Reservation, from model.ReservationStatus) (bool, error) {
+    if m.TransitionReservationFn != nil {
+        return m.TransitionReservationFn(ctx, res, from)
+    }
+    return false, nil
+}
+
+type mockMaintenance struct {
+    MaintenanceRecordsFn func(ctx context.Context, filter model.MaintenanceFilter, limit, offset int) ([]model.MaintenanceRecord, error)
+    OpenMaintenanceFn    func(ctx context.Context, d *model.Device, rec *model.MaintenanceRecord) error
+    CloseMaintenanceFn   func(ctx context.Context, d *model.Device, rec *model.MaintenanceRecord) error
+}
+
+func (m *mockMaintenance) MaintenanceRecords(ctx context.Context, filter model.MaintenanceFilter, limit, offset int) ([]model.MaintenanceRecord, error) {
+    if m.MaintenanceRecordsFn != nil {
+        return m.MaintenanceRecordsFn(ctx, filter, limit, offset)
+    }
+    return nil, nil
+}
+
+func (m *mockMaintenance) OpenMaintenance(ctx context.Context, d *model.Device, rec *model.MaintenanceRecord) error {
+    if m.OpenMaintenanceFn != nil {
+        return m.OpenMaintenanceFn(ctx, d, rec)
+    }
+    return nil
+}
+
+func (m *mockMaintenance) CloseMaintenance(ctx context.Context, d *model.Device, rec *model.MaintenanceRecord) error {
+    if m.CloseMaintenanceFn != nil {
+        return m.CloseMaintenanceFn(ctx, d, rec)
+    }
+    return nil
+}
+
+func (m *mockMaintenance) RepairTimes(ctx context.Context, brandID string, from, to time.Time) ([]model.RepairTime, error) {
+    return nil, nil
+}
+
+type mockSchedule struct {
+    CreateScheduledActionFn func(ctx context.Context, a *model.ScheduledAction) error
+    ClaimScheduledActionsFn func(ctx context.Context, at time.Time, lease time.Duration, limit int) ([]model.ScheduledAction, error)
+    FinishScheduledActionFn func(ctx context.Context, a *model.ScheduledAction) (bool, error)
+}
+
+func (m *mockSchedule) ScheduledActions(ctx context.Context, filter model.ScheduledActionFilter, limit, offset int) ([]model.ScheduledAction, error) {
+    return nil, nil
+}
+
+func (m *mockSchedule) ScheduledAction(ctx context.Context, id string) (*model.ScheduledAction, error) {
+    return nil, nil
+}
+
+func (m *mockSchedule) CreateScheduledAction(ctx context.Context, a *model.ScheduledAction) error {
+    if m.CreateScheduledActionFn != nil {
+        return m.CreateScheduledActionFn(ctx, a)
+    }
+    return nil
+}
+
+func (m *mockSchedule) CancelScheduledAction(ctx context.Context, id string, at time.Time) (bool, error) {
+    return false, nil
+}
+
+func (m *mockSchedule) ClaimScheduledActions(ctx context.Context, at time.Time, lease time.Duration, limit int) ([]model.ScheduledAction, error) {
+    if m.ClaimScheduledActionsFn != nil {
+        return m.ClaimScheduledActionsFn(ctx, at, lease, limit)
+    }
+    return nil, nil
+}
+
+func (m *mockSchedule) FinishScheduledAction(ctx context.Context, a *model.ScheduledAction) (bool, error) {
+    if m.FinishScheduledActionFn != nil {
+        return m.FinishScheduledActionFn(ctx, a)
+    }
+    return true, nil
+}
+
+// newTestService builds a service on repo, with a mock of each feature
+// store that st leaves nil.
+func newTestService(repo *mockRepo, st Stores) *DeviceService {
+    st.Devices, st.Brands, st.Schemas = repo, repo, repo
+    if st.History == nil {
+        st.History = &mockHistory{}
+    }
+    if st.Stats == nil {
+        st.Stats = &mockStats{}
+    }
+    if st.Utilization == nil {
+        st.Utilization = &mockUtilization{}
+    }
+    if st.Models == nil {
+        st.Models = &mockModels{}
+    }
+    if st.Locations == nil {
+        st.Locations = &mockLocations{}
+    }
+    if st.Parents == nil {
+        st.Parents = &mockParents{}
+    }
+    if st.Holders == nil {
+        st.Holders = &mockHolders{}
+    }
+    if st.Reservations == nil {
+        st.Reservations = &mockReservations{}
+    }
+    if st.Maintenance == nil {
+        st.Maintenance = &mockMaintenance{}
+    }
+    if st.Schedule == nil {
+        st.Schedule = &mockSchedule{}
+    }
+    return NewDeviceService(st)
+}
+
 //
 // TESTES DAS REGRAS DE NEGÓCIO
 //
@@ -75,9 +557,9 @@ func TestUpdate_CannotChangeNameWhenInUse(t *testing.T) {
         },
     }
 
-    svc := NewDeviceService(repo)
+    svc := newTestService(repo, Stores{})
 
-    _, err := svc.Update(context.Background(), "1", &newName, nil, nil)
+    _, err := svc.Update(context.Background(), UpdateInput{ID: "1", Name: &newName})
     if err == nil {
         t.Fatalf("expected error, got nil")
     }
@@ -98,9 +580,9 @@ func TestUpdate_CannotChangeBrandWhenInUse(t *testing.T) {
         },
     }
 
-    svc := NewDeviceService(repo)
+    svc := newTestService(repo, Stores{})
 
-    _, err := svc.Update(context.Background(), "1", nil, &newBrand, nil)
+    _, err := svc.Update(context.Background(), UpdateInput{ID: "1", Brand: &newBrand})
     if err == nil {
         t.Fatalf("expected error, got nil")
     }
@@ -119,7 +601,7 @@ func TestDelete_CannotDeleteInUse(t *testing.T) {
         },
     }
 
-    svc := NewDeviceService(repo)
+    svc := newTestService(repo, Stores{})
 
     err := svc.Delete(context.Background(), "1")
     if err == nil {
@@ -142,9 +624,9 @@ func TestUpdate_InvalidState(t *testing.T) {
         },
     }
 
-    svc := NewDeviceService(repo)
+    svc := newTestService(repo, Stores{})
 
-    _, err := svc.Update(context.Background(), "1", nil, nil, &invalid)
+    _, err := svc.Update(context.Background(), UpdateInput{ID: "1", State: &invalid})
     if err == nil {
         t.Fatalf("expected error for invalid state")
     }
@@ -171,10 +653,10 @@ func TestUpdate_CreatedAtIsNotModified(t *testing.T) {
         },
     }
 
-    svc := NewDeviceService(repo)
+    svc := newTestService(repo, Stores{})
 
     newName := "Updated"
-    _, err := svc.Update(context.Background(), "1", &newName, nil, nil)
+    _, err := svc.Update(context.Background(), UpdateInput{ID: "1", Name: &newName})
     if err != nil {
         t.Fatalf("unexpected error: %v", err)
     }
@@ -191,9 +673,9 @@ func TestUpdate_DeviceNotFound(t *testing.T) {
         },
     }
 
-    svc := NewDeviceService(repo)
+    svc := newTestService(repo, Stores{})
 
-    dev, err := svc.Update(context.Background(), "1", nil, nil, nil)
+    dev, err := svc.Update(context.Background(), UpdateInput{ID: "1"})
     if err != nil {
         t.Fatalf("unexpected error: %v", err)
     }
@@ -204,15 +686,906 @@ func TestUpdate_DeviceNotFound(t *testing.T) {
 
 func TestCreate_RequiresNameAndBrand(t *testing.T) {
     repo := &mockRepo{}
-    svc := NewDeviceService(repo)
+    svc := newTestService(repo, Stores{})
 
-    _, err := svc.Create(context.Background(), "", "Brand", "available")
+    _, err := svc.Create(context.Background(), CreateInput{Name: "", Brand: "Brand", State: "available"})
     if err == nil {
         t.Fatalf("expected error for missing name")
     }
 
-    _, err = svc.Create(context.Background(), "Device", "", "available")
+    _, err = svc.Create(context.Background(), CreateInput{Name: "Device", Brand: "", State: "available"})
     if err == nil {
         t.Fatalf("expected error for missing brand")
     }
 }
+
+func TestCreate_RejectsWhenQuotaExceeded(t *testing.T) {
+    repo := &mockRepo{
+        CreateFn: func(ctx context.Context, d *model.Device) error {
+            return ErrQuotaExceeded
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+
+    _, err := svc.Create(context.Background(), CreateInput{Name: "Device", Brand: "Brand", State: "available"})
+    if !errors.Is(err, ErrQuotaExceeded) {
+        t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+    }
+}
+
+func TestReplace_KeepsInUseRules(t *testing.T) {
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            return &model.Device{ID: id, Name: "A", Brand: "B", State: model.StateInUse}, nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+
+    if _, _, err := svc.Replace(context.Background(), "1", CreateInput{Name: "Other", Brand: "B", State: "in-use"}, nil, false); err == nil {
+        t.Fatalf("expected error renaming an in-use device")
+    }
+    if _, _, err := svc.Replace(context.Background(), "1", CreateInput{Name: "A", Brand: "B", State: "available"}, nil, false); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+}
+
+func TestReplace_CreatedAtIsImmutable(t *testing.T) {
+    created := time.Now().Add(-time.Hour)
+
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            return &model.Device{ID: id, Name: "A", Brand: "B", State: model.StateAvailable, CreatedAt: created}, nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+
+    other := created.Add(time.Minute)
+    if _, _, err := svc.Replace(context.Background(), "1", CreateInput{Name: "A", Brand: "B", State: "available"}, &other, false); err == nil {
+        t.Fatalf("expected error changing created_at")
+    }
+    if _, _, err := svc.Replace(context.Background(), "1", CreateInput{Name: "A", Brand: "B", State: "available"}, &created, false); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+}
+
+func TestReplace_Upsert(t *testing.T) {
+    var saved *model.Device
+    repo := &mockRepo{
+        CreateFn: func(ctx context.Context, d *model.Device) error {
+            saved = d
+            return nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+
+    dev, created, err := svc.Replace(context.Background(), "1", CreateInput{Name: "A", Brand: "B", State: "available"}, nil, false)
+    if err != nil || dev != nil || created {
+        t.Fatalf("expected not found without upsert")
+    }
+
+    if _, _, err := svc.Replace(context.Background(), "not-a-uuid", CreateInput{Name: "A", Brand: "B", State: "available"}, nil, true); err == nil {
+        t.Fatalf("expected error for non-UUID id")
+    }
+
+    id := "6f1c5c1e-3f0a-4a7e-9a52-6d2b8c1f4e11"
+    dev, created, err = svc.Replace(context.Background(), id, CreateInput{Name: "A", Brand: "B", State: "available"}, nil, true)
+    if err != nil || !created || saved == nil || saved.ID != id {
+        t.Fatalf("expected device to be created with the given id, got %v", err)
+    }
+}
+
+func TestPatchDocument(t *testing.T) {
+    created := time.Now().Add(-time.Hour).UTC()
+    current := func() *model.Device {
+        return &model.Device{ID: "1", Name: "A", Brand: "B", State: model.StateInUse, CreatedAt: created}
+    }
+
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            return current(), nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+
+    set := func(doc string) func([]byte) ([]byte, error) {
+        return func([]byte) ([]byte, error) { return []byte(doc), nil }
+    }
+    createdAt := created.Format(time.RFC3339Nano)
+
+    dev, err := svc.PatchDocument(context.Background(), "1", set(`{"id":"1","name":"A","brand":"B","state":"available","created_at":"`+createdAt+`"}`))
+    if err != nil || dev.State != model.StateAvailable {
+        t.Fatalf("expected state change to be applied, got %v", err)
+    }
+
+    tests := map[string]string{
+        "in-use rename":    `{"id":"1","name":"Z","brand":"B","state":"in-use","created_at":"` + createdAt + `"}`,
+        "removed name":     `{"id":"1","brand":"B","state":"in-use","created_at":"` + createdAt + `"}`,
+        "changed id":       `{"id":"2","name":"A","brand":"B","state":"in-use","created_at":"` + createdAt + `"}`,
+        "changed created":  `{"id":"1","name":"A","brand":"B","state":"in-use","created_at":"2000-01-01T00:00:00Z"}`,
+        "unknown member":   `{"id":"1","name":"A","brand":"B","state":"in-use","created_at":"` + createdAt + `","color":"red"}`,
+        "invalid state":    `{"id":"1","name":"A","brand":"B","state":"broken","created_at":"` + createdAt + `"}`,
+    }
+    for name, doc := range tests {
+        if _, err := svc.PatchDocument(context.Background(), "1", set(doc)); err == nil {
+            t.Fatalf("%s: expected error", name)
+        }
+    }
+}
+
+func TestSetLabels_ValidatesAndReplaces(t *testing.T) {
+    var saved *model.Device
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            return &model.Device{ID: id, State: model.StateInUse, Labels: map[string]string{"old": "x"}}, nil
+        },
+        SetLabelsFn: func(ctx context.Context, d *model.Device) error {
+            saved = d
+            return nil
+        },
+    }
+    svc := newTestService(repo, Stores{})
+
+    if _, err := svc.SetLabels(context.Background(), "1", map[string]string{"bad key": "x"}); err == nil {
+        t.Fatalf("expected error for invalid label key")
+    }
+    if saved != nil {
+        t.Fatalf("invalid labels must not be saved")
+    }
+
+    device, err := svc.SetLabels(context.Background(), "1", map[string]string{"env": "prod"})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if saved != device || len(device.Labels) != 1 || device.Labels["env"] != "prod" {
+        t.Fatalf("expected labels to be replaced, got %+v", device.Labels)
+    }
+}
+
+func TestAttributes_ValidatedAgainstBrandSchema(t *testing.T) {
+    lookups := 0
+    repo := &mockRepo{
+        BrandSchemaFn: func(ctx context.Context, brand string) (*model.BrandSchema, error) {
+            lookups++
+            if brand != "acme" {
+                return nil, nil
+            }
+            return &model.BrandSchema{Brand: brand, Schema: []byte(`{"type":"object","properties":{"firmware":{"type":"string"}},"required":["firmware"]}`)}, nil
+        },
+    }
+    svc := newTestService(repo, Stores{})
+
+    _, err := svc.Create(context.Background(), CreateInput{Name: "d1", Brand: "acme", State: "available", Attributes: map[string]any{"firmware": 3}})
+    if !isValidationError(err) {
+        t.Fatalf("expected validation error, got %v", err)
+    }
+    if _, err := svc.Create(context.Background(), CreateInput{Name: "d1", Brand: "acme", State: "available", Attributes: map[string]any{"firmware": "1.2"}}); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if _, err := svc.Create(context.Background(), CreateInput{Name: "d1", Brand: "other", State: "available", Attributes: map[string]any{"anything": true}}); err != nil {
+        t.Fatalf("brands without a schema must accept any attributes: %v", err)
+    }
+
+    lookups = 0
+    checker := svc.attributeChecker()
+    before := model.Device{Brand: "acme", Attributes: map[string]any{}}
+    unchanged := before
+    if err := checker.checkChanged(context.Background(), before, &unchanged); err != nil || lookups != 0 {
+        t.Fatalf("unchanged attributes must not be revalidated: err=%v lookups=%d", err, lookups)
+    }
+}
+
+func TestCreate_ResolvesBrandAliases(t *testing.T) {
+    apple := &model.Brand{ID: "b1", Name: "Apple", Aliases: []string{"Apple Inc"}}
+    var created []*model.Brand
+    repo := &mockRepo{
+        BrandByKeyFn: func(ctx context.Context, key string) (*model.Brand, error) {
+            if key == "apple" || key == "apple inc" {
+                return apple, nil
+            }
+            return nil, nil
+        },
+        CreateBrandFn: func(ctx context.Context, b *model.Brand) error {
+            created = append(created, b)
+            return nil
+        },
+    }
+    svc := newTestService(repo, Stores{})
+
+    for _, brand := range []string{"Apple", "apple ", "APPLE  Inc"} {
+        device, err := svc.Create(context.Background(), CreateInput{Name: "d1", Brand: brand, State: "available"})
+        if err != nil {
+            t.Fatalf("%q: unexpected error: %v", brand, err)
+        }
+        if device.Brand != "Apple" || device.BrandID != "b1" {
+            t.Fatalf("%q: expected canonical brand, got %q (%q)", brand, device.Brand, device.BrandID)
+        }
+    }
+    if len(created) != 0 {
+        t.Fatalf("known brands must not be registered again")
+    }
+
+    device, err := svc.Create(context.Background(), CreateInput{Name: "d1", Brand: "  Samsung  ", State: "available"})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if device.Brand != "Samsung" || device.BrandID == "" || device.BrandID == "b1" {
+        t.Fatalf("expected an unknown brand to be registered, got %q (%q)", device.Brand, device.BrandID)
+    }
+    // The repository creates it along with the device.
+    if len(created) != 0 {
+        t.Fatalf("expected no brand to be saved apart from the device, got %+v", created)
+    }
+}
+
+func TestPutBrandSchema_UsesBrandRegisteredConcurrently(t *testing.T) {
+    var saved *model.Brand
+    repo := &mockRepo{
+        BrandByKeyFn: func(ctx context.Context, key string) (*model.Brand, error) {
+            return saved, nil
+        },
+        CreateBrandFn: func(ctx context.Context, b *model.Brand) error {
+            // Another request registers the brand first.
+            saved = &model.Brand{ID: "b1", Name: "Acme", Aliases: []string{}}
+            return &model.DuplicateError{}
+        },
+    }
+    svc := newTestService(repo, Stores{})
+
+    bs, err := svc.PutBrandSchema(context.Background(), "ACME", []byte(`{"type": "object"}`))
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if bs.Brand != "Acme" {
+        t.Fatalf("expected the schema of the saved brand, got %q", bs.Brand)
+    }
+}
+
+func TestCreateBrand_RejectsTakenAlias(t *testing.T) {
+    repo := &mockRepo{
+        BrandByKeyFn: func(ctx context.Context, key string) (*model.Brand, error) {
+            if key == "apple" {
+                return &model.Brand{ID: "b1", Name: "Apple"}, nil
+            }
+            return nil, nil
+        },
+    }
+    svc := newTestService(repo, Stores{})
+
+    if _, err := svc.CreateBrand(context.Background(), "Apple Computer", []string{"APPLE"}); !errors.Is(err, ErrBrandConflict) {
+        t.Fatalf("expected ErrBrandConflict, got %v", err)
+    }
+
+    if _, err := svc.CreateBrand(context.Background(), " Samsung ", []string{"samsung", "Samsung Electronics", ""}); err == nil {
+        t.Fatalf("expected error for blank alias")
+    }
+    brand, err := svc.CreateBrand(context.Background(), " Samsung ", []string{"samsung", "Samsung  Electronics"})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if brand.Name != "Samsung" || len(brand.Aliases) != 1 || brand.Aliases[0] != "Samsung Electronics" {
+        t.Fatalf("unexpected brand %+v", brand)
+    }
+}
+
+func TestSetModel_RequiresSameBrand(t *testing.T) {
+    const modelID = "7d1f5e0e-3c5e-4f7a-9d59-2f3c6a9b8e01"
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            return &model.Device{ID: id, Brand: "Apple", BrandID: "b1", State: model.StateAvailable}, nil
+        },
+    }
+    models := &mockModels{
+        ModelFn: func(ctx context.Context, id string) (*model.DeviceModel, error) {
+            if id != modelID {
+                return nil, nil
+            }
+            return &model.DeviceModel{ID: id, BrandID: "b1", Brand: "Apple", Name: "iPhone 15 Pro"}, nil
+        },
+    }
+    svc := newTestService(repo, Stores{Models: models})
+
+    device, err := svc.SetModel(context.Background(), "1", modelID)
+    if err != nil || device.ModelID != modelID {
+        t.Fatalf("expected model to be assigned, got %+v, %v", device, err)
+    }
+
+    if _, err := svc.SetModel(context.Background(), "1", "1b9d6bcd-bbfd-4b2d-9b5d-ab8dfbbd4bed"); !isValidationError(err) {
+        t.Fatalf("expected validation error for unknown model, got %v", err)
+    }
+
+    repo.GetByIDFn = func(ctx context.Context, id string) (*model.Device, error) {
+        return &model.Device{ID: id, Brand: "Samsung", BrandID: "b2", State: model.StateAvailable}, nil
+    }
+    if _, err := svc.SetModel(context.Background(), "1", modelID); err == nil {
+        t.Fatalf("expected error for a model of another brand")
+    }
+}
+
+func TestUpdate_CannotChangeBrandWithModel(t *testing.T) {
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            return &model.Device{ID: id, Brand: "Apple", BrandID: "b1", ModelID: "m1", State: model.StateAvailable}, nil
+        },
+    }
+    svc := newTestService(repo, Stores{})
+
+    brand := "Samsung"
+    if _, err := svc.Update(context.Background(), UpdateInput{ID: "1", Brand: &brand}); err == nil {
+        t.Fatalf("expected error when changing the brand of a device with a model")
+    }
+}
+
+func TestGetBySerialNumber_RequiresBrandWhenShared(t *testing.T) {
+    repo := &mockRepo{
+        BrandByKeyFn: func(ctx context.Context, key string) (*model.Brand, error) {
+            if key == "apple" {
+                return &model.Brand{ID: "b1", Name: "Apple"}, nil
+            }
+            return nil, nil
+        },
+        FindByFieldsFn: func(ctx context.Context, match map[string]string, limit int) ([]model.Device, error) {
+            if match["serial_number"] != "SN1" {
+                return nil, nil
+            }
+            if match["brand_id"] == "b1" {
+                return []model.Device{{ID: "1", BrandID: "b1", SerialNumber: "SN1"}}, nil
+            }
+            return []model.Device{{ID: "1", BrandID: "b1"}, {ID: "2", BrandID: "b2"}}, nil
+        },
+    }
+    svc := newTestService(repo, Stores{})
+
+    if _, err := svc.GetBySerialNumber(context.Background(), "SN1", ""); !isValidationError(err) {
+        t.Fatalf("expected validation error for a serial number shared by several brands, got %v", err)
+    }
+    device, err := svc.GetBySerialNumber(context.Background(), "SN1", "APPLE")
+    if err != nil || device == nil || device.ID != "1" {
+        t.Fatalf("expected the device of the brand, got %+v, %v", device, err)
+    }
+    if device, err := svc.GetBySerialNumber(context.Background(), "SN1", "Unknown"); err != nil || device != nil {
+        t.Fatalf("expected no device for an unknown brand, got %+v, %v", device, err)
+    }
+}
+
+func TestCreateLocation_RequiresParentOfLevelAbove(t *testing.T) {
+    const siteID = "3f0c1a52-5d0e-4b44-8f1a-6c2b9d7e4a10"
+    repo := &mockRepo{}
+    locations := &mockLocations{
+        LocationFn: func(ctx context.Context, id string) (*model.Location, error) {
+            if id != siteID {
+                return nil, nil
+            }
+            return &model.Location{ID: id, Kind: model.LocationSite, Name: "Lisbon", Path: []string{"Lisbon"}}, nil
+        },
+    }
+    svc := newTestService(repo, Stores{Locations: locations})
+
+    building, err := svc.CreateLocation(context.Background(), LocationInput{ParentID: siteID, Kind: "building", Name: "HQ"})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if building.ParentID != siteID || len(building.Path) != 2 || building.Path[1] != "HQ" {
+        t.Fatalf("expected the building under the site, got %+v", building)
+    }
+
+    for _, in := range []LocationInput{
+        {ParentID: siteID, Kind: "room", Name: "Lab"},
+        {Kind: "room", Name: "Lab"},
+        {ParentID: siteID, Kind: "site", Name: "Porto"},
+        {ParentID: "1b9d6bcd-bbfd-4b2d-9b5d-ab8dfbbd4bed", Kind: "building", Name: "Annex"},
+    } {
+        if _, err := svc.CreateLocation(context.Background(), in); !isValidationError(err) {
+            t.Fatalf("expected validation error for %+v, got %v", in, err)
+        }
+    }
+}
+
+func TestMoveDevice_RecordsHistory(t *testing.T) {
+    const roomID = "5a7e2c11-0b3d-4d5f-9e8a-1c2d3e4f5a6b"
+    var moves []*model.DeviceMove
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            return &model.Device{ID: id, Name: "d1", Brand: "Apple", State: model.StateAvailable, LocationID: roomID}, nil
+        },
+    }
+    locations := &mockLocations{
+        LocationFn: func(ctx context.Context, id string) (*model.Location, error) {
+            return &model.Location{ID: id, Kind: model.LocationRoom, Name: "Lab"}, nil
+        },
+        MoveDeviceFn: func(ctx context.Context, d *model.Device, mv *model.DeviceMove) error {
+            moves = append(moves, mv)
+            return nil
+        },
+    }
+    svc := newTestService(repo, Stores{Locations: locations})
+
+    if _, err := svc.MoveDevice(context.Background(), "1", roomID, ""); err != nil || len(moves) != 0 {
+        t.Fatalf("expected no move to the current location, got %d moves, %v", len(moves), err)
+    }
+
+    const shelfID = "9c8b7a6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"
+    device, err := svc.MoveDevice(context.Background(), "1", shelfID, "restocked")
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if device.LocationID != shelfID || len(moves) != 1 {
+        t.Fatalf("expected one move to the shelf, got %+v, %d moves", device, len(moves))
+    }
+    if moves[0].FromLocationID != roomID || moves[0].ToLocationID != shelfID || moves[0].Note != "restocked" {
+        t.Fatalf("unexpected move %+v", moves[0])
+    }
+
+    device, err = svc.MoveDevice(context.Background(), "1", "", "")
+    if err != nil || device.LocationID != "" || moves[1].ToLocationID != "" {
+        t.Fatalf("expected the location to be cleared, got %+v, %v", device, err)
+    }
+}
+
+func TestDelete_GuardsAttachedDevices(t *testing.T) {
+    compositions := map[string]model.Composition{
+        "dock":   {InUseAncestorID: "laptop"},
+        "laptop": {Children: 2},
+    }
+    deleted := false
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            return &model.Device{ID: id, Name: id, Brand: "Dell", State: model.StateAvailable}, nil
+        },
+        DeleteFn: func(ctx context.Context, id string) error {
+            deleted = true
+            return nil
+        },
+    }
+    parents := &mockParents{
+        CompositionsFn: func(ctx context.Context, ids []string) (map[string]model.Composition, error) {
+            out := map[string]model.Composition{}
+            for _, id := range ids {
+                out[id] = compositions[id]
+            }
+            return out, nil
+        },
+    }
+    svc := newTestService(repo, Stores{Parents: parents})
+
+    if err := svc.Delete(context.Background(), "dock"); err == nil || !strings.Contains(err.Error(), "in-use device laptop") {
+        t.Fatalf("expected a device attached to an in-use device to be guarded, got %v", err)
+    }
+    if err := svc.Delete(context.Background(), "laptop"); err == nil || !strings.Contains(err.Error(), "attached devices") {
+        t.Fatalf("expected a device with attached devices to be guarded, got %v", err)
+    }
+    if deleted {
+        t.Fatalf("expected nothing to be deleted")
+    }
+
+    if err := svc.Delete(context.Background(), "charger"); err != nil || !deleted {
+        t.Fatalf("expected a detached device to be deleted, got %v", err)
+    }
+}
+
+func TestSetParent_RejectsSelfAndUnknownParent(t *testing.T) {
+    const laptopID = "0f8a3c52-1d2e-4b3f-9a4b-5c6d7e8f9a0b"
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            if id != laptopID && id != "dock" {
+                return nil, nil
+            }
+            return &model.Device{ID: id, Name: id, Brand: "Dell", State: model.StateAvailable}, nil
+        },
+    }
+    svc := newTestService(repo, Stores{})
+
+    device, err := svc.SetParent(context.Background(), "dock", laptopID)
+    if err != nil || device.ParentID != laptopID {
+        t.Fatalf("expected the dock to be attached, got %+v, %v", device, err)
+    }
+
+    if _, err := svc.SetParent(context.Background(), laptopID, laptopID); !errors.Is(err, model.ErrParentCycle) {
+        t.Fatalf("expected ErrParentCycle, got %v", err)
+    }
+    if _, err := svc.SetParent(context.Background(), "dock", "1b9d6bcd-bbfd-4b2d-9b5d-ab8dfbbd4bed"); !isValidationError(err) {
+        t.Fatalf("expected validation error for unknown parent, got %v", err)
+    }
+
+    device, err = svc.SetParent(context.Background(), "dock", "")
+    if err != nil || device.ParentID != "" {
+        t.Fatalf("expected the dock to be detached, got %+v, %v", device, err)
+    }
+}
+
+func TestAssign_PutsDeviceInUseOnce(t *testing.T) {
+    const holderID = "2c4e6a8b-0d1f-4a3c-8e5b-7d9f1a3c5e7b"
+    device := &model.Device{ID: "1", Name: "Laptop", Brand: "Dell", State: model.StateAvailable}
+    var active []model.Assignment
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            d := *device
+            return &d, nil
+        },
+    }
+    holders := &mockHolders{
+        HolderFn: func(ctx context.Context, id string) (*model.Holder, error) {
+            return &model.Holder{ID: id, Kind: model.HolderPerson, Name: "Ana"}, nil
+        },
+        AssignmentsFn: func(ctx context.Context, filter model.AssignmentFilter, limit, offset int) ([]model.Assignment, error) {
+            return active, nil
+        },
+        AssignFn: func(ctx context.Context, d *model.Device, a *model.Assignment) error {
+            device = d
+            active = append(active, *a)
+            return nil
+        },
+        EndAssignmentFn: func(ctx context.Context, d *model.Device, a *model.Assignment) error {
+            device = d
+            active = nil
+            return nil
+        },
+    }
+    svc := newTestService(repo, Stores{Holders: holders})
+
+    a, err := svc.Assign(context.Background(), "1", holderID, "")
+    if err != nil || a.HolderID != holderID || device.State != model.StateInUse {
+        t.Fatalf("expected the device to be assigned and in use, got %+v, %+v, %v", a, device, err)
+    }
+    if _, err := svc.Assign(context.Background(), "1", holderID, ""); !errors.Is(err, model.ErrAlreadyAssigned) {
+        t.Fatalf("expected ErrAlreadyAssigned, got %v", err)
+    }
+
+    a, err = svc.EndAssignment(context.Background(), "1")
+    if err != nil || a.EndedAt == nil || device.State != model.StateAvailable {
+        t.Fatalf("expected the assignment to end and the device to be available, got %+v, %+v, %v", a, device, err)
+    }
+    if _, err := svc.EndAssignment(context.Background(), "1"); !errors.Is(err, ErrNotAssigned) {
+        t.Fatalf("expected ErrNotAssigned, got %v", err)
+    }
+
+    device.State = model.StateInactive
+    if _, err := svc.Assign(context.Background(), "1", holderID, ""); err == nil {
+        t.Fatalf("expected an inactive device not to be assigned")
+    }
+}
+
+func TestRunReservations_PutsDeviceInUseForThePeriod(t *testing.T) {
+    start := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+    device := &model.Device{ID: "1", Name: "Phone", Brand: "Apple", State: model.StateAvailable}
+    reservations := []model.Reservation{{ID: "r1", DeviceID: "1", StartsAt: start, EndsAt: start.Add(time.Hour), Status: model.ReservationScheduled}}
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            d := *device
+            return &d, nil
+        },
+        UpdateFn: func(ctx context.Context, d *model.Device) error {
+            device = d
+            return nil
+        },
+    }
+    store := &mockReservations{
+        ReservationTenantsFn: func(ctx context.Context, at time.Time) ([]string, error) {
+            return []string{"acme"}, nil
+        },
+        DueReservationsFn: func(ctx context.Context, at time.Time, limit int) ([]model.Reservation, error) {
+            if id, _ := tenant.FromContext(ctx); id != "acme" {
+                t.Fatalf("expected the reservations of tenant acme, got %q", id)
+            }
+            var due []model.Reservation
+            for _, res := range reservations {
+                if (res.Status == model.ReservationScheduled && !res.StartsAt.After(at)) ||
+                    (res.Status == model.ReservationActive && !res.EndsAt.After(at)) {
+                    due = append(due, res)
+                }
+            }
+            return due, nil
+        },
+        TransitionReservationFn: func(ctx context.Context, res *model.Reservation, from model.ReservationStatus) (bool, error) {
+            if reservations[0].Status != from {
+                return false, nil
+            }
+            reservations[0] = *res
+            return true, nil
+        },
+    }
+    svc := newTestService(repo, Stores{Reservations: store})
+
+    if err := svc.RunReservations(context.Background(), start.Add(-time.Minute)); err != nil || device.State != model.StateAvailable {
+        t.Fatalf("expected nothing to happen before the start, got %+v, %v", device, err)
+    }
+
+    if err := svc.RunReservations(context.Background(), start); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if device.State != model.StateInUse || reservations[0].Status != model.ReservationActive || !reservations[0].Applied {
+        t.Fatalf("expected the reservation to start and put the device in use, got %+v, %+v", device, reservations[0])
+    }
+
+    if err := svc.RunReservations(context.Background(), start.Add(time.Hour)); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if device.State != model.StateAvailable || reservations[0].Status != model.ReservationCompleted {
+        t.Fatalf("expected the reservation to end and free the device, got %+v, %+v", device, reservations[0])
+    }
+}
+
+func TestReserve_ValidatesPeriod(t *testing.T) {
+    device := &model.Device{ID: "1", Name: "Phone", Brand: "Apple", State: model.StateAvailable}
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            d := *device
+            return &d, nil
+        },
+    }
+    reservations := &mockReservations{
+        CreateReservationFn: func(ctx context.Context, res *model.Reservation) error {
+            return model.ErrReservationConflict
+        },
+    }
+    svc := newTestService(repo, Stores{Reservations: reservations})
+
+    now := time.Now()
+    if _, err := svc.Reserve(context.Background(), "1", ReservationInput{StartsAt: now.Add(2 * time.Hour), EndsAt: now.Add(time.Hour)}); !isValidationError(err) {
+        t.Fatalf("expected validation error for a period that ends before it starts, got %v", err)
+    }
+    if _, err := svc.Reserve(context.Background(), "1", ReservationInput{StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)}); !isValidationError(err) {
+        t.Fatalf("expected validation error for a past period, got %v", err)
+    }
+    if _, err := svc.Reserve(context.Background(), "1", ReservationInput{StartsAt: now, EndsAt: now.Add(time.Hour)}); !errors.Is(err, model.ErrReservationConflict) {
+        t.Fatalf("expected ErrReservationConflict, got %v", err)
+    }
+}
+
+func TestMaintenance_TakesDeviceOutOfServiceAndRestoresIt(t *testing.T) {
+    device := &model.Device{ID: "1", Name: "Laptop", Brand: "Dell", State: model.StateInUse}
+    var open []model.MaintenanceRecord
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            d := *device
+            return &d, nil
+        },
+    }
+    maintenance := &mockMaintenance{
+        MaintenanceRecordsFn: func(ctx context.Context, filter model.MaintenanceFilter, limit, offset int) ([]model.MaintenanceRecord, error) {
+            return open, nil
+        },
+        OpenMaintenanceFn: func(ctx context.Context, d *model.Device, rec *model.MaintenanceRecord) error {
+            device = d
+            open = append(open, *rec)
+            return nil
+        },
+        CloseMaintenanceFn: func(ctx context.Context, d *model.Device, rec *model.MaintenanceRecord) error {
+            device = d
+            open = nil
+            return nil
+        },
+    }
+    svc := newTestService(repo, Stores{Maintenance: maintenance})
+
+    rec, err := svc.OpenMaintenance(context.Background(), "1", "screen flickers")
+    if err != nil || rec.PreviousState != model.StateInUse || device.State != model.StateInactive {
+        t.Fatalf("expected the device to be taken out of service, got %+v, %+v, %v", rec, device, err)
+    }
+    if _, err := svc.OpenMaintenance(context.Background(), "1", ""); !errors.Is(err, model.ErrUnderMaintenance) {
+        t.Fatalf("expected ErrUnderMaintenance, got %v", err)
+    }
+
+    negative := int64(-1)
+    if _, err := svc.CloseMaintenance(context.Background(), "1", CloseMaintenanceInput{Resolution: "replaced", CostCents: &negative}); !isValidationError(err) {
+        t.Fatalf("expected validation error for a negative cost, got %v", err)
+    }
+
+    cost := int64(12000)
+    rec, err = svc.CloseMaintenance(context.Background(), "1", CloseMaintenanceInput{Resolution: "replaced the panel", CostCents: &cost})
+    if err != nil || rec.ClosedAt == nil || rec.Diagnosis != "screen flickers" || device.State != model.StateInUse {
+        t.Fatalf("expected the record to close and the device to be back in use, got %+v, %+v, %v", rec, device, err)
+    }
+    if _, err := svc.CloseMaintenance(context.Background(), "1", CloseMaintenanceInput{Resolution: "again"}); !errors.Is(err, ErrNotUnderMaintenance) {
+        t.Fatalf("expected ErrNotUnderMaintenance, got %v", err)
+    }
+}
+
+func TestRunScheduledActions_RetriesUntilOutOfAttempts(t *testing.T) {
+    now := time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+    device := &model.Device{ID: "1", Name: "Laptop", Brand: "Dell", State: model.StateInUse}
+    actions := []model.ScheduledAction{
+        {ID: "a1", TenantID: "acme", DeviceID: "1", Action: model.ActionDelete, RunAt: now, Status: model.ActionPending, MaxAttempts: 2},
+        {ID: "a2", TenantID: "acme", DeviceID: "1", Action: model.ActionSetState, State: model.StateInactive, RunAt: now, Status: model.ActionPending, MaxAttempts: 5},
+    }
+    deleted := false
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            d := *device
+            return &d, nil
+        },
+        UpdateFn: func(ctx context.Context, d *model.Device) error {
+            device = d
+            return nil
+        },
+        DeleteFn: func(ctx context.Context, id string) error {
+            deleted = true
+            return nil
+        },
+    }
+    schedule := &mockSchedule{
+        ClaimScheduledActionsFn: func(ctx context.Context, at time.Time, lease time.Duration, limit int) ([]model.ScheduledAction, error) {
+            var claimed []model.ScheduledAction
+            for i := range actions {
+                if actions[i].Status == model.ActionPending && !actions[i].RunAt.After(at) {
+                    actions[i].Attempts++
+                    claimed = append(claimed, actions[i])
+                }
+            }
+            return claimed, nil
+        },
+        FinishScheduledActionFn: func(ctx context.Context, a *model.ScheduledAction) (bool, error) {
+            if id, _ := tenant.FromContext(ctx); id != a.TenantID {
+                t.Fatalf("expected the action to finish under tenant %s, got %q", a.TenantID, id)
+            }
+            for i := range actions {
+                if actions[i].ID == a.ID {
+                    actions[i] = *a
+                }
+            }
+            return true, nil
+        },
+    }
+    svc := newTestService(repo, Stores{Schedule: schedule})
+
+    // The device is in use when the delete runs, so it fails and is retried.
+    if err := svc.RunScheduledActions(context.Background(), now); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if actions[0].Status != model.ActionPending || actions[0].LastError == "" || actions[0].RunAt != now.Add(time.Minute) {
+        t.Fatalf("expected the delete to be retried a minute later, got %+v", actions[0])
+    }
+    if actions[1].Status != model.ActionDone || device.State != model.StateInactive {
+        t.Fatalf("expected the state change to be done, got %+v, %+v", actions[1], device)
+    }
+
+    device.State = model.StateInUse
+    if err := svc.RunScheduledActions(context.Background(), actions[0].RunAt); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if actions[0].Status != model.ActionFailed || actions[0].CompletedAt == nil || deleted {
+        t.Fatalf("expected the delete to fail after its last attempt, got %+v", actions[0])
+    }
+}
+
+func TestScheduleAction_Validates(t *testing.T) {
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            if id != "1" {
+                return nil, nil
+            }
+            return &model.Device{ID: id, Name: "Laptop", Brand: "Dell", State: model.StateAvailable}, nil
+        },
+    }
+    svc := newTestService(repo, Stores{})
+    runAt := time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+    for _, in := range []ScheduledActionInput{
+        {DeviceID: "1", Action: "reboot", RunAt: runAt},
+        {DeviceID: "1", Action: "set_state", State: "broken", RunAt: runAt},
+        {DeviceID: "1", Action: "delete", State: "inactive", RunAt: runAt},
+        {DeviceID: "1", Action: "delete"},
+        {DeviceID: "2", Action: "delete", RunAt: runAt},
+    } {
+        if _, err := svc.ScheduleAction(context.Background(), in); !isValidationError(err) {
+            t.Fatalf("expected validation error for %+v, got %v", in, err)
+        }
+    }
+
+    a, err := svc.ScheduleAction(context.Background(), ScheduledActionInput{DeviceID: "1", Action: "set_state", State: "inactive", RunAt: runAt})
+    if err != nil || a.Status != model.ActionPending || a.State != model.StateInactive {
+        t.Fatalf("expected a pending state change, got %+v, %v", a, err)
+    }
+}
+
+func TestDeviceStats_CountsNothingForUnknownBrand(t *testing.T) {
+    repo := &mockRepo{}
+    stats := &mockStats{
+        CountDevicesFn: func(ctx context.Context, filter model.DeviceFilter, by []model.StatsDimension) ([]model.DeviceCount, error) {
+            t.Fatal("devices of an unknown brand should not be counted")
+            return nil, nil
+        },
+    }
+    svc := newTestService(repo, Stores{Stats: stats})
+
+    counts, err := svc.DeviceStats(context.Background(), model.DeviceFilter{Brand: "Unknown"}, nil)
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(counts) != 1 || counts[0].Count != 0 {
+        t.Fatalf("expected a single count of 0, got %+v", counts)
+    }
+
+    counts, err = svc.DeviceStats(context.Background(), model.DeviceFilter{Brand: "Unknown"}, []string{"brand"})
+    if err != nil || len(counts) != 0 {
+        t.Fatalf("expected no groups, got %+v, %v", counts, err)
+    }
+}
+
+func TestDeviceUtilization_EndsThePeriodNow(t *testing.T) {
+    var end time.Time
+    repo := &mockRepo{
+        GetByIDFn: func(ctx context.Context, id string) (*model.Device, error) {
+            return &model.Device{ID: id, Name: "Phone", Brand: "Apple", State: model.StateInUse}, nil
+        },
+    }
+    utilization := &mockUtilization{
+        DeviceUtilizationFn: func(ctx context.Context, deviceID string, from, to time.Time) (*model.Utilization, error) {
+            end = to
+            return &model.Utilization{Devices: 1}, nil
+        },
+    }
+    svc := newTestService(repo, Stores{Utilization: utilization})
+
+    now := time.Now()
+    if _, err := svc.DeviceUtilization(context.Background(), "1", now.Add(-time.Hour), now.Add(24*time.Hour)); err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if end.After(time.Now()) || end.Before(now) {
+        t.Fatalf("expected the period to end now, got %v", end)
+    }
+
+    if _, err := svc.DeviceUtilization(context.Background(), "1", now.Add(time.Hour), time.Time{}); err == nil || !strings.Contains(err.Error(), "invalid period") {
+        t.Fatalf("expected invalid period for a period starting in the future, got %v", err)
+    }
+    if _, err := svc.FleetUtilization(context.Background(), "state", time.Time{}, time.Time{}); err == nil || !strings.Contains(err.Error(), "invalid group_by") {
+        t.Fatalf("expected invalid group_by, got %v", err)
+    }
+}
+
+func TestDiffDevice_ListsChangedFields(t *testing.T) {
+    created := time.Date(2026, time.January, 5, 9, 0, 0, 0, time.UTC)
+    versions := []model.Device{
+        {ID: "9b2f0a9e-59a4-4a3c-9f3c-2f4a1f0f1a01", Name: "Phone", Brand: "Apple", State: model.StateAvailable, CreatedAt: created, UpdatedAt: created},
+        {ID: "9b2f0a9e-59a4-4a3c-9f3c-2f4a1f0f1a01", Name: "Phone", Brand: "Apple", State: model.StateInUse, SerialNumber: "SN-1", CreatedAt: created, UpdatedAt: created.Add(24 * time.Hour)},
+    }
+    repo := &mockRepo{}
+    history := &mockHistory{
+        GetByIDAsOfFn: func(ctx context.Context, id string, at time.Time) (*model.Device, error) {
+            switch {
+            case at.Before(created):
+                return nil, nil
+            case at.Before(versions[1].UpdatedAt):
+                d := versions[0]
+                return &d, nil
+            default:
+                d := versions[1]
+                return &d, nil
+            }
+        },
+    }
+    svc := newTestService(repo, Stores{History: history})
+    ctx := context.Background()
+    id := versions[0].ID
+
+    diff, err := svc.DiffDevice(ctx, id, created.Add(time.Hour), created.Add(48*time.Hour))
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    var fields []string
+    for _, c := range diff.Changes {
+        fields = append(fields, c.Field)
+    }
+    if strings.Join(fields, ",") != "serial_number,state,updated_at" {
+        t.Fatalf("expected serial_number, state and updated_at to change, got %v", diff.Changes)
+    }
+    if c := diff.Changes[0]; c.From != nil || c.To != "SN-1" {
+        t.Fatalf("expected the serial number to be added, got %+v", c)
+    }
+
+    diff, err = svc.DiffDevice(ctx, id, created.Add(-time.Hour), created.Add(time.Hour))
+    if err != nil || diff.Before != nil || len(diff.Changes) == 0 {
+        t.Fatalf("expected every field to be added, got %+v, %v", diff, err)
+    }
+
+    if diff, err := svc.DiffDevice(ctx, id, created.Add(-2*time.Hour), created.Add(-time.Hour)); err != nil || diff != nil {
+        t.Fatalf("expected nil for a device that did not exist, got %+v, %v", diff, err)
+    }
+    if _, err := svc.DiffDevice(ctx, id, time.Time{}, created); err == nil || !strings.Contains(err.Error(), "required") {
+        t.Fatalf("expected from to be required, got %v", err)
+    }
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// HistoryStore reads the devices of the current tenant as they were at a
+// past time.
+type HistoryStore interface {
+	GetByIDAsOf(ctx context.Context, id string, at time.Time) (*model.Device, error)
+	ListAsOf(ctx context.Context, filter model.DeviceFilter, at time.Time, limit, offset int) ([]model.Device, error)
+}
+
+// GetByIDAsOf returns the device with the given ID as it was at the given
+// time, or nil if it did not exist then.
+func (s *DeviceService) GetByIDAsOf(ctx context.Context, id string, at time.Time) (*model.Device, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil
+	}
+	return s.history.GetByIDAsOf(ctx, id, at)
+}
+
+// ListAsOf returns a page of the devices that matched filter at the given
+// time, as they were then, newest first. The brand is resolved as it is now.
+func (s *DeviceService) ListAsOf(ctx context.Context, filter model.DeviceFilter, at time.Time, limit, offset int) ([]model.Device, error) {
+	if filter.State != "" && !model.IsValidState(filter.State) {
+		return nil, fmt.Errorf("invalid state value")
+	}
+	if ok, err := s.resolveFilter(ctx, &filter); !ok {
+		return []model.Device{}, err
+	}
+	return s.history.ListAsOf(ctx, filter, at, limit, offset)
+}
+
+// DiffDevice compares the device with the given ID as it was at from and at
+// to. A zero to compares it with the device as it is now. It returns nil if
+// the device existed at neither time.
+func (s *DeviceService) DiffDevice(ctx context.Context, id string, from, to time.Time) (*model.DeviceDiff, error) {
+	if from.IsZero() {
+		return nil, fmt.Errorf("from is required")
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("invalid period: to must be after from")
+	}
+
+	before, err := s.GetByIDAsOf(ctx, id, from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := s.GetByIDAsOf(ctx, id, to)
+	if err != nil {
+		return nil, err
+	}
+	if before == nil && after == nil {
+		return nil, nil
+	}
+
+	changes, err := diffDevices(before, after)
+	if err != nil {
+		return nil, err
+	}
+	return &model.DeviceDiff{From: from, To: to, Before: before, After: after, Changes: changes}, nil
+}
+
+// diffDevices lists the fields of two versions of a device that differ, in
+// order of name. Either version may be nil.
+func diffDevices(before, after *model.Device) ([]model.FieldChange, error) {
+	fields := func(d *model.Device) (map[string]any, error) {
+		out := map[string]any{}
+		if d == nil {
+			return out, nil
+		}
+		data, err := json.Marshal(d)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &out); err != nil {
+			return nil, err
+		}
+		delete(out, "tenant_id")
+		return out, nil
+	}
+
+	from, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(from)+len(to))
+	for name := range from {
+		names = append(names, name)
+	}
+	for name := range to {
+		if _, ok := from[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	changes := []model.FieldChange{}
+	for _, name := range names {
+		if !reflect.DeepEqual(from[name], to[name]) {
+			changes = append(changes, model.FieldChange{Field: name, From: from[name], To: to[name]})
+		}
+	}
+	return changes, nil
+}
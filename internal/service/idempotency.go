@@ -0,0 +1,19 @@
+package service
+
+import (
+	"context"
+	"time"
+)
+
+// IdempotencyKeys holds the idempotency keys of every tenant.
+type IdempotencyKeys interface {
+	PurgeExpired(ctx context.Context, at time.Time) error
+}
+
+// RunIdempotencyPurge deletes the expired idempotency keys of every tenant
+// every interval until ctx is done. Reserving a key only deletes an expired
+// record of that same key, so keys that are never reused would otherwise
+// be kept forever.
+func RunIdempotencyPurge(ctx context.Context, keys IdempotencyKeys, interval time.Duration) {
+	runEvery(ctx, interval, "idempotency purge", keys.PurgeExpired)
+}
@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// GetBySerialNumber returns the device with the given serial number, or nil
+// if there is none. Serial numbers are only unique within a brand, so brand,
+// which resolves like the brand of a device, is required when devices of
+// several brands share it.
+func (s *DeviceService) GetBySerialNumber(ctx context.Context, serial, brand string) (*model.Device, error) {
+	return s.getByIdentifier(ctx, "serial_number", serial, brand)
+}
+
+// GetByAssetTag returns the device with the given asset tag, or nil if there
+// is none, with the same brand rules as GetBySerialNumber.
+func (s *DeviceService) GetByAssetTag(ctx context.Context, tag, brand string) (*model.Device, error) {
+	return s.getByIdentifier(ctx, "asset_tag", tag, brand)
+}
+
+func (s *DeviceService) getByIdentifier(ctx context.Context, field, value, brand string) (*model.Device, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	match := map[string]string{field: value}
+	if brand != "" {
+		b, err := s.brandResolver().lookup(ctx, brand)
+		if err != nil || b == nil {
+			return nil, err
+		}
+		match["brand_id"] = b.ID
+	}
+
+	found, err := s.devices.FindByFields(ctx, match, 2)
+	if err != nil {
+		return nil, err
+	}
+	switch len(found) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &found[0], nil
+	default:
+		return nil, validate.Errors{"brand": {fmt.Sprintf("is required: devices of several brands have this %s", field)}}
+	}
+}
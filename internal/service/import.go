@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// NaturalKeyFields are the device fields an import can upsert by.
+var NaturalKeyFields = []string{"name", "brand", "serial_number", "asset_tag"}
+
+// ImportOptions configures an import.
+type ImportOptions struct {
+	// DryRun validates the rows without writing anything.
+	DryRun bool
+	// UpsertBy lists the fields that identify an existing device. When set,
+	// a row matching an existing device updates it instead of creating a new
+	// one. Empty means every row creates a device.
+	UpsertBy []string
+}
+
+// ImportAction is what an import did, or would do in a dry run, with a row.
+type ImportAction string
+
+const (
+	ImportCreated  ImportAction = "created"
+	ImportUpdated  ImportAction = "updated"
+	ImportRejected ImportAction = "rejected"
+)
+
+// ImportResult is the outcome of one imported row.
+type ImportResult struct {
+	Action ImportAction
+	Device *model.Device
+	Err    error
+}
+
+// Import applies rows to the inventory chunk by chunk, so that a file of
+// any size can be imported in bounded memory.
+type Import struct {
+	svc       *DeviceService
+	opts      ImportOptions
+	brands    *brandResolver
+	checker   *attributeChecker
+	remaining int
+	limited   bool
+}
+
+func (s *DeviceService) StartImport(ctx context.Context, opts ImportOptions) (*Import, error) {
+	for _, field := range opts.UpsertBy {
+		if !isNaturalKeyField(field) {
+			return nil, fmt.Errorf("invalid upsert field %q: must be one of %s", field, strings.Join(NaturalKeyFields, ", "))
+		}
+	}
+
+	remaining, limited, err := s.devices.RemainingQuota(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Import{svc: s, opts: opts, brands: s.brandResolver(), checker: s.attributeChecker(), remaining: remaining, limited: limited}, nil
+}
+
+// Apply imports one chunk of rows with the same rules as Create and Update.
+// Rows are independent: a rejected row does not prevent the others from
+// being imported.
+func (im *Import) Apply(ctx context.Context, rows []CreateInput) ([]ImportResult, error) {
+	results := make([]ImportResult, len(rows))
+	var creates, updates []*model.Device
+	// pending holds the devices created or updated earlier in this chunk,
+	// which the repository cannot see yet.
+	pending := make(map[string]*model.Device)
+
+	for i, row := range rows {
+		res, err := im.applyRow(ctx, row, pending, &creates, &updates)
+		if err != nil {
+			return nil, err
+		}
+		results[i] = res
+	}
+
+	im.rejectCreates(results, &creates, duplicateIdentifiers(creates))
+	updates = im.reject(results, updates, duplicateIdentifiers(updates))
+	if im.opts.DryRun {
+		return results, nil
+	}
+
+	// Rows can still be rejected when they are written: their identifiers
+	// may be taken, or other requests may have used up the quota, since
+	// they were checked.
+	errs, err := im.svc.devices.CreateMany(ctx, creates, false)
+	if err != nil {
+		return nil, err
+	}
+	im.rejectCreates(results, &creates, errs)
+	errs, err = im.svc.devices.UpdateMany(ctx, updates, false)
+	if err != nil {
+		return nil, err
+	}
+	im.reject(results, updates, errs)
+
+	return results, nil
+}
+
+// reject rejects the rows of results that write a device that failed, with
+// its error, and returns the devices that did not fail. errs holds the
+// error of each device, and is nil if none failed.
+func (im *Import) reject(results []ImportResult, devices []*model.Device, errs []error) []*model.Device {
+	if errs == nil {
+		return devices
+	}
+
+	failed := make(map[*model.Device]error)
+	var ok []*model.Device
+	for i, d := range devices {
+		if errs[i] != nil {
+			failed[d] = errs[i]
+		} else {
+			ok = append(ok, d)
+		}
+	}
+	for i := range results {
+		if err, found := failed[results[i].Device]; found {
+			results[i] = ImportResult{Action: ImportRejected, Err: err}
+		}
+	}
+	return ok
+}
+
+// rejectCreates rejects the rows that create a device that failed, like
+// reject, and gives the places of those devices in the quota back, unless
+// the quota turned out to be used up.
+func (im *Import) rejectCreates(results []ImportResult, creates *[]*model.Device, errs []error) {
+	n := len(*creates)
+	*creates = im.reject(results, *creates, errs)
+	im.remaining += n - len(*creates)
+	for _, err := range errs {
+		if errors.Is(err, ErrQuotaExceeded) {
+			im.remaining = 0
+		}
+	}
+}
+
+// applyRow decides what to do with one row and queues the resulting write.
+// Rejections are reported in the result; the error is for repository
+// failures only.
+func (im *Import) applyRow(ctx context.Context, row CreateInput, pending map[string]*model.Device, creates, updates *[]*model.Device) (ImportResult, error) {
+	// Rows match existing devices by their canonical brand.
+	brand, brandID, err := im.brands.canonical(ctx, row.Brand)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	row.Brand = brand
+
+	key := naturalKey(im.opts.UpsertBy, row)
+	if key != "" {
+		existing, queued := pending[key]
+		if !queued {
+			found, err := im.svc.devices.FindByFields(ctx, naturalKeyMatch(im.opts.UpsertBy, row), 2)
+			if err != nil {
+				return ImportResult{}, err
+			}
+			if len(found) > 1 {
+				return ImportResult{Action: ImportRejected, Err: fmt.Errorf("cannot upsert: more than one device matches %s", strings.Join(im.opts.UpsertBy, ", "))}, nil
+			}
+			if len(found) == 1 {
+				existing = &found[0]
+			}
+		}
+
+		if existing != nil {
+			device := *existing
+			if err := applyUpdate(&device, rowUpdate(row)); err != nil {
+				return ImportResult{Action: ImportRejected, Err: err}, nil
+			}
+			device.BrandID = brandID
+			if err := im.checker.checkChanged(ctx, *existing, &device); err != nil {
+				return im.rejectOrFail(err)
+			}
+			// Devices already queued are written with their final values,
+			// so they only need to be updated in place.
+			*existing = device
+			if !queued {
+				pending[key] = existing
+				*updates = append(*updates, existing)
+			}
+			return ImportResult{Action: ImportUpdated, Device: existing}, nil
+		}
+	}
+
+	device, err := newDevice(row)
+	if err == nil && im.limited && im.remaining <= 0 {
+		err = ErrQuotaExceeded
+	}
+	if err != nil {
+		return ImportResult{Action: ImportRejected, Err: err}, nil
+	}
+	device.BrandID = brandID
+	if err := im.checker.check(ctx, device); err != nil {
+		return im.rejectOrFail(err)
+	}
+
+	im.remaining--
+	if key != "" {
+		pending[key] = device
+	}
+	*creates = append(*creates, device)
+	return ImportResult{Action: ImportCreated, Device: device}, nil
+}
+
+// rowUpdate is the update an import row applies to the device it matches.
+// The identifiers and attributes of the row are only applied when present,
+// so files without those columns leave them unchanged.
+func rowUpdate(row CreateInput) UpdateInput {
+	in := UpdateInput{Name: &row.Name, Brand: &row.Brand, State: &row.State, Attributes: row.Attributes}
+	if row.SerialNumber != "" {
+		in.SerialNumber = &row.SerialNumber
+	}
+	if row.AssetTag != "" {
+		in.AssetTag = &row.AssetTag
+	}
+	return in
+}
+
+// rejectOrFail turns an attribute check error into a rejected row, unless
+// it is a repository failure.
+func (im *Import) rejectOrFail(err error) (ImportResult, error) {
+	if isValidationError(err) {
+		return ImportResult{Action: ImportRejected, Err: err}, nil
+	}
+	return ImportResult{}, err
+}
+
+func isNaturalKeyField(field string) bool {
+	for _, f := range NaturalKeyFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func naturalKeyMatch(fields []string, row CreateInput) map[string]string {
+	match := make(map[string]string, len(fields))
+	for _, f := range fields {
+		match[f] = naturalKeyValue(f, row)
+	}
+	return match
+}
+
+// naturalKey identifies the device a row upserts within an import. It is
+// empty, so that the row creates a device, when there are no upsert fields
+// or the row leaves one of them empty.
+func naturalKey(fields []string, row CreateInput) string {
+	var sb strings.Builder
+	for _, f := range fields {
+		value := naturalKeyValue(f, row)
+		if value == "" {
+			return ""
+		}
+		sb.WriteString(value)
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
+func naturalKeyValue(field string, row CreateInput) string {
+	switch field {
+	case "name":
+		return row.Name
+	case "brand":
+		return row.Brand
+	case "serial_number":
+		return row.SerialNumber
+	case "asset_tag":
+		return row.AssetTag
+	}
+	return ""
+}
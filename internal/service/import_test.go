@@ -0,0 +1,167 @@
+package service
+
+import (
+    "context"
+    "errors"
+    "testing"
+
+    "github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+func TestImport_DryRunWritesNothing(t *testing.T) {
+    written := false
+    repo := &mockRepo{
+        CreateManyFn: func(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+            written = true
+            return nil, nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+    imp, err := svc.StartImport(context.Background(), ImportOptions{DryRun: true})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    results, err := imp.Apply(context.Background(), []CreateInput{
+        {Name: "A", Brand: "X", State: "available"},
+        {Name: "B", Brand: "X", State: "broken"},
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if written {
+        t.Fatalf("dry run must not write")
+    }
+    if results[0].Action != ImportCreated || results[1].Action != ImportRejected {
+        t.Fatalf("unexpected actions: %s, %s", results[0].Action, results[1].Action)
+    }
+}
+
+func TestImport_UpsertByNaturalKey(t *testing.T) {
+    var created, updated []*model.Device
+    repo := &mockRepo{
+        FindByFieldsFn: func(ctx context.Context, match map[string]string, limit int) ([]model.Device, error) {
+            if match["name"] == "Existing" && match["brand"] == "X" {
+                return []model.Device{{ID: "1", Name: "Existing", Brand: "X", State: model.StateAvailable}}, nil
+            }
+            return nil, nil
+        },
+        CreateManyFn: func(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+            created = devices
+            return nil, nil
+        },
+        UpdateManyFn: func(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+            updated = devices
+            return nil, nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+    imp, err := svc.StartImport(context.Background(), ImportOptions{UpsertBy: []string{"name", "brand"}})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    results, err := imp.Apply(context.Background(), []CreateInput{
+        {Name: "Existing", Brand: "X", State: "inactive"},
+        {Name: "New", Brand: "X", State: "available"},
+        {Name: "New", Brand: "X", State: "in-use"},
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if results[0].Action != ImportUpdated || len(updated) != 1 || updated[0].State != model.StateInactive {
+        t.Fatalf("expected existing device to be updated")
+    }
+    if results[1].Action != ImportCreated || results[2].Action != ImportUpdated {
+        t.Fatalf("expected repeated row to update the device created earlier in the chunk")
+    }
+    if len(created) != 1 || created[0].State != model.StateInUse {
+        t.Fatalf("expected one device created with the final state")
+    }
+}
+
+func TestImport_RejectsUnknownUpsertField(t *testing.T) {
+    svc := newTestService(&mockRepo{}, Stores{})
+
+    if _, err := svc.StartImport(context.Background(), ImportOptions{UpsertBy: []string{"state"}}); err == nil {
+        t.Fatalf("expected error for unknown upsert field")
+    }
+}
+
+func TestImport_UpsertBySerialNumberSkipsRowsWithoutOne(t *testing.T) {
+    var created []*model.Device
+    repo := &mockRepo{
+        FindByFieldsFn: func(ctx context.Context, match map[string]string, limit int) ([]model.Device, error) {
+            if match["serial_number"] == "" {
+                t.Fatalf("rows without a serial number must not be matched")
+            }
+            return nil, nil
+        },
+        CreateManyFn: func(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+            created = devices
+            return nil, nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+    imp, err := svc.StartImport(context.Background(), ImportOptions{UpsertBy: []string{"serial_number"}})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    results, err := imp.Apply(context.Background(), []CreateInput{
+        {Name: "A", Brand: "X", State: "available"},
+        {Name: "B", Brand: "X", State: "available"},
+        {Name: "C", Brand: "X", State: "available", SerialNumber: "SN1"},
+        {Name: "C", Brand: "X", State: "inactive", SerialNumber: "SN1"},
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    if results[0].Action != ImportCreated || results[1].Action != ImportCreated {
+        t.Fatalf("expected rows without a serial number to create devices")
+    }
+    if results[2].Action != ImportCreated || results[3].Action != ImportUpdated {
+        t.Fatalf("expected repeated serial number to update the device created earlier in the chunk")
+    }
+    if len(created) != 3 || created[2].State != model.StateInactive {
+        t.Fatalf("unexpected created devices: %+v", created)
+    }
+}
+
+func TestImport_RejectsRowsOverQuota(t *testing.T) {
+    var created []*model.Device
+    repo := &mockRepo{
+        RemainingQuotaFn: func(ctx context.Context) (int, bool, error) {
+            return 1, true, nil
+        },
+        CreateManyFn: func(ctx context.Context, devices []*model.Device, atomic bool) ([]error, error) {
+            created = devices
+            return nil, nil
+        },
+    }
+
+    svc := newTestService(repo, Stores{})
+    imp, err := svc.StartImport(context.Background(), ImportOptions{})
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+
+    results, err := imp.Apply(context.Background(), []CreateInput{
+        {Name: "A", Brand: "X", State: "available"},
+        {Name: "B", Brand: "X", State: "available"},
+    })
+    if err != nil {
+        t.Fatalf("unexpected error: %v", err)
+    }
+    if len(created) != 1 || results[0].Action != ImportCreated {
+        t.Fatalf("expected the first row to be created, got %+v", results[0])
+    }
+    if results[1].Action != ImportRejected || !errors.Is(results[1].Err, ErrQuotaExceeded) {
+        t.Fatalf("expected the second row to be rejected over quota, got %+v", results[1])
+    }
+}
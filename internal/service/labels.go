@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/labels"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// SetLabels replaces every label of a device. It returns nil if the device
+// does not exist, and validate.Errors if a key or value is invalid.
+func (s *DeviceService) SetLabels(ctx context.Context, id string, set map[string]string) (*model.Device, error) {
+	if err := labels.Validate(set); err != nil {
+		return nil, err
+	}
+
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	if set == nil {
+		set = map[string]string{}
+	}
+	device.Labels = set
+	device.UpdatedAt = time.Now()
+
+	if err := s.devices.SetLabels(ctx, device); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// LocationStore stores the location hierarchy and the moves of devices
+// between locations.
+type LocationStore interface {
+	Locations(ctx context.Context, parentID, kind string, limit, offset int) ([]model.Location, error)
+	Location(ctx context.Context, id string) (*model.Location, error)
+	CreateLocation(ctx context.Context, l *model.Location) error
+	UpdateLocation(ctx context.Context, l *model.Location) error
+	DeleteLocation(ctx context.Context, id string) (bool, error)
+	MoveDevice(ctx context.Context, d *model.Device, m *model.DeviceMove) error
+	DeviceMoves(ctx context.Context, deviceID string, limit, offset int) ([]model.DeviceMove, error)
+}
+
+// LocationInput holds the fields of a location.
+type LocationInput struct {
+	ParentID string
+	Kind     string
+	Name     string
+}
+
+// ListLocations returns a page of locations. A non-empty parentID restricts
+// it to the children of that location, and a non-empty kind to the
+// locations of that kind.
+func (s *DeviceService) ListLocations(ctx context.Context, parentID, kind string, limit, offset int) ([]model.Location, error) {
+	if kind != "" && !model.IsValidLocationKind(kind) {
+		return nil, fmt.Errorf("invalid kind value")
+	}
+	if parentID != "" {
+		if _, err := uuid.Parse(parentID); err != nil {
+			return []model.Location{}, nil
+		}
+	}
+	return s.locations.Locations(ctx, parentID, kind, limit, offset)
+}
+
+// GetLocation returns the location with the given ID, or nil if it does not
+// exist.
+func (s *DeviceService) GetLocation(ctx context.Context, id string) (*model.Location, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil
+	}
+	return s.locations.Location(ctx, id)
+}
+
+// CreateLocation adds a location. Sites are the roots of the tree; any
+// other location is placed in a location of the level above it.
+func (s *DeviceService) CreateLocation(ctx context.Context, in LocationInput) (*model.Location, error) {
+	if in.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	if !model.IsValidLocationKind(in.Kind) {
+		return nil, validate.Errors{"kind": {"must be one of site, building, room, shelf"}}
+	}
+
+	now := time.Now()
+	l := &model.Location{ID: uuid.New().String(), Kind: model.LocationKind(in.Kind), Name: in.Name, CreatedAt: now, UpdatedAt: now}
+	parent, err := s.locationParent(ctx, l.Kind, in.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	l.ParentID, l.Path = placeUnder(parent, l.Name)
+
+	if err := s.locations.CreateLocation(ctx, l); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// UpdateLocation renames a location or moves it, along with everything
+// under it, to another parent of the same level. Its kind cannot change; an
+// empty kind keeps it. It returns nil if the location does not exist.
+func (s *DeviceService) UpdateLocation(ctx context.Context, id string, in LocationInput) (*model.Location, error) {
+	if in.Name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	l, err := s.GetLocation(ctx, id)
+	if err != nil || l == nil {
+		return nil, err
+	}
+	if in.Kind != "" && model.LocationKind(in.Kind) != l.Kind {
+		return nil, fmt.Errorf("cannot change the kind of a location")
+	}
+
+	parent, err := s.locationParent(ctx, l.Kind, in.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	l.Name, l.UpdatedAt = in.Name, time.Now()
+	l.ParentID, l.Path = placeUnder(parent, l.Name)
+
+	if err := s.locations.UpdateLocation(ctx, l); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// DeleteLocation removes a location. The boolean is false if it did not
+// exist. Locations that still hold other locations or devices cannot be
+// deleted; their moves keep the history without it.
+func (s *DeviceService) DeleteLocation(ctx context.Context, id string) (bool, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return false, nil
+	}
+
+	children, err := s.locations.Locations(ctx, id, "", 1, 0)
+	if err != nil {
+		return false, err
+	}
+	if len(children) > 0 {
+		return false, fmt.Errorf("cannot delete location that has locations")
+	}
+
+	devices, err := s.devices.List(ctx, model.DeviceFilter{LocationID: id}, 1, 0)
+	if err != nil {
+		return false, err
+	}
+	if len(devices) > 0 {
+		return false, fmt.Errorf("cannot delete location that has devices")
+	}
+
+	return s.locations.DeleteLocation(ctx, id)
+}
+
+// LocationDevices returns a page of the devices kept in a location, or with
+// recursive also anywhere under it. It returns nil if the location does not
+// exist.
+func (s *DeviceService) LocationDevices(ctx context.Context, id string, recursive bool, limit, offset int) ([]model.Device, error) {
+	l, err := s.GetLocation(ctx, id)
+	if err != nil || l == nil {
+		return nil, err
+	}
+
+	devices, err := s.devices.List(ctx, model.DeviceFilter{LocationID: l.ID, WithinLocation: recursive}, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if devices == nil {
+		devices = []model.Device{}
+	}
+	return devices, nil
+}
+
+// MoveDevice places a device in a location, or clears its location when
+// locationID is empty, and records the move in its history. Moving a device
+// to where it already is changes nothing. It returns nil if the device does
+// not exist.
+func (s *DeviceService) MoveDevice(ctx context.Context, id, locationID, note string) (*model.Device, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	if locationID != "" {
+		l, err := s.GetLocation(ctx, locationID)
+		if err != nil {
+			return nil, err
+		}
+		if l == nil {
+			return nil, validate.Errors{"location_id": {"does not exist"}}
+		}
+		locationID = l.ID
+	}
+	if locationID == device.LocationID {
+		return device, nil
+	}
+
+	now := time.Now()
+	move := &model.DeviceMove{
+		ID:             uuid.New().String(),
+		DeviceID:       device.ID,
+		FromLocationID: device.LocationID,
+		ToLocationID:   locationID,
+		Note:           note,
+		MovedAt:        now,
+	}
+	device.LocationID = locationID
+	device.UpdatedAt = now
+
+	if err := s.locations.MoveDevice(ctx, device, move); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// DeviceMoves returns a page of the location history of a device, the most
+// recent move first. It returns nil if the device does not exist.
+func (s *DeviceService) DeviceMoves(ctx context.Context, id string, limit, offset int) ([]model.DeviceMove, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+	return s.locations.DeviceMoves(ctx, device.ID, limit, offset)
+}
+
+// locationParent returns the location a location of the given kind is
+// placed in, checking that it exists and is of the level above. Sites have
+// no parent, so it returns nil for them.
+func (s *DeviceService) locationParent(ctx context.Context, kind model.LocationKind, parentID string) (*model.Location, error) {
+	want := kind.ParentKind()
+	if want == "" {
+		if parentID != "" {
+			return nil, validate.Errors{"parent_id": {"must be empty for a site"}}
+		}
+		return nil, nil
+	}
+	if parentID == "" {
+		return nil, validate.Errors{"parent_id": {fmt.Sprintf("is required: a %s is placed in a %s", kind, want)}}
+	}
+
+	parent, err := s.GetLocation(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	if parent == nil {
+		return nil, validate.Errors{"parent_id": {"does not exist"}}
+	}
+	if parent.Kind != want {
+		return nil, validate.Errors{"parent_id": {fmt.Sprintf("must be a %s: a %s is placed in a %s", want, kind, want)}}
+	}
+	return parent, nil
+}
+
+// placeUnder returns the parent ID and path of a location named name placed
+// in parent, which is nil for sites.
+func placeUnder(parent *model.Location, name string) (string, []string) {
+	if parent == nil {
+		return "", []string{name}
+	}
+	path := append(append([]string{}, parent.Path...), name)
+	return parent.ID, path
+}
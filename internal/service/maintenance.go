@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// MaintenanceStore stores the maintenance records of devices.
+type MaintenanceStore interface {
+	MaintenanceRecords(ctx context.Context, filter model.MaintenanceFilter, limit, offset int) ([]model.MaintenanceRecord, error)
+	OpenMaintenance(ctx context.Context, d *model.Device, rec *model.MaintenanceRecord) error
+	CloseMaintenance(ctx context.Context, d *model.Device, rec *model.MaintenanceRecord) error
+	RepairTimes(ctx context.Context, brandID string, from, to time.Time) ([]model.RepairTime, error)
+}
+
+// ErrNotUnderMaintenance is returned when closing the maintenance of a
+// device that has no open maintenance record.
+var ErrNotUnderMaintenance = errors.New("device has no open maintenance record")
+
+// CloseMaintenanceInput holds the outcome of a repair. A nil Diagnosis
+// keeps the one given when the record was opened, and a nil CostCents
+// leaves the cost unknown.
+type CloseMaintenanceInput struct {
+	Diagnosis  *string
+	Resolution string
+	CostCents  *int64
+}
+
+// DeviceMaintenance returns a page of the maintenance history of a device,
+// the most recently opened first. It returns nil if the device does not
+// exist.
+func (s *DeviceService) DeviceMaintenance(ctx context.Context, id string, limit, offset int) ([]model.MaintenanceRecord, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+	return s.maintenance.MaintenanceRecords(ctx, model.MaintenanceFilter{DeviceID: device.ID}, limit, offset)
+}
+
+// OpenMaintenanceRecords returns a page of the open maintenance records, the
+// most recently opened first. A non-empty brand, resolved by name or alias,
+// restricts it to the devices of that brand.
+func (s *DeviceService) OpenMaintenanceRecords(ctx context.Context, brand string, limit, offset int) ([]model.MaintenanceRecord, error) {
+	filter := model.MaintenanceFilter{Open: true}
+	if brand != "" {
+		b, err := s.brandResolver().lookup(ctx, brand)
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			return []model.MaintenanceRecord{}, nil
+		}
+		filter.BrandID = b.ID
+	}
+	return s.maintenance.MaintenanceRecords(ctx, filter, limit, offset)
+}
+
+// OpenMaintenance opens a maintenance record for a device and takes the
+// device out of service by making it inactive. The state it had is kept in
+// the record for CloseMaintenance to restore. A device has at most one open
+// record. It returns nil if the device does not exist.
+func (s *DeviceService) OpenMaintenance(ctx context.Context, id, diagnosis string) (*model.MaintenanceRecord, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	open, err := s.maintenance.MaintenanceRecords(ctx, model.MaintenanceFilter{DeviceID: device.ID, Open: true}, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(open) > 0 {
+		return nil, model.ErrUnderMaintenance
+	}
+
+	now := time.Now()
+	rec := &model.MaintenanceRecord{
+		ID:            uuid.New().String(),
+		DeviceID:      device.ID,
+		Brand:         device.Brand,
+		Diagnosis:     diagnosis,
+		PreviousState: device.State,
+		OpenedAt:      now,
+	}
+	device.State = model.StateInactive
+	device.UpdatedAt = now
+
+	// The database rejects a second open record too, for concurrent
+	// requests that both passed the check above.
+	if err := s.maintenance.OpenMaintenance(ctx, device, rec); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// CloseMaintenance closes the open maintenance record of a device with the
+// outcome of the repair and puts the device back in the state it had when
+// the record was opened. A device whose state was changed during the repair
+// keeps it. It returns nil if the device does not exist, and
+// ErrNotUnderMaintenance if it has no open record.
+func (s *DeviceService) CloseMaintenance(ctx context.Context, id string, in CloseMaintenanceInput) (*model.MaintenanceRecord, error) {
+	if in.CostCents != nil && *in.CostCents < 0 {
+		return nil, validate.Errors{"cost_cents": {"must not be negative"}}
+	}
+
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	open, err := s.maintenance.MaintenanceRecords(ctx, model.MaintenanceFilter{DeviceID: device.ID, Open: true}, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(open) == 0 {
+		return nil, ErrNotUnderMaintenance
+	}
+
+	now := time.Now()
+	rec := &open[0]
+	if in.Diagnosis != nil {
+		rec.Diagnosis = *in.Diagnosis
+	}
+	rec.Resolution = in.Resolution
+	rec.CostCents = in.CostCents
+	rec.ClosedAt = &now
+	if device.State == model.StateInactive {
+		device.State = rec.PreviousState
+	}
+	device.UpdatedAt = now
+
+	if err := s.maintenance.CloseMaintenance(ctx, device, rec); err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// RepairTimes reports, per brand, how many maintenance records were closed
+// from from to to, the mean time to repair and their total cost. A
+// non-empty brand, resolved by name or alias, restricts it to that brand,
+// and a zero from or to leaves that side of the period open.
+func (s *DeviceService) RepairTimes(ctx context.Context, brand string, from, to time.Time) ([]model.RepairTime, error) {
+	if !from.IsZero() && !to.IsZero() && !to.After(from) {
+		return nil, fmt.Errorf("invalid period: to must be after from")
+	}
+
+	var brandID string
+	if brand != "" {
+		b, err := s.brandResolver().lookup(ctx, brand)
+		if err != nil {
+			return nil, err
+		}
+		if b == nil {
+			return []model.RepairTime{}, nil
+		}
+		brandID = b.ID
+	}
+	return s.maintenance.RepairTimes(ctx, brandID, from, to)
+}
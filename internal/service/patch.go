@@ -0,0 +1,124 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// deviceDocument is the JSON document edited by merge patches and JSON
+// patches. Pointers tell a removed or null member apart from an empty one.
+type deviceDocument struct {
+	ID        *string    `json:"id"`
+	Name      *string    `json:"name"`
+	Brand     *string    `json:"brand"`
+	State     *string    `json:"state"`
+	CreatedAt *time.Time `json:"created_at"`
+	// Identifiers may be removed or set to null, which clears them.
+	SerialNumber *string `json:"serial_number"`
+	AssetTag     *string `json:"asset_tag"`
+	// Attributes may be removed, which clears them.
+	Attributes map[string]any `json:"attributes"`
+}
+
+// PatchDocument applies a patch to the JSON document of a device and saves
+// the result with the same rules as Update. Errors returned by apply are
+// passed through unchanged. A nil device is returned when it does not exist.
+func (s *DeviceService) PatchDocument(ctx context.Context, id string, apply func(doc []byte) ([]byte, error)) (*model.Device, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		return nil, nil
+	}
+
+	state := string(device.State)
+	doc, err := json.Marshal(deviceDocument{
+		ID:           &device.ID,
+		Name:         &device.Name,
+		Brand:        &device.Brand,
+		State:        &state,
+		CreatedAt:    &device.CreatedAt,
+		SerialNumber: optionalString(device.SerialNumber),
+		AssetTag:     optionalString(device.AssetTag),
+		Attributes:   device.Attributes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := apply(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var result deviceDocument
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid patch result: %v", err)
+	}
+
+	switch {
+	case result.ID == nil || *result.ID != device.ID:
+		return nil, fmt.Errorf("cannot change id")
+	case result.CreatedAt == nil || !result.CreatedAt.Equal(device.CreatedAt):
+		return nil, fmt.Errorf("cannot change created_at")
+	case result.Name == nil || *result.Name == "":
+		return nil, fmt.Errorf("invalid patch result: name is required")
+	case result.Brand == nil || *result.Brand == "":
+		return nil, fmt.Errorf("invalid patch result: brand is required")
+	case result.State == nil:
+		return nil, fmt.Errorf("invalid patch result: state is required")
+	}
+
+	brands := s.brandResolver()
+	brand, brandID, err := brands.canonical(ctx, *result.Brand)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *device
+	update := UpdateInput{
+		Name:         result.Name,
+		Brand:        &brand,
+		State:        result.State,
+		SerialNumber: emptyIfNil(result.SerialNumber),
+		AssetTag:     emptyIfNil(result.AssetTag),
+	}
+	if err := applyUpdate(device, update); err != nil {
+		return nil, err
+	}
+	device.BrandID = brandID
+	device.Attributes = result.Attributes
+	if err := s.attributeChecker().checkChanged(ctx, before, device); err != nil {
+		return nil, err
+	}
+
+	if err := s.devices.Update(ctx, device); err != nil {
+		return nil, err
+	}
+
+	return device, nil
+}
+
+// optionalString represents an empty document member as null.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// emptyIfNil reads a null document member as an empty value.
+func emptyIfNil(s *string) *string {
+	if s == nil {
+		return new(string)
+	}
+	return s
+}
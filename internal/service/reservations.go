@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// ReservationStore stores the reservations of devices.
+type ReservationStore interface {
+	Reservations(ctx context.Context, deviceID string, from, to time.Time, limit, offset int) ([]model.Reservation, error)
+	Reservation(ctx context.Context, id string) (*model.Reservation, error)
+	CreateReservation(ctx context.Context, res *model.Reservation) error
+	DeleteReservation(ctx context.Context, id string) (bool, error)
+	Available(ctx context.Context, filter model.DeviceFilter, from, to time.Time, limit, offset int) ([]model.Device, error)
+	ReservationTenants(ctx context.Context, at time.Time) ([]string, error)
+	DueReservations(ctx context.Context, at time.Time, limit int) ([]model.Reservation, error)
+	TransitionReservation(ctx context.Context, res *model.Reservation, from model.ReservationStatus) (bool, error)
+}
+
+// reservationBatch is how many due reservations of a tenant the reservation
+// job loads at a time.
+const reservationBatch = 100
+
+// ReservationInput holds the fields of a new reservation.
+type ReservationInput struct {
+	HolderID string
+	Note     string
+	StartsAt time.Time
+	EndsAt   time.Time
+}
+
+// Reserve books a device for a period. The period must end after it starts
+// and must not have ended, and it must not overlap another reservation of
+// the device. Inactive devices cannot be reserved. It returns nil if the
+// device does not exist.
+func (s *DeviceService) Reserve(ctx context.Context, id string, in ReservationInput) (*model.Reservation, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	errs := validate.Errors{}
+	if in.StartsAt.IsZero() {
+		errs.Add("starts_at", "is required")
+	}
+	switch {
+	case in.EndsAt.IsZero():
+		errs.Add("ends_at", "is required")
+	case !in.StartsAt.IsZero() && !in.EndsAt.After(in.StartsAt):
+		errs.Add("ends_at", "must be after starts_at")
+	case !in.EndsAt.After(now):
+		errs.Add("ends_at", "must be in the future")
+	}
+	if in.HolderID != "" {
+		holder, err := s.GetHolder(ctx, in.HolderID)
+		if err != nil {
+			return nil, err
+		}
+		if holder == nil {
+			errs.Add("holder_id", "does not exist")
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if device.State == model.StateInactive {
+		return nil, fmt.Errorf("cannot reserve device that is inactive")
+	}
+
+	res := &model.Reservation{
+		ID:        uuid.New().String(),
+		DeviceID:  device.ID,
+		HolderID:  in.HolderID,
+		Note:      in.Note,
+		StartsAt:  in.StartsAt,
+		EndsAt:    in.EndsAt,
+		Status:    model.ReservationScheduled,
+		CreatedAt: now,
+	}
+	if err := s.reservations.CreateReservation(ctx, res); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// DeviceReservations returns a page of the reservations of a device that
+// overlap the period from from to to, in order of start. A zero from or to
+// leaves that side of the period open. It returns nil if the device does not
+// exist.
+func (s *DeviceService) DeviceReservations(ctx context.Context, id string, from, to time.Time, limit, offset int) ([]model.Reservation, error) {
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+	return s.reservations.Reservations(ctx, device.ID, from, to, limit, offset)
+}
+
+// CancelReservation removes a reservation of a device. Only reservations
+// that have not started can be cancelled. The boolean is false if the device
+// has no such reservation.
+func (s *DeviceService) CancelReservation(ctx context.Context, id, reservationID string) (bool, error) {
+	if _, err := uuid.Parse(reservationID); err != nil {
+		return false, nil
+	}
+
+	res, err := s.reservations.Reservation(ctx, reservationID)
+	if err != nil || res == nil || res.DeviceID != id {
+		return false, err
+	}
+	if res.Status != model.ReservationScheduled {
+		return false, fmt.Errorf("cannot cancel a reservation that has started")
+	}
+
+	return s.reservations.DeleteReservation(ctx, res.ID)
+}
+
+// Availability returns a page of the devices matching filter that can be
+// used for the whole period from from to to: they are not inactive, not
+// assigned and not reserved for any part of it.
+func (s *DeviceService) Availability(ctx context.Context, filter model.DeviceFilter, from, to time.Time, limit, offset int) ([]model.Device, error) {
+	if from.IsZero() || to.IsZero() {
+		return nil, fmt.Errorf("from and to are required")
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("invalid period: to must be after from")
+	}
+	if filter.State != "" && !model.IsValidState(filter.State) {
+		return nil, fmt.Errorf("invalid state value")
+	}
+	if ok, err := s.resolveFilter(ctx, &filter); !ok {
+		return []model.Device{}, err
+	}
+	return s.reservations.Available(ctx, filter, from, to, limit, offset)
+}
+
+// RunReservations starts and ends the reservations of every tenant that are
+// due at the given time. A reservation that starts puts its device in use
+// if the device is available, and when it ends the device is made available
+// again unless it has been assigned in the meantime. Devices change state
+// through Update, under the same rules as any other update.
+func (s *DeviceService) RunReservations(ctx context.Context, at time.Time) error {
+	tenants, err := s.reservations.ReservationTenants(ctx, at)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, id := range tenants {
+		if err := s.runTenantReservations(tenant.WithID(ctx, id), at); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RunReservationJob calls RunReservations every interval until ctx is done.
+func (s *DeviceService) RunReservationJob(ctx context.Context, interval time.Duration) {
+	runEvery(ctx, interval, "reservation job", s.RunReservations)
+}
+
+func (s *DeviceService) runTenantReservations(ctx context.Context, at time.Time) error {
+	for {
+		due, err := s.reservations.DueReservations(ctx, at, reservationBatch)
+		if err != nil {
+			return err
+		}
+
+		for i := range due {
+			res := &due[i]
+			if res.Status == model.ReservationScheduled {
+				if err := s.startReservation(ctx, res); err != nil {
+					return err
+				}
+			}
+			if res.Status == model.ReservationActive && !res.EndsAt.After(at) {
+				if err := s.endReservation(ctx, res); err != nil {
+					return err
+				}
+			}
+		}
+
+		if len(due) < reservationBatch {
+			return nil
+		}
+	}
+}
+
+// startReservation marks a reservation active and puts its device in use.
+// A device that is in use or inactive is left as it is.
+func (s *DeviceService) startReservation(ctx context.Context, res *model.Reservation) error {
+	res.Status = model.ReservationActive
+	claimed, err := s.reservations.TransitionReservation(ctx, res, model.ReservationScheduled)
+	if err != nil || !claimed {
+		return err
+	}
+
+	device, err := s.devices.GetByID(ctx, res.DeviceID)
+	if err != nil || device == nil || device.State != model.StateAvailable {
+		return err
+	}
+
+	state := string(model.StateInUse)
+	if _, err := s.Update(ctx, UpdateInput{ID: device.ID, State: &state}); err != nil {
+		return err
+	}
+
+	res.Applied = true
+	_, err = s.reservations.TransitionReservation(ctx, res, model.ReservationActive)
+	return err
+}
+
+// endReservation marks a reservation completed and, if the reservation put
+// its device in use, makes the device available unless it is assigned.
+func (s *DeviceService) endReservation(ctx context.Context, res *model.Reservation) error {
+	res.Status = model.ReservationCompleted
+	claimed, err := s.reservations.TransitionReservation(ctx, res, model.ReservationActive)
+	if err != nil || !claimed || !res.Applied {
+		return err
+	}
+
+	device, err := s.devices.GetByID(ctx, res.DeviceID)
+	if err != nil || device == nil || device.State != model.StateInUse {
+		return err
+	}
+	active, err := s.holders.Assignments(ctx, model.AssignmentFilter{DeviceID: device.ID, Active: true}, 1, 0)
+	if err != nil || len(active) > 0 {
+		return err
+	}
+
+	state := string(model.StateAvailable)
+	_, err = s.Update(ctx, UpdateInput{ID: device.ID, State: &state})
+	return err
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lucast-ruiz/devices-api/internal/model"
+	"github.com/lucast-ruiz/devices-api/internal/tenant"
+	"github.com/lucast-ruiz/devices-api/internal/validate"
+)
+
+// ScheduleStore stores scheduled actions, and leases due ones to the
+// scheduler across tenants.
+type ScheduleStore interface {
+	ScheduledActions(ctx context.Context, filter model.ScheduledActionFilter, limit, offset int) ([]model.ScheduledAction, error)
+	ScheduledAction(ctx context.Context, id string) (*model.ScheduledAction, error)
+	CreateScheduledAction(ctx context.Context, a *model.ScheduledAction) error
+	CancelScheduledAction(ctx context.Context, id string, at time.Time) (bool, error)
+	ClaimScheduledActions(ctx context.Context, at time.Time, lease time.Duration, limit int) ([]model.ScheduledAction, error)
+	FinishScheduledAction(ctx context.Context, a *model.ScheduledAction) (bool, error)
+}
+
+const (
+	// scheduledActionBatch is how many due actions the scheduler claims at a
+	// time.
+	scheduledActionBatch = 50
+	// scheduledActionLease is how long a claimed action is kept from other
+	// replicas. It bounds how long an action waits when the replica that
+	// claimed it stops before finishing it.
+	scheduledActionLease = 5 * time.Minute
+	// scheduledActionMaxAttempts is how many times an action is attempted
+	// before it fails.
+	scheduledActionMaxAttempts = 5
+	// scheduledActionRetryDelay is the wait before the first retry of a
+	// failed attempt. It doubles with every further attempt.
+	scheduledActionRetryDelay = time.Minute
+)
+
+// errDeviceGone is the outcome of an action whose device no longer exists.
+// It is not retried.
+var errDeviceGone = errors.New("device does not exist")
+
+// ScheduledActionInput holds the fields of a new scheduled action. State is
+// the state to set for model.ActionSetState, and empty for
+// model.ActionDelete.
+type ScheduledActionInput struct {
+	DeviceID string
+	Action   string
+	State    string
+	RunAt    time.Time
+}
+
+// ListScheduledActions returns a page of the scheduled actions matching
+// filter, the soonest to run first.
+func (s *DeviceService) ListScheduledActions(ctx context.Context, filter model.ScheduledActionFilter, limit, offset int) ([]model.ScheduledAction, error) {
+	if filter.Status != "" && !model.IsValidScheduledActionStatus(filter.Status) {
+		return nil, fmt.Errorf("invalid status value")
+	}
+	return s.schedule.ScheduledActions(ctx, filter, limit, offset)
+}
+
+// GetScheduledAction returns the scheduled action with the given ID, or nil
+// if it does not exist.
+func (s *DeviceService) GetScheduledAction(ctx context.Context, id string) (*model.ScheduledAction, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, nil
+	}
+	return s.schedule.ScheduledAction(ctx, id)
+}
+
+// ScheduleAction schedules a state change or the deletion of a device. An
+// action due in the past runs as soon as the scheduler next runs.
+func (s *DeviceService) ScheduleAction(ctx context.Context, in ScheduledActionInput) (*model.ScheduledAction, error) {
+	errs := validate.Errors{}
+	switch model.ScheduledActionKind(in.Action) {
+	case model.ActionSetState:
+		if !model.IsValidState(in.State) {
+			errs.Add("state", "must be one of available, in-use, inactive")
+		}
+	case model.ActionDelete:
+		if in.State != "" {
+			errs.Add("state", "must be empty for delete")
+		}
+	default:
+		errs.Add("action", "must be one of set_state, delete")
+	}
+	if in.RunAt.IsZero() {
+		errs.Add("run_at", "is required")
+	}
+
+	device, err := s.devices.GetByID(ctx, in.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+	if device == nil {
+		errs.Add("device_id", "does not exist")
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	now := time.Now()
+	a := &model.ScheduledAction{
+		ID:          uuid.New().String(),
+		DeviceID:    device.ID,
+		Action:      model.ScheduledActionKind(in.Action),
+		State:       model.DeviceState(in.State),
+		RunAt:       in.RunAt,
+		Status:      model.ActionPending,
+		MaxAttempts: scheduledActionMaxAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.schedule.CreateScheduledAction(ctx, a); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// CancelScheduledAction cancels a pending scheduled action. Actions that have
+// run for the last time, or are running, cannot be cancelled. It returns nil
+// if the action does not exist.
+func (s *DeviceService) CancelScheduledAction(ctx context.Context, id string) (*model.ScheduledAction, error) {
+	a, err := s.GetScheduledAction(ctx, id)
+	if err != nil || a == nil {
+		return nil, err
+	}
+	if a.Status != model.ActionPending {
+		return nil, fmt.Errorf("cannot cancel a scheduled action that is %s", a.Status)
+	}
+
+	cancelled, err := s.schedule.CancelScheduledAction(ctx, a.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !cancelled {
+		return nil, fmt.Errorf("cannot cancel a scheduled action that is running")
+	}
+
+	return s.schedule.ScheduledAction(ctx, a.ID)
+}
+
+// RunScheduledActions runs the scheduled actions of every tenant that are due
+// at the given time. Actions are claimed with a lease, so that several
+// replicas can run the scheduler at once and each action is run by one of
+// them. Each action runs through Update or Delete, under the same rules as a
+// request. A failed attempt is retried with a growing delay until the action
+// runs out of attempts, and an action whose device no longer exists fails
+// at once. The returned error is about storing the outcomes, which are
+// otherwise recorded on the actions.
+func (s *DeviceService) RunScheduledActions(ctx context.Context, at time.Time) error {
+	var errs []error
+	for {
+		claimed, err := s.schedule.ClaimScheduledActions(ctx, at, scheduledActionLease, scheduledActionBatch)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+
+		for i := range claimed {
+			a := &claimed[i]
+			actx := tenant.WithID(ctx, a.TenantID)
+			finishScheduledAction(a, s.runScheduledAction(actx, a), at, time.Now())
+			if _, err := s.schedule.FinishScheduledAction(actx, a); err != nil {
+				errs = append(errs, fmt.Errorf("scheduled action %s: %w", a.ID, err))
+			}
+		}
+
+		if len(claimed) < scheduledActionBatch {
+			return errors.Join(errs...)
+		}
+	}
+}
+
+// RunScheduler calls RunScheduledActions every interval until ctx is done.
+func (s *DeviceService) RunScheduler(ctx context.Context, interval time.Duration) {
+	runEvery(ctx, interval, "scheduler", s.RunScheduledActions)
+}
+
+func (s *DeviceService) runScheduledAction(ctx context.Context, a *model.ScheduledAction) error {
+	switch a.Action {
+	case model.ActionSetState:
+		state := string(a.State)
+		device, err := s.Update(ctx, UpdateInput{ID: a.DeviceID, State: &state})
+		if err == nil && device == nil {
+			return errDeviceGone
+		}
+		return err
+	case model.ActionDelete:
+		return s.Delete(ctx, a.DeviceID)
+	default:
+		return fmt.Errorf("unknown action %q", a.Action)
+	}
+}
+
+// finishScheduledAction records the outcome err of an attempt at a, made by
+// the run of the scheduler at the given time and finished at now. Retries
+// are scheduled from the time of the run.
+func finishScheduledAction(a *model.ScheduledAction, err error, at, now time.Time) {
+	a.UpdatedAt = now
+	switch {
+	case err == nil:
+		a.Status, a.LastError, a.CompletedAt = model.ActionDone, "", &now
+	case errors.Is(err, errDeviceGone) || a.Attempts >= a.MaxAttempts:
+		a.Status, a.LastError, a.CompletedAt = model.ActionFailed, err.Error(), &now
+	default:
+		a.LastError = err.Error()
+		a.RunAt = at.Add(scheduledActionRetryDelay << (a.Attempts - 1))
+	}
+}
+
+// runEvery calls fn with the current time every interval until ctx is done,
+// logging its errors under name.
+func runEvery(ctx context.Context, interval time.Duration, name string, fn func(context.Context, time.Time) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := fn(ctx, time.Now()); err != nil {
+				log.Printf("%s: %v", name, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// StatsStore counts the devices of the current tenant.
+type StatsStore interface {
+	CountDevices(ctx context.Context, filter model.DeviceFilter, by []model.StatsDimension) ([]model.DeviceCount, error)
+}
+
+// DeviceStats counts the devices matching filter, grouped by the given
+// dimensions in that order. Each dimension may be given once. With no
+// dimensions it returns a single count of every matching device.
+func (s *DeviceService) DeviceStats(ctx context.Context, filter model.DeviceFilter, by []string) ([]model.DeviceCount, error) {
+	dims := make([]model.StatsDimension, 0, len(by))
+	seen := map[string]bool{}
+	for _, d := range by {
+		if !model.IsValidStatsDimension(d) || seen[d] {
+			return nil, fmt.Errorf("invalid group_by value %q: expected distinct values among brand, state, month", d)
+		}
+		seen[d] = true
+		dims = append(dims, model.StatsDimension(d))
+	}
+	if filter.State != "" && !model.IsValidState(filter.State) {
+		return nil, fmt.Errorf("invalid state value")
+	}
+
+	if ok, err := s.resolveFilter(ctx, &filter); !ok {
+		if err != nil || len(dims) > 0 {
+			return []model.DeviceCount{}, err
+		}
+		return []model.DeviceCount{{}}, nil
+	}
+	return s.stats.CountDevices(ctx, filter, dims)
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lucast-ruiz/devices-api/internal/model"
+)
+
+// UtilizationStore reports how long devices of the current tenant spent in
+// each state.
+type UtilizationStore interface {
+	DeviceUtilization(ctx context.Context, deviceID string, from, to time.Time) (*model.Utilization, error)
+	FleetUtilization(ctx context.Context, byBrand bool, from, to time.Time) ([]model.Utilization, error)
+}
+
+// DeviceUtilization returns the time a device spent in each state over the
+// period from from to to, and its number of changes of state. A zero from
+// starts the period at the first recorded change, and a zero to, or one in
+// the future, ends it now. It returns nil if the device does not exist.
+func (s *DeviceService) DeviceUtilization(ctx context.Context, id string, from, to time.Time) (*model.Utilization, error) {
+	to, err := utilizationPeriod(from, to, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	device, err := s.devices.GetByID(ctx, id)
+	if err != nil || device == nil {
+		return nil, err
+	}
+	return s.utilization.DeviceUtilization(ctx, device.ID, from, to)
+}
+
+// FleetUtilization returns the time the devices spent in each state over the
+// period from from to to, and their number of changes of state, for the
+// whole fleet or, with groupBy "brand", per brand. The period is as for
+// DeviceUtilization.
+func (s *DeviceService) FleetUtilization(ctx context.Context, groupBy string, from, to time.Time) ([]model.Utilization, error) {
+	if groupBy != "" && groupBy != string(model.StatsByBrand) {
+		return nil, fmt.Errorf("invalid group_by value %q: expected brand", groupBy)
+	}
+	to, err := utilizationPeriod(from, to, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return s.utilization.FleetUtilization(ctx, groupBy != "", from, to)
+}
+
+// utilizationPeriod returns the end of the period from from to to, which is
+// now when to is zero or after now.
+func utilizationPeriod(from, to, now time.Time) (time.Time, error) {
+	if to.IsZero() || to.After(now) {
+		to = now
+	}
+	if !from.IsZero() && !to.After(from) {
+		return time.Time{}, fmt.Errorf("invalid period: to must be after from, which must be in the past")
+	}
+	return to, nil
+}
@@ -0,0 +1,21 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrMissing is returned when an operation needs a tenant and the context
+// does not carry one.
+var ErrMissing = errors.New("missing tenant")
+
+type tenantKey struct{}
+
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(tenantKey{}).(string)
+	return id, ok && id != ""
+}
@@ -0,0 +1,139 @@
+// Package validate checks and normalizes request structs from the rules in
+// their `validate` struct tags, collecting every violation instead of
+// stopping at the first one.
+//
+// Rules are comma-separated and applied in order to string and *string
+// fields; nil pointers are skipped, so optional fields are only checked
+// when present. Fields are reported by their JSON name.
+//
+//	trim       removes leading and trailing whitespace
+//	lower      lowercases the value
+//	required   rejects the empty string
+//	max=N      rejects values longer than N characters
+//	printable  rejects control characters, such as newlines and tabs
+//	oneof=a b  rejects values other than the listed ones
+//
+// An unknown rule is a programming error and panics.
+package validate
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Errors maps a field name to its violations. It is returned as the error
+// of Struct when at least one rule fails.
+type Errors map[string][]string
+
+// Add records a violation of field.
+func (e Errors) Add(field, message string) {
+	e[field] = append(e[field], message)
+}
+
+func (e Errors) Error() string {
+	fields := make([]string, 0, len(e))
+	for f := range e {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, len(fields))
+	for i, f := range fields {
+		parts[i] = f + ": " + strings.Join(e[f], ", ")
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Struct applies the rules of the struct pointed to by v, normalizing its
+// fields in place. It returns Errors if any rule fails.
+func Struct(v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		panic("validate: Struct requires a pointer to a struct")
+	}
+	rv = rv.Elem()
+
+	errs := Errors{}
+	for i := 0; i < rv.NumField(); i++ {
+		sf := rv.Type().Field(i)
+		tag, ok := sf.Tag.Lookup("validate")
+		if !ok {
+			continue
+		}
+
+		field := rv.Field(i)
+		if field.Kind() == reflect.Pointer {
+			if field.IsNil() {
+				continue
+			}
+			field = field.Elem()
+		}
+		if field.Kind() != reflect.String {
+			panic("validate: rules on non-string field " + sf.Name)
+		}
+
+		value := field.String()
+		name := jsonName(sf)
+		for _, rule := range strings.Split(tag, ",") {
+			value = apply(rule, value, name, errs)
+		}
+		field.SetString(value)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// apply runs one rule, recording a violation in errs, and returns the
+// possibly normalized value.
+func apply(rule, value, field string, errs Errors) string {
+	name, arg, _ := strings.Cut(rule, "=")
+	switch name {
+	case "trim":
+		return strings.TrimSpace(value)
+	case "lower":
+		return strings.ToLower(value)
+	case "required":
+		if value == "" {
+			errs.Add(field, "is required")
+		}
+	case "max":
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			panic("validate: invalid max rule " + rule)
+		}
+		if utf8.RuneCountInString(value) > n {
+			errs.Add(field, fmt.Sprintf("must be at most %d characters", n))
+		}
+	case "printable":
+		if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			errs.Add(field, "must not contain control characters")
+		}
+	case "oneof":
+		allowed := strings.Fields(arg)
+		for _, a := range allowed {
+			if value == a {
+				return value
+			}
+		}
+		errs.Add(field, "must be one of "+strings.Join(allowed, ", "))
+	default:
+		panic("validate: unknown rule " + rule)
+	}
+	return value
+}
+
+func jsonName(sf reflect.StructField) string {
+	name, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return sf.Name
+	}
+	return name
+}
@@ -0,0 +1,56 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type device struct {
+	Name  string  `json:"name" validate:"trim,required,max=5,printable"`
+	Brand *string `json:"brand,omitempty" validate:"trim,required"`
+	State string  `json:"state" validate:"trim,lower,oneof=available in-use"`
+	Note  string  `json:"note"`
+}
+
+func TestStruct_NormalizesValidInput(t *testing.T) {
+	brand := "  Acme "
+	d := device{Name: " Phone ", Brand: &brand, State: " In-Use"}
+
+	if err := Struct(&d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Name != "Phone" || *d.Brand != "Acme" || d.State != "in-use" {
+		t.Fatalf("expected normalized fields, got %+v (brand %q)", d, *d.Brand)
+	}
+}
+
+func TestStruct_CollectsEveryViolation(t *testing.T) {
+	blank := "   "
+	d := device{Name: "Lap\ntop!", Brand: &blank, State: "broken"}
+
+	err := Struct(&d)
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected Errors, got %v", err)
+	}
+
+	want := Errors{
+		"name":  {"must be at most 5 characters", "must not contain control characters"},
+		"brand": {"is required"},
+		"state": {"must be one of available, in-use"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Fatalf("unexpected errors:\n got %v\nwant %v", errs, want)
+	}
+	if got := err.Error(); got != "brand: is required; name: must be at most 5 characters, must not contain control characters; state: must be one of available, in-use" {
+		t.Fatalf("unexpected message %q", got)
+	}
+}
+
+func TestStruct_SkipsNilPointers(t *testing.T) {
+	d := device{Name: "Phone", State: "available"}
+	if err := Struct(&d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE USAGE, SELECT ON SEQUENCES FROM devices_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public REVOKE SELECT, INSERT, UPDATE, DELETE ON TABLES FROM devices_app;
+REVOKE ALL ON devices, tenant_quotas FROM devices_app;
+REVOKE USAGE ON SCHEMA public FROM devices_app;
+
+DROP POLICY IF EXISTS devices_tenant_isolation ON devices;
+ALTER TABLE devices NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE devices DISABLE ROW LEVEL SECURITY;
+
+DROP TABLE IF EXISTS tenant_quotas;
+
+DROP INDEX IF EXISTS idx_devices_tenant_id;
+ALTER TABLE devices DROP COLUMN IF EXISTS tenant_id;
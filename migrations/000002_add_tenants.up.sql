@@ -0,0 +1,43 @@
+ALTER TABLE devices ADD COLUMN tenant_id TEXT NOT NULL DEFAULT 'default';
+ALTER TABLE devices ALTER COLUMN tenant_id DROP DEFAULT;
+
+CREATE INDEX idx_devices_tenant_id ON devices (tenant_id);
+
+CREATE TABLE tenant_quotas (
+  tenant_id TEXT PRIMARY KEY,
+  max_devices INTEGER NOT NULL CHECK (max_devices >= 0)
+);
+
+-- Row-level security is a second line of defense behind the tenant_id
+-- filters in the repository. The application sets app.tenant_id at the
+-- start of every transaction. Superusers and roles with BYPASSRLS ignore
+-- these policies, so the API connects as devices_app, which has neither.
+ALTER TABLE devices ENABLE ROW LEVEL SECURITY;
+ALTER TABLE devices FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY devices_tenant_isolation ON devices
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+-- Deployments create devices_app with a password before migrating. It is
+-- created here without one otherwise, so that the grants below apply.
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'devices_app') THEN
+    CREATE ROLE devices_app NOLOGIN NOSUPERUSER NOBYPASSRLS;
+  END IF;
+END
+$$;
+
+GRANT USAGE ON SCHEMA public TO devices_app;
+GRANT SELECT, INSERT, UPDATE, DELETE ON devices TO devices_app;
+
+-- Quotas are set by operators, not through the API. tenant_quotas has no
+-- row-level security, so devices_app may only read them, and lock the row of
+-- its tenant with SELECT ... FOR UPDATE, which needs the UPDATE privilege.
+GRANT SELECT, UPDATE ON tenant_quotas TO devices_app;
+
+-- The tables and sequences of later migrations, which run as the same role,
+-- are granted as they are created.
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT SELECT, INSERT, UPDATE, DELETE ON TABLES TO devices_app;
+ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO devices_app;
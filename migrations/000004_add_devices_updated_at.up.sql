@@ -0,0 +1,10 @@
+ALTER TABLE devices ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE;
+
+-- The data migration below runs as the table owner, which only bypasses
+-- row-level security while it is not forced.
+ALTER TABLE devices NO FORCE ROW LEVEL SECURITY;
+UPDATE devices SET updated_at = created_at;
+ALTER TABLE devices FORCE ROW LEVEL SECURITY;
+
+ALTER TABLE devices ALTER COLUMN updated_at SET NOT NULL;
+ALTER TABLE devices ALTER COLUMN updated_at SET DEFAULT now();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS devices_labels_idx;
+ALTER TABLE devices DROP COLUMN IF EXISTS labels;
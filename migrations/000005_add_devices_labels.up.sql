@@ -0,0 +1,6 @@
+ALTER TABLE devices ADD COLUMN labels JSONB NOT NULL DEFAULT '{}'
+  CHECK (jsonb_typeof(labels) = 'object');
+
+-- The default jsonb_ops class serves both the containment (@>) and the key
+-- existence (?) operators used by label selectors.
+CREATE INDEX devices_labels_idx ON devices USING GIN (labels);
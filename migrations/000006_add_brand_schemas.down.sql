@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS brand_schemas;
+DROP INDEX IF EXISTS devices_attributes_idx;
+ALTER TABLE devices DROP COLUMN IF EXISTS attributes;
@@ -0,0 +1,19 @@
+ALTER TABLE devices ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}'
+  CHECK (jsonb_typeof(attributes) = 'object');
+
+CREATE INDEX devices_attributes_idx ON devices USING GIN (attributes);
+
+CREATE TABLE brand_schemas (
+  tenant_id TEXT NOT NULL,
+  brand TEXT NOT NULL,
+  schema JSONB NOT NULL,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  PRIMARY KEY (tenant_id, brand)
+);
+
+ALTER TABLE brand_schemas ENABLE ROW LEVEL SECURITY;
+ALTER TABLE brand_schemas FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY brand_schemas_tenant_isolation ON brand_schemas
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_devices_brand_id;
+ALTER TABLE devices DROP COLUMN IF EXISTS brand_id;
+DROP TABLE IF EXISTS brand_keys;
+DROP TABLE IF EXISTS brands;
@@ -0,0 +1,92 @@
+CREATE TABLE brands (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  tenant_id TEXT NOT NULL,
+  name TEXT NOT NULL,
+  aliases TEXT[] NOT NULL DEFAULT '{}',
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_brands_tenant_id ON brands (tenant_id);
+
+-- brand_keys holds the normalized name and aliases of every brand, so that
+-- a key resolves to at most one brand per tenant.
+CREATE TABLE brand_keys (
+  tenant_id TEXT NOT NULL,
+  key TEXT NOT NULL,
+  brand_id UUID NOT NULL REFERENCES brands (id) ON DELETE CASCADE,
+  PRIMARY KEY (tenant_id, key)
+);
+
+CREATE INDEX idx_brand_keys_brand_id ON brand_keys (brand_id);
+
+-- The data migration below runs as the table owner, which only bypasses
+-- row-level security while it is not forced.
+ALTER TABLE devices NO FORCE ROW LEVEL SECURITY;
+ALTER TABLE brand_schemas NO FORCE ROW LEVEL SECURITY;
+
+-- Every distinct normalized brand becomes a brand, named after its most
+-- common spelling.
+CREATE TEMPORARY TABLE existing_brands AS
+SELECT tenant_id, regexp_replace(btrim(brand), '\s+', ' ', 'g') AS name, count(*) AS uses
+FROM (
+  SELECT tenant_id, brand FROM devices
+  UNION ALL
+  SELECT tenant_id, brand FROM brand_schemas
+) b
+GROUP BY 1, 2;
+
+INSERT INTO brands (tenant_id, name)
+SELECT DISTINCT ON (tenant_id, lower(name)) tenant_id, name
+FROM existing_brands
+ORDER BY tenant_id, lower(name), uses DESC, name;
+
+INSERT INTO brand_keys (tenant_id, key, brand_id)
+SELECT tenant_id, lower(name), id FROM brands;
+
+ALTER TABLE devices ADD COLUMN brand_id UUID REFERENCES brands (id);
+
+UPDATE devices d
+SET brand_id = k.brand_id, brand = b.name
+FROM brand_keys k
+JOIN brands b ON b.id = k.brand_id
+WHERE k.tenant_id = d.tenant_id
+  AND k.key = lower(regexp_replace(btrim(d.brand), '\s+', ' ', 'g'));
+
+ALTER TABLE devices ALTER COLUMN brand_id SET NOT NULL;
+
+CREATE INDEX idx_devices_brand_id ON devices (brand_id);
+
+-- Schemas saved under spellings of the same brand collapse to the most
+-- recently updated one.
+DELETE FROM brand_schemas s
+USING brand_schemas newer
+WHERE newer.tenant_id = s.tenant_id
+  AND lower(regexp_replace(btrim(newer.brand), '\s+', ' ', 'g')) = lower(regexp_replace(btrim(s.brand), '\s+', ' ', 'g'))
+  AND (newer.updated_at, newer.brand) > (s.updated_at, s.brand);
+
+UPDATE brand_schemas s
+SET brand = b.name
+FROM brand_keys k
+JOIN brands b ON b.id = k.brand_id
+WHERE k.tenant_id = s.tenant_id
+  AND k.key = lower(regexp_replace(btrim(s.brand), '\s+', ' ', 'g'));
+
+DROP TABLE existing_brands;
+
+ALTER TABLE devices FORCE ROW LEVEL SECURITY;
+ALTER TABLE brand_schemas FORCE ROW LEVEL SECURITY;
+
+ALTER TABLE brands ENABLE ROW LEVEL SECURITY;
+ALTER TABLE brands FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY brands_tenant_isolation ON brands
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE brand_keys ENABLE ROW LEVEL SECURITY;
+ALTER TABLE brand_keys FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY brand_keys_tenant_isolation ON brand_keys
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
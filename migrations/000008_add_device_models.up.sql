@@ -0,0 +1,25 @@
+CREATE TABLE device_models (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  tenant_id TEXT NOT NULL,
+  brand_id UUID NOT NULL REFERENCES brands (id),
+  name TEXT NOT NULL,
+  specs JSONB NOT NULL DEFAULT '{}' CHECK (jsonb_typeof(specs) = 'object'),
+  release_date DATE,
+  end_of_support DATE CHECK (end_of_support >= release_date),
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE UNIQUE INDEX device_models_name_idx ON device_models (tenant_id, brand_id, lower(name));
+CREATE INDEX idx_device_models_end_of_support ON device_models (tenant_id, end_of_support);
+
+ALTER TABLE device_models ENABLE ROW LEVEL SECURITY;
+ALTER TABLE device_models FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY device_models_tenant_isolation ON device_models
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+ALTER TABLE devices ADD COLUMN model_id UUID REFERENCES device_models (id);
+
+CREATE INDEX idx_devices_model_id ON devices (model_id);
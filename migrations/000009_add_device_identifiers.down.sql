@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS devices_asset_tag_idx;
+DROP INDEX IF EXISTS devices_serial_number_idx;
+ALTER TABLE devices DROP COLUMN IF EXISTS asset_tag;
+ALTER TABLE devices DROP COLUMN IF EXISTS serial_number;
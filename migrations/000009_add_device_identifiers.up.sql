@@ -0,0 +1,6 @@
+ALTER TABLE devices ADD COLUMN serial_number TEXT CHECK (serial_number <> '');
+ALTER TABLE devices ADD COLUMN asset_tag TEXT CHECK (asset_tag <> '');
+
+-- Devices without an identifier store NULL, which never conflicts.
+CREATE UNIQUE INDEX devices_serial_number_idx ON devices (tenant_id, brand_id, serial_number);
+CREATE UNIQUE INDEX devices_asset_tag_idx ON devices (tenant_id, brand_id, asset_tag);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS device_moves;
+DROP INDEX IF EXISTS idx_devices_location_id;
+ALTER TABLE devices DROP COLUMN IF EXISTS location_id;
+DROP TABLE IF EXISTS location_paths;
+DROP TABLE IF EXISTS locations;
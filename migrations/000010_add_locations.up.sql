@@ -0,0 +1,64 @@
+CREATE TABLE locations (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  tenant_id TEXT NOT NULL,
+  parent_id UUID REFERENCES locations (id),
+  kind TEXT NOT NULL CHECK (kind IN ('site', 'building', 'room', 'shelf')),
+  name TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  CHECK ((kind = 'site') = (parent_id IS NULL))
+);
+
+-- Sibling names are unique, ignoring case. Sites have no parent, so they
+-- are compared under the nil UUID.
+CREATE UNIQUE INDEX locations_name_idx ON locations (
+  tenant_id, COALESCE(parent_id, '00000000-0000-0000-0000-000000000000'), lower(name)
+);
+CREATE INDEX idx_locations_parent_id ON locations (parent_id);
+
+-- location_paths is the closure table of the tree: one row for every
+-- location and each of its ancestors, including itself at depth 0.
+CREATE TABLE location_paths (
+  tenant_id TEXT NOT NULL,
+  ancestor_id UUID NOT NULL REFERENCES locations (id) ON DELETE CASCADE,
+  descendant_id UUID NOT NULL REFERENCES locations (id) ON DELETE CASCADE,
+  depth INT NOT NULL,
+  PRIMARY KEY (ancestor_id, descendant_id)
+);
+
+CREATE INDEX idx_location_paths_descendant_id ON location_paths (descendant_id);
+
+ALTER TABLE devices ADD COLUMN location_id UUID REFERENCES locations (id);
+
+CREATE INDEX idx_devices_location_id ON devices (location_id);
+
+CREATE TABLE device_moves (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  tenant_id TEXT NOT NULL,
+  device_id UUID NOT NULL REFERENCES devices (id) ON DELETE CASCADE,
+  from_location_id UUID REFERENCES locations (id) ON DELETE SET NULL,
+  to_location_id UUID REFERENCES locations (id) ON DELETE SET NULL,
+  note TEXT NOT NULL DEFAULT '',
+  moved_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_device_moves_device_id ON device_moves (device_id, moved_at);
+
+ALTER TABLE locations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE locations FORCE ROW LEVEL SECURITY;
+ALTER TABLE location_paths ENABLE ROW LEVEL SECURITY;
+ALTER TABLE location_paths FORCE ROW LEVEL SECURITY;
+ALTER TABLE device_moves ENABLE ROW LEVEL SECURITY;
+ALTER TABLE device_moves FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY locations_tenant_isolation ON locations
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+CREATE POLICY location_paths_tenant_isolation ON location_paths
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+CREATE POLICY device_moves_tenant_isolation ON device_moves
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
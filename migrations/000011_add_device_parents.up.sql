@@ -0,0 +1,6 @@
+-- A device may be attached to a parent device, such as a dock or charger to
+-- the laptop it belongs to. Parents cannot be deleted while they have
+-- children, so the foreign key has no cascade.
+ALTER TABLE devices ADD COLUMN parent_id UUID REFERENCES devices (id) CHECK (parent_id <> id);
+
+CREATE INDEX idx_devices_parent_id ON devices (parent_id);
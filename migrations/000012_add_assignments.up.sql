@@ -0,0 +1,49 @@
+-- btree_gist lets the exclusion constraint below compare UUIDs with = in a
+-- GiST index, alongside the range overlap.
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+CREATE TABLE holders (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  tenant_id TEXT NOT NULL,
+  kind TEXT NOT NULL CHECK (kind IN ('person', 'team')),
+  name TEXT NOT NULL,
+  external_id TEXT CHECK (external_id <> ''),
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+-- External IDs come from the directory of each kind of holder, such as an
+-- employee number or a team slug, so they are unique per kind.
+CREATE UNIQUE INDEX holders_external_id_idx ON holders (tenant_id, kind, external_id);
+
+CREATE TABLE device_assignments (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  tenant_id TEXT NOT NULL,
+  device_id UUID NOT NULL REFERENCES devices (id) ON DELETE CASCADE,
+  holder_id UUID NOT NULL REFERENCES holders (id),
+  note TEXT NOT NULL DEFAULT '',
+  started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  ended_at TIMESTAMP WITH TIME ZONE CHECK (ended_at >= started_at),
+  -- The assignments of a device never overlap, so at most one of them is
+  -- active, with no end, at any time.
+  CONSTRAINT device_assignments_no_overlap EXCLUDE USING gist (
+    device_id WITH =,
+    tstzrange(started_at, ended_at, '[)') WITH &&
+  )
+);
+
+CREATE INDEX idx_device_assignments_device_id ON device_assignments (device_id, started_at);
+CREATE INDEX idx_device_assignments_holder_id ON device_assignments (holder_id) WHERE ended_at IS NULL;
+
+ALTER TABLE holders ENABLE ROW LEVEL SECURITY;
+ALTER TABLE holders FORCE ROW LEVEL SECURITY;
+ALTER TABLE device_assignments ENABLE ROW LEVEL SECURITY;
+ALTER TABLE device_assignments FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY holders_tenant_isolation ON holders
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+CREATE POLICY device_assignments_tenant_isolation ON device_assignments
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS due_reservation_tenants(TIMESTAMP WITH TIME ZONE);
+DROP TABLE IF EXISTS device_reservations;
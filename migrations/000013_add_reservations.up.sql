@@ -0,0 +1,55 @@
+CREATE TABLE device_reservations (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  tenant_id TEXT NOT NULL,
+  device_id UUID NOT NULL REFERENCES devices (id) ON DELETE CASCADE,
+  holder_id UUID REFERENCES holders (id),
+  note TEXT NOT NULL DEFAULT '',
+  starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  ends_at TIMESTAMP WITH TIME ZONE NOT NULL CHECK (ends_at > starts_at),
+  -- scheduled reservations have not started yet, active ones have started
+  -- and not ended, and completed ones have ended. applied is set when the
+  -- reservation put its device in use, so that its end makes it available.
+  status TEXT NOT NULL DEFAULT 'scheduled' CHECK (status IN ('scheduled', 'active', 'completed')),
+  applied BOOLEAN NOT NULL DEFAULT false,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  CONSTRAINT device_reservations_no_overlap EXCLUDE USING gist (
+    device_id WITH =,
+    tstzrange(starts_at, ends_at, '[)') WITH &&
+  )
+);
+
+CREATE INDEX idx_device_reservations_scheduled ON device_reservations (starts_at) WHERE status = 'scheduled';
+CREATE INDEX idx_device_reservations_active ON device_reservations (ends_at) WHERE status = 'active';
+
+ALTER TABLE device_reservations ENABLE ROW LEVEL SECURITY;
+ALTER TABLE device_reservations FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY device_reservations_tenant_isolation ON device_reservations
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+-- The reservation job runs for every tenant, but the policies only show
+-- the rows of the tenant of the transaction. This function only tells the
+-- job which tenants have reservations to start or end; each tenant is then
+-- processed under its own policies. It runs with the rights of its owner,
+-- devices_jobs, a role without login that bypasses row-level security, so
+-- that it does not depend on whether the role applying the migrations does.
+DO $$
+BEGIN
+  IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'devices_jobs') THEN
+    CREATE ROLE devices_jobs NOLOGIN NOSUPERUSER BYPASSRLS;
+  END IF;
+END
+$$;
+
+GRANT SELECT ON device_reservations TO devices_jobs;
+
+CREATE FUNCTION due_reservation_tenants(at TIMESTAMP WITH TIME ZONE) RETURNS SETOF TEXT
+LANGUAGE sql STABLE SECURITY DEFINER SET search_path = public AS $$
+  SELECT DISTINCT tenant_id FROM device_reservations
+  WHERE (status = 'scheduled' AND starts_at <= at) OR (status = 'active' AND ends_at <= at)
+$$;
+
+ALTER FUNCTION due_reservation_tenants(TIMESTAMP WITH TIME ZONE) OWNER TO devices_jobs;
+REVOKE EXECUTE ON FUNCTION due_reservation_tenants(TIMESTAMP WITH TIME ZONE) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION due_reservation_tenants(TIMESTAMP WITH TIME ZONE) TO devices_app;
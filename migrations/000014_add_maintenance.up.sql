@@ -0,0 +1,27 @@
+CREATE TABLE maintenance_records (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  tenant_id TEXT NOT NULL,
+  device_id UUID NOT NULL REFERENCES devices (id) ON DELETE CASCADE,
+  diagnosis TEXT NOT NULL DEFAULT '',
+  resolution TEXT NOT NULL DEFAULT '',
+  -- The cost of the repair in the smallest unit of the currency, such as
+  -- cents, or NULL when unknown.
+  cost_cents BIGINT CHECK (cost_cents >= 0),
+  -- The state the device had when the record was opened, which closing it
+  -- restores.
+  previous_state TEXT NOT NULL CHECK (previous_state IN ('available', 'in-use', 'inactive')),
+  opened_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  closed_at TIMESTAMP WITH TIME ZONE CHECK (closed_at >= opened_at)
+);
+
+-- A device has at most one open maintenance record.
+CREATE UNIQUE INDEX maintenance_records_open_idx ON maintenance_records (device_id) WHERE closed_at IS NULL;
+CREATE INDEX idx_maintenance_records_device_id ON maintenance_records (device_id, opened_at);
+CREATE INDEX idx_maintenance_records_closed_at ON maintenance_records (tenant_id, closed_at);
+
+ALTER TABLE maintenance_records ENABLE ROW LEVEL SECURITY;
+ALTER TABLE maintenance_records FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY maintenance_records_tenant_isolation ON maintenance_records
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS claim_scheduled_actions(TIMESTAMP WITH TIME ZONE, INTERVAL, INTEGER);
+DROP TABLE IF EXISTS scheduled_actions;
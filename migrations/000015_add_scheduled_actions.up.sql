@@ -0,0 +1,59 @@
+CREATE TABLE scheduled_actions (
+  id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  tenant_id TEXT NOT NULL,
+  device_id UUID NOT NULL REFERENCES devices (id) ON DELETE CASCADE,
+  -- set_state changes the state of the device to state, and delete deletes
+  -- the device.
+  action TEXT NOT NULL CHECK (action IN ('set_state', 'delete')),
+  state TEXT CHECK (state IN ('available', 'in-use', 'inactive')),
+  run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  -- pending actions are run at run_at, which moves forward on every retry.
+  -- done and failed ones have run for the last time.
+  status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'done', 'failed', 'cancelled')),
+  attempts INTEGER NOT NULL DEFAULT 0,
+  max_attempts INTEGER NOT NULL DEFAULT 5 CHECK (max_attempts > 0),
+  last_error TEXT NOT NULL DEFAULT '',
+  -- A replica that claims an action leases it until locked_until. An action
+  -- whose lease has expired, because its replica stopped, is claimed again.
+  locked_until TIMESTAMP WITH TIME ZONE,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  completed_at TIMESTAMP WITH TIME ZONE,
+  CHECK ((action = 'set_state') = (state IS NOT NULL))
+);
+
+CREATE INDEX idx_scheduled_actions_due ON scheduled_actions (run_at) WHERE status = 'pending';
+CREATE INDEX idx_scheduled_actions_device_id ON scheduled_actions (device_id, run_at);
+
+ALTER TABLE scheduled_actions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE scheduled_actions FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY scheduled_actions_tenant_isolation ON scheduled_actions
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
+
+-- Like due_reservation_tenants, this function runs with the rights of
+-- devices_jobs, which bypasses row-level security, so that the scheduler can
+-- claim the due actions of every tenant. Each action is then run under the
+-- policies of its tenant. SKIP LOCKED lets several replicas claim at once
+-- without waiting on, or claiming, the same rows.
+GRANT SELECT, UPDATE ON scheduled_actions TO devices_jobs;
+
+CREATE FUNCTION claim_scheduled_actions(at TIMESTAMP WITH TIME ZONE, lease INTERVAL, max_count INTEGER)
+RETURNS SETOF scheduled_actions
+LANGUAGE sql VOLATILE SECURITY DEFINER SET search_path = public AS $$
+  UPDATE scheduled_actions
+  SET locked_until = at + lease, attempts = attempts + 1
+  WHERE id IN (
+    SELECT id FROM scheduled_actions
+    WHERE status = 'pending' AND run_at <= at AND (locked_until IS NULL OR locked_until <= at)
+    ORDER BY run_at
+    LIMIT max_count
+    FOR UPDATE SKIP LOCKED
+  )
+  RETURNING *
+$$;
+
+ALTER FUNCTION claim_scheduled_actions(TIMESTAMP WITH TIME ZONE, INTERVAL, INTEGER) OWNER TO devices_jobs;
+REVOKE EXECUTE ON FUNCTION claim_scheduled_actions(TIMESTAMP WITH TIME ZONE, INTERVAL, INTEGER) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION claim_scheduled_actions(TIMESTAMP WITH TIME ZONE, INTERVAL, INTEGER) TO devices_app;
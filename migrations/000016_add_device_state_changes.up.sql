@@ -0,0 +1,32 @@
+-- Every change of state of a device, from which the time spent in each state
+-- is derived. A device is in a state from changed_at until its next change.
+CREATE TABLE device_state_changes (
+  -- Orders the changes of a device made at the same time.
+  id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  tenant_id TEXT NOT NULL,
+  device_id UUID NOT NULL REFERENCES devices (id) ON DELETE CASCADE,
+  state TEXT NOT NULL CHECK (state IN ('available', 'in-use', 'inactive')),
+  changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_device_state_changes_device_id ON device_state_changes (device_id, changed_at, id);
+CREATE INDEX idx_device_state_changes_changed_at ON device_state_changes (tenant_id, changed_at);
+
+-- The data migration below runs as the table owner, which only bypasses
+-- row-level security while it is not forced.
+ALTER TABLE devices NO FORCE ROW LEVEL SECURITY;
+
+-- The history of existing devices is unknown, so it starts now with their
+-- current state.
+INSERT INTO device_state_changes (tenant_id, device_id, state, changed_at)
+SELECT tenant_id, id, state, now()
+FROM devices;
+
+ALTER TABLE devices FORCE ROW LEVEL SECURITY;
+
+ALTER TABLE device_state_changes ENABLE ROW LEVEL SECURITY;
+ALTER TABLE device_state_changes FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY device_state_changes_tenant_isolation ON device_state_changes
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,50 @@
+-- Every version of every device row, for reading the inventory as it was at
+-- a past time. A version is current from valid_from until valid_to, or until
+-- now while valid_to is NULL; the current version of a deleted device is
+-- closed when it is deleted. The times are those of the transactions that
+-- wrote the versions. Versions outlive their device, so id, the ID of the
+-- device, does not reference devices. The other columns are those of devices.
+CREATE TABLE device_versions (
+  version BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+  tenant_id TEXT NOT NULL,
+  id UUID NOT NULL,
+  name TEXT NOT NULL,
+  brand TEXT NOT NULL,
+  brand_id UUID NOT NULL,
+  model_id UUID,
+  location_id UUID,
+  parent_id UUID,
+  serial_number TEXT,
+  asset_tag TEXT,
+  state TEXT NOT NULL,
+  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+  labels JSONB NOT NULL,
+  attributes JSONB NOT NULL,
+  valid_from TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+  valid_to TIMESTAMP WITH TIME ZONE CHECK (valid_to >= valid_from)
+);
+
+-- A device has at most one current version.
+CREATE UNIQUE INDEX device_versions_current_idx ON device_versions (id) WHERE valid_to IS NULL;
+CREATE INDEX idx_device_versions_id ON device_versions (id, valid_from);
+CREATE INDEX idx_device_versions_valid_from ON device_versions (tenant_id, valid_from);
+
+-- The data migration below runs as the table owner, which only bypasses
+-- row-level security while it is not forced.
+ALTER TABLE devices NO FORCE ROW LEVEL SECURITY;
+
+-- The history of existing devices is unknown, but each has been as it is
+-- since it was last updated.
+INSERT INTO device_versions (tenant_id, id, name, brand, brand_id, model_id, location_id, parent_id, serial_number, asset_tag, state, created_at, updated_at, labels, attributes, valid_from)
+SELECT tenant_id, id, name, brand, brand_id, model_id, location_id, parent_id, serial_number, asset_tag, state, created_at, updated_at, labels, attributes, updated_at
+FROM devices;
+
+ALTER TABLE devices FORCE ROW LEVEL SECURITY;
+
+ALTER TABLE device_versions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE device_versions FORCE ROW LEVEL SECURITY;
+
+CREATE POLICY device_versions_tenant_isolation ON device_versions
+  USING (tenant_id = current_setting('app.tenant_id', true))
+  WITH CHECK (tenant_id = current_setting('app.tenant_id', true));
@@ -0,0 +1,2 @@
+DROP FUNCTION IF EXISTS purge_idempotency_keys(TIMESTAMP WITH TIME ZONE);
+REVOKE ALL ON idempotency_keys FROM devices_jobs;
@@ -0,0 +1,13 @@
+-- Expired idempotency keys are deleted for every tenant by a periodic job.
+-- Like due_reservation_tenants, this function runs with the rights of
+-- devices_jobs, which bypasses row-level security.
+GRANT SELECT, DELETE ON idempotency_keys TO devices_jobs;
+
+CREATE FUNCTION purge_idempotency_keys(at TIMESTAMP WITH TIME ZONE) RETURNS VOID
+LANGUAGE sql VOLATILE SECURITY DEFINER SET search_path = public AS $$
+  DELETE FROM idempotency_keys WHERE expires_at < at
+$$;
+
+ALTER FUNCTION purge_idempotency_keys(TIMESTAMP WITH TIME ZONE) OWNER TO devices_jobs;
+REVOKE EXECUTE ON FUNCTION purge_idempotency_keys(TIMESTAMP WITH TIME ZONE) FROM PUBLIC;
+GRANT EXECUTE ON FUNCTION purge_idempotency_keys(TIMESTAMP WITH TIME ZONE) TO devices_app;